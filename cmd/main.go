@@ -39,7 +39,7 @@ func main() {
 
 	<-stop
 
-	application.GRPCServer.Stop()
+	application.Stop()
 	log.Info("Gracefully stopped")
 
 }
@@ -2,19 +2,44 @@ package app
 
 import (
 	"auth/internal/app/grpc"
+	"auth/internal/audit"
+	"auth/internal/clients"
 	"auth/internal/config"
+	"auth/internal/email"
+	"auth/internal/events"
+	"auth/internal/password"
+	"auth/internal/provider/breaker"
+	"auth/internal/provider/s2s"
 	"auth/internal/provider/users"
+	"auth/internal/rbac"
 	redis2 "auth/internal/redis"
+	"auth/internal/risk"
 	"auth/internal/sender"
 	"auth/internal/servises/auth"
+	"auth/internal/sessions"
+	"auth/internal/signin"
 	"auth/internal/token"
+	"auth/internal/webhook"
 	"auth/pkg/client/redis"
 	"context"
+	"fmt"
+	"io"
 	"log/slog"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
+// usersHealthService - имя сервиса в grpc.health.v1, отражающее состояние users service
+const usersHealthService = "users"
+
 type App struct {
 	GRPCServer *grpc.App
+	health     *health.Server
+	log        *slog.Logger
+	cancel     context.CancelFunc
+	// Закрываются в обратном порядке при Stop
+	closers []io.Closer
 }
 
 func New(ctx context.Context, cfg config.Config, log *slog.Logger) *App {
@@ -25,20 +50,463 @@ func New(ctx context.Context, cfg config.Config, log *slog.Logger) *App {
 	}
 	repositoryRedis := redis2.NewRepositoryRedis(client, cfg.Token.RefreshTTL)
 
-	provider := users.NewUsersProvider(cfg.Provider.Protocol, cfg.Provider.Host, cfg.Provider.Port, *log)
-	manager := token.NewJWTManager(cfg.Token.RefreshSecret, cfg.Token.AccessSecret, cfg.Token.AccessTTL, cfg.Token.RefreshTTL)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(usersHealthService, healthpb.HealthCheckResponse_SERVING)
+
+	var closers []io.Closer
+
+	usersProvider, err := newUsersProvider(cfg.Provider, log)
+	if err != nil {
+		log.Error("failed to create users provider", slog.String("error", err.Error()))
+		return nil
+	}
+	if c, ok := usersProvider.(io.Closer); ok {
+		closers = append(closers, c)
+	}
+
+	var provider *users.ResilientProvider
+	provider = users.NewResilientProvider(
+		usersProvider,
+		users.ResilienceConfig{
+			Retry: users.RetryConfig{
+				MaxAttempts: cfg.Provider.Retry.MaxAttempts,
+				BaseDelay:   cfg.Provider.Retry.BaseDelay,
+				MaxDelay:    cfg.Provider.Retry.MaxDelay,
+			},
+			Breaker: breaker.Config{
+				FailureThreshold: cfg.Provider.Breaker.FailureThreshold,
+				OpenTimeout:      cfg.Provider.Breaker.OpenTimeout,
+				HalfOpenMaxCalls: cfg.Provider.Breaker.HalfOpenMaxCalls,
+			},
+			MaxConcurrent: cfg.Provider.MaxConcurrent,
+		},
+		*log,
+		func(string, breaker.State, breaker.State) {
+			// users service считается недоступным, пока открыт хотя бы один breaker
+			status := healthpb.HealthCheckResponse_SERVING
+			for _, state := range provider.States() {
+				if state == breaker.Open {
+					status = healthpb.HealthCheckResponse_NOT_SERVING
+				}
+			}
+			healthServer.SetServingStatus(usersHealthService, status)
+		},
+	)
+
+	var usersSource users.Provider = provider
+	var cache *users.CachingProvider
+	if cfg.Provider.Cache.Enabled {
+		var remote users.RemoteCache
+		if cfg.Provider.Cache.Redis {
+			remote = users.NewRedisUserCache(client)
+		}
+		cache = users.NewCachingProvider(provider, users.CacheConfig{
+			Size:        cfg.Provider.Cache.Size,
+			TTL:         cfg.Provider.Cache.TTL,
+			NegativeTTL: cfg.Provider.Cache.NegativeTTL,
+			RemoteTTL:   cfg.Provider.Cache.RedisTTL,
+		}, remote, *log)
+		usersSource = cache
+	}
+
+	registry := clientRegistry(cfg.Clients, client)
+	tokenOpts := []token.Option{
+		token.WithIssuer(cfg.Token.Issuer),
+		token.WithAudience(cfg.Token.Audience...),
+		token.WithLeeway(cfg.Token.Leeway),
+		token.WithLegacyTokens(cfg.Sessions.LegacyIDs),
+	}
+	if registry != nil {
+		tokenOpts = append(tokenOpts, token.WithClientAudiences(func(clientID string) ([]string, error) {
+			c, err := registry.Client(ctx, clientID)
+			if err != nil {
+				return nil, err
+			}
+			return c.Audiences, nil
+		}))
+	}
+	manager := token.NewJWTManager(cfg.Token.AccessSecret, cfg.Token.RefreshSecret, cfg.Token.AccessTTL, cfg.Token.RefreshTTL,
+		tokenOpts...)
+
+	channels, err := newChannels(cfg, log)
+	if err != nil {
+		log.Error("failed to create notification channels", slog.String("error", err.Error()))
+		return nil
+	}
+	router := sender.NewRouter(channels...)
+	closers = append(closers, router)
+
+	var notifier sender.EmailSender = router
+
+	var emailQueue *sender.Queue
+	if cfg.EmailQueue.Enabled {
+		emailQueue = sender.NewQueue(client, router, sender.QueueConfig{
+			Workers:        cfg.EmailQueue.Workers,
+			MaxAttempts:    cfg.EmailQueue.MaxAttempts,
+			BaseBackoff:    cfg.EmailQueue.BaseBackoff,
+			MaxBackoff:     cfg.EmailQueue.MaxBackoff,
+			ClaimIdle:      cfg.EmailQueue.ClaimIdle,
+			IdempotencyTTL: cfg.EmailQueue.IdempotencyTTL,
+			DeadLetterMax:  cfg.EmailQueue.DeadLetterMax,
+			CodeTTL:        cfg.EmailQueue.CodeTTL,
+			Consumer:       cfg.EmailQueue.Consumer,
+		}, log)
+		notifier = emailQueue
+	}
+
+	auditSink, err := audit.New(audit.Config{
+		Sink:       cfg.Audit.Sink,
+		Path:       cfg.Audit.Path,
+		MaxSizeMB:  cfg.Audit.MaxSizeMB,
+		MaxBackups: cfg.Audit.MaxBackups,
+	})
+	if err != nil {
+		log.Error("failed to create audit sink", slog.String("error", err.Error()))
+		return nil
+	}
+	closers = append(closers, auditSink)
+
+	broker, err := events.NewBroker(events.Config{
+		Broker:        cfg.Events.Broker,
+		NATSURL:       cfg.Events.NATSURL,
+		SubjectPrefix: cfg.Events.SubjectPrefix,
+		NATSStream:    cfg.Events.NATSStream,
+	})
+	if err != nil {
+		log.Error("failed to create events broker", slog.String("error", err.Error()))
+		return nil
+	}
+
+	if cache != nil && len(cfg.Provider.Cache.InvalidateOn) > 0 {
+		sub, ok := broker.(events.Subscriber)
+		if !ok {
+			// Без брокера с подпиской изменения ролей и прав видны только через ttl кеша
+			log.Warn("users cache invalidation is disabled: events broker does not support subscriptions",
+				slog.String("broker", cfg.Events.Broker),
+				slog.Any("invalidate_on", cfg.Provider.Cache.InvalidateOn),
+				slog.Duration("ttl", cfg.Provider.Cache.TTL))
+		} else {
+			types := make([]events.Type, 0, len(cfg.Provider.Cache.InvalidateOn))
+			for _, t := range cfg.Provider.Cache.InvalidateOn {
+				types = append(types, events.Type(t))
+			}
+			if _, err := cache.InvalidateOn(sub, types...); err != nil {
+				log.Error("failed to subscribe users cache to invalidation events", slog.String("error", err.Error()))
+				return nil
+			}
+		}
+	}
+
+	closers = append(closers, broker)
+
+	relays := []*events.Relay{events.NewRelay(client, broker, events.RelayConfig{
+		Group:     cfg.Events.Group,
+		Consumer:  cfg.Events.Consumer,
+		BatchSize: cfg.Events.BatchSize,
+		ClaimIdle: cfg.Events.ClaimIdle,
+	}, log)}
+
+	// У каждого подписчика webhook своя consumer group: медленный получатель
+	// задерживает только свои события, а повтор брокера не шлет webhook заново
+	deadLetters := webhook.NewRedisDeadLetterStore(client, cfg.Webhooks.DeadLetterMax)
+	for _, sub := range webhookConfig(cfg.Webhooks).Subscriptions {
+		whCfg := webhookConfig(cfg.Webhooks)
+		whCfg.Subscriptions = []webhook.Subscription{sub}
+		dispatcher := webhook.NewDispatcher(whCfg, deadLetters, log)
+		closers = append(closers, dispatcher)
+
+		relays = append(relays, events.NewRelay(client, dispatcher, events.RelayConfig{
+			Group:     cfg.Webhooks.Group + ":" + sub.Name,
+			Consumer:  cfg.Events.Consumer,
+			BatchSize: cfg.Events.BatchSize,
+			ClaimIdle: cfg.Events.ClaimIdle,
+		}, log))
+	}
+
+	emailPolicy, err := email.NewPolicy(email.PolicyConfig{
+		Mode:            email.Mode(cfg.EmailPolicy.Mode),
+		Allow:           cfg.EmailPolicy.Allow,
+		Block:           cfg.EmailPolicy.Block,
+		AllowFile:       cfg.EmailPolicy.AllowFile,
+		BlockFile:       cfg.EmailPolicy.BlockFile,
+		BlockDisposable: cfg.EmailPolicy.BlockDisposable,
+		DisposableFile:  cfg.EmailPolicy.DisposableFile,
+		CheckMX:         cfg.EmailPolicy.CheckMX,
+		MXTimeout:       cfg.EmailPolicy.MXTimeout,
+		ReloadInterval:  cfg.EmailPolicy.ReloadInterval,
+	}, nil, log)
+	if err != nil {
+		log.Error("failed to create email policy", slog.String("error", err.Error()))
+		return nil
+	}
+
+	passwordConfig := password.Config{
+		MinLength:     cfg.Password.MinLength,
+		MaxLength:     cfg.Password.MaxLength,
+		RequireUpper:  cfg.Password.RequireUpper,
+		RequireLower:  cfg.Password.RequireLower,
+		RequireDigit:  cfg.Password.RequireDigit,
+		RequireSymbol: cfg.Password.RequireSymbol,
+		MinEntropy:    cfg.Password.MinEntropy,
+	}
+	if cfg.Password.BreachedFile != "" {
+		breached, err := password.OpenPrefixFile(cfg.Password.BreachedFile)
+		if err != nil {
+			log.Error("failed to open breached password file", slog.String("error", err.Error()))
+			return nil
+		}
+		closers = append(closers, breached)
+		passwordConfig.Breached = breached
+	}
+
+	roles, err := rbac.NewRoles(cfg.Permissions.Roles)
+	if err != nil {
+		log.Error("failed to load role permissions", slog.String("error", err.Error()))
+		return nil
+	}
 
-	smtp, err := sender.NewEmailSender(cfg.SMTPConfig)
+	alerts, err := signInAlerts(cfg.SignIn)
 	if err != nil {
+		log.Error("failed to load sign-in alerts", slog.String("error", err.Error()))
 		return nil
 	}
 
-	server := auth.NewServer(provider, manager, repositoryRedis, smtp, *log)
+	ctx, cancel := context.WithCancel(ctx)
+	go emailPolicy.Watch(ctx)
+	for _, relay := range relays {
+		go func() {
+			if err := relay.Run(ctx); err != nil {
+				log.Error("outbox relay stopped", slog.String("error", err.Error()))
+			}
+		}()
+	}
+
+	for _, channel := range channels {
+		if dev, ok := channel.(*sender.DevSink); ok {
+			go func() {
+				if err := dev.Serve(ctx, cfg.Notify.DevAddr); err != nil {
+					log.Error("dev inbox stopped", slog.String("error", err.Error()))
+				}
+			}()
+		}
+	}
+
+	if emailQueue != nil {
+		go func() {
+			if err := emailQueue.Run(ctx); err != nil {
+				log.Error("email queue stopped", slog.String("error", err.Error()))
+			}
+		}()
+	}
+
+	server := auth.NewServer(usersSource, manager, repositoryRedis, notifier, *log,
+		auth.WithAudit(auditSink),
+		auth.WithDomainPolicy(emailPolicy),
+		auth.WithEmailCanonicalizer(email.NewCanonicalizer(email.CanonicalConfig{
+			FoldGmail:      cfg.EmailPolicy.FoldGmail,
+			FoldSubaddress: cfg.EmailPolicy.FoldSubaddress,
+		})),
+		auth.WithPasswordPolicy(password.NewPolicy(passwordConfig)),
+		auth.WithRoles(roles),
+		auth.WithLegacySessions(cfg.Sessions.LegacyIDs),
+		auth.WithRefreshMode(cfg.Token.RefreshMode),
+		auth.WithSessionPolicy(sessionPolicy(cfg.Sessions)),
+		auth.WithSignInAlerts(alerts),
+		auth.WithClients(registry, cfg.Clients.Default),
+	)
+
+	// Страница "это был не я" нужна только для ссылок из писем
+	if alerts != nil && cfg.SignIn.RevokeURL != "" && cfg.SignIn.HTTPAddr != "" {
+		go func() {
+			if err := signin.Serve(ctx, cfg.SignIn.HTTPAddr, signin.Handler(server.(signin.Revoker), log)); err != nil {
+				log.Error("sign-in alerts http server stopped", slog.String("error", err.Error()))
+			}
+		}()
+	}
 
 	app := grpc.New(log, server, cfg.GRPCConfig.Port)
+	app.RegisterHealth(healthServer)
 
 	return &App{
 		GRPCServer: app,
+		health:     healthServer,
+		log:        log,
+		cancel:     cancel,
+		closers:    closers,
+	}
+
+}
+
+// Stop останавливает gRPC сервер и закрывает ресурсы
+func (a *App) Stop() {
+	a.health.Shutdown()
+	a.GRPCServer.Stop()
+	a.cancel()
+
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		if err := a.closers[i].Close(); err != nil {
+			a.log.Error("failed to close resource",
+				slog.String("resource", fmt.Sprintf("%T", a.closers[i])),
+				slog.String("error", err.Error()))
+		}
+	}
+}
+
+// newUsersProvider - транспорт до users service по ProviderConfig.Type
+func newUsersProvider(cfg config.ProviderConfig, log *slog.Logger) (users.Provider, error) {
+	var tokens s2s.TokenSource
+	if cfg.Auth.Mode == "jwt" {
+		tokens = token.NewServiceTokens(cfg.Auth.Secret, cfg.Auth.Issuer, cfg.Auth.TTL)
+	}
+	signer, err := s2s.New(s2s.Config{
+		Mode:     cfg.Auth.Mode,
+		Token:    cfg.Auth.Token,
+		KeyID:    cfg.Auth.KeyID,
+		Secret:   cfg.Auth.Secret,
+		Audience: cfg.Auth.Audience,
+	}, tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Type {
+	case "grpc":
+		return users.NewGRPCProvider(cfg.Host, cfg.Port, cfg.TLS, cfg.Timeout, signer, *log)
+	case "http", "port", "":
+		// "port" - прежнее значение по умолчанию, означало HTTP
+		return users.NewUsersProvider(cfg.Protocol, cfg.Host, cfg.Port, cfg.Timeout, signer, *log), nil
+	default:
+		return nil, fmt.Errorf("unknown provider type: %s", cfg.Type)
+	}
+}
+
+// newChannels - каналы доставки кодов в порядке из NotifyConfig.Channels
+func newChannels(cfg config.Config, log *slog.Logger) ([]sender.Channel, error) {
+	channels := make([]sender.Channel, 0, len(cfg.Notify.Channels))
+	for _, name := range cfg.Notify.Channels {
+		var (
+			channel sender.Channel
+			err     error
+		)
+		switch name {
+		case "email":
+			channel, err = sender.NewEmailChannel(cfg.SMTPConfig)
+		case "sms":
+			if cfg.Notify.SMS.URL == "" {
+				return nil, fmt.Errorf("sms channel requires notify.sms.url")
+			}
+			provider := sender.NewHTTPSMSProvider(cfg.Notify.SMS.URL, cfg.Notify.SMS.Token, cfg.Notify.SMS.Timeout)
+			channel, err = sender.NewSMSChannel(cfg.SMTPConfig, provider)
+		case "dev":
+			channel, err = sender.NewDevSink(cfg.SMTPConfig, cfg.Notify.DevDir, log)
+		default:
+			return nil, fmt.Errorf("unknown notification channel: %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, channel)
 	}
 
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("no notification channels configured")
+	}
+	return channels, nil
+}
+
+func webhookConfig(cfg config.WebhooksConfig) webhook.Config {
+	subscriptions := make([]webhook.Subscription, 0, len(cfg.Subscriptions))
+	for _, sub := range cfg.Subscriptions {
+		types := make([]events.Type, 0, len(sub.Events))
+		for _, e := range sub.Events {
+			types = append(types, events.Type(e))
+		}
+		subscriptions = append(subscriptions, webhook.Subscription{
+			Name:   sub.Name,
+			URL:    sub.URL,
+			Secret: sub.Secret,
+			Events: types,
+		})
+	}
+
+	return webhook.Config{
+		Subscriptions: subscriptions,
+		MaxAttempts:   cfg.MaxAttempts,
+		BaseBackoff:   cfg.BaseBackoff,
+		MaxBackoff:    cfg.MaxBackoff,
+		Timeout:       cfg.Timeout,
+	}
+}
+
+// sessionPolicy - сроки сессий из конфига
+func sessionPolicy(cfg config.SessionsConfig) *sessions.Policy {
+	limits := func(overrides map[string]config.SessionLimitsConfig) map[string]sessions.Limits {
+		out := make(map[string]sessions.Limits, len(overrides))
+		for name, o := range overrides {
+			out[name] = sessions.Limits{MaxAge: o.MaxAge, IdleTimeout: o.IdleTimeout, MaxSessions: o.MaxSessions}
+		}
+		return out
+	}
+
+	return &sessions.Policy{
+		Default: sessions.Limits{MaxAge: cfg.MaxAge, IdleTimeout: cfg.IdleTimeout, MaxSessions: cfg.MaxPerUser},
+		Roles:   limits(cfg.Roles),
+		Clients: limits(cfg.Clients),
+		OnLimit: cfg.OnLimit,
+	}
+}
+
+// signInAlerts - nil, если история входов выключена
+func signInAlerts(cfg config.SignInConfig) (*auth.SignInAlerts, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	alerts := &auth.SignInAlerts{
+		RevokeURL: cfg.RevokeURL,
+		RevokeTTL: cfg.RevokeTTL,
+		Risk: &risk.Detector{
+			MaxSpeed:   cfg.Risk.MaxSpeed,
+			MinHistory: cfg.Risk.MinHistory,
+			HourWindow: cfg.Risk.HourWindow,
+		},
+	}
+	if cfg.GeoIPPath != "" {
+		geo, err := risk.LoadGeoIP(cfg.GeoIPPath)
+		if err != nil {
+			return nil, err
+		}
+		alerts.GeoIP = geo
+	}
+	return alerts, nil
+}
+
+// clientRegistry - nil, если клиенты не настроены ни в конфиге, ни в Redis
+func clientRegistry(cfg config.ClientsConfig, client clients.RedisClient) clients.Registry {
+	if len(cfg.Registry) == 0 && !cfg.Redis {
+		return nil
+	}
+
+	static := make([]*clients.Client, 0, len(cfg.Registry))
+	for id, c := range cfg.Registry {
+		secretHash := c.SecretHash
+		if c.Secret != "" {
+			secretHash = clients.HashSecret(c.Secret)
+		}
+		static = append(static, &clients.Client{
+			ID:           id,
+			SecretHash:   secretHash,
+			GrantTypes:   c.GrantTypes,
+			AccessTTL:    c.AccessTTL,
+			RefreshTTL:   c.RefreshTTL,
+			Audiences:    c.Audiences,
+			RedirectURIs: c.RedirectURIs,
+		})
+	}
+
+	registry := clients.Chain{clients.NewStatic(static...)}
+	if cfg.Redis {
+		registry = append(registry, clients.NewRedis(client))
+	}
+	return registry
 }
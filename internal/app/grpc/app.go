@@ -4,6 +4,8 @@ import (
 	grpcAuth "auth/internal/grpc/auth"
 	"fmt"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"log/slog"
 	"net"
 )
@@ -21,6 +23,11 @@ func New(log *slog.Logger, server grpcAuth.Auth, port int) *App {
 	return &App{log: log, grpc: grpcServer, port: port}
 }
 
+// RegisterHealth регистрирует сервис grpc.health.v1. Вызывать до Run.
+func (a *App) RegisterHealth(h *health.Server) {
+	healthpb.RegisterHealthServer(a.grpc, h)
+}
+
 func (a *App) Run() error {
 	const op = "grpcapp.Run"
 
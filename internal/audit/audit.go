@@ -0,0 +1,133 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType - тип события безопасности
+type EventType string
+
+const (
+	EventLogin          EventType = "login"
+	EventRegister       EventType = "register"
+	EventVerifyEmail    EventType = "verify_email"
+	EventRefresh        EventType = "refresh"
+	EventRefreshReuse   EventType = "refresh_reuse"
+	EventLogout         EventType = "logout"
+	EventLogoutAll      EventType = "logout_all"
+	EventSessionEvicted EventType = "session_evicted"
+	EventLoginRisk      EventType = "login_risk"
+	// EventLockout - вход отклонен лимитом сессий (sessions.on_limit: reject):
+	// пользователь не войдет с нового устройства, пока не завершит одну из сессий
+	EventLockout EventType = "lockout"
+)
+
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+)
+
+// Record - одна запись аудита. Секреты (пароли, токены, коды) сюда не попадают,
+// email хранится только в виде хеша.
+type Record struct {
+	Time      time.Time `json:"time"`
+	Event     EventType `json:"event"`
+	Outcome   Outcome   `json:"outcome"`
+	UserID    string    `json:"user_id,omitempty"`
+	EmailHash string    `json:"email_hash,omitempty"`
+	DeviceID  string    `json:"device_id,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+type Sink interface {
+	Write(ctx context.Context, record Record) error
+	Close() error
+}
+
+var ErrUnknownSink = errors.New("unknown audit sink")
+
+type Config struct {
+	Sink       string
+	Path       string
+	MaxSizeMB  int
+	MaxBackups int
+}
+
+func New(cfg Config) (Sink, error) {
+	switch cfg.Sink {
+	case "", "stdout":
+		return NewStdoutSink(), nil
+	case "file":
+		return NewFileSink(cfg.Path, int64(cfg.MaxSizeMB)*1024*1024, cfg.MaxBackups)
+	case "none":
+		return NopSink{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSink, cfg.Sink)
+	}
+}
+
+// HashEmail - нормализует email и возвращает его sha256 в hex
+func HashEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(email))
+	return hex.EncodeToString(sum[:])
+}
+
+type NopSink struct{}
+
+func (NopSink) Write(context.Context, Record) error { return nil }
+func (NopSink) Close() error                        { return nil }
+
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewStdoutSink() Sink {
+	return &writerSink{w: os.Stdout}
+}
+
+func (s *writerSink) Write(_ context.Context, record Record) error {
+	line, err := marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(line)
+	return err
+}
+
+func (s *writerSink) Close() error {
+	return nil
+}
+
+func marshal(record Record) ([]byte, error) {
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("marshal audit record: %w", err)
+	}
+	return append(line, '\n'), nil
+}
@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const rotateTimeFormat = "20060102T150405.000000000"
+
+// fileSink - пишет записи в JSON Lines файл, открытый только на дозапись.
+// При превышении maxSize файл переименовывается в <path>.<timestamp>.
+// maxBackups <= 0 - копии не удаляются никогда (по умолчанию: журнал аудита
+// не должен теряться без явной настройки), иначе старые копии сверх maxBackups удаляются.
+type fileSink struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func NewFileSink(path string, maxSize int64, maxBackups int) (Sink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("audit file path is empty")
+	}
+
+	s := &fileSink{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) Write(_ context.Context, record Record) error {
+	line, err := marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return fmt.Errorf("audit file is closed")
+	}
+
+	// Ошибка ротации возвращается, но запись не теряется, если файл удалось открыть
+	var rotateErr error
+	if s.maxSize > 0 && s.size+int64(len(line)) > s.maxSize && s.size > 0 {
+		rotateErr = s.rotate()
+		if s.file == nil {
+			return rotateErr
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return errors.Join(fmt.Errorf("write audit record: %w", err), rotateErr)
+	}
+	return rotateErr
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *fileSink) open() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o750); err != nil {
+		return fmt.Errorf("create audit dir: %w", err)
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open audit file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("stat audit file: %w", err)
+	}
+
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+// rotate - при любой ошибке пишем дальше в файл по исходному пути:
+// сбой ротации не должен останавливать запись аудита
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		s.file = nil
+		return errors.Join(fmt.Errorf("close audit file: %w", err), s.open())
+	}
+	s.file = nil
+
+	rotated := fmt.Sprintf("%s.%s", s.path, time.Now().UTC().Format(rotateTimeFormat))
+	if err := os.Rename(s.path, rotated); err != nil {
+		return errors.Join(fmt.Errorf("rotate audit file: %w", err), s.open())
+	}
+
+	if err := s.open(); err != nil {
+		// Новый файл не создать - возвращаем прежний на место
+		if rerr := os.Rename(rotated, s.path); rerr != nil {
+			return errors.Join(err, fmt.Errorf("restore audit file: %w", rerr))
+		}
+		return errors.Join(err, s.open())
+	}
+
+	return s.prune()
+}
+
+func (s *fileSink) prune() error {
+	if s.maxBackups <= 0 {
+		return nil
+	}
+
+	backups, err := filepath.Glob(s.path + ".*")
+	if err != nil {
+		return err
+	}
+	// Имена содержат timestamp, поэтому лексикографический порядок = хронологический
+	sort.Strings(backups)
+
+	for _, old := range backups[:max(0, len(backups)-s.maxBackups)] {
+		if err := os.Remove(old); err != nil {
+			return fmt.Errorf("remove old audit file: %w", err)
+		}
+	}
+	return nil
+}
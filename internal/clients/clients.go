@@ -0,0 +1,122 @@
+// Package clients - реестр клиентских приложений (web, iOS, Android, внутренние
+// инструменты): секрет, разрешенные grant, сроки токенов, аудитории и redirect URI.
+package clients
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"time"
+)
+
+// Grant types, которые клиенту можно разрешить
+const (
+	GrantPassword     = "password"
+	GrantRefreshToken = "refresh_token"
+)
+
+var (
+	// ErrUnknownClient - клиент не зарегистрирован или не указан
+	ErrUnknownClient = errors.New("unknown client")
+	// ErrInvalidSecret - у конфиденциального клиента нет секрета или он не совпал
+	ErrInvalidSecret = errors.New("invalid client credentials")
+	// ErrGrantNotAllowed - клиенту не разрешен этот способ получения токенов
+	ErrGrantNotAllowed = errors.New("grant type not allowed for client")
+	// ErrAudienceNotAllowed - запрошена аудитория вне списка клиента
+	ErrAudienceNotAllowed = errors.New("audience not allowed for client")
+	// ErrClientMismatch - refresh от имени другого клиента, не того, что открыл сессию
+	ErrClientMismatch = errors.New("client does not match session")
+)
+
+// Client - зарегистрированное приложение. Нулевые поля - настройки сервиса по умолчанию.
+type Client struct {
+	ID string
+	// SecretHash - SHA-256 секрета в hex; пустой - публичный клиент (мобильные, SPA)
+	SecretHash string
+	// GrantTypes - пустой список разрешает все grant
+	GrantTypes []string
+	AccessTTL  time.Duration
+	// RefreshTTL - не длиннее общего refresh TTL сервиса
+	RefreshTTL   time.Duration
+	Audiences    []string
+	RedirectURIs []string
+}
+
+// Authenticate - проверка секрета конфиденциального клиента
+func (c *Client) Authenticate(secret string) error {
+	if c.SecretHash == "" {
+		return nil
+	}
+	if secret == "" || subtle.ConstantTimeCompare([]byte(HashSecret(secret)), []byte(c.SecretHash)) != 1 {
+		return ErrInvalidSecret
+	}
+	return nil
+}
+
+func (c *Client) AllowsGrant(grant string) bool {
+	return len(c.GrantTypes) == 0 || slices.Contains(c.GrantTypes, grant)
+}
+
+// AllowsRedirect - точное совпадение, без префиксов и шаблонов
+func (c *Client) AllowsRedirect(uri string) bool {
+	return uri != "" && slices.Contains(c.RedirectURIs, uri)
+}
+
+// Audience - aud access token: запрошенные аудитории, если все разрешены,
+// иначе весь список клиента. nil - аудитория сервиса по умолчанию.
+func (c *Client) Audience(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return c.Audiences, nil
+	}
+	for _, aud := range requested {
+		if !slices.Contains(c.Audiences, aud) {
+			return nil, ErrAudienceNotAllowed
+		}
+	}
+	return requested, nil
+}
+
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Registry - поиск клиента по ID; неизвестный - ErrUnknownClient
+type Registry interface {
+	Client(ctx context.Context, id string) (*Client, error)
+}
+
+// Static - клиенты из конфига
+type Static map[string]*Client
+
+func NewStatic(list ...*Client) Static {
+	s := make(Static, len(list))
+	for _, c := range list {
+		s[c.ID] = c
+	}
+	return s
+}
+
+func (s Static) Client(_ context.Context, id string) (*Client, error) {
+	if c, ok := s[id]; ok && id != "" {
+		return c, nil
+	}
+	return nil, ErrUnknownClient
+}
+
+// Chain - первый реестр, знающий клиента; конфиг обычно перед Redis
+type Chain []Registry
+
+func (ch Chain) Client(ctx context.Context, id string) (*Client, error) {
+	for _, r := range ch {
+		c, err := r.Client(ctx, id)
+		if errors.Is(err, ErrUnknownClient) {
+			continue
+		}
+		return c, err
+	}
+	return nil, ErrUnknownClient
+}
@@ -0,0 +1,103 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisClient - команды Redis, которые нужны реестру
+type RedisClient interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+}
+
+// Redis - клиенты, заведенные без перезапуска сервиса: JSON в ключе client:<id>
+type Redis struct {
+	client RedisClient
+}
+
+func NewRedis(client RedisClient) *Redis {
+	return &Redis{client: client}
+}
+
+// record - формат в Redis; сроки строками ("15m", "720h"), чтобы их можно было править руками
+type record struct {
+	SecretHash   string   `json:"secret_hash,omitempty"`
+	GrantTypes   []string `json:"grant_types,omitempty"`
+	AccessTTL    string   `json:"access_ttl,omitempty"`
+	RefreshTTL   string   `json:"refresh_ttl,omitempty"`
+	Audiences    []string `json:"audiences,omitempty"`
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+}
+
+func clientKey(id string) string {
+	return fmt.Sprintf("client:%s", id)
+}
+
+func (r *Redis) Client(ctx context.Context, id string) (*Client, error) {
+	if id == "" {
+		return nil, ErrUnknownClient
+	}
+
+	raw, err := r.client.Get(ctx, clientKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrUnknownClient
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rec record
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return nil, fmt.Errorf("unmarshal client %s: %w", id, err)
+	}
+
+	c := &Client{
+		ID:           id,
+		SecretHash:   rec.SecretHash,
+		GrantTypes:   rec.GrantTypes,
+		Audiences:    rec.Audiences,
+		RedirectURIs: rec.RedirectURIs,
+	}
+	if c.AccessTTL, err = parseTTL(rec.AccessTTL); err != nil {
+		return nil, fmt.Errorf("client %s access_ttl: %w", id, err)
+	}
+	if c.RefreshTTL, err = parseTTL(rec.RefreshTTL); err != nil {
+		return nil, fmt.Errorf("client %s refresh_ttl: %w", id, err)
+	}
+	return c, nil
+}
+
+// Save - регистрация или замена клиента
+func (r *Redis) Save(ctx context.Context, c *Client) error {
+	rec := record{
+		SecretHash:   c.SecretHash,
+		GrantTypes:   c.GrantTypes,
+		Audiences:    c.Audiences,
+		RedirectURIs: c.RedirectURIs,
+	}
+	if c.AccessTTL > 0 {
+		rec.AccessTTL = c.AccessTTL.String()
+	}
+	if c.RefreshTTL > 0 {
+		rec.RefreshTTL = c.RefreshTTL.String()
+	}
+
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("marshal client: %w", err)
+	}
+	return r.client.Set(ctx, clientKey(c.ID), raw, 0).Err()
+}
+
+func parseTTL(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
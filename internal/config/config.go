@@ -3,6 +3,7 @@ package config
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"github.com/ilyakaznacheev/cleanenv"
 	"log/slog"
 	"os"
@@ -11,13 +12,31 @@ import (
 )
 
 type Config struct {
-	ListenConfig ListenConfig   `yaml:"listen"`
-	Redis        StorageRedis   `yaml:"redis"`
-	Token        TokenConfig    `yaml:"token"`
-	Provider     ProviderConfig `yaml:"provider"`
-	GRPCConfig   GRPCConfig     `yaml:"grpc"`
-	SMTPConfig   SMTPConfig     `yaml:"smtp"`
-	Env          string         `yaml:"env"`
+	ListenConfig ListenConfig      `yaml:"listen"`
+	Redis        StorageRedis      `yaml:"redis"`
+	Token        TokenConfig       `yaml:"token"`
+	Provider     ProviderConfig    `yaml:"provider"`
+	GRPCConfig   GRPCConfig        `yaml:"grpc"`
+	SMTPConfig   SMTPConfig        `yaml:"smtp"`
+	Audit        AuditConfig       `yaml:"audit"`
+	Events       EventsConfig      `yaml:"events"`
+	Webhooks     WebhooksConfig    `yaml:"webhooks"`
+	EmailQueue   EmailQueueConfig  `yaml:"email_queue"`
+	Notify       NotifyConfig      `yaml:"notify"`
+	EmailPolicy  EmailPolicyConfig `yaml:"email_policy"`
+	Password     PasswordConfig    `yaml:"password"`
+	Permissions  PermissionsConfig `yaml:"permissions"`
+	Sessions     SessionsConfig    `yaml:"sessions"`
+	SignIn       SignInConfig      `yaml:"signin"`
+	Clients      ClientsConfig     `yaml:"clients"`
+	Env          string            `yaml:"env"`
+}
+
+type AuditConfig struct {
+	Sink       string `yaml:"sink" env:"AUDIT_SINK" env-default:"stdout"` // stdout | file | none
+	Path       string `yaml:"path" env:"AUDIT_PATH" env-default:"audit/audit.log"`
+	MaxSizeMB  int    `yaml:"max_size_mb" env-default:"100"`
+	MaxBackups int    `yaml:"max_backups" env-default:"0"` // 0 - ротированные файлы не удаляются
 }
 
 type SMTPConfig struct {
@@ -31,14 +50,236 @@ type SMTPConfig struct {
 	SupportEmail string `yaml:"support_email" env-default:"s10n41kk@gmail.com"`
 	UseTLS       bool   `yaml:"use_tls" env:"SMTP_USE_TLS" env-default:"true"`
 	Timeout      int    `yaml:"timeout" env:"SMTP_TIMEOUT" env-default:"10"`
+	// starttls | implicit | none; пустой - из UseTLS и порта (465 - implicit)
+	TLSMode       string `yaml:"tls_mode" env:"SMTP_TLS_MODE"`
+	AuthMechanism string `yaml:"auth_mechanism" env:"SMTP_AUTH_MECHANISM"` // PLAIN | LOGIN | CRAM-MD5, пустой - по EHLO
+	// Каталог с шаблонами писем поверх встроенных: <type>/<locale>/{subject.txt,body.html,body.txt}
+	TemplatesDir  string `yaml:"templates_dir" env:"SMTP_TEMPLATES_DIR"`
+	DefaultLocale string `yaml:"default_locale" env:"SMTP_DEFAULT_LOCALE" env-default:"ru"`
+	ReplyTo       string `yaml:"reply_to" env:"SMTP_REPLY_TO"`
+	// URL или mailto: для заголовка List-Unsubscribe, пустой - без заголовка
+	ListUnsubscribe string     `yaml:"list_unsubscribe" env:"SMTP_LIST_UNSUBSCRIBE"`
+	DKIM            DKIMConfig `yaml:"dkim"`
+}
+
+// DKIMConfig - подпись исходящих писем; без KeyPath письма не подписываются
+type DKIMConfig struct {
+	Domain   string `yaml:"domain" env:"SMTP_DKIM_DOMAIN"`
+	Selector string `yaml:"selector" env:"SMTP_DKIM_SELECTOR"`
+	KeyPath  string `yaml:"key_path" env:"SMTP_DKIM_KEY_PATH"` // PEM: RSA или Ed25519
+}
+
+// EmailPolicyConfig - допустимые домены email при регистрации
+type EmailPolicyConfig struct {
+	Mode            string        `yaml:"mode" env:"EMAIL_POLICY_MODE" env-default:"allowlist"` // allowlist | blocklist | open
+	Allow           []string      `yaml:"allow" env-default:"gmail.com,yandex.ru,mail.ru,mail.com"`
+	Block           []string      `yaml:"block"`
+	AllowFile       string        `yaml:"allow_file" env:"EMAIL_POLICY_ALLOW_FILE"`
+	BlockFile       string        `yaml:"block_file" env:"EMAIL_POLICY_BLOCK_FILE"`
+	BlockDisposable bool          `yaml:"block_disposable" env-default:"true"`
+	DisposableFile  string        `yaml:"disposable_file" env:"EMAIL_POLICY_DISPOSABLE_FILE"`
+	CheckMX         bool          `yaml:"check_mx" env:"EMAIL_POLICY_CHECK_MX" env-default:"false"`
+	MXTimeout       time.Duration `yaml:"mx_timeout" env-default:"3s"`
+	ReloadInterval  time.Duration `yaml:"reload_interval" env-default:"30s"`
+	// Каноническая форма адреса: точки и +тег в Gmail, +тег в перечисленных доменах
+	FoldGmail      bool     `yaml:"fold_gmail" env:"EMAIL_FOLD_GMAIL" env-default:"false"`
+	FoldSubaddress []string `yaml:"fold_subaddress"`
+}
+
+// PasswordConfig - требования к паролю при регистрации
+type PasswordConfig struct {
+	MinLength     int     `yaml:"min_length" env-default:"8"`
+	MaxLength     int     `yaml:"max_length" env-default:"128"`
+	RequireUpper  bool    `yaml:"require_upper" env-default:"true"`
+	RequireLower  bool    `yaml:"require_lower" env-default:"false"`
+	RequireDigit  bool    `yaml:"require_digit" env-default:"true"`
+	RequireSymbol bool    `yaml:"require_symbol" env-default:"false"`
+	MinEntropy    float64 `yaml:"min_entropy" env:"PASSWORD_MIN_ENTROPY" env-default:"35"`
+	// BreachedFile - SHA-1 хеши утекших паролей, отсортированные (выгрузка HIBP); пустой - без проверки
+	BreachedFile string `yaml:"breached_file" env:"PASSWORD_BREACHED_FILE"`
+}
+
+// PermissionsConfig - права ролей для claim scope; "@роль" подключает права другой роли
+type PermissionsConfig struct {
+	Roles map[string][]string `yaml:"roles"`
+}
+
+// SessionsConfig - сессии пользователей
+type SessionsConfig struct {
+	// LegacyIDs - принимать токены старого формата (typ JWT, без iss и sub) со старыми
+	// ID "userID:deviceID" и переводить их на новые при refresh; выключать через
+	// refresh_ttl после выкладки. Выключено - все, кто вошел до обновления, разлогинены
+	LegacyIDs bool `yaml:"legacy_ids" env:"SESSIONS_LEGACY_IDS" env-default:"true"`
+	// MaxAge - абсолютный срок сессии от входа; 0 (по умолчанию) - без ограничения
+	MaxAge time.Duration `yaml:"max_age" env:"SESSIONS_MAX_AGE" env-default:"0"`
+	// IdleTimeout - срок без refresh; 0 (по умолчанию) - только refresh_ttl.
+	// Фактически не больше refresh_ttl
+	IdleTimeout time.Duration `yaml:"idle_timeout" env:"SESSIONS_IDLE_TIMEOUT" env-default:"0"`
+	// MaxPerUser - одновременных сессий у пользователя; 0 (по умолчанию) - без ограничения,
+	// чтобы обновление не начало отклонять или вытеснять сессии без явной настройки
+	MaxPerUser int `yaml:"max_per_user" env:"SESSIONS_MAX_PER_USER" env-default:"0"`
+	// OnLimit - reject (отклонить вход) или evict_lru (вытеснить давно неактивную)
+	OnLimit string `yaml:"on_limit" env:"SESSIONS_ON_LIMIT" env-default:"evict_lru"`
+	// Roles, Clients - переопределения по роли и по x-client-id
+	Roles   map[string]SessionLimitsConfig `yaml:"roles"`
+	Clients map[string]SessionLimitsConfig `yaml:"clients"`
+}
+
+// SessionLimitsConfig - переопределение сроков; 0 - взять значение по умолчанию
+type SessionLimitsConfig struct {
+	MaxAge      time.Duration `yaml:"max_age"`
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	MaxSessions int           `yaml:"max_sessions"`
+}
+
+// ClientsConfig - реестр клиентских приложений; пустой registry без redis - реестра нет
+type ClientsConfig struct {
+	// Default - клиент запросов без x-client-id; пустой - такие запросы отклоняются
+	Default string `yaml:"default" env:"CLIENTS_DEFAULT"`
+	// Redis - искать клиентов, которых нет в registry, в ключах client:<id>
+	Redis    bool                    `yaml:"redis" env:"CLIENTS_REDIS" env-default:"false"`
+	Registry map[string]ClientConfig `yaml:"registry"`
+}
+
+// ClientConfig - клиентское приложение; нулевые сроки и пустой audiences - общие из token
+type ClientConfig struct {
+	// Secret или SecretHash (SHA-256 в hex); без них клиент публичный
+	Secret       string        `yaml:"secret"`
+	SecretHash   string        `yaml:"secret_hash"`
+	GrantTypes   []string      `yaml:"grant_types"` // password | refresh_token; пустой - все
+	AccessTTL    time.Duration `yaml:"access_ttl"`
+	RefreshTTL   time.Duration `yaml:"refresh_ttl"` // не больше token.refresh_ttl
+	Audiences    []string      `yaml:"audiences"`
+	RedirectURIs []string      `yaml:"redirect_uris"`
+}
+
+// SignInConfig - история входов, письмо о новом устройстве и оценка риска входа
+type SignInConfig struct {
+	Enabled bool `yaml:"enabled" env:"SIGNIN_ENABLED" env-default:"false"`
+	// RevokeURL - публичный адрес страницы "это был не я" (/signin/revoke на HTTPAddr);
+	// пустой - письма о новых устройствах не отправляются и HTTP сервер не запускается
+	RevokeURL string        `yaml:"revoke_url" env:"SIGNIN_REVOKE_URL"`
+	RevokeTTL time.Duration `yaml:"revoke_ttl" env:"SIGNIN_REVOKE_TTL" env-default:"168h"`
+	// HTTPAddr - по умолчанию только loopback: наружу страницу публикует прокси
+	HTTPAddr string `yaml:"http_addr" env:"SIGNIN_HTTP_ADDR" env-default:"127.0.0.1:8081"`
+	// GeoIPPath - CSV DB-IP "IP to City Lite"; пустой - местоположение неизвестно
+	GeoIPPath string           `yaml:"geoip_path" env:"SIGNIN_GEOIP_PATH"`
+	Risk      SignInRiskConfig `yaml:"risk"`
+}
+
+// SignInRiskConfig - 0 отключает проверку
+type SignInRiskConfig struct {
+	// MaxSpeed - км/ч между двумя входами, быстрее - невозможное перемещение
+	MaxSpeed float64 `yaml:"max_speed_kmh" env-default:"900"`
+	// MinHistory - входов в истории, после которых проверяется необычное время
+	MinHistory int `yaml:"min_history" env-default:"10"`
+	HourWindow int `yaml:"hour_window" env-default:"1"`
+}
+
+// NotifyConfig - каналы доставки кодов; пробуются по порядку, пока у получателя есть адрес
+type NotifyConfig struct {
+	Channels []string        `yaml:"channels" env:"NOTIFY_CHANNELS" env-default:"email"` // email | sms | dev
+	DevDir   string          `yaml:"dev_dir" env:"NOTIFY_DEV_DIR" env-default:"mail/dev"`
+	DevAddr  string          `yaml:"dev_addr" env:"NOTIFY_DEV_ADDR" env-default:"127.0.0.1:8025"`
+	SMS      NotifySMSConfig `yaml:"sms"`
+}
+
+type NotifySMSConfig struct {
+	URL     string        `yaml:"url" env:"NOTIFY_SMS_URL"`
+	Token   string        `env:"NOTIFY_SMS_TOKEN"`
+	Timeout time.Duration `yaml:"timeout" env-default:"10s"`
+}
+
+// EmailQueueConfig - очередь исходящих писем в Redis Stream email:queue
+type EmailQueueConfig struct {
+	Enabled        bool          `yaml:"enabled" env:"EMAIL_QUEUE_ENABLED" env-default:"true"`
+	Workers        int           `yaml:"workers" env-default:"4"`
+	MaxAttempts    int           `yaml:"max_attempts" env-default:"5"`
+	BaseBackoff    time.Duration `yaml:"base_backoff" env-default:"5s"`
+	MaxBackoff     time.Duration `yaml:"max_backoff" env-default:"10m"`
+	ClaimIdle      time.Duration `yaml:"claim_idle" env-default:"1m"`
+	IdempotencyTTL time.Duration `yaml:"idempotency_ttl" env-default:"24h"`
+	DeadLetterMax  int64         `yaml:"dead_letter_max" env-default:"10000"`
+	// CodeTTL - срок кода подтверждения (временной сессии регистрации); позже письмо не уходит
+	CodeTTL  time.Duration `yaml:"code_ttl" env-default:"3m"`
+	Consumer string        `yaml:"consumer" env:"EMAIL_QUEUE_CONSUMER"`
+}
+
+type EventsConfig struct {
+	Broker        string        `yaml:"broker" env:"EVENTS_BROKER" env-default:"none"` // none | memory | nats
+	NATSURL       string        `yaml:"nats_url" env:"EVENTS_NATS_URL" env-default:"nats://localhost:4222"`
+	SubjectPrefix string        `yaml:"subject_prefix" env-default:"auth.events"`
+	NATSStream    string        `yaml:"nats_stream" env:"EVENTS_NATS_STREAM" env-default:"AUTH_EVENTS"`
+	Group         string        `yaml:"group" env-default:"outbox-relay"`
+	Consumer      string        `yaml:"consumer" env:"EVENTS_CONSUMER" env-default:"relay-1"`
+	BatchSize     int64         `yaml:"batch_size" env-default:"100"`
+	ClaimIdle     time.Duration `yaml:"claim_idle" env-default:"30s"`
+}
+
+type WebhooksConfig struct {
+	// Group - префикс consumer group outbox; у подписчика своя группа "<group>:<name>"
+	Group         string                `yaml:"group" env-default:"webhooks"`
+	Subscriptions []WebhookSubscription `yaml:"subscriptions"`
+	MaxAttempts   int                   `yaml:"max_attempts" env-default:"5"`
+	BaseBackoff   time.Duration         `yaml:"base_backoff" env-default:"1s"`
+	MaxBackoff    time.Duration         `yaml:"max_backoff" env-default:"1m"`
+	Timeout       time.Duration         `yaml:"timeout" env-default:"10s"`
+	DeadLetterMax int64                 `yaml:"dead_letter_max" env-default:"10000"`
+}
+
+type WebhookSubscription struct {
+	Name   string   `yaml:"name"`
+	URL    string   `yaml:"url"`
+	Secret string   `yaml:"secret"`
+	Events []string `yaml:"events"`
 }
 
 type ProviderConfig struct {
-	Type     string `yaml:"type" env-default:"port"`
-	Port     string `yaml:"port" env-default:"8080"`
-	Host     string `yaml:"host" env-default:"localhost"`
-	Protocol string `yaml:"protocol" env-default:"http"`
-	BindIP   string `yaml:"bind_ip" env-default:"127.0.0.1"`
+	Type          string                `yaml:"type" env:"PROVIDER_TYPE" env-default:"http"` // http | grpc
+	Port          string                `yaml:"port" env-default:"8080"`
+	Host          string                `yaml:"host" env-default:"localhost"`
+	Protocol      string                `yaml:"protocol" env-default:"http"`
+	BindIP        string                `yaml:"bind_ip" env-default:"127.0.0.1"`
+	TLS           bool                  `yaml:"tls" env-default:"false"` // только для grpc
+	Timeout       time.Duration         `yaml:"timeout" env:"PROVIDER_TIMEOUT" env-default:"5s"`
+	Retry         ProviderRetryConfig   `yaml:"retry"`
+	Breaker       ProviderBreakerConfig `yaml:"breaker"`
+	MaxConcurrent int                   `yaml:"max_concurrent" env-default:"50"`
+	Cache         ProviderCacheConfig   `yaml:"cache"`
+	Auth          ProviderAuthConfig    `yaml:"auth"`
+}
+
+// ProviderAuthConfig - как auth service представляется users service
+type ProviderAuthConfig struct {
+	Mode     string        `yaml:"mode" env:"PROVIDER_AUTH_MODE" env-default:"none"` // none | bearer | hmac | jwt
+	Token    string        `env:"PROVIDER_AUTH_TOKEN"`                               // bearer
+	KeyID    string        `yaml:"key_id" env:"PROVIDER_AUTH_KEY_ID"`                // hmac
+	Secret   string        `env:"PROVIDER_AUTH_SECRET"`                              // hmac и jwt
+	Audience string        `yaml:"audience" env-default:"users-service"`             // jwt
+	Issuer   string        `yaml:"issuer" env-default:"auth-service"`                // jwt
+	TTL      time.Duration `yaml:"ttl" env-default:"1m"`                             // jwt
+}
+
+type ProviderCacheConfig struct {
+	Enabled      bool          `yaml:"enabled" env:"PROVIDER_CACHE_ENABLED" env-default:"true"`
+	Size         int           `yaml:"size" env-default:"10000"`
+	TTL          time.Duration `yaml:"ttl" env-default:"1m"`
+	NegativeTTL  time.Duration `yaml:"negative_ttl" env-default:"10s"`
+	Redis        bool          `yaml:"redis" env-default:"false"`
+	RedisTTL     time.Duration `yaml:"redis_ttl" env-default:"5m"`
+	InvalidateOn []string      `yaml:"invalidate_on" env-default:"UserUpdated,UserDeleted"`
+}
+
+type ProviderRetryConfig struct {
+	MaxAttempts int           `yaml:"max_attempts" env-default:"3"`
+	BaseDelay   time.Duration `yaml:"base_delay" env-default:"100ms"`
+	MaxDelay    time.Duration `yaml:"max_delay" env-default:"2s"`
+}
+
+type ProviderBreakerConfig struct {
+	FailureThreshold int           `yaml:"failure_threshold" env-default:"5"`
+	OpenTimeout      time.Duration `yaml:"open_timeout" env-default:"30s"`
+	HalfOpenMaxCalls int           `yaml:"half_open_max_calls" env-default:"1"`
 }
 
 type GRPCConfig struct {
@@ -65,6 +306,13 @@ type TokenConfig struct {
 	RefreshSecret string        `env:"TOKEN_REFRESH_SECRET,required"`
 	AccessTTL     time.Duration `yaml:"access_ttl" env:"TOKEN_ACCESS_TTL" env-default:"15m"`    // ← добавил env тег!
 	RefreshTTL    time.Duration `yaml:"refresh_ttl" env:"TOKEN_REFRESH_TTL" env-default:"168h"` // ← добавил env тег!
+	// Issuer - iss всех токенов; Audience - aud access token, первое значение проверяется при разборе
+	Issuer   string   `yaml:"issuer" env:"TOKEN_ISSUER" env-default:"auth"`
+	Audience []string `yaml:"audience" env:"TOKEN_AUDIENCE" env-default:"api"`
+	// Leeway - допуск расхождения часов для exp / nbf / iat
+	Leeway time.Duration `yaml:"leeway" env:"TOKEN_LEEWAY" env-default:"30s"`
+	// RefreshMode - jwt | opaque; в opaque в Redis хранится только SHA-256 токена
+	RefreshMode string `yaml:"refresh_mode" env:"TOKEN_REFRESH_MODE" env-default:"jwt"`
 }
 
 const (
@@ -127,5 +375,30 @@ func validateConfig(cfg *Config) error {
 	if cfg.Token.RefreshSecret == "" {
 		return errors.New("TOKEN_REFRESH_SECRET is required")
 	}
+	if mode := cfg.Token.RefreshMode; mode != "jwt" && mode != "opaque" {
+		return fmt.Errorf("unknown token refresh_mode %q", mode)
+	}
+	if policy := cfg.Sessions.OnLimit; policy != "reject" && policy != "evict_lru" {
+		return fmt.Errorf("unknown sessions on_limit %q", policy)
+	}
+	names := make(map[string]bool, len(cfg.Webhooks.Subscriptions))
+	for _, sub := range cfg.Webhooks.Subscriptions {
+		if sub.Name == "" || names[sub.Name] {
+			return fmt.Errorf("webhook subscription name %q must be unique and non-empty", sub.Name)
+		}
+		names[sub.Name] = true
+	}
+	for id, client := range cfg.Clients.Registry {
+		for _, grant := range client.GrantTypes {
+			if grant != "password" && grant != "refresh_token" {
+				return fmt.Errorf("client %s: unknown grant type %q", id, grant)
+			}
+		}
+	}
+	if id := cfg.Clients.Default; id != "" && !cfg.Clients.Redis {
+		if _, ok := cfg.Clients.Registry[id]; !ok {
+			return fmt.Errorf("default client %q is not registered", id)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,185 @@
+package email
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	ErrWhitespace    = errors.New("email cannot contain spaces")
+	ErrMissingAt     = errors.New("your email doesn't contain the '@' symbol")
+	ErrInvalidFormat = errors.New("your email contains not valid characters")
+	ErrTooLong       = errors.New("your email is too long")
+)
+
+// Ограничения RFC 5321: local-part до 64 октетов, адрес целиком до 254
+const (
+	maxLocalLen   = 64
+	maxAddressLen = 254
+)
+
+// gmailDomains - в Gmail точки в имени не значимы, googlemail.com - тот же ящик
+var gmailDomains = map[string]bool{"gmail.com": true, "googlemail.com": true}
+
+// domainProfile - UTS 46 для поиска: регистр, NFC, STD3 и длины меток DNS
+var domainProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.VerifyDNSLength(true),
+)
+
+type CanonicalConfig struct {
+	// FoldGmail - убирать точки и +тег в gmail.com / googlemail.com
+	FoldGmail bool
+	// FoldSubaddress - домены, где +тег ведет в тот же ящик и отбрасывается
+	FoldSubaddress []string
+}
+
+// Address - разобранный адрес.
+// Display - как ввел пользователь, Canonical - ключ уникальности, сессий и лимитов.
+type Address struct {
+	Display   string
+	Local     string
+	Domain    string // ASCII (punycode), в нижнем регистре
+	Canonical string
+}
+
+// Mailbox - адрес для доставки: local-part как введен, домен в ASCII
+func (a Address) Mailbox() string {
+	return a.Local + "@" + a.Domain
+}
+
+// Canonicalizer - разбор адресов по RFC 5322 (dot-atom) с UTF-8 по RFC 6531
+type Canonicalizer struct {
+	foldGmail bool
+	subaddr   map[string]bool
+}
+
+func NewCanonicalizer(cfg CanonicalConfig) *Canonicalizer {
+	subaddr := make(map[string]bool, len(cfg.FoldSubaddress))
+	for _, d := range cfg.FoldSubaddress {
+		if ascii, err := domainProfile.ToASCII(strings.TrimSpace(d)); err == nil && ascii != "" {
+			subaddr[ascii] = true
+		}
+	}
+
+	return &Canonicalizer{foldGmail: cfg.FoldGmail, subaddr: subaddr}
+}
+
+// Canonical - каноническая форма или сам ввод, если адрес не разбирается.
+// Для путей, где адрес уже был проверен при регистрации (логин).
+func (c *Canonicalizer) Canonical(raw string) string {
+	addr, err := c.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return addr.Canonical
+}
+
+func (c *Canonicalizer) Parse(raw string) (Address, error) {
+	display := norm.NFC.String(strings.TrimSpace(raw))
+	if strings.IndexFunc(display, unicode.IsSpace) >= 0 {
+		return Address{}, ErrWhitespace
+	}
+
+	at := strings.LastIndex(display, "@")
+	if at < 0 {
+		return Address{}, ErrMissingAt
+	}
+	local, domain := display[:at], display[at+1:]
+
+	if !validLocal(local) {
+		return Address{}, ErrInvalidFormat
+	}
+	if len(local) > maxLocalLen {
+		return Address{}, ErrTooLong
+	}
+
+	// IP-литералы ([192.0.2.1]) не принимаем - регистрация только на домены
+	if domain == "" || strings.HasPrefix(domain, "[") {
+		return Address{}, ErrInvalidFormat
+	}
+	ascii, err := domainProfile.ToASCII(domain)
+	if err != nil || !validDomain(ascii) {
+		return Address{}, ErrInvalidFormat
+	}
+	if len(local)+1+len(ascii) > maxAddressLen {
+		return Address{}, ErrTooLong
+	}
+
+	return Address{
+		Display:   display,
+		Local:     local,
+		Domain:    ascii,
+		Canonical: c.canonicalLocal(local, ascii) + "@" + c.canonicalDomain(ascii),
+	}, nil
+}
+
+// canonicalLocal - регистр local-part по RFC значим, но почтовые сервисы его
+// не различают, поэтому для уникальности сворачиваем
+func (c *Canonicalizer) canonicalLocal(local, domain string) string {
+	local = strings.ToLower(local)
+
+	if c.foldGmail && gmailDomains[domain] {
+		local, _, _ = strings.Cut(local, "+")
+		return strings.ReplaceAll(local, ".", "")
+	}
+	if c.subaddr[domain] {
+		local, _, _ = strings.Cut(local, "+")
+	}
+
+	return local
+}
+
+func (c *Canonicalizer) canonicalDomain(domain string) string {
+	if c.foldGmail && gmailDomains[domain] {
+		return "gmail.com"
+	}
+	return domain
+}
+
+// validLocal - dot-atom: atext через одиночные точки; не-ASCII символы разрешены (RFC 6531).
+// Quoted-string не принимаем: большинство ящиков их не выдает, а каноническая форма неоднозначна.
+func validLocal(local string) bool {
+	if local == "" || !utf8.ValidString(local) {
+		return false
+	}
+
+	for _, atom := range strings.Split(local, ".") {
+		if atom == "" {
+			return false
+		}
+		for _, r := range atom {
+			if !isAtext(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isAtext(r rune) bool {
+	switch {
+	case r >= utf8.RuneSelf:
+		return unicode.IsGraphic(r) && !unicode.IsSpace(r)
+	case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-/=?^_`{|}~", r)
+}
+
+// validDomain - минимум две метки, TLD не из одних цифр
+func validDomain(ascii string) bool {
+	labels := strings.Split(ascii, ".")
+	if len(labels) < 2 {
+		return false
+	}
+
+	tld := labels[len(labels)-1]
+	return strings.TrimFunc(tld, func(r rune) bool { return '0' <= r && r <= '9' }) != ""
+}
@@ -0,0 +1,308 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Mode - режим политики доменов
+type Mode string
+
+const (
+	// ModeAllowlist - регистрация только с доменов из списка
+	ModeAllowlist Mode = "allowlist"
+	// ModeBlocklist - любые домены, кроме запрещенных
+	ModeBlocklist Mode = "blocklist"
+	// ModeOpen - любые домены; одноразовые и MX проверяются, если включены
+	ModeOpen Mode = "open"
+)
+
+var (
+	ErrDomainNotAllowed = errors.New("your domain isn't allowed")
+	ErrDomainBlocked    = errors.New("your domain is blocked")
+	ErrDisposableDomain = errors.New("disposable email addresses are not allowed")
+	ErrNoMailServer     = errors.New("your domain doesn't accept email")
+)
+
+//go:embed disposable_domains.txt
+var bundledDisposable []byte
+
+// LegacyDomains - домены, разрешенные до появления настраиваемой политики
+var LegacyDomains = []string{"gmail.com", "yandex.ru", "mail.ru", "mail.com"}
+
+// Resolver - DNS запросы для проверки MX; *net.Resolver подходит
+type Resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+type PolicyConfig struct {
+	Mode Mode
+	// Allow / Block - домены из конфига; AllowFile / BlockFile - файлы, один домен на строку
+	Allow     []string
+	Block     []string
+	AllowFile string
+	BlockFile string
+	// BlockDisposable - отклонять одноразовые домены (встроенный список + DisposableFile)
+	BlockDisposable bool
+	DisposableFile  string
+	CheckMX         bool
+	MXTimeout       time.Duration
+	// ReloadInterval - как часто Watch проверяет файлы на изменения
+	ReloadInterval time.Duration
+}
+
+// Policy - проверка домена email при регистрации.
+// Списки из файлов перечитываются Watch без рестарта.
+type Policy struct {
+	cfg      PolicyConfig
+	resolver Resolver
+	log      *slog.Logger
+
+	lists  atomic.Pointer[domainLists]
+	mtimes map[string]time.Time
+}
+
+type domainLists struct {
+	allow      domainSet
+	block      domainSet
+	disposable domainSet
+}
+
+func NewPolicy(cfg PolicyConfig, resolver Resolver, log *slog.Logger) (*Policy, error) {
+	switch cfg.Mode {
+	case ModeAllowlist, ModeBlocklist, ModeOpen:
+	case "":
+		cfg.Mode = ModeOpen
+	default:
+		return nil, fmt.Errorf("unknown email policy mode: %s", cfg.Mode)
+	}
+	if cfg.MXTimeout <= 0 {
+		cfg.MXTimeout = 3 * time.Second
+	}
+	if cfg.ReloadInterval <= 0 {
+		cfg.ReloadInterval = 30 * time.Second
+	}
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	p := &Policy{cfg: cfg, resolver: resolver, log: log, mtimes: make(map[string]time.Time)}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// DefaultPolicy - прежнее поведение: только LegacyDomains
+func DefaultPolicy() *Policy {
+	p := &Policy{cfg: PolicyConfig{Mode: ModeAllowlist}, log: slog.Default(), mtimes: make(map[string]time.Time)}
+	p.lists.Store(&domainLists{allow: newDomainSet(LegacyDomains)})
+	return p
+}
+
+// Check - nil, если с этого домена можно регистрироваться
+func (p *Policy) Check(ctx context.Context, domain string) error {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	lists := p.lists.Load()
+
+	switch p.cfg.Mode {
+	case ModeAllowlist:
+		if !lists.allow.contains(domain) {
+			return ErrDomainNotAllowed
+		}
+	case ModeBlocklist:
+		if lists.block.contains(domain) {
+			return ErrDomainBlocked
+		}
+	}
+
+	// Явно разрешенный домен не проверяется по списку одноразовых
+	if p.cfg.BlockDisposable && !lists.allow.contains(domain) && lists.disposable.contains(domain) {
+		return ErrDisposableDomain
+	}
+
+	if p.cfg.CheckMX {
+		return p.checkMX(ctx, domain)
+	}
+	return nil
+}
+
+// checkMX - домен принимает почту, если у него есть MX или, по RFC 5321, адрес.
+// Временные ошибки DNS не блокируют регистрацию.
+func (p *Policy) checkMX(ctx context.Context, domain string) error {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.MXTimeout)
+	defer cancel()
+
+	records, err := p.resolver.LookupMX(ctx, domain)
+	if err == nil && len(records) > 0 {
+		// "MX 0 ." - домен явно не принимает почту (RFC 7505)
+		if len(records) == 1 && records[0].Host == "." {
+			return ErrNoMailServer
+		}
+		return nil
+	}
+	if err != nil && !isNotFound(err) {
+		p.log.Warn("mx lookup failed, allowing domain", slog.String("domain", domain), slog.String("error", err.Error()))
+		return nil
+	}
+
+	hosts, err := p.resolver.LookupHost(ctx, domain)
+	if err == nil && len(hosts) > 0 {
+		return nil
+	}
+	if err != nil && !isNotFound(err) {
+		p.log.Warn("host lookup failed, allowing domain", slog.String("domain", domain), slog.String("error", err.Error()))
+		return nil
+	}
+	return ErrNoMailServer
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// Reload - перечитывает файлы списков; при ошибке остаются прежние списки
+func (p *Policy) Reload() error {
+	allow, err := p.readList(p.cfg.AllowFile, p.cfg.Allow)
+	if err != nil {
+		return err
+	}
+	block, err := p.readList(p.cfg.BlockFile, p.cfg.Block)
+	if err != nil {
+		return err
+	}
+
+	disposable := domainSet{}
+	if p.cfg.BlockDisposable {
+		disposable = parseDomains(bundledDisposable)
+		extra, err := p.readList(p.cfg.DisposableFile, nil)
+		if err != nil {
+			return err
+		}
+		for d := range extra {
+			disposable[d] = struct{}{}
+		}
+	}
+
+	p.lists.Store(&domainLists{allow: allow, block: block, disposable: disposable})
+	return nil
+}
+
+// Watch - перечитывает списки при изменении файлов, блокируется до отмены контекста
+func (p *Policy) Watch(ctx context.Context) {
+	files := []string{p.cfg.AllowFile, p.cfg.BlockFile, p.cfg.DisposableFile}
+	for _, f := range files {
+		if f != "" {
+			p.mtimes[f] = modTime(f)
+		}
+	}
+
+	ticker := time.NewTicker(p.cfg.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed := false
+		for _, f := range files {
+			if f == "" {
+				continue
+			}
+			if mt := modTime(f); !mt.Equal(p.mtimes[f]) {
+				p.mtimes[f] = mt
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		if err := p.Reload(); err != nil {
+			p.log.Error("failed to reload email policy", slog.String("error", err.Error()))
+			continue
+		}
+		p.log.Info("email policy reloaded")
+	}
+}
+
+func (p *Policy) readList(path string, inline []string) (domainSet, error) {
+	set := newDomainSet(inline)
+	if path == "" {
+		return set, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read email policy list: %w", err)
+	}
+	for d := range parseDomains(data) {
+		set[d] = struct{}{}
+	}
+	return set, nil
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// domainSet - домены в нижнем регистре; запись покрывает и поддомены
+type domainSet map[string]struct{}
+
+func newDomainSet(domains []string) domainSet {
+	set := make(domainSet, len(domains))
+	for _, d := range domains {
+		if d = normalizeDomain(d); d != "" {
+			set[d] = struct{}{}
+		}
+	}
+	return set
+}
+
+func parseDomains(data []byte) domainSet {
+	set := domainSet{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if d := normalizeDomain(line); d != "" {
+			set[d] = struct{}{}
+		}
+	}
+	return set
+}
+
+func (s domainSet) contains(domain string) bool {
+	for {
+		if _, ok := s[domain]; ok {
+			return true
+		}
+		_, parent, found := strings.Cut(domain, ".")
+		if !found || !strings.Contains(parent, ".") {
+			return false
+		}
+		domain = parent
+	}
+}
+
+func normalizeDomain(d string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(d)), ".")
+}
@@ -0,0 +1,116 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Type - тип доменного события
+type Type string
+
+const (
+	UserRegistered     Type = "UserRegistered"
+	EmailVerified      Type = "EmailVerified"
+	UserLoggedIn       Type = "UserLoggedIn"
+	SessionRevoked     Type = "SessionRevoked"
+	SessionEvicted     Type = "SessionEvicted"
+	AllSessionsRevoked Type = "AllSessionsRevoked"
+	LoginRiskDetected  Type = "LoginRiskDetected"
+
+	// Публикуются users service, auth service на них только подписывается
+	UserUpdated Type = "UserUpdated"
+	UserDeleted Type = "UserDeleted"
+)
+
+// Event - доменное событие. ID используется потребителями как ключ идемпотентности:
+// доставка at-least-once, одно и то же событие может прийти повторно.
+type Event struct {
+	ID         string            `json:"id"`
+	Type       Type              `json:"type"`
+	OccurredAt time.Time         `json:"occurred_at"`
+	UserID     string            `json:"user_id,omitempty"`
+	Data       map[string]string `json:"data,omitempty"`
+}
+
+func New(typ Type, userID string, data map[string]string) Event {
+	return Event{
+		ID:         uuid.NewString(),
+		Type:       typ,
+		OccurredAt: time.Now().UTC(),
+		UserID:     userID,
+		Data:       data,
+	}
+}
+
+// Handler - обработчик события у подписчика
+type Handler func(ctx context.Context, event Event) error
+
+// Broker - куда relay публикует события из outbox
+type Broker interface {
+	Publish(ctx context.Context, event Event) error
+	Close() error
+}
+
+// Subscriber - брокер, на события которого можно подписаться
+type Subscriber interface {
+	Subscribe(typ Type, handler Handler) (unsubscribe func(), err error)
+}
+
+var ErrUnknownBroker = errors.New("unknown events broker")
+
+type Config struct {
+	Broker        string
+	NATSURL       string
+	SubjectPrefix string
+	// NATSStream - стрим JetStream для событий; создается, если его нет
+	NATSStream string
+}
+
+func NewBroker(cfg Config) (Broker, error) {
+	switch cfg.Broker {
+	case "", "none":
+		return NopBroker{}, nil
+	case "memory":
+		return NewMemoryBroker(), nil
+	case "nats":
+		return NewNATSBroker(cfg.NATSURL, cfg.SubjectPrefix, cfg.NATSStream)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBroker, cfg.Broker)
+	}
+}
+
+func Marshal(event Event) ([]byte, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("marshal event: %w", err)
+	}
+	return data, nil
+}
+
+func Unmarshal(data []byte) (Event, error) {
+	var event Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return Event{}, fmt.Errorf("unmarshal event: %w", err)
+	}
+	return event, nil
+}
+
+type pendingKey struct{}
+
+// WithEvents - прикрепляет события к контексту операции изменения состояния.
+// Хранилище запишет их в outbox в той же транзакции, что и само изменение.
+func WithEvents(ctx context.Context, events ...Event) context.Context {
+	pending := append(Pending(ctx), events...)
+	return context.WithValue(ctx, pendingKey{}, pending)
+}
+
+// Pending - события, прикрепленные к контексту
+func Pending(ctx context.Context) []Event {
+	pending, _ := ctx.Value(pendingKey{}).([]Event)
+	return pending[:len(pending):len(pending)]
+}
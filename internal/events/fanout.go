@@ -0,0 +1,28 @@
+package events
+
+import (
+	"context"
+	"errors"
+)
+
+// Fanout - публикует событие во все брокеры. При ошибке любого из них
+// relay повторит событие во все брокеры, поэтому получатели дедуплицируют по ID.
+type Fanout []Broker
+
+func (f Fanout) Publish(ctx context.Context, event Event) error {
+	var errs []error
+	for _, b := range f {
+		if err := b.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f Fanout) Close() error {
+	var errs []error
+	for _, b := range f {
+		errs = append(errs, b.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,73 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBroker - брокер внутри процесса, для тестов и локального запуска
+type MemoryBroker struct {
+	mu        sync.Mutex
+	published []Event
+	handlers  map[Type]map[int]Handler
+	nextID    int
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{handlers: make(map[Type]map[int]Handler)}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, event Event) error {
+	b.mu.Lock()
+	b.published = append(b.published, event)
+	handlers := make([]Handler, 0, len(b.handlers[event.Type]))
+	for _, h := range b.handlers[event.Type] {
+		handlers = append(handlers, h)
+	}
+	b.mu.Unlock()
+
+	for _, h := range handlers {
+		if err := h(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(typ Type, handler Handler) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.handlers[typ] == nil {
+		b.handlers[typ] = make(map[int]Handler)
+	}
+	id := b.nextID
+	b.nextID++
+	b.handlers[typ][id] = handler
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers[typ], id)
+	}, nil
+}
+
+// Published - все опубликованные события в порядке публикации
+func (b *MemoryBroker) Published() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	out := make([]Event, len(b.published))
+	copy(out, b.published)
+	return out
+}
+
+func (b *MemoryBroker) Close() error {
+	return nil
+}
+
+// NopBroker - события подтверждаются без публикации
+type NopBroker struct{}
+
+func (NopBroker) Publish(context.Context, Event) error { return nil }
+func (NopBroker) Close() error                         { return nil }
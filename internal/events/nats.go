@@ -0,0 +1,118 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// NATSBroker - публикует события в JetStream, subject <prefix>.<Type>.
+// Publish возвращает успех только после PubAck: событие сохранено в стриме,
+// иначе outbox повторит его. ID события уходит в заголовке Nats-Msg-Id,
+// по которому JetStream отбрасывает дубликаты при повторной доставке.
+type NATSBroker struct {
+	conn   *nats.Conn
+	js     jetstream.JetStream
+	prefix string
+	stream string
+}
+
+func NewNATSBroker(url, prefix, stream string) (*NATSBroker, error) {
+	conn, err := nats.Connect(url,
+		nats.Name("auth-service"),
+		nats.Timeout(5*time.Second),
+		nats.MaxReconnects(-1),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("connect to nats: %w", err)
+	}
+
+	if prefix == "" {
+		prefix = "auth.events"
+	}
+	if stream == "" {
+		stream = "AUTH_EVENTS"
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("jetstream: %w", err)
+	}
+
+	b := &NATSBroker{conn: conn, js: js, prefix: prefix, stream: stream}
+	if err := b.ensureStream(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// ensureStream - создает стрим, если его нет; настройки существующего не трогаются
+func (b *NATSBroker) ensureStream() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := b.js.Stream(ctx, b.stream)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		_, err = b.js.CreateStream(ctx, jetstream.StreamConfig{
+			Name:     b.stream,
+			Subjects: []string{b.prefix + ".>"},
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("nats stream %s: %w", b.stream, err)
+	}
+	return nil
+}
+
+func (b *NATSBroker) subject(typ Type) string {
+	return fmt.Sprintf("%s.%s", b.prefix, typ)
+}
+
+func (b *NATSBroker) Publish(ctx context.Context, event Event) error {
+	data, err := Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(b.subject(event.Type))
+	msg.Data = data
+
+	publishCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	// Без стрима или без PubAck - ошибка, и outbox не подтвердит событие.
+	// Дубликат по Nats-Msg-Id - тоже PubAck: событие уже сохранено
+	_, err = b.js.PublishMsg(publishCtx, msg,
+		jetstream.WithMsgID(event.ID),
+		jetstream.WithExpectStream(b.stream),
+	)
+	if err != nil {
+		return fmt.Errorf("publish to nats: %w", err)
+	}
+	return nil
+}
+
+func (b *NATSBroker) Subscribe(typ Type, handler Handler) (func(), error) {
+	sub, err := b.conn.Subscribe(b.subject(typ), func(msg *nats.Msg) {
+		event, err := Unmarshal(msg.Data)
+		if err != nil {
+			return
+		}
+		_ = handler(context.Background(), event)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("subscribe to nats: %w", err)
+	}
+
+	return func() { _ = sub.Unsubscribe() }, nil
+}
+
+func (b *NATSBroker) Close() error {
+	return b.conn.Drain()
+}
@@ -0,0 +1,30 @@
+package events
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	OutboxStream = "events:outbox"
+	fieldEvent   = "event"
+)
+
+// AppendOutbox - добавляет XADD для событий из контекста в pipeline транзакции
+func AppendOutbox(ctx context.Context, pipe redis.Pipeliner) error {
+	for _, event := range Pending(ctx) {
+		data, err := Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		// Без MAXLEN: обрезка по длине удалила бы неподтвержденные события,
+		// обработанные всеми группами записи убирает TrimOutbox
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: OutboxStream,
+			Values: map[string]interface{}{fieldEvent: data},
+		})
+	}
+	return nil
+}
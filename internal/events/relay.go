@@ -0,0 +1,170 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Client - команды Redis, которые нужны relay
+type Client interface {
+	XGroupCreateMkStream(ctx context.Context, stream, group, start string) *redis.StatusCmd
+	XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd
+	XAutoClaim(ctx context.Context, a *redis.XAutoClaimArgs) *redis.XAutoClaimCmd
+	XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd
+	XInfoGroups(ctx context.Context, key string) *redis.XInfoGroupsCmd
+	XPending(ctx context.Context, stream, group string) *redis.XPendingCmd
+	XTrimMinID(ctx context.Context, key string, minID string) *redis.IntCmd
+}
+
+type RelayConfig struct {
+	Group     string
+	Consumer  string
+	BatchSize int64
+	Block     time.Duration
+	// Через сколько неподтвержденное сообщение забирается повторно
+	ClaimIdle time.Duration
+	// Как часто удалять из outbox записи, обработанные всеми группами
+	TrimInterval time.Duration
+}
+
+// Relay - читает outbox через consumer group и публикует события в брокер.
+// Сообщение подтверждается только после успешной публикации, поэтому
+// при падении процесса или брокера событие будет доставлено повторно.
+type Relay struct {
+	client Client
+	broker Broker
+	cfg    RelayConfig
+	log    *slog.Logger
+}
+
+func NewRelay(client Client, broker Broker, cfg RelayConfig, log *slog.Logger) *Relay {
+	if cfg.Group == "" {
+		cfg.Group = "outbox-relay"
+	}
+	if cfg.Consumer == "" {
+		cfg.Consumer = "relay-1"
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.Block <= 0 {
+		cfg.Block = 5 * time.Second
+	}
+	if cfg.ClaimIdle <= 0 {
+		cfg.ClaimIdle = 30 * time.Second
+	}
+	if cfg.TrimInterval <= 0 {
+		cfg.TrimInterval = time.Minute
+	}
+
+	return &Relay{client: client, broker: broker, cfg: cfg, log: log}
+}
+
+// Run - блокируется до отмены контекста
+func (r *Relay) Run(ctx context.Context) error {
+	const op = "events.Relay.Run"
+
+	err := r.client.XGroupCreateMkStream(ctx, OutboxStream, r.cfg.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("%s: create group: %w", op, err)
+	}
+
+	var trimmed time.Time
+	for ctx.Err() == nil {
+		if time.Since(trimmed) >= r.cfg.TrimInterval {
+			if _, err := TrimOutbox(ctx, r.client); err != nil && ctx.Err() == nil {
+				r.log.Warn("failed to trim outbox", slog.String("error", err.Error()))
+			}
+			trimmed = time.Now()
+		}
+
+		if err := r.claimStale(ctx); err != nil && ctx.Err() == nil {
+			r.log.Warn("failed to claim stale outbox messages", slog.String("error", err.Error()))
+		}
+
+		if err := r.readNew(ctx); err != nil && ctx.Err() == nil {
+			r.log.Warn("failed to read outbox", slog.String("error", err.Error()))
+			time.Sleep(time.Second)
+		}
+	}
+
+	return nil
+}
+
+func (r *Relay) readNew(ctx context.Context) error {
+	streams, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    r.cfg.Group,
+		Consumer: r.cfg.Consumer,
+		Streams:  []string{OutboxStream, ">"},
+		Count:    r.cfg.BatchSize,
+		Block:    r.cfg.Block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, stream := range streams {
+		r.process(ctx, stream.Messages)
+	}
+	return nil
+}
+
+func (r *Relay) claimStale(ctx context.Context) error {
+	messages, _, err := r.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   OutboxStream,
+		Group:    r.cfg.Group,
+		Consumer: r.cfg.Consumer,
+		MinIdle:  r.cfg.ClaimIdle,
+		Start:    "0-0",
+		Count:    r.cfg.BatchSize,
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	r.process(ctx, messages)
+	return nil
+}
+
+func (r *Relay) process(ctx context.Context, messages []redis.XMessage) {
+	for _, msg := range messages {
+		raw, _ := msg.Values[fieldEvent].(string)
+
+		event, err := Unmarshal([]byte(raw))
+		if err != nil {
+			// Битое сообщение не станет валидным при повторе - подтверждаем и пропускаем
+			r.log.Error("dropping malformed outbox message",
+				slog.String("id", msg.ID),
+				slog.String("error", err.Error()))
+			r.ack(ctx, msg.ID)
+			continue
+		}
+
+		if err := r.broker.Publish(ctx, event); err != nil {
+			r.log.Warn("failed to publish event, will retry",
+				slog.String("event_id", event.ID),
+				slog.String("type", string(event.Type)),
+				slog.String("error", err.Error()))
+			continue
+		}
+
+		r.ack(ctx, msg.ID)
+	}
+}
+
+func (r *Relay) ack(ctx context.Context, id string) {
+	if err := r.client.XAck(ctx, OutboxStream, r.cfg.Group, id).Err(); err != nil {
+		r.log.Warn("failed to ack outbox message",
+			slog.String("id", id),
+			slog.String("error", err.Error()))
+	}
+}
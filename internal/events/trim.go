@@ -0,0 +1,54 @@
+package events
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// TrimOutbox - удаляет из outbox записи, которые уже обработали все consumer groups:
+// все, что раньше самого старого неподтвержденного или еще не прочитанного сообщения
+// каждой группы. Длина стрима не ограничивается: отстающая группа держит свои записи.
+// Группа удаленного подписчика держит их, пока ее не удалят через XGROUP DESTROY.
+func TrimOutbox(ctx context.Context, client Client) (int64, error) {
+	groups, err := client.XInfoGroups(ctx, OutboxStream).Result()
+	if err != nil || len(groups) == 0 {
+		return 0, err
+	}
+
+	minID := ""
+	for _, g := range groups {
+		// Без неподтвержденных группа обработала все до last-delivered-id включительно
+		keep := g.LastDeliveredID
+		if g.Pending > 0 {
+			pending, err := client.XPending(ctx, OutboxStream, g.Name).Result()
+			if err != nil {
+				return 0, err
+			}
+			keep = pending.Lower
+		}
+		if minID == "" || lessID(keep, minID) {
+			minID = keep
+		}
+	}
+
+	// MINID удаляет записи строго меньше minID
+	return client.XTrimMinID(ctx, OutboxStream, minID).Result()
+}
+
+// lessID - порядок ID стрима "ms-seq"
+func lessID(a, b string) bool {
+	am, as := splitID(a)
+	bm, bs := splitID(b)
+	if am != bm {
+		return am < bm
+	}
+	return as < bs
+}
+
+func splitID(id string) (ms, seq uint64) {
+	m, s, _ := strings.Cut(id, "-")
+	ms, _ = strconv.ParseUint(m, 10, 64)
+	seq, _ = strconv.ParseUint(s, 10, 64)
+	return ms, seq
+}
@@ -1,12 +1,17 @@
 package auth
 
 import (
+	"auth/internal/clients"
 	"auth/internal/model"
+	"auth/internal/password"
 	"auth/internal/provider"
+	"auth/internal/sender"
+	"auth/internal/sessions"
 	"context"
 	"errors"
 	"fmt"
 	"github.com/s10n41k/protos/gen/go/sso"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
@@ -46,6 +51,19 @@ func (s *serverApi) Register(ctx context.Context, in *sso.RegisterRequest) (*sso
 		if errors.Is(err, provider.ErrUserExists) {
 			return nil, status.Error(codes.AlreadyExists, "user already exists")
 		}
+		if errors.Is(err, provider.ErrUnavailable) {
+			return nil, status.Error(codes.Unavailable, "users service unavailable")
+		}
+		if errors.Is(err, sender.ErrNotSent) {
+			return nil, status.Error(codes.Unavailable, sender.ErrNotSent.Error())
+		}
+		var violations *password.ViolationError
+		if errors.As(err, &violations) {
+			return nil, passwordViolations(violations)
+		}
+		if errors.Is(err, password.ErrCorpusUnavailable) {
+			return nil, status.Error(codes.Internal, "failed to check password")
+		}
 
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
@@ -86,6 +104,15 @@ func (s *serverApi) Login(ctx context.Context, in *sso.LoginRequest) (*sso.Login
 		if errors.Is(err, provider.ErrUserExists) {
 			return nil, status.Error(codes.AlreadyExists, "user already exists")
 		}
+		if errors.Is(err, provider.ErrUnavailable) {
+			return nil, status.Error(codes.Unavailable, "users service unavailable")
+		}
+		if errors.Is(err, sessions.ErrTooManySessions) {
+			return nil, status.Error(codes.ResourceExhausted, sessions.ErrTooManySessions.Error())
+		}
+		if st := clientStatus(err); st != nil {
+			return nil, st
+		}
 		return nil, status.Error(codes.Internal, "failed to login")
 	}
 
@@ -111,6 +138,39 @@ func (s *serverApi) Login(ctx context.Context, in *sso.LoginRequest) (*sso.Login
 	}, nil
 }
 
+// passwordViolations - InvalidArgument с BadRequest: по нарушению на правило,
+// Reason - код правила для клиентского текста
+func passwordViolations(e *password.ViolationError) error {
+	details := &errdetails.BadRequest{}
+	for _, v := range e.Violations {
+		details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       "password",
+			Description: v.Message,
+			Reason:      string(v.Rule),
+		})
+	}
+
+	st, err := status.New(codes.InvalidArgument, e.Error()).WithDetails(details)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, e.Error())
+	}
+	return st.Err()
+}
+
+// clientStatus - отказ клиентскому приложению; nil, если ошибка не про клиента
+func clientStatus(err error) error {
+	switch {
+	case errors.Is(err, clients.ErrUnknownClient),
+		errors.Is(err, clients.ErrInvalidSecret),
+		errors.Is(err, clients.ErrClientMismatch):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, clients.ErrGrantNotAllowed),
+		errors.Is(err, clients.ErrAudienceNotAllowed):
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
+
 // Вспомогательная функция для получения IP
 func getClientIP(ctx context.Context) string {
 	if p, ok := peer.FromContext(ctx); ok {
@@ -127,6 +187,15 @@ func (s *serverApi) GetAccessToken(ctx context.Context, request *sso.TokenReques
 
 	token, err := s.auth.GetRefreshToken(ctx, request.GetRefreshToken())
 	if err != nil {
+		if errors.Is(err, provider.ErrUnavailable) {
+			return nil, status.Error(codes.Unavailable, "users service unavailable")
+		}
+		if errors.Is(err, sessions.ErrEvicted) {
+			return nil, status.Error(codes.Unauthenticated, sessions.ErrEvicted.Error())
+		}
+		if st := clientStatus(err); st != nil {
+			return nil, st
+		}
 		return nil, err
 	}
 
@@ -200,6 +269,9 @@ func (s *serverApi) VerifyEmail(ctx context.Context, request *sso.VerifyEmailReq
 
 	userID, err := s.auth.VerifyEmail(ctx, request.Session, request.Code)
 	if err != nil {
+		if errors.Is(err, provider.ErrUnavailable) {
+			return nil, status.Error(codes.Unavailable, "users service unavailable")
+		}
 		return nil, status.Error(codes.Internal, "failed to verify")
 	}
 
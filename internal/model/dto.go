@@ -1,18 +1,30 @@
 package model
 
+import "time"
+
 type UserRefresh struct {
 	SessionId string `json:"session_id"`
 	UserID    string
+	DeviceID  string
 	Name      string
 	Email     string
 	Role      string
-	Version   int
+	// Permissions - персональные права; после Login/Refresh - итоговый набор с правами роли
+	Permissions []string
+	Version     int
+	// ClientID, Audience, AccessTTL - настройки клиента для access token (azp, aud, exp);
+	// пустые - общие настройки. В кеш пользователей не попадают.
+	ClientID  string        `json:"-"`
+	Audience  []string      `json:"-"`
+	AccessTTL time.Duration `json:"-"`
 }
 
 type UserTemporary struct {
 	SessionId string `json:"session_id"`
 	Code      string
 	Name      string
-	Email     string
-	Password  string
+	// Email - каноническая форма, DisplayEmail - как ввел пользователь
+	Email        string
+	DisplayEmail string
+	Password     string
 }
@@ -1,11 +1,18 @@
 package model
 
+import "time"
+
 type User struct {
 	UserID string `json:"user_id"`
 	Email  string `json:"email"`
 	Name   string `json:"name"`
 	Valid  bool   `json:"valid"`
 	Role   string `json:"role"`
+	// Permissions - персональные права от users service сверх прав роли
+	Permissions []string `json:"permissions,omitempty"`
+	// Phone - подтвержденный номер в E.164 от users service; пусто, если номера нет
+	// или он не подтвержден. Единственный источник телефона для SMS канала.
+	Phone string `json:"phone,omitempty"`
 }
 
 type Token struct {
@@ -13,3 +20,32 @@ type Token struct {
 	RefreshToken string `json:"refresh_token"`
 	TokenType    string `json:"token_type"`
 }
+
+// Session - запись сессии. ID выдает сервер, поэтому его нельзя подобрать
+// или получить склейкой userID и deviceID, как раньше.
+type Session struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	DeviceID  string    `json:"device_id"`
+	ClientID  string    `json:"client_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// LastSeenAt - время последнего входа или refresh
+	LastSeenAt time.Time `json:"last_seen_at"`
+	IP         string    `json:"ip,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	// Legacy - сессия со старым ID "userID:deviceID" без записи в хранилище
+	Legacy bool `json:"-"`
+}
+
+// LoginRecord - вход в истории пользователя, по ней оцениваются новые входы
+type LoginRecord struct {
+	DeviceID string  `json:"device_id"`
+	IP       string  `json:"ip,omitempty"`
+	Country  string  `json:"country,omitempty"`
+	City     string  `json:"city,omitempty"`
+	Lat      float64 `json:"lat,omitempty"`
+	Lon      float64 `json:"lon,omitempty"`
+	// Located - координаты известны; нулевые Lat/Lon - тоже точка на карте
+	Located bool      `json:"located,omitempty"`
+	At      time.Time `json:"at"`
+}
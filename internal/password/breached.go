@@ -0,0 +1,116 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// Corpus - набор утекших паролей
+type Corpus interface {
+	Contains(password string) (bool, error)
+}
+
+// prefixBits - 5 hex символов SHA-1, как в k-anonymity API Have I Been Pwned
+const prefixBits = 20
+
+var ErrCorpusNotSorted = errors.New("breached password file must be sorted by hash")
+
+// PrefixFile - файл вида "SHA1HEX[:COUNT]" по строке, отсортированный по хешу
+// (формат выгрузки HIBP "ordered by hash"). В памяти только индекс смещений
+// по 20-битному префиксу; при проверке читается один блок файла с этим префиксом.
+type PrefixFile struct {
+	file    *os.File
+	offsets []int64
+}
+
+func OpenPrefixFile(path string) (*PrefixFile, error) {
+	const op = "password.OpenPrefixFile"
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	offsets, err := indexPrefixes(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &PrefixFile{file: file, offsets: offsets}, nil
+}
+
+// indexPrefixes - offsets[p] - начало первой строки с префиксом >= p
+func indexPrefixes(r io.Reader) ([]int64, error) {
+	offsets := make([]int64, 1<<prefixBits+1)
+	reader := bufio.NewReaderSize(r, 1<<16)
+
+	var offset int64
+	next := 0
+	for {
+		line, err := reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, fmt.Errorf("line at offset %d is too long", offset)
+		}
+		if len(line) >= 5 {
+			prefix, perr := strconv.ParseUint(string(line[:5]), 16, prefixBits+1)
+			if perr != nil {
+				return nil, fmt.Errorf("invalid hash at offset %d", offset)
+			}
+			if int(prefix)+1 < next {
+				return nil, ErrCorpusNotSorted
+			}
+			for ; next <= int(prefix); next++ {
+				offsets[next] = offset
+			}
+		}
+		offset += int64(len(line))
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for ; next < len(offsets); next++ {
+		offsets[next] = offset
+	}
+	return offsets, nil
+}
+
+func (f *PrefixFile) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := bytes.ToUpper([]byte(hex.EncodeToString(sum[:])))
+
+	prefix, _ := strconv.ParseUint(string(hash[:5]), 16, prefixBits+1)
+	start, end := f.offsets[prefix], f.offsets[prefix+1]
+	if start == end {
+		return false, nil
+	}
+
+	block := make([]byte, end-start)
+	if _, err := f.file.ReadAt(block, start); err != nil && !errors.Is(err, io.EOF) {
+		return false, fmt.Errorf("password.PrefixFile.Contains: %w", err)
+	}
+
+	for _, line := range bytes.Split(block, []byte("\n")) {
+		candidate, _, _ := bytes.Cut(bytes.TrimSpace(line), []byte(":"))
+		if bytes.EqualFold(candidate, hash) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *PrefixFile) Close() error {
+	return f.file.Close()
+}
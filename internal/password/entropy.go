@@ -0,0 +1,83 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// keyboardRows - соседние клавиши считаются предсказуемыми, как и последовательности
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm", "йцукенгшщзхъ", "фывапролджэ", "ячсмитьбю"}
+
+// Entropy - грубая оценка стойкости в битах: размер алфавита по использованным
+// классам символов, умноженный на "эффективную" длину. Повторы, последовательности
+// (abc, 321) и соседние клавиши дают лишь часть символа.
+func Entropy(password string) float64 {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 0
+	}
+
+	effective := 0.0
+	seen := make(map[rune]bool, len(runes))
+	for i, r := range runes {
+		lower := unicode.ToLower(r)
+		weight := 1.0
+
+		if i > 0 {
+			prev := unicode.ToLower(runes[i-1])
+			switch {
+			case lower == prev:
+				weight = 0.25
+			case lower-prev == 1 || prev-lower == 1, adjacentKeys(prev, lower):
+				weight = 0.5
+			case seen[lower]:
+				weight = 0.75
+			}
+		}
+
+		seen[lower] = true
+		effective += weight
+	}
+
+	return effective * math.Log2(float64(poolSize(classify(password))))
+}
+
+func poolSize(c charClasses) int {
+	pool := 0
+	if c.lower {
+		pool += 26
+	}
+	if c.upper {
+		pool += 26
+	}
+	if c.digit {
+		pool += 10
+	}
+	if c.symbol {
+		pool += 33
+	}
+	if c.other {
+		pool += 100
+	}
+	if pool < 2 {
+		pool = 2
+	}
+	return pool
+}
+
+func adjacentKeys(a, b rune) bool {
+	for _, row := range keyboardRows {
+		i := strings.IndexRune(row, a)
+		j := strings.IndexRune(row, b)
+		if i < 0 || j < 0 {
+			continue
+		}
+		// Индексы в байтах: в кириллице символ занимает два
+		width := len(string(a))
+		if i-j == width || j-i == width {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rule - код нарушенного правила; клиент может показать свой текст по коду
+type Rule string
+
+const (
+	RuleMinLength     Rule = "min_length"
+	RuleMaxLength     Rule = "max_length"
+	RuleUpper         Rule = "upper"
+	RuleLower         Rule = "lower"
+	RuleDigit         Rule = "digit"
+	RuleSymbol        Rule = "symbol"
+	RuleContainsEmail Rule = "contains_email"
+	RuleContainsName  Rule = "contains_name"
+	RuleWeak          Rule = "weak"
+	RuleBreached      Rule = "breached"
+)
+
+// ErrWeakPassword - пароль не прошел политику; подробности в *ViolationError
+var ErrWeakPassword = errors.New("password does not meet the policy")
+
+// ErrCorpusUnavailable - корпус утекших паролей не прочитан; пароль не проверен
+var ErrCorpusUnavailable = errors.New("breached password corpus unavailable")
+
+type Violation struct {
+	Rule    Rule
+	Message string
+}
+
+// ViolationError - все нарушенные правила сразу, а не только первое
+type ViolationError struct {
+	Violations []Violation
+}
+
+func (e *ViolationError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *ViolationError) Is(target error) bool {
+	return target == ErrWeakPassword
+}
+
+// Rules - коды нарушений по порядку
+func (e *ViolationError) Rules() []Rule {
+	rules := make([]Rule, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+type Config struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// MinEntropy - порог оценки Entropy в битах; 0 - без проверки
+	MinEntropy float64
+	// Breached - корпус утекших паролей; nil - без проверки
+	Breached Corpus
+}
+
+// Policy - проверка пароля при регистрации
+type Policy struct {
+	cfg Config
+}
+
+func NewPolicy(cfg Config) *Policy {
+	if cfg.MinLength <= 0 {
+		cfg.MinLength = 8
+	}
+	return &Policy{cfg: cfg}
+}
+
+// DefaultPolicy - прежние правила (8+ символов, заглавная и цифра) и порог энтропии
+func DefaultPolicy() *Policy {
+	return NewPolicy(Config{
+		MinLength:    8,
+		MaxLength:    128,
+		RequireUpper: true,
+		RequireDigit: true,
+		MinEntropy:   35,
+	})
+}
+
+// Check - nil, *ViolationError или ErrCorpusUnavailable
+func (p *Policy) Check(password, email, name string) error {
+	var violations []Violation
+	add := func(rule Rule, format string, args ...any) {
+		violations = append(violations, Violation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.cfg.MinLength {
+		add(RuleMinLength, "the password must contain at %d characters or more", p.cfg.MinLength)
+	}
+	if p.cfg.MaxLength > 0 && length > p.cfg.MaxLength {
+		add(RuleMaxLength, "the password must contain at most %d characters", p.cfg.MaxLength)
+	}
+
+	classes := classify(password)
+	if p.cfg.RequireUpper && !classes.upper {
+		add(RuleUpper, "the password must contain at least one uppercase character")
+	}
+	if p.cfg.RequireLower && !classes.lower {
+		add(RuleLower, "the password must contain at least one lowercase character")
+	}
+	if p.cfg.RequireDigit && !classes.digit {
+		add(RuleDigit, "the password must contain at least one number")
+	}
+	if p.cfg.RequireSymbol && !classes.symbol {
+		add(RuleSymbol, "the password must contain at least one symbol")
+	}
+
+	lower := strings.ToLower(password)
+	if containsEmail(lower, email) {
+		add(RuleContainsEmail, "the password must not contain your email")
+	}
+	if containsName(lower, name) {
+		add(RuleContainsName, "the password must not contain your name")
+	}
+
+	// Оценку и корпус проверяем, только если базовые правила пройдены
+	if len(violations) == 0 && p.cfg.MinEntropy > 0 && Entropy(password) < p.cfg.MinEntropy {
+		add(RuleWeak, "the password is too easy to guess")
+	}
+	if len(violations) == 0 && p.cfg.Breached != nil {
+		breached, err := p.cfg.Breached.Contains(password)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrCorpusUnavailable, err)
+		}
+		if breached {
+			add(RuleBreached, "the password has appeared in a data breach")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &ViolationError{Violations: violations}
+	}
+	return nil
+}
+
+type charClasses struct {
+	upper, lower, digit, symbol, other bool
+}
+
+func classify(password string) charClasses {
+	var c charClasses
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			c.upper = true
+		case unicode.IsLower(r):
+			c.lower = true
+		case unicode.IsDigit(r):
+			c.digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || r == ' ':
+			c.symbol = true
+		default:
+			c.other = true
+		}
+	}
+	return c
+}
+
+// minFragment - короче этого совпадения с email или именем считаем случайными
+const minFragment = 3
+
+// containsEmail - local-part целиком, без разделителей и по частям: john.smith -> johnsmith, john, smith
+func containsEmail(lower, email string) bool {
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	local, _, _ = strings.Cut(local, "+")
+
+	parts := strings.FieldsFunc(local, func(r rune) bool { return r == '.' || r == '-' || r == '_' })
+	fragments := append([]string{local, strings.Join(parts, "")}, parts...)
+	for _, fragment := range fragments {
+		if utf8.RuneCountInString(fragment) >= minFragment && strings.Contains(lower, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsName(lower, name string) bool {
+	for _, part := range strings.Fields(strings.ToLower(name)) {
+		if utf8.RuneCountInString(part) >= minFragment && strings.Contains(lower, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type Config struct {
+	// Сколько ошибок подряд открывают breaker
+	FailureThreshold int
+	// Сколько breaker остается открытым до пробного запроса
+	OpenTimeout time.Duration
+	// Сколько пробных запросов пропускается в half-open
+	HalfOpenMaxCalls int
+}
+
+// Breaker - circuit breaker по числу ошибок подряд
+type Breaker struct {
+	name     string
+	cfg      Config
+	onChange func(name string, from, to State)
+	now      func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	inFlight int
+	changes  []transition
+}
+
+type transition struct {
+	from, to State
+}
+
+func New(name string, cfg Config, onChange func(name string, from, to State)) *Breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	if cfg.HalfOpenMaxCalls <= 0 {
+		cfg.HalfOpenMaxCalls = 1
+	}
+
+	return &Breaker{name: name, cfg: cfg, onChange: onChange, now: time.Now}
+}
+
+// Allow - можно ли выполнить запрос. После Allow без ошибки
+// обязательно вызвать Success или Failure.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.unlock()
+
+	switch b.state {
+	case Open:
+		if b.now().Sub(b.openedAt) < b.cfg.OpenTimeout {
+			return ErrOpen
+		}
+		b.setState(HalfOpen)
+		fallthrough
+	case HalfOpen:
+		if b.inFlight >= b.cfg.HalfOpenMaxCalls {
+			return ErrOpen
+		}
+		b.inFlight++
+	}
+	return nil
+}
+
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.failures = 0
+	if b.state == HalfOpen {
+		b.inFlight--
+		b.setState(Closed)
+	}
+}
+
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.unlock()
+
+	switch b.state {
+	case HalfOpen:
+		b.inFlight--
+		b.trip()
+	case Closed:
+		b.failures++
+		if b.failures >= b.cfg.FailureThreshold {
+			b.trip()
+		}
+	}
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// unlock - снимает блокировку и только потом вызывает onChange,
+// чтобы обработчик мог безопасно читать состояние breaker
+func (b *Breaker) unlock() {
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+
+	if b.onChange == nil {
+		return
+	}
+	for _, c := range changes {
+		b.onChange(b.name, c.from, c.to)
+	}
+}
+
+func (b *Breaker) trip() {
+	b.failures = 0
+	b.openedAt = b.now()
+	b.setState(Open)
+}
+
+func (b *Breaker) setState(to State) {
+	from := b.state
+	if from == to {
+		return
+	}
+	b.state = to
+	if to != HalfOpen {
+		b.inFlight = 0
+	}
+	b.changes = append(b.changes, transition{from: from, to: to})
+}
@@ -1,9 +1,33 @@
 package provider
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrUserExists   = errors.New("user already exists")
 	ErrUserNotFound = errors.New("user not found")
 	ErrMissingData  = errors.New("missing email or password")
+	ErrUnavailable  = errors.New("users service unavailable")
 )
+
+// UnavailableError - users service недоступен: сетевая ошибка, 5xx,
+// открытый circuit breaker или переполненный лимит параллельных запросов.
+// errors.Is(err, ErrUnavailable) == true.
+type UnavailableError struct {
+	Endpoint string
+	Err      error
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%s: %s: %v", ErrUnavailable, e.Endpoint, e.Err)
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrUnavailable
+}
@@ -0,0 +1,153 @@
+package s2s
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderAuthorization = "Authorization"
+	HeaderKeyID         = "X-Auth-Key-Id"
+	HeaderTimestamp     = "X-Auth-Timestamp"
+	HeaderContentSHA256 = "X-Auth-Content-Sha256"
+	HeaderSignature     = "X-Auth-Signature"
+)
+
+var ErrUnknownMode = errors.New("unknown service auth mode")
+
+// Signer - учетные данные auth service для исходящего запроса.
+// method/path: для HTTP - метод и RequestURI, для gRPC - "POST" и полное имя метода.
+type Signer interface {
+	Headers(method, path string, body []byte) (map[string]string, error)
+}
+
+// TokenSource - выпускает короткоживущий JWT для указанной аудитории
+type TokenSource interface {
+	ServiceToken(audience string) (string, error)
+}
+
+type Config struct {
+	Mode     string
+	Token    string
+	KeyID    string
+	Secret   string
+	Audience string
+}
+
+// New - Signer по режиму; для "none" возвращает nil
+func New(cfg Config, tokens TokenSource) (Signer, error) {
+	switch cfg.Mode {
+	case "", "none":
+		return nil, nil
+	case "bearer":
+		if cfg.Token == "" {
+			return nil, fmt.Errorf("service auth: bearer token is empty")
+		}
+		return Bearer(cfg.Token), nil
+	case "hmac":
+		if cfg.Secret == "" {
+			return nil, fmt.Errorf("service auth: hmac secret is empty")
+		}
+		return &HMAC{KeyID: cfg.KeyID, Secret: []byte(cfg.Secret), Now: time.Now}, nil
+	case "jwt":
+		if tokens == nil {
+			return nil, fmt.Errorf("service auth: token source is not configured")
+		}
+		return &JWT{Audience: cfg.Audience, Tokens: tokens}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMode, cfg.Mode)
+	}
+}
+
+// Bearer - статический токен
+type Bearer string
+
+func (b Bearer) Headers(string, string, []byte) (map[string]string, error) {
+	return map[string]string{HeaderAuthorization: "Bearer " + string(b)}, nil
+}
+
+// HMAC - подпись запроса: HMAC-SHA256(secret, method \n path \n timestamp \n sha256(body))
+type HMAC struct {
+	KeyID  string
+	Secret []byte
+	Now    func() time.Time
+}
+
+func (h *HMAC) Headers(method, path string, body []byte) (map[string]string, error) {
+	timestamp := strconv.FormatInt(h.Now().Unix(), 10)
+	digest := sha256.Sum256(body)
+	digestHex := hex.EncodeToString(digest[:])
+
+	headers := map[string]string{
+		HeaderTimestamp:     timestamp,
+		HeaderContentSHA256: digestHex,
+		HeaderSignature:     SignHMAC(h.Secret, method, path, timestamp, digestHex),
+	}
+	if h.KeyID != "" {
+		headers[HeaderKeyID] = h.KeyID
+	}
+	return headers, nil
+}
+
+// SignHMAC - строка подписи, которую users service пересчитывает на своей стороне
+func SignHMAC(secret []byte, method, path, timestamp, bodySHA256 string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{strings.ToUpper(method), path, timestamp, bodySHA256}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// JWT - короткоживущий токен auth service с claim aud
+type JWT struct {
+	Audience string
+	Tokens   TokenSource
+}
+
+func (j *JWT) Headers(string, string, []byte) (map[string]string, error) {
+	token, err := j.Tokens.ServiceToken(j.Audience)
+	if err != nil {
+		return nil, fmt.Errorf("mint service token: %w", err)
+	}
+	return map[string]string{HeaderAuthorization: "Bearer " + token}, nil
+}
+
+// Transport - http.RoundTripper, подписывающий каждый запрос
+type Transport struct {
+	Base   http.RoundTripper
+	Signer Signer
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("read request body for signing: %w", err)
+		}
+		body, err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read request body for signing: %w", err)
+		}
+	}
+
+	headers, err := t.Signer.Headers(req.Method, req.URL.RequestURI(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	// RoundTripper не должен менять исходный запрос
+	signed := req.Clone(req.Context())
+	for k, v := range headers {
+		signed.Header.Set(k, v)
+	}
+
+	return t.Base.RoundTrip(signed)
+}
@@ -0,0 +1,241 @@
+package users
+
+import (
+	"auth/internal/events"
+	"auth/internal/model"
+	"auth/internal/provider"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type CacheConfig struct {
+	// Число записей в LRU процесса
+	Size        int
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	// TTL записей в Redis, если подключен второй уровень
+	RemoteTTL time.Duration
+}
+
+// CachedUser - запись кеша, nil User означает закешированный "не найден"
+type CachedUser struct {
+	User *model.UserRefresh `json:"user"`
+	// TTL - оставшийся срок записи во втором уровне; заполняет RemoteCache.Get,
+	// 0 - неизвестен
+	TTL time.Duration `json:"-"`
+}
+
+// RemoteCache - второй уровень кеша, общий для всех инстансов
+type RemoteCache interface {
+	Get(ctx context.Context, id string) (entry CachedUser, found bool, err error)
+	Set(ctx context.Context, id string, entry CachedUser, ttl time.Duration) error
+	Delete(ctx context.Context, id string) error
+}
+
+// CachingProvider - read-through кеш FindOneUsers. Остальные вызовы
+// проходят насквозь: логин и регистрация не должны видеть устаревших данных.
+type CachingProvider struct {
+	Provider
+	local  *lru[string, CachedUser]
+	remote RemoteCache
+	cfg    CacheConfig
+	log    slog.Logger
+}
+
+// NewCachingProvider - remote может быть nil, тогда используется только LRU
+func NewCachingProvider(next Provider, cfg CacheConfig, remote RemoteCache, log slog.Logger) *CachingProvider {
+	if cfg.TTL <= 0 {
+		cfg.TTL = time.Minute
+	}
+	if cfg.NegativeTTL <= 0 {
+		cfg.NegativeTTL = 10 * time.Second
+	}
+	if cfg.RemoteTTL <= 0 {
+		cfg.RemoteTTL = 5 * cfg.TTL
+	}
+
+	return &CachingProvider{
+		Provider: next,
+		local:    newLRU[string, CachedUser](cfg.Size),
+		remote:   remote,
+		cfg:      cfg,
+		log:      log,
+	}
+}
+
+func (c *CachingProvider) FindOneUsers(ctx context.Context, id string) (*model.UserRefresh, error) {
+	if entry, ok := c.local.Get(id); ok {
+		return entry.result(id)
+	}
+
+	if c.remote != nil {
+		entry, found, err := c.remote.Get(ctx, id)
+		if err != nil {
+			// Redis - только ускорение, при ошибке идем в users service
+			c.log.Warn("users cache: remote get failed",
+				slog.String("user_id", id),
+				slog.String("error", err.Error()))
+		}
+		if found {
+			// Запись из Redis не должна пережить сам Redis: после ее истечения
+			// или удаления другие инстансы уже видят свежие данные
+			ttl := entryTTL(entry, c.cfg.TTL, c.cfg.NegativeTTL)
+			if entry.TTL > 0 && entry.TTL < ttl {
+				ttl = entry.TTL
+			}
+			c.local.Set(id, entry, ttl)
+			return entry.result(id)
+		}
+	}
+
+	user, err := c.Provider.FindOneUsers(ctx, id)
+	switch {
+	case err == nil:
+		c.store(ctx, id, CachedUser{User: cloneUser(user)})
+	case errors.Is(err, provider.ErrUserNotFound):
+		c.store(ctx, id, CachedUser{})
+	}
+
+	return user, err
+}
+
+// Purge - удаляет пользователя из обоих уровней кеша
+func (c *CachingProvider) Purge(ctx context.Context, id string) error {
+	c.local.Delete(id)
+	if c.remote != nil {
+		return c.remote.Delete(ctx, id)
+	}
+	return nil
+}
+
+// InvalidateOn - подписывает кеш на события изменения пользователя.
+// Каждый инстанс получает событие и чистит свой LRU.
+func (c *CachingProvider) InvalidateOn(sub events.Subscriber, types ...events.Type) (func(), error) {
+	var unsubscribers []func()
+	unsubscribe := func() {
+		for _, u := range unsubscribers {
+			u()
+		}
+	}
+
+	for _, typ := range types {
+		u, err := sub.Subscribe(typ, func(ctx context.Context, event events.Event) error {
+			if event.UserID == "" {
+				return nil
+			}
+			return c.Purge(ctx, event.UserID)
+		})
+		if err != nil {
+			unsubscribe()
+			return nil, fmt.Errorf("subscribe to %s: %w", typ, err)
+		}
+		unsubscribers = append(unsubscribers, u)
+	}
+
+	return unsubscribe, nil
+}
+
+func (c *CachingProvider) store(ctx context.Context, id string, entry CachedUser) {
+	c.local.Set(id, entry, entryTTL(entry, c.cfg.TTL, c.cfg.NegativeTTL))
+
+	if c.remote == nil {
+		return
+	}
+	if err := c.remote.Set(ctx, id, entry, entryTTL(entry, c.cfg.RemoteTTL, c.cfg.NegativeTTL)); err != nil {
+		c.log.Warn("users cache: remote set failed",
+			slog.String("user_id", id),
+			slog.String("error", err.Error()))
+	}
+}
+
+func entryTTL(entry CachedUser, positive, negative time.Duration) time.Duration {
+	if entry.User == nil {
+		return negative
+	}
+	return positive
+}
+
+func (e CachedUser) result(id string) (*model.UserRefresh, error) {
+	if e.User == nil {
+		return nil, fmt.Errorf("%w: %s", provider.ErrUserNotFound, id)
+	}
+	return cloneUser(e.User), nil
+}
+
+// cloneUser - глубокая копия, чтобы вызывающий не изменил закешированное значение
+func cloneUser(u *model.UserRefresh) *model.UserRefresh {
+	user := *u
+	user.Permissions = slices.Clone(u.Permissions)
+	user.Audience = slices.Clone(u.Audience)
+	return &user
+}
+
+// RedisCacheClient - команды Redis, которые нужны кешу
+type RedisCacheClient interface {
+	TxPipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error)
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+}
+
+type redisUserCache struct {
+	client RedisCacheClient
+}
+
+func NewRedisUserCache(client RedisCacheClient) RemoteCache {
+	return &redisUserCache{client: client}
+}
+
+func cacheKey(id string) string {
+	return fmt.Sprintf("users_cache:%s", id)
+}
+
+// Get - запись и ее оставшийся TTL в одной транзакции: ключ не истечет между ними
+func (r *redisUserCache) Get(ctx context.Context, id string) (CachedUser, bool, error) {
+	var get *redis.StringCmd
+	var ttl *redis.DurationCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, cacheKey(id))
+		ttl = pipe.PTTL(ctx, cacheKey(id))
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return CachedUser{}, false, err
+	}
+
+	raw, err := get.Bytes()
+	if errors.Is(err, redis.Nil) {
+		return CachedUser{}, false, nil
+	}
+	if err != nil {
+		return CachedUser{}, false, err
+	}
+
+	var entry CachedUser
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return CachedUser{}, false, fmt.Errorf("unmarshal cached user: %w", err)
+	}
+	// -1 - ключ без срока
+	if remaining := ttl.Val(); remaining > 0 {
+		entry.TTL = remaining
+	}
+	return entry, true, nil
+}
+
+func (r *redisUserCache) Set(ctx context.Context, id string, entry CachedUser, ttl time.Duration) error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal cached user: %w", err)
+	}
+	return r.client.Set(ctx, cacheKey(id), raw, ttl).Err()
+}
+
+func (r *redisUserCache) Delete(ctx context.Context, id string) error {
+	return r.client.Del(ctx, cacheKey(id)).Err()
+}
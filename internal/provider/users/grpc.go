@@ -0,0 +1,192 @@
+package users
+
+import (
+	"auth/internal/model"
+	"auth/internal/provider"
+	"auth/internal/provider/s2s"
+	"auth/internal/provider/users/userspb"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// GRPCProvider - Provider поверх gRPC API users service (proto/users.proto,
+// сгенерированный клиент - userspb)
+type GRPCProvider struct {
+	conn    *grpc.ClientConn
+	client  userspb.UsersClient
+	timeout time.Duration
+	signer  s2s.Signer
+	log     slog.Logger
+}
+
+// NewGRPCProvider - signer добавляет учетные данные в metadata каждого вызова, nil - без них
+func NewGRPCProvider(host, port string, useTLS bool, timeout time.Duration, signer s2s.Signer, log slog.Logger, opts ...grpc.DialOption) (*GRPCProvider, error) {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	creds := insecure.NewCredentials()
+	if useTLS {
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, opts...)
+
+	conn, err := grpc.NewClient(fmt.Sprintf("%s:%s", host, port), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create users grpc client: %w", err)
+	}
+
+	return &GRPCProvider{
+		conn:    conn,
+		client:  userspb.NewUsersClient(conn),
+		timeout: timeout,
+		signer:  signer,
+		log:     log,
+	}, nil
+}
+
+func (g *GRPCProvider) Close() error {
+	return g.conn.Close()
+}
+
+func (g *GRPCProvider) LoginUsers(ctx context.Context, email, password string) (*model.User, error) {
+	in := &userspb.LoginRequest{Email: email, Password: password}
+	out, err := invoke(ctx, g, EndpointLogin, userspb.Users_Login_FullMethodName, in, g.client.Login)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.User{
+		UserID:      out.GetId(),
+		Email:       out.GetEmail(),
+		Name:        out.GetName(),
+		Role:        out.GetRole(),
+		Valid:       out.GetValid(),
+		Permissions: out.GetPermissions(),
+		Phone:       out.GetVerifiedPhone(),
+	}, nil
+}
+
+func (g *GRPCProvider) RegisterUsers(ctx context.Context, email, displayEmail, name, password string) (string, error) {
+	in := &userspb.RegisterRequest{Email: email, DisplayEmail: displayEmail, Name: name, Password: password}
+	out, err := invoke(ctx, g, EndpointRegister, userspb.Users_Register_FullMethodName, in, g.client.Register)
+	if err != nil {
+		return "", err
+	}
+	if out.GetId() == "" {
+		return "", fmt.Errorf("empty response")
+	}
+	return out.GetId(), nil
+}
+
+func (g *GRPCProvider) FindOneUsers(ctx context.Context, id string) (*model.UserRefresh, error) {
+	in := &userspb.FindOneRequest{Id: id}
+	out, err := invoke(ctx, g, EndpointFindOne, userspb.Users_FindOne_FullMethodName, in, g.client.FindOne)
+	if err != nil {
+		return nil, err
+	}
+	if out.GetId() == "" {
+		return nil, fmt.Errorf("%w: %s", provider.ErrUserNotFound, id)
+	}
+
+	return &model.UserRefresh{
+		UserID:      out.GetId(),
+		Name:        out.GetName(),
+		Email:       out.GetEmail(),
+		Role:        out.GetRole(),
+		Permissions: out.GetPermissions(),
+	}, nil
+}
+
+func (g *GRPCProvider) Exists(ctx context.Context, email string) error {
+	in := &userspb.ExistsRequest{Email: email}
+	out, err := invoke(ctx, g, EndpointExists, userspb.Users_Exists_FullMethodName, in, g.client.Exists)
+	if err != nil {
+		return err
+	}
+	if out.GetExists() {
+		return provider.ErrUserExists
+	}
+	return nil
+}
+
+// invoke - вызов метода сгенерированного клиента. Дедлайн берется из контекста
+// запроса, а если его нет - из timeout; подписывается сериализованное сообщение.
+func invoke[Req proto.Message, Resp any](ctx context.Context, g *GRPCProvider, endpoint, method string, in Req,
+	call func(context.Context, Req, ...grpc.CallOption) (Resp, error)) (Resp, error) {
+	var zero Resp
+
+	callCtx := ctx
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+
+	if g.signer != nil {
+		body, err := proto.Marshal(in)
+		if err != nil {
+			return zero, fmt.Errorf("marshal users grpc request: %w", err)
+		}
+		headers, err := g.signer.Headers("POST", method, body)
+		if err != nil {
+			return zero, fmt.Errorf("sign users grpc call: %w", err)
+		}
+		pairs := make([]string, 0, len(headers)*2)
+		for k, v := range headers {
+			pairs = append(pairs, strings.ToLower(k), v)
+		}
+		callCtx = metadata.AppendToOutgoingContext(callCtx, pairs...)
+	}
+
+	out, err := call(callCtx, in)
+	if err != nil {
+		g.log.Debug("users grpc call failed",
+			slog.String("method", method),
+			slog.String("error", err.Error()))
+		return zero, mapGRPCError(ctx, endpoint, err)
+	}
+	return out, nil
+}
+
+func mapGRPCError(ctx context.Context, endpoint string, err error) error {
+	st := status.Convert(err)
+
+	switch st.Code() {
+	case codes.NotFound:
+		return fmt.Errorf("%w: %s", provider.ErrUserNotFound, st.Message())
+	case codes.AlreadyExists:
+		return provider.ErrUserExists
+	case codes.Unauthenticated:
+		return provider.ErrMissingData
+	case codes.InvalidArgument:
+		if endpoint == EndpointLogin {
+			return provider.ErrMissingData
+		}
+		return fmt.Errorf("bad request: %s", st.Message())
+	case codes.Canceled:
+		return fmt.Errorf("request cancelled: %w", err)
+	case codes.DeadlineExceeded, codes.Unavailable, codes.ResourceExhausted,
+		codes.Aborted, codes.Internal, codes.Unknown:
+		// Истекший дедлайн самого вызывающего - не признак недоступности сервиса
+		if ctx.Err() != nil {
+			return fmt.Errorf("request timeout: %w", err)
+		}
+		return &provider.UnavailableError{Endpoint: endpoint, Err: err}
+	default:
+		return fmt.Errorf("users service error (%s): %s", st.Code(), st.Message())
+	}
+}
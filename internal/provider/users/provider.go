@@ -3,6 +3,7 @@ package users
 import (
 	"auth/internal/model"
 	"auth/internal/provider"
+	"auth/internal/provider/s2s"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -17,15 +18,25 @@ import (
 )
 
 type usersResponse struct {
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
-	Role  string `json:"role"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Email       string   `json:"email"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
 }
 
+// Имена эндпоинтов users service - для ошибок, breaker и метрик
+const (
+	EndpointLogin    = "login"
+	EndpointRegister = "register"
+	EndpointFindOne  = "find_one"
+	EndpointExists   = "exists"
+)
+
 type Provider interface {
 	LoginUsers(ctx context.Context, email, password string) (*model.User, error)
-	RegisterUsers(ctx context.Context, email, name, password string) (id string, err error)
+	// RegisterUsers - email - каноническая форма (ключ уникальности), displayEmail - как ввел пользователь
+	RegisterUsers(ctx context.Context, email, displayEmail, name, password string) (id string, err error)
 	FindOneUsers(ctx context.Context, id string) (*model.UserRefresh, error)
 	Exists(ctx context.Context, email string) error
 }
@@ -38,34 +49,46 @@ type usersProvider struct {
 	log      slog.Logger
 }
 
-func NewUsersProvider(protocol string, host string, port string, log slog.Logger) Provider {
+// NewUsersProvider - signer подписывает исходящие запросы, nil - без учетных данных
+func NewUsersProvider(protocol string, host string, port string, timeout time.Duration, signer s2s.Signer, log slog.Logger) Provider {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	var transport http.RoundTripper = &http.Transport{
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   20,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		ForceAttemptHTTP2:     true,
+		DisableKeepAlives:     false,
+		DisableCompression:    false,
+		MaxConnsPerHost:       50, // не более 50 одновременных соединений
+	}
+	if signer != nil {
+		transport = &s2s.Transport{Base: transport, Signer: signer}
+	}
+
 	return &usersProvider{
 		protocol: protocol,
 		host:     host,
 		port:     port,
 		log:      log,
 		client: &http.Client{
-			Transport: &http.Transport{
-				MaxIdleConns:          100,
-				MaxIdleConnsPerHost:   20,
-				IdleConnTimeout:       90 * time.Second,
-				TLSHandshakeTimeout:   10 * time.Second,
-				ResponseHeaderTimeout: 30 * time.Second,
-				ExpectContinueTimeout: 1 * time.Second,
-				ForceAttemptHTTP2:     true,
-				DisableKeepAlives:     false,
-				DisableCompression:    false,
-				MaxConnsPerHost:       50, // не более 50 одновременных соединений
-			},
-			Timeout: 5 * time.Second,
+			Transport: transport,
+			Timeout:   timeout,
 		},
 	}
 }
 
 type RegisterRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Name     string `json:"name" validate:"required"`
-	Password string `json:"password" validate:"required,min=6"`
+	Email string `json:"email" validate:"required,email"`
+	// DisplayEmail - адрес как ввел пользователь, для писем и профиля
+	DisplayEmail string `json:"display_email,omitempty"`
+	Name         string `json:"name" validate:"required"`
+	Password     string `json:"password" validate:"required,min=6"`
 }
 
 type loginRequest struct {
@@ -79,6 +102,10 @@ type loginResponse struct {
 	Name   string `json:"name"`
 	Valid  bool   `json:"valid"`
 	Role   string `json:"role"`
+	// Permissions - персональные права сверх роли, необязательное поле
+	Permissions []string `json:"permissions"`
+	// VerifiedPhone - подтвержденный номер в E.164, необязательное поле
+	VerifiedPhone string `json:"verified_phone"`
 }
 
 func (u *usersProvider) LoginUsers(ctx context.Context, email, password string) (*model.User, error) {
@@ -110,7 +137,7 @@ func (u *usersProvider) LoginUsers(ctx context.Context, email, password string)
 		u.log.Error("HTTP request failed",
 			slog.String("error", err.Error()),
 			slog.String("url", url))
-		return nil, fmt.Errorf("http request: %w", err)
+		return nil, transportError(ctx, EndpointLogin, err)
 	}
 	defer resp.Body.Close()
 
@@ -141,7 +168,7 @@ func (u *usersProvider) LoginUsers(ctx context.Context, email, password string)
 		case http.StatusBadRequest:
 			return nil, fmt.Errorf("bad request")
 		default:
-			return nil, fmt.Errorf("api error %d", resp.StatusCode)
+			return nil, statusError(EndpointLogin, resp.StatusCode)
 		}
 	}
 
@@ -167,11 +194,13 @@ func (u *usersProvider) LoginUsers(ctx context.Context, email, password string)
 
 	// Создаем пользователя
 	user := &model.User{
-		UserID: out.UserID,
-		Name:   out.Name,
-		Email:  out.Email,
-		Role:   out.Role,
-		Valid:  out.Valid,
+		UserID:      out.UserID,
+		Name:        out.Name,
+		Email:       out.Email,
+		Role:        out.Role,
+		Valid:       out.Valid,
+		Permissions: out.Permissions,
+		Phone:       out.VerifiedPhone,
 	}
 
 	u.log.Debug("Login request completed",
@@ -179,13 +208,14 @@ func (u *usersProvider) LoginUsers(ctx context.Context, email, password string)
 
 	return user, nil
 }
-func (u *usersProvider) RegisterUsers(ctx context.Context, email, name, password string) (string, error) {
+func (u *usersProvider) RegisterUsers(ctx context.Context, email, displayEmail, name, password string) (string, error) {
 	url := fmt.Sprintf("%s://%s:%s/user/register", u.protocol, u.host, u.port)
 
 	body, err := json.Marshal(RegisterRequest{
-		Email:    email,
-		Password: password,
-		Name:     name,
+		Email:        email,
+		DisplayEmail: displayEmail,
+		Password:     password,
+		Name:         name,
 	})
 	if err != nil {
 		return "", fmt.Errorf("marshal request: %w", err)
@@ -199,7 +229,7 @@ func (u *usersProvider) RegisterUsers(ctx context.Context, email, name, password
 
 	resp, err := u.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("http request: %w", err)
+		return "", transportError(ctx, EndpointRegister, err)
 	}
 	defer resp.Body.Close()
 
@@ -226,6 +256,9 @@ func (u *usersProvider) RegisterUsers(ctx context.Context, email, name, password
 		case http.StatusBadRequest:
 			return "", fmt.Errorf("bad request")
 		default:
+			if resp.StatusCode >= http.StatusInternalServerError {
+				return "", statusError(EndpointRegister, resp.StatusCode)
+			}
 			return "", fmt.Errorf("internal error")
 		}
 	}
@@ -271,13 +304,13 @@ func (u *usersProvider) FindOneUsers(ctx context.Context, id string) (*model.Use
 	// Выполняем запрос
 	resp, err := u.client.Do(req)
 	if err != nil {
-		// Проверяем, была ли отмена контекста
-		if errors.Is(err, context.Canceled) {
+		// Проверяем, была ли отмена контекста вызывающей стороной
+		if errors.Is(ctx.Err(), context.Canceled) {
 			u.log.Warn("request cancelled",
 				slog.String("user_id", id))
 			return nil, fmt.Errorf("request cancelled: %w", err)
 		}
-		if errors.Is(err, context.DeadlineExceeded) {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 			u.log.Warn("request timeout",
 				slog.String("user_id", id))
 			return nil, fmt.Errorf("request timeout: %w", err)
@@ -286,7 +319,7 @@ func (u *usersProvider) FindOneUsers(ctx context.Context, id string) (*model.Use
 		u.log.Error("failed to call users service",
 			slog.String("error", err.Error()),
 			slog.String("user_id", id))
-		return nil, fmt.Errorf("call users service: %w", err)
+		return nil, transportError(ctx, EndpointFindOne, err)
 	}
 	defer resp.Body.Close()
 
@@ -310,14 +343,15 @@ func (u *usersProvider) FindOneUsers(ctx context.Context, id string) (*model.Use
 		// Обрабатываем разные статусы
 		switch resp.StatusCode {
 		case http.StatusNotFound:
-			return nil, fmt.Errorf("user not found: %s", id)
+			return nil, fmt.Errorf("%w: %s", provider.ErrUserNotFound, id)
 		case http.StatusBadRequest:
 			return nil, fmt.Errorf("invalid user id: %s", id)
 		case http.StatusUnauthorized, http.StatusForbidden:
 			return nil, fmt.Errorf("access denied for user: %s", id)
-		case http.StatusInternalServerError:
-			return nil, fmt.Errorf("users service internal error")
 		default:
+			if resp.StatusCode >= http.StatusInternalServerError {
+				return nil, statusError(EndpointFindOne, resp.StatusCode)
+			}
 			return nil, fmt.Errorf("users service error (status=%d): %s",
 				resp.StatusCode, string(body))
 		}
@@ -334,10 +368,11 @@ func (u *usersProvider) FindOneUsers(ctx context.Context, id string) (*model.Use
 	}
 
 	user := model.UserRefresh{
-		UserID: respUser.ID,
-		Name:   respUser.Name,
-		Email:  respUser.Email,
-		Role:   respUser.Role,
+		UserID:      respUser.ID,
+		Name:        respUser.Name,
+		Email:       respUser.Email,
+		Role:        respUser.Role,
+		Permissions: respUser.Permissions,
 	}
 
 	// Проверяем, что пользователь действительно найден
@@ -345,7 +380,7 @@ func (u *usersProvider) FindOneUsers(ctx context.Context, id string) (*model.Use
 		u.log.Warn("empty user returned from service",
 			slog.String("requested_id", id),
 			slog.Any("response", user))
-		return nil, fmt.Errorf("user not found: %s", id)
+		return nil, fmt.Errorf("%w: %s", provider.ErrUserNotFound, id)
 	}
 
 	// Логируем успех
@@ -373,13 +408,13 @@ func (u *usersProvider) Exists(ctx context.Context, email string) error {
 
 	resp, err := u.client.Do(req)
 	if err != nil {
-		// Проверяем, была ли отмена контекста
-		if errors.Is(err, context.Canceled) {
+		// Проверяем, была ли отмена контекста вызывающей стороной
+		if errors.Is(ctx.Err(), context.Canceled) {
 			u.log.Warn("request cancelled",
 				slog.String("email", email))
 			return fmt.Errorf("request cancelled: %w", err)
 		}
-		if errors.Is(err, context.DeadlineExceeded) {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 			u.log.Warn("request timeout",
 				slog.String("email", email))
 			return fmt.Errorf("request timeout: %w", err)
@@ -388,7 +423,7 @@ func (u *usersProvider) Exists(ctx context.Context, email string) error {
 		u.log.Error("failed to call users service",
 			slog.String("error", err.Error()),
 			slog.String("email", email))
-		return fmt.Errorf("call users service: %w", err)
+		return transportError(ctx, EndpointExists, err)
 	}
 	defer resp.Body.Close()
 
@@ -426,6 +461,26 @@ func (u *usersProvider) Exists(ctx context.Context, email string) error {
 			slog.String("email", email),
 			slog.Int("status_code", resp.StatusCode),
 			slog.String("response_body", string(body)))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return statusError(EndpointExists, resp.StatusCode)
+		}
 		return fmt.Errorf("users service error (status=%d): %s", resp.StatusCode, string(body))
 	}
 }
+
+// transportError - сетевая ошибка означает недоступность users service,
+// если запрос не был отменен самим вызывающим
+func transportError(ctx context.Context, endpoint string, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("call users service %s: %w", endpoint, err)
+	}
+	return &provider.UnavailableError{Endpoint: endpoint, Err: err}
+}
+
+// statusError - 5xx от users service
+func statusError(endpoint string, status int) error {
+	if status >= http.StatusInternalServerError {
+		return &provider.UnavailableError{Endpoint: endpoint, Err: fmt.Errorf("status %d", status)}
+	}
+	return fmt.Errorf("api error %d", status)
+}
@@ -0,0 +1,189 @@
+package users
+
+import (
+	"auth/internal/model"
+	"auth/internal/provider"
+	"auth/internal/provider/breaker"
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"time"
+)
+
+var ErrBulkheadFull = errors.New("too many concurrent requests to users service")
+
+type RetryConfig struct {
+	// Общее число попыток, включая первую
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+type ResilienceConfig struct {
+	Retry   RetryConfig
+	Breaker breaker.Config
+	// Лимит одновременных запросов к users service
+	MaxConcurrent int
+	// Сколько ждать свободного слота, прежде чем отказать
+	AcquireTimeout time.Duration
+}
+
+// ResilientProvider - оборачивает Provider: повторы с jitter для
+// идемпотентных вызовов, circuit breaker на каждый эндпоинт и bulkhead.
+type ResilientProvider struct {
+	next     Provider
+	cfg      ResilienceConfig
+	breakers map[string]*breaker.Breaker
+	slots    chan struct{}
+	log      slog.Logger
+}
+
+func NewResilientProvider(next Provider, cfg ResilienceConfig, log slog.Logger, onStateChange func(endpoint string, from, to breaker.State)) *ResilientProvider {
+	if cfg.Retry.MaxAttempts <= 0 {
+		cfg.Retry.MaxAttempts = 1
+	}
+	if cfg.Retry.BaseDelay <= 0 {
+		cfg.Retry.BaseDelay = 100 * time.Millisecond
+	}
+	if cfg.Retry.MaxDelay <= 0 {
+		cfg.Retry.MaxDelay = 2 * time.Second
+	}
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = 50
+	}
+	if cfg.AcquireTimeout <= 0 {
+		cfg.AcquireTimeout = 100 * time.Millisecond
+	}
+
+	p := &ResilientProvider{
+		next:     next,
+		cfg:      cfg,
+		breakers: make(map[string]*breaker.Breaker),
+		slots:    make(chan struct{}, cfg.MaxConcurrent),
+		log:      log,
+	}
+
+	onChange := func(endpoint string, from, to breaker.State) {
+		p.log.Warn("users service circuit breaker changed state",
+			slog.String("endpoint", endpoint),
+			slog.String("from", from.String()),
+			slog.String("to", to.String()))
+		if onStateChange != nil {
+			onStateChange(endpoint, from, to)
+		}
+	}
+
+	for _, endpoint := range []string{EndpointLogin, EndpointRegister, EndpointFindOne, EndpointExists} {
+		p.breakers[endpoint] = breaker.New(endpoint, cfg.Breaker, onChange)
+	}
+
+	return p
+}
+
+// States - состояние breaker каждого эндпоинта, для health checks
+func (p *ResilientProvider) States() map[string]breaker.State {
+	states := make(map[string]breaker.State, len(p.breakers))
+	for endpoint, b := range p.breakers {
+		states[endpoint] = b.State()
+	}
+	return states
+}
+
+func (p *ResilientProvider) LoginUsers(ctx context.Context, email, password string) (user *model.User, err error) {
+	err = p.call(ctx, EndpointLogin, false, func(ctx context.Context) error {
+		user, err = p.next.LoginUsers(ctx, email, password)
+		return err
+	})
+	return user, err
+}
+
+func (p *ResilientProvider) RegisterUsers(ctx context.Context, email, displayEmail, name, password string) (id string, err error) {
+	err = p.call(ctx, EndpointRegister, false, func(ctx context.Context) error {
+		id, err = p.next.RegisterUsers(ctx, email, displayEmail, name, password)
+		return err
+	})
+	return id, err
+}
+
+func (p *ResilientProvider) FindOneUsers(ctx context.Context, id string) (user *model.UserRefresh, err error) {
+	err = p.call(ctx, EndpointFindOne, true, func(ctx context.Context) error {
+		user, err = p.next.FindOneUsers(ctx, id)
+		return err
+	})
+	return user, err
+}
+
+func (p *ResilientProvider) Exists(ctx context.Context, email string) error {
+	return p.call(ctx, EndpointExists, true, func(ctx context.Context) error {
+		return p.next.Exists(ctx, email)
+	})
+}
+
+func (p *ResilientProvider) call(ctx context.Context, endpoint string, idempotent bool, fn func(ctx context.Context) error) error {
+	release, err := p.acquire(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	b := p.breakers[endpoint]
+
+	attempts := 1
+	if idempotent {
+		attempts = p.cfg.Retry.MaxAttempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err := b.Allow(); err != nil {
+			return &provider.UnavailableError{Endpoint: endpoint, Err: err}
+		}
+
+		err = fn(ctx)
+		// Бизнес-ошибки (не найден, уже существует) означают, что сервис жив
+		if !errors.Is(err, provider.ErrUnavailable) {
+			b.Success()
+			return err
+		}
+		b.Failure()
+
+		if attempt >= attempts {
+			return err
+		}
+
+		delay := p.backoff(attempt)
+		p.log.Debug("retrying users service call",
+			slog.String("endpoint", endpoint),
+			slog.Int("attempt", attempt),
+			slog.Duration("delay", delay))
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (p *ResilientProvider) acquire(ctx context.Context, endpoint string) (func(), error) {
+	timer := time.NewTimer(p.cfg.AcquireTimeout)
+	defer timer.Stop()
+
+	select {
+	case p.slots <- struct{}{}:
+		return func() { <-p.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, &provider.UnavailableError{Endpoint: endpoint, Err: ErrBulkheadFull}
+	}
+}
+
+// backoff - full jitter: случайная задержка от 0 до min(MaxDelay, BaseDelay*2^(attempt-1))
+func (p *ResilientProvider) backoff(attempt int) time.Duration {
+	ceiling := p.cfg.Retry.BaseDelay << (attempt - 1)
+	if ceiling <= 0 || ceiling > p.cfg.Retry.MaxDelay {
+		ceiling = p.cfg.Retry.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
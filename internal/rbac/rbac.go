@@ -0,0 +1,70 @@
+package rbac
+
+import (
+	"auth/pkg/permissions"
+	"fmt"
+	"strings"
+)
+
+// Roles - права ролей из конфига. Элемент "@роль" подключает права другой роли:
+//
+//	user:  [tasks:read, tasks:write]
+//	admin: ["@user", "users:*"]
+type Roles struct {
+	perms map[string]permissions.Set
+}
+
+func NewRoles(config map[string][]string) (*Roles, error) {
+	r := &Roles{perms: make(map[string]permissions.Set, len(config))}
+
+	for role := range config {
+		set := permissions.Set{}
+		if err := expand(config, role, set, map[string]bool{}); err != nil {
+			return nil, err
+		}
+		r.perms[role] = set
+	}
+
+	return r, nil
+}
+
+func expand(config map[string][]string, role string, into permissions.Set, visiting map[string]bool) error {
+	if visiting[role] {
+		return fmt.Errorf("rbac: role %q includes itself", role)
+	}
+	visiting[role] = true
+	defer delete(visiting, role)
+
+	entries, ok := config[role]
+	if !ok {
+		return fmt.Errorf("rbac: unknown role %q", role)
+	}
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if parent, ok := strings.CutPrefix(entry, "@"); ok {
+			if err := expand(config, parent, into, visiting); err != nil {
+				return err
+			}
+			continue
+		}
+		if entry != "" {
+			into[entry] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// Resolve - права роли вместе с персональными правами пользователя, по алфавиту.
+// Неизвестная роль прав не дает.
+func (r *Roles) Resolve(role string, grants []string) []string {
+	set := permissions.NewSet(grants...)
+	for p := range r.perms[role] {
+		set[p] = struct{}{}
+	}
+
+	if len(set) == 0 {
+		return nil
+	}
+	return set.List()
+}
@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"auth/internal/events"
 	"auth/internal/model"
 	"auth/internal/storage"
 	"auth/pkg/client/redis"
@@ -22,7 +23,25 @@ func NewRepositoryRedis(client redis.Client, RefreshTTl time.Duration) storage.S
 	return &repositoryRedis{Client: client, RefreshTTL: RefreshTTl}
 }
 
-func (r *repositoryRedis) Save(ctx context.Context, userId string, refreshToken string) error {
+// exec - выполняет команды в MULTI/EXEC. События, прикрепленные к контексту
+// через events.WithEvents, пишутся в outbox в той же транзакции.
+func (r *repositoryRedis) exec(ctx context.Context, fn func(pipe redis2.Pipeliner)) error {
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis2.Pipeliner) error {
+		fn(pipe)
+		return events.AppendOutbox(ctx, pipe)
+	})
+	return err
+}
+
+// ttl - срок ключа: до конца сессии, но не больше RefreshTTL
+func (r *repositoryRedis) ttl(ttl time.Duration) time.Duration {
+	if ttl <= 0 || ttl > r.RefreshTTL {
+		return r.RefreshTTL
+	}
+	return ttl
+}
+
+func (r *repositoryRedis) Save(ctx context.Context, userId string, refreshToken string, ttl time.Duration) error {
 	token, err := json.Marshal(refreshToken)
 	if err != nil {
 		return err
@@ -30,24 +49,67 @@ func (r *repositoryRedis) Save(ctx context.Context, userId string, refreshToken
 
 	key := fmt.Sprintf("session:%s", userId)
 
-	res := r.Client.Set(ctx, key, token, r.RefreshTTL)
-	if res.Err() != nil {
+	return r.exec(ctx, func(pipe redis2.Pipeliner) {
+		pipe.Set(ctx, key, token, r.ttl(ttl))
+	})
+}
+
+func refreshHashKey(hash string) string {
+	return fmt.Sprintf("refresh:%s", hash)
+}
+
+// SaveRefreshHash - индекс по хешам предыдущих токенов не чистится: они истекают сами,
+// а найденная по старому хешу сессия уже хранит другой хеш - это повторное использование
+func (r *repositoryRedis) SaveRefreshHash(ctx context.Context, session string, hash string, ttl time.Duration) error {
+	value, err := json.Marshal(hash)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return r.exec(ctx, func(pipe redis2.Pipeliner) {
+		pipe.Set(ctx, fmt.Sprintf("session:%s", session), value, r.ttl(ttl))
+		pipe.Set(ctx, refreshHashKey(hash), session, r.ttl(ttl))
+	})
 }
 
-func (r *repositoryRedis) DeleteRefreshToken(ctx context.Context, session string) error {
+func (r *repositoryRedis) SessionByRefreshHash(ctx context.Context, hash string) (string, error) {
+	return r.Client.Get(ctx, refreshHashKey(hash)).Result()
+}
 
-	key := fmt.Sprintf("session:%s", session)
+// takeRefreshScript - удаляет токен сессии, только если он совпал с предъявленным
+const takeRefreshScript = `
+local stored = redis.call('GET', KEYS[1])
+if not stored then
+	return false
+end
+if stored ~= ARGV[1] then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+return 1
+`
 
-	err := r.Client.Del(ctx, key).Err()
+func (r *repositoryRedis) TakeRefreshToken(ctx context.Context, session string, refreshToken string) (bool, error) {
+	value, err := json.Marshal(refreshToken)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	return nil
+	taken, err := r.Client.Eval(ctx, takeRefreshScript, []string{fmt.Sprintf("session:%s", session)}, value).Int()
+	if err != nil {
+		return false, err
+	}
+	return taken == 1, nil
+}
+
+// DeleteRefreshToken - конец сессии: вместе с токеном удаляется и запись сессии
+func (r *repositoryRedis) DeleteRefreshToken(ctx context.Context, session string) error {
+
+	key := fmt.Sprintf("session:%s", session)
+
+	return r.exec(ctx, func(pipe redis2.Pipeliner) {
+		pipe.Del(ctx, key, sessionKey(session))
+	})
 }
 
 func (r *repositoryRedis) Get(ctx context.Context, userId string) (token string, err error) {
@@ -98,21 +160,141 @@ func (r *repositoryRedis) IncrementTokenVersion(ctx context.Context, userID stri
 
 func (r *repositoryRedis) DeleteVersionToken(ctx context.Context, session string) error {
 	key := fmt.Sprintf("token_ver:%s", session)
-	err := r.Client.Del(ctx, key).Err()
+	return r.exec(ctx, func(pipe redis2.Pipeliner) {
+		pipe.Del(ctx, key)
+	})
+}
+
+func sessionKey(sessionID string) string {
+	return fmt.Sprintf("session_info:%s", sessionID)
+}
+
+func (r *repositoryRedis) SaveSession(ctx context.Context, session *model.Session, ttl time.Duration) error {
+	data, err := json.Marshal(session)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	return r.exec(ctx, func(pipe redis2.Pipeliner) {
+		pipe.Set(ctx, sessionKey(session.ID), data, r.ttl(ttl))
+		pipe.SAdd(ctx, fmt.Sprintf("user_sessions:%s", session.UserID), session.ID)
+	})
 }
 
-func (r *repositoryRedis) AddSession(ctx context.Context, userID, deviceID string) error {
-	key := fmt.Sprintf("user_sessions:%s", userID)
-	return r.Client.SAdd(ctx, key, deviceID).Err()
+func (r *repositoryRedis) GetSession(ctx context.Context, sessionID string) (*model.Session, error) {
+	res, err := r.Client.Get(ctx, sessionKey(sessionID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var session model.Session
+	if err = json.Unmarshal([]byte(res), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
 }
 
-func (r *repositoryRedis) RemoveSession(ctx context.Context, userID, deviceID string) error {
-	key := fmt.Sprintf("user_sessions:%s", userID)
-	return r.Client.SRem(ctx, key, deviceID).Err()
+// RemoveSession - убирает сессию из списка пользователя; запись удаляет DeleteRefreshToken
+func (r *repositoryRedis) RemoveSession(ctx context.Context, session *model.Session) error {
+	key := fmt.Sprintf("user_sessions:%s", session.UserID)
+
+	member := session.ID
+	if session.Legacy {
+		// Старые сессии записаны в списке по deviceID
+		member = session.DeviceID
+	}
+	return r.Client.SRem(ctx, key, member).Err()
+}
+
+func evictedKey(sessionID string) string {
+	return fmt.Sprintf("evicted:%s", sessionID)
+}
+
+// EvictSession - ключи сессии и метка удаляются/ставятся в одной транзакции:
+// устройство не увидит промежуточного "revoked"
+func (r *repositoryRedis) EvictSession(ctx context.Context, session *model.Session) error {
+	member := session.ID
+	if session.Legacy {
+		member = session.DeviceID
+	}
+
+	return r.exec(ctx, func(pipe redis2.Pipeliner) {
+		pipe.SRem(ctx, fmt.Sprintf("user_sessions:%s", session.UserID), member)
+		pipe.Del(ctx,
+			fmt.Sprintf("session:%s", session.ID),
+			sessionKey(session.ID),
+			fmt.Sprintf("token_ver:%s", session.ID))
+		// Дольше refresh TTL токен вытесненной сессии не живет
+		pipe.Set(ctx, evictedKey(session.ID), 1, r.RefreshTTL)
+	})
+}
+
+func (r *repositoryRedis) IsEvicted(ctx context.Context, sessionID string) (bool, error) {
+	n, err := r.Client.Exists(ctx, evictedKey(sessionID)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+const (
+	// loginHistoryMax - сколько последних входов хранится для оценки риска
+	loginHistoryMax = 50
+	// loginHistoryTTL - история и устройства забываются после долгого отсутствия
+	loginHistoryTTL = 180 * 24 * time.Hour
+)
+
+func (r *repositoryRedis) UserDevices(ctx context.Context, userID string) ([]string, error) {
+	return r.Client.SMembers(ctx, fmt.Sprintf("user_devices:%s", userID)).Result()
+}
+
+func (r *repositoryRedis) LoginHistory(ctx context.Context, userID string) ([]model.LoginRecord, error) {
+	values, err := r.Client.LRange(ctx, fmt.Sprintf("login_history:%s", userID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]model.LoginRecord, 0, len(values))
+	for _, value := range values {
+		var login model.LoginRecord
+		if err = json.Unmarshal([]byte(value), &login); err != nil {
+			return nil, err
+		}
+		history = append(history, login)
+	}
+	return history, nil
+}
+
+func (r *repositoryRedis) AddLogin(ctx context.Context, userID string, login model.LoginRecord) error {
+	data, err := json.Marshal(login)
+	if err != nil {
+		return err
+	}
+
+	devices := fmt.Sprintf("user_devices:%s", userID)
+	history := fmt.Sprintf("login_history:%s", userID)
+
+	return r.exec(ctx, func(pipe redis2.Pipeliner) {
+		pipe.SAdd(ctx, devices, login.DeviceID)
+		pipe.Expire(ctx, devices, loginHistoryTTL)
+		pipe.LPush(ctx, history, data)
+		pipe.LTrim(ctx, history, 0, loginHistoryMax-1)
+		pipe.Expire(ctx, history, loginHistoryTTL)
+	})
+}
+
+func revokeTokenKey(hash string) string {
+	return fmt.Sprintf("revoke:%s", hash)
+}
+
+func (r *repositoryRedis) SaveRevokeToken(ctx context.Context, hash string, userID string, ttl time.Duration) error {
+	return r.exec(ctx, func(pipe redis2.Pipeliner) {
+		pipe.Set(ctx, revokeTokenKey(hash), userID, ttl)
+	})
+}
+
+func (r *repositoryRedis) TakeRevokeToken(ctx context.Context, hash string) (string, error) {
+	return r.Client.GetDel(ctx, revokeTokenKey(hash)).Result()
 }
 
 func (r *repositoryRedis) GetUserSessions(ctx context.Context, userID string) ([]string, error) {
@@ -122,7 +304,9 @@ func (r *repositoryRedis) GetUserSessions(ctx context.Context, userID string) ([
 
 func (r *repositoryRedis) DeleteAllSessions(ctx context.Context, userID string) error {
 	key := fmt.Sprintf("user_sessions:%s", userID)
-	return r.Client.Del(ctx, key).Err()
+	return r.exec(ctx, func(pipe redis2.Pipeliner) {
+		pipe.Del(ctx, key)
+	})
 }
 
 func (r *repositoryRedis) SaveTemporarySession(ctx context.Context, userTemporary *model.UserTemporary) error {
@@ -133,9 +317,9 @@ func (r *repositoryRedis) SaveTemporarySession(ctx context.Context, userTemporar
 		return err
 	}
 
-	r.Client.Set(ctx, key, user, 3*time.Minute)
-
-	return nil
+	return r.exec(ctx, func(pipe redis2.Pipeliner) {
+		pipe.Set(ctx, key, user, 3*time.Minute)
+	})
 }
 
 func (r *repositoryRedis) GetTemporarySession(ctx context.Context, session string) (user *model.UserTemporary, err error) {
@@ -151,9 +335,7 @@ func (r *repositoryRedis) GetTemporarySession(ctx context.Context, session strin
 }
 
 func (r *repositoryRedis) DeleteTemporarySession(ctx context.Context, session string) error {
-	err := r.Client.Del(ctx, session).Err()
-	if err != nil {
-		return err
-	}
-	return nil
+	return r.exec(ctx, func(pipe redis2.Pipeliner) {
+		pipe.Del(ctx, session)
+	})
 }
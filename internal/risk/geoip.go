@@ -0,0 +1,131 @@
+package risk
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Location - приблизительное местоположение IP адреса
+type Location struct {
+	Country string
+	Region  string
+	City    string
+	Lat     float64
+	Lon     float64
+}
+
+// String - "City, Region, Country" без пустых частей
+func (l Location) String() string {
+	parts := make([]string, 0, 3)
+	for _, part := range []string{l.City, l.Region, l.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+type ipRange struct {
+	start, end netip.Addr
+	location   Location
+}
+
+// GeoIP - офлайн база диапазонов адресов в памяти. Формат - CSV DB-IP "IP to City Lite":
+// ip_start,ip_end,continent,country,stateprov,city,latitude,longitude
+type GeoIP struct {
+	ranges []ipRange
+}
+
+// LoadGeoIP - читает базу из файла целиком
+func LoadGeoIP(path string) (*GeoIP, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open geoip database: %w", err)
+	}
+	defer f.Close()
+
+	return ReadGeoIP(f)
+}
+
+func ReadGeoIP(r io.Reader) (*GeoIP, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	var ranges []ipRange
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read geoip database: %w", err)
+		}
+		if len(record) < 8 {
+			return nil, fmt.Errorf("geoip database line %d: expected 8 fields, got %d", line, len(record))
+		}
+
+		start, err := netip.ParseAddr(record[0])
+		if err != nil {
+			if line == 1 {
+				// Строка заголовка
+				continue
+			}
+			return nil, fmt.Errorf("geoip database line %d: %w", line, err)
+		}
+		end, err := netip.ParseAddr(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("geoip database line %d: %w", line, err)
+		}
+		lat, _ := strconv.ParseFloat(record[6], 64)
+		lon, _ := strconv.ParseFloat(record[7], 64)
+
+		ranges = append(ranges, ipRange{
+			start: start.Unmap(),
+			end:   end.Unmap(),
+			location: Location{
+				Country: record[3],
+				Region:  record[4],
+				City:    record[5],
+				Lat:     lat,
+				Lon:     lon,
+			},
+		})
+	}
+
+	slices.SortFunc(ranges, func(a, b ipRange) int {
+		return a.start.Compare(b.start)
+	})
+	return &GeoIP{ranges: ranges}, nil
+}
+
+// Lookup - местоположение адреса; nil база ничего не находит
+func (g *GeoIP) Lookup(ip string) (Location, bool) {
+	if g == nil {
+		return Location{}, false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Location{}, false
+	}
+	addr = addr.Unmap()
+
+	// Последний диапазон, который начинается не позже адреса
+	i, found := slices.BinarySearchFunc(g.ranges, addr, func(r ipRange, target netip.Addr) int {
+		return r.start.Compare(target)
+	})
+	if !found {
+		i--
+	}
+	if i < 0 || g.ranges[i].end.Compare(addr) < 0 {
+		return Location{}, false
+	}
+	return g.ranges[i].location, true
+}
@@ -0,0 +1,100 @@
+// Package risk - оценка входа по истории входов пользователя: невозможное
+// перемещение и вход в непривычное время. Местоположение берется из GeoIP.
+package risk
+
+import (
+	"auth/internal/model"
+	"math"
+	"time"
+)
+
+// Причины, по которым вход считается подозрительным
+const (
+	ImpossibleTravel = "impossible_travel"
+	UnusualHour      = "unusual_hour"
+)
+
+// minTravelKm - ближе точность GeoIP не позволяет судить о перемещении
+const minTravelKm = 100
+
+// Detector - нулевое поле отключает соответствующую проверку
+type Detector struct {
+	// MaxSpeed - км/ч; быстрее между двумя входами не переместиться
+	MaxSpeed float64
+	// MinHistory - сколько входов нужно, чтобы судить о привычных часах
+	MinHistory int
+	// HourWindow - на сколько часов от привычного вход еще не считается необычным
+	HourWindow int
+}
+
+// Assess - причины подозрительности входа current; history - прошлые входы, новые первыми.
+// nil Detector ничего не находит.
+func (d *Detector) Assess(history []model.LoginRecord, current model.LoginRecord) []string {
+	if d == nil {
+		return nil
+	}
+
+	var reasons []string
+	if d.impossibleTravel(history, current) {
+		reasons = append(reasons, ImpossibleTravel)
+	}
+	if d.unusualHour(history, current) {
+		reasons = append(reasons, UnusualHour)
+	}
+	return reasons
+}
+
+func (d *Detector) impossibleTravel(history []model.LoginRecord, current model.LoginRecord) bool {
+	if d.MaxSpeed <= 0 || !current.Located {
+		return false
+	}
+
+	for _, prev := range history {
+		if !prev.Located {
+			continue
+		}
+		distance := distanceKm(prev.Lat, prev.Lon, current.Lat, current.Lon)
+		if distance < minTravelKm {
+			return false
+		}
+		// Входы в одну минуту сравниваются как через минуту
+		hours := max(current.At.Sub(prev.At), time.Minute).Hours()
+		return distance/hours > d.MaxSpeed
+	}
+	return false
+}
+
+func (d *Detector) unusualHour(history []model.LoginRecord, current model.LoginRecord) bool {
+	if d.MinHistory <= 0 || len(history) < d.MinHistory {
+		return false
+	}
+
+	hour := current.At.UTC().Hour()
+	for _, prev := range history {
+		diff := abs(prev.At.UTC().Hour() - hour)
+		if min(diff, 24-diff) <= d.HourWindow {
+			return false
+		}
+	}
+	return true
+}
+
+// distanceKm - расстояние по большому кругу (формула гаверсинусов)
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKm = 6371
+
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := rad(lat2 - lat1)
+	dLon := rad(lon2 - lon1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
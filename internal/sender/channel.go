@@ -0,0 +1,171 @@
+package sender
+
+import (
+	"auth/internal/config"
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+)
+
+// ErrNoAddress - у получателя нет адреса для этого канала, Router пробует следующий
+var ErrNoAddress = errors.New("recipient has no address for channel")
+
+// Notification - сообщение для доставки по любому каналу
+type Notification struct {
+	Type   MessageType
+	Email  string
+	Phone  string
+	Name   string
+	Code   string
+	SignIn SignIn
+	Locale string
+}
+
+// Channel - способ доставки: email, SMS, dev sink
+type Channel interface {
+	Name() string
+	Deliver(ctx context.Context, n Notification) error
+}
+
+type phoneKey struct{}
+
+// e164 - "+", код страны и номер, всего не больше 15 цифр
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// ValidPhone - номер в формате E.164
+func ValidPhone(phone string) bool {
+	return e164.MatchString(phone)
+}
+
+// WithPhone - телефон получателя для SMS канала; EmailSender принимает только email.
+// Только подтвержденный номер из записи пользователя: номер из запроса позволил бы
+// получить чужой код или слать SMS на произвольные номера. Номер не в E.164 игнорируется.
+func WithPhone(ctx context.Context, phone string) context.Context {
+	if !ValidPhone(phone) {
+		return ctx
+	}
+	return context.WithValue(ctx, phoneKey{}, phone)
+}
+
+func PhoneFrom(ctx context.Context) string {
+	phone, _ := ctx.Value(phoneKey{}).(string)
+	return phone
+}
+
+// Router - EmailSender поверх каналов: письмо уходит в первый канал,
+// для которого у получателя есть адрес
+type Router struct {
+	channels []Channel
+}
+
+func NewRouter(channels ...Channel) *Router {
+	return &Router{channels: channels}
+}
+
+func (r *Router) SendVerificationCode(ctx context.Context, toEmail, userName, code, locale string) error {
+	return r.Deliver(ctx, Notification{
+		Type:   MessageVerification,
+		Email:  toEmail,
+		Phone:  PhoneFrom(ctx),
+		Name:   userName,
+		Code:   code,
+		Locale: locale,
+	})
+}
+
+// SendNewSignIn - по SMS, если в ctx есть подтвержденный телефон пользователя (WithPhone)
+func (r *Router) SendNewSignIn(ctx context.Context, toEmail, userName string, signIn SignIn, locale string) error {
+	return r.Deliver(ctx, Notification{
+		Type:   MessageNewSignIn,
+		Email:  toEmail,
+		Phone:  PhoneFrom(ctx),
+		Name:   userName,
+		SignIn: signIn,
+		Locale: locale,
+	})
+}
+
+func (r *Router) Deliver(ctx context.Context, n Notification) error {
+	for _, channel := range r.channels {
+		err := channel.Deliver(ctx, n)
+		if errors.Is(err, ErrNoAddress) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s channel: %w", channel.Name(), err)
+		}
+		return nil
+	}
+	return ErrNoAddress
+}
+
+// Close - закрывает каналы, которые держат ресурсы
+func (r *Router) Close() error {
+	var errs []error
+	for _, channel := range r.channels {
+		if c, ok := channel.(interface{ Close() error }); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// composer - общая для каналов сборка письма из шаблонов
+type composer struct {
+	config    config.SMTPConfig
+	templates *Templates
+	replyTo   *mail.Address
+}
+
+func newComposer(cfg config.SMTPConfig) (*composer, error) {
+	templates, err := NewTemplates(cfg.TemplatesDir, cfg.DefaultLocale)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load email templates: %w", err)
+	}
+
+	var replyTo *mail.Address
+	if cfg.ReplyTo != "" {
+		if replyTo, err = mail.ParseAddress(cfg.ReplyTo); err != nil {
+			return nil, fmt.Errorf("invalid reply-to address: %w", err)
+		}
+	}
+
+	return &composer{config: cfg, templates: templates, replyTo: replyTo}, nil
+}
+
+func (c *composer) render(n Notification) (*Rendered, error) {
+	data := TemplateData{
+		UserName:      n.Name,
+		Code:          n.Code,
+		AppName:       c.config.FromName,
+		AppURL:        c.config.AppURL,
+		SupportEmail:  c.config.SupportEmail,
+		ExpiryMinutes: 3,
+		SignIn:        n.SignIn,
+	}
+
+	rendered, err := c.templates.Render(n.Type, n.Locale, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render email template: %w", err)
+	}
+	return rendered, nil
+}
+
+func (c *composer) compose(n Notification) (*Message, error) {
+	rendered, err := c.render(n)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		From:            mail.Address{Name: c.config.FromName, Address: c.config.FromEmail},
+		To:              []mail.Address{{Name: n.Name, Address: n.Email}},
+		ReplyTo:         c.replyTo,
+		Subject:         rendered.Subject,
+		Text:            rendered.Text,
+		HTML:            rendered.HTML,
+		ListUnsubscribe: c.config.ListUnsubscribe,
+	}, nil
+}
@@ -0,0 +1,261 @@
+package sender
+
+import (
+	"auth/internal/config"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DevSink - канал для локальной разработки: письма пишутся .eml файлами
+// в каталог и доступны в маленьком web inbox, SMTP не нужен
+type DevSink struct {
+	*composer
+	dir string
+	log *slog.Logger
+}
+
+func NewDevSink(cfg config.SMTPConfig, dir string, log *slog.Logger) (*DevSink, error) {
+	composer, err := newComposer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create dev mailbox dir: %w", err)
+	}
+	return &DevSink{composer: composer, dir: dir, log: log}, nil
+}
+
+func (d *DevSink) Name() string {
+	return "dev"
+}
+
+func (d *DevSink) Deliver(_ context.Context, n Notification) error {
+	if n.Email == "" {
+		return ErrNoAddress
+	}
+
+	message, err := d.compose(n)
+	if err != nil {
+		return err
+	}
+	raw, err := message.Bytes()
+	if err != nil {
+		return fmt.Errorf("failed to build email: %w", err)
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitizeFileName(n.Email))
+	path := filepath.Join(d.dir, name)
+
+	// Через временный файл, чтобы inbox не увидел недописанное письмо
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o644); err != nil {
+		return fmt.Errorf("write dev mail: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("write dev mail: %w", err)
+	}
+
+	d.log.Info("dev mail written", slog.String("to", n.Email), slog.String("path", path))
+	return nil
+}
+
+// Serve - web inbox на addr до отмены контекста
+func (d *DevSink) Serve(ctx context.Context, addr string) error {
+	server := &http.Server{Addr: addr, Handler: d.Handler(), ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Handler - "/" список писем, "/html/<file>" HTML часть, "/raw/<file>" исходник
+func (d *DevSink) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", d.handleList)
+	mux.HandleFunc("GET /html/{name}", d.handleHTML)
+	mux.HandleFunc("GET /raw/{name}", d.handleRaw)
+	return mux
+}
+
+type devMail struct {
+	Name    string
+	Date    string
+	To      string
+	Subject string
+}
+
+var inboxTemplate = template.Must(template.New("inbox").Parse(`<!DOCTYPE html>
+<html><head><meta charset="UTF-8"><title>Dev inbox</title></head>
+<body style="font-family: Arial, sans-serif;">
+<h2>Dev inbox</h2>
+<table cellpadding="6">
+<tr><th align="left">Date</th><th align="left">To</th><th align="left">Subject</th><th></th></tr>
+{{range .}}<tr><td>{{.Date}}</td><td>{{.To}}</td><td><a href="html/{{.Name}}">{{.Subject}}</a></td><td><a href="raw/{{.Name}}">raw</a></td></tr>
+{{else}}<tr><td colspan="4">No messages</td></tr>
+{{end}}</table>
+</body></html>`))
+
+func (d *DevSink) handleList(w http.ResponseWriter, _ *http.Request) {
+	mails, err := d.list()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	inboxTemplate.Execute(w, mails)
+}
+
+func (d *DevSink) handleRaw(w http.ResponseWriter, r *http.Request) {
+	path, ok := d.mailPath(r.PathValue("name"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeFile(w, r, path)
+}
+
+func (d *DevSink) handleHTML(w http.ResponseWriter, r *http.Request) {
+	path, ok := d.mailPath(r.PathValue("name"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, contentType, err := readPreferredPart(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+func (d *DevSink) list() ([]devMail, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := new(mime.WordDecoder)
+	mails := make([]devMail, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".eml") {
+			continue
+		}
+		f, err := os.Open(filepath.Join(d.dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		msg, err := mail.ReadMessage(f)
+		if err == nil {
+			subject, _ := decoder.DecodeHeader(msg.Header.Get("Subject"))
+			to, _ := decoder.DecodeHeader(msg.Header.Get("To"))
+			mails = append(mails, devMail{
+				Name:    entry.Name(),
+				Date:    msg.Header.Get("Date"),
+				To:      to,
+				Subject: subject,
+			})
+		}
+		f.Close()
+	}
+
+	// Имена начинаются с UnixNano - новые сверху
+	sort.Slice(mails, func(i, j int) bool { return mails[i].Name > mails[j].Name })
+	return mails, nil
+}
+
+func (d *DevSink) mailPath(name string) (string, bool) {
+	if name != filepath.Base(name) || !strings.HasSuffix(name, ".eml") {
+		return "", false
+	}
+	path := filepath.Join(d.dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// readPreferredPart - HTML часть письма, а если ее нет - текстовая
+func readPreferredPart(path string) ([]byte, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	msg, err := mail.ReadMessage(f)
+	if err != nil {
+		return nil, "", err
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		var body io.Reader = msg.Body
+		if strings.EqualFold(msg.Header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+			body = quotedprintable.NewReader(body)
+		}
+		data, err := io.ReadAll(body)
+		return data, msg.Header.Get("Content-Type"), err
+	}
+
+	var text []byte
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, "", err
+		}
+		switch {
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/html"):
+			return data, "text/html; charset=utf-8", nil
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain"):
+			text = data
+		}
+	}
+	return text, "text/plain; charset=utf-8", nil
+}
+
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' || r == '@' {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,227 @@
+package sender
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dkimHeaders - подписываемые заголовки, если они есть в письме
+var dkimHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-ID",
+	"MIME-Version", "Content-Type", "Content-Transfer-Encoding",
+	"List-Unsubscribe", "List-Unsubscribe-Post",
+}
+
+// DKIMSigner - подпись DKIM (RFC 6376), c=relaxed/relaxed;
+// rsa-sha256 или ed25519-sha256 (RFC 8463) по типу ключа
+type DKIMSigner struct {
+	domain    string
+	selector  string
+	key       crypto.Signer
+	algorithm string
+	now       func() time.Time
+}
+
+func NewDKIMSigner(domain, selector string, key crypto.Signer) (*DKIMSigner, error) {
+	if domain == "" || selector == "" {
+		return nil, errors.New("dkim: domain and selector are required")
+	}
+
+	var algorithm string
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		algorithm = "rsa-sha256"
+	case ed25519.PrivateKey:
+		algorithm = "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("dkim: unsupported key type %T", key)
+	}
+
+	return &DKIMSigner{domain: domain, selector: selector, key: key, algorithm: algorithm, now: time.Now}, nil
+}
+
+// LoadDKIMKey - PEM с ключом RSA (PKCS#1 или PKCS#8) или Ed25519 (PKCS#8)
+func LoadDKIMKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("dkim: read key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("dkim: no PEM block in key file")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("dkim: parse key: %w", err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("dkim: unsupported key type %T", key)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("dkim: unsupported PEM block %q", block.Type)
+	}
+}
+
+// Sign - письмо с заголовком DKIM-Signature в начале
+func (d *DKIMSigner) Sign(msg []byte) ([]byte, error) {
+	header, body, ok := bytes.Cut(msg, []byte("\r\n\r\n"))
+	if !ok {
+		return nil, errors.New("dkim: message has no header/body separator")
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+	fields := parseHeaderFields(string(header) + "\r\n")
+
+	var signed []string
+	var canonical strings.Builder
+	for _, name := range dkimHeaders {
+		// При повторах подписывается нижний экземпляр (RFC 6376, 5.4.2)
+		for i := len(fields) - 1; i >= 0; i-- {
+			if strings.EqualFold(fields[i].name, name) {
+				canonical.WriteString(relaxedHeader(fields[i].name, fields[i].value))
+				canonical.WriteString("\r\n")
+				signed = append(signed, strings.ToLower(name))
+				break
+			}
+		}
+	}
+	if len(signed) == 0 || signed[0] != "from" {
+		return nil, errors.New("dkim: message has no From header")
+	}
+
+	value := fmt.Sprintf("v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s; t=%s; h=%s; bh=%s; b=",
+		d.algorithm, d.domain, d.selector,
+		strconv.FormatInt(d.now().Unix(), 10),
+		strings.Join(signed, ":"),
+		base64.StdEncoding.EncodeToString(bodyHash[:]))
+
+	// Сам DKIM-Signature входит в хэш с пустым b= и без завершающего CRLF
+	canonical.WriteString(relaxedHeader("DKIM-Signature", value))
+	digest := sha256.Sum256([]byte(canonical.String()))
+
+	var signature []byte
+	var err error
+	switch d.algorithm {
+	case "rsa-sha256":
+		signature, err = d.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	case "ed25519-sha256":
+		// RFC 8463: Ed25519 подписывает SHA-256 от канонизированных заголовков
+		signature, err = d.key.Sign(rand.Reader, digest[:], crypto.Hash(0))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dkim: sign: %w", err)
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(msg) + 512)
+	out.WriteString("DKIM-Signature: ")
+	out.WriteString(value)
+	out.WriteString(foldBase64(base64.StdEncoding.EncodeToString(signature)))
+	out.WriteString("\r\n")
+	out.Write(msg)
+	return out.Bytes(), nil
+}
+
+type headerField struct {
+	name  string
+	value string
+}
+
+// parseHeaderFields - поля заголовка с сохранением продолжений строк
+func parseHeaderFields(header string) []headerField {
+	var fields []headerField
+	for _, line := range strings.SplitAfter(header, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].value += line
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields = append(fields, headerField{name: name, value: value})
+	}
+	return fields
+}
+
+// relaxedHeader - имя в нижнем регистре, без переносов, пробелы схлопнуты
+func relaxedHeader(name, value string) string {
+	value = strings.NewReplacer("\r\n", "", "\r", "", "\n", "").Replace(value)
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(collapseWSP(value))
+}
+
+// relaxedBody - пробелы в строках схлопнуты, хвостовые пробелы и пустые строки в конце убраны
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(collapseWSP(line), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func collapseWSP(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	space := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' || s[i] == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteByte(s[i])
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// foldBase64 - длинная подпись переносится строками по 72 символа
+func foldBase64(s string) string {
+	const width = 72
+	if len(s) <= width {
+		return s
+	}
+	var b strings.Builder
+	for len(s) > width {
+		b.WriteString(s[:width])
+		b.WriteString("\r\n ")
+		s = s[width:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
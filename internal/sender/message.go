@@ -0,0 +1,162 @@
+package sender
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message - письмо до сериализации в RFC 5322
+type Message struct {
+	From    mail.Address
+	To      []mail.Address
+	ReplyTo *mail.Address
+	Subject string
+	Text    string
+	HTML    string
+	// ListUnsubscribe - URL или mailto: без угловых скобок
+	ListUnsubscribe string
+	Date            time.Time
+	// MessageID - без угловых скобок; пустой - генерируется от домена отправителя
+	MessageID string
+}
+
+var ErrEmptyMessage = errors.New("email has neither text nor html body")
+
+// Bytes - письмо с заголовками в CRLF; при двух телах - multipart/alternative
+func (m *Message) Bytes() ([]byte, error) {
+	if m.Text == "" && m.HTML == "" {
+		return nil, ErrEmptyMessage
+	}
+	if len(m.To) == 0 {
+		return nil, errors.New("email has no recipients")
+	}
+
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	messageID := m.MessageID
+	if messageID == "" {
+		var err error
+		if messageID, err = newMessageID(m.From.Address); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	writeHeader(&buf, "From", m.From.String())
+	writeHeader(&buf, "To", joinAddresses(m.To))
+	if m.ReplyTo != nil {
+		writeHeader(&buf, "Reply-To", m.ReplyTo.String())
+	}
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	writeHeader(&buf, "Date", date.Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", "<"+messageID+">")
+	if m.ListUnsubscribe != "" {
+		writeHeader(&buf, "List-Unsubscribe", "<"+m.ListUnsubscribe+">")
+		if strings.HasPrefix(m.ListUnsubscribe, "https://") {
+			// RFC 8058 - отписка одним POST без подтверждения
+			writeHeader(&buf, "List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+		}
+	}
+	writeHeader(&buf, "MIME-Version", "1.0")
+
+	// Одно тело - без multipart
+	if m.Text == "" || m.HTML == "" {
+		contentType, body := "text/plain", m.Text
+		if m.HTML != "" {
+			contentType, body = "text/html", m.HTML
+		}
+		writeHeader(&buf, "Content-Type", contentType+"; charset=utf-8")
+		writeHeader(&buf, "Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, body); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	writeHeader(&buf, "Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": mw.Boundary()}))
+	buf.WriteString("\r\n")
+
+	// Порядок важен: клиенты показывают последнюю понятную им часть
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain", m.Text},
+		{"text/html", m.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Recipients - адреса для RCPT TO
+func (m *Message) Recipients() []string {
+	recipients := make([]string, 0, len(m.To))
+	for _, to := range m.To {
+		recipients = append(recipients, to.Address)
+	}
+	return recipients
+}
+
+func writeHeader(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	buf.WriteString(": ")
+	// Переводы строк в значении дали бы внедрить заголовок
+	buf.WriteString(strings.NewReplacer("\r", "", "\n", "").Replace(value))
+	buf.WriteString("\r\n")
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	// quotedprintable сам переводит \n в CRLF
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func joinAddresses(addresses []mail.Address) string {
+	parts := make([]string, 0, len(addresses))
+	for _, a := range addresses {
+		parts = append(parts, a.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+func newMessageID(from string) (string, error) {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 && at < len(from)-1 {
+		domain = from[at+1:]
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate message id: %w", err)
+	}
+	return hex.EncodeToString(b) + "@" + domain, nil
+}
@@ -0,0 +1,576 @@
+package sender
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	QueueStream   = "email:queue"
+	retryKey      = "email:retry"
+	deadLetterKey = "email:dead"
+	fieldJob      = "job"
+)
+
+// JobState - состояние доставки письма
+type JobState string
+
+const (
+	JobQueued   JobState = "queued"
+	JobRetrying JobState = "retrying"
+	JobSent     JobState = "sent"
+	JobDead     JobState = "dead"
+	// JobExpired - код в письме истек раньше, чем удалось доставить
+	JobExpired JobState = "expired"
+)
+
+var (
+	ErrJobNotFound    = errors.New("email job not found")
+	errUnknownJobType = errors.New("unknown email job type")
+)
+
+// Job - письмо в очереди; содержит все, чтобы отрендерить его заново после рестарта
+type Job struct {
+	ID        string      `json:"id"`
+	Key       string      `json:"key"`
+	Type      MessageType `json:"type"`
+	To        string      `json:"to"`
+	Phone     string      `json:"phone,omitempty"`
+	Name      string      `json:"name"`
+	Code      string      `json:"code,omitempty"`
+	SignIn    *SignIn     `json:"sign_in,omitempty"`
+	Locale    string      `json:"locale,omitempty"`
+	Attempt   int         `json:"attempt"`
+	CreatedAt time.Time   `json:"created_at"`
+	// ExpiresAt - после этого момента письмо бесполезно и не отправляется
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+type JobStatus struct {
+	ID        string
+	State     JobState
+	Attempts  int
+	LastError string
+	UpdatedAt time.Time
+}
+
+// DeadJob - письмо, исчерпавшее попытки
+type DeadJob struct {
+	Job       Job       `json:"job"`
+	LastError string    `json:"last_error"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// QueueClient - команды Redis, которые нужны очереди
+type QueueClient interface {
+	XAdd(ctx context.Context, a *redis.XAddArgs) *redis.StringCmd
+	XGroupCreateMkStream(ctx context.Context, stream, group, start string) *redis.StatusCmd
+	XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd
+	XAutoClaim(ctx context.Context, a *redis.XAutoClaimArgs) *redis.XAutoClaimCmd
+	XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd
+	XDel(ctx context.Context, stream string, ids ...string) *redis.IntCmd
+	TxPipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error)
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	HGetAll(ctx context.Context, key string) *redis.MapStringStringCmd
+	LRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
+}
+
+type QueueConfig struct {
+	Workers     int
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// PollInterval - как часто отложенные повторы возвращаются в поток
+	PollInterval time.Duration
+	Block        time.Duration
+	// Через сколько неподтвержденное письмо забирается другим worker
+	ClaimIdle      time.Duration
+	IdempotencyTTL time.Duration
+	StatusTTL      time.Duration
+	DeadLetterMax  int64
+	// CodeTTL - срок кода подтверждения; письмо с истекшим кодом не отправляется
+	CodeTTL  time.Duration
+	Group    string
+	Consumer string
+}
+
+// Queue - EmailSender, который только ставит письмо в Redis Stream.
+// Worker'ы доставляют его через next с повторами; после MaxAttempts
+// письмо уходит в dead-letter список email:dead.
+type Queue struct {
+	client QueueClient
+	next   EmailSender
+	cfg    QueueConfig
+	log    *slog.Logger
+}
+
+func NewQueue(client QueueClient, next EmailSender, cfg QueueConfig, log *slog.Logger) *Queue {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = 5 * time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 10 * time.Minute
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.Block <= 0 {
+		cfg.Block = 5 * time.Second
+	}
+	if cfg.ClaimIdle <= 0 {
+		cfg.ClaimIdle = time.Minute
+	}
+	if cfg.IdempotencyTTL <= 0 {
+		cfg.IdempotencyTTL = 24 * time.Hour
+	}
+	if cfg.StatusTTL <= 0 {
+		cfg.StatusTTL = 7 * 24 * time.Hour
+	}
+	if cfg.DeadLetterMax <= 0 {
+		cfg.DeadLetterMax = 10000
+	}
+	if cfg.CodeTTL <= 0 {
+		cfg.CodeTTL = 3 * time.Minute
+	}
+	if cfg.Group == "" {
+		cfg.Group = "email-workers"
+	}
+	if cfg.Consumer == "" {
+		// Разные экземпляры сервиса не должны делить имена consumer'ов
+		cfg.Consumer, _ = os.Hostname()
+		if cfg.Consumer == "" {
+			cfg.Consumer = "worker"
+		}
+	}
+
+	return &Queue{client: client, next: next, cfg: cfg, log: log}
+}
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey - ключ, по которому повторная постановка того же письма игнорируется
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+func (q *Queue) SendVerificationCode(ctx context.Context, toEmail, userName, code, locale string) error {
+	_, err := q.Enqueue(ctx, Job{
+		Type:   MessageVerification,
+		To:     toEmail,
+		Phone:  PhoneFrom(ctx),
+		Name:   userName,
+		Code:   code,
+		Locale: locale,
+	})
+	return err
+}
+
+func (q *Queue) SendNewSignIn(ctx context.Context, toEmail, userName string, signIn SignIn, locale string) error {
+	_, err := q.Enqueue(ctx, Job{
+		Type:   MessageNewSignIn,
+		To:     toEmail,
+		Phone:  PhoneFrom(ctx),
+		Name:   userName,
+		SignIn: &signIn,
+		Locale: locale,
+	})
+	return err
+}
+
+// Enqueue - возвращает ID задания; для уже поставленного ключа - ID существующего задания
+func (q *Queue) Enqueue(ctx context.Context, job Job) (string, error) {
+	const op = "sender.Queue.Enqueue"
+
+	if job.Key == "" {
+		job.Key, _ = ctx.Value(idempotencyKey{}).(string)
+	}
+	if job.Key == "" {
+		parts := []string{string(job.Type), strings.ToLower(job.To), job.Code}
+		if job.SignIn != nil {
+			// Ссылка отзыва у каждого входа своя
+			parts = append(parts, job.SignIn.RevokeURL)
+		}
+		sum := sha256.Sum256([]byte(strings.Join(parts, "|")))
+		job.Key = hex.EncodeToString(sum[:])
+	}
+	job.ID = uuid.NewString()
+	job.Attempt = 0
+	job.CreatedAt = time.Now().UTC()
+	if job.Type == MessageVerification && job.ExpiresAt.IsZero() {
+		job.ExpiresAt = job.CreatedAt.Add(q.cfg.CodeTTL)
+	}
+
+	idemKey := "email:idem:" + job.Key
+	created, err := q.client.SetNX(ctx, idemKey, job.ID, q.cfg.IdempotencyTTL).Result()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	if !created {
+		existing, err := q.client.Get(ctx, idemKey).Result()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		return existing, nil
+	}
+
+	raw, err := json.Marshal(job)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: QueueStream, Values: map[string]interface{}{fieldJob: raw}})
+		q.setStatus(ctx, pipe, job.ID, JobQueued, 0, "")
+		return nil
+	})
+	if err != nil {
+		// Ключ освобождается, иначе повтор запроса вернул бы ID непоставленного письма
+		q.client.Del(ctx, idemKey)
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return job.ID, nil
+}
+
+// JobID - ID задания по ключу идемпотентности
+func (q *Queue) JobID(ctx context.Context, key string) (string, error) {
+	id, err := q.client.Get(ctx, "email:idem:"+key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrJobNotFound
+	}
+	return id, err
+}
+
+func (q *Queue) Status(ctx context.Context, id string) (*JobStatus, error) {
+	values, err := q.client.HGetAll(ctx, statusKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, ErrJobNotFound
+	}
+
+	attempts, _ := strconv.Atoi(values["attempts"])
+	updatedAt, _ := time.Parse(time.RFC3339Nano, values["updated_at"])
+
+	return &JobStatus{
+		ID:        id,
+		State:     JobState(values["state"]),
+		Attempts:  attempts,
+		LastError: values["last_error"],
+		UpdatedAt: updatedAt,
+	}, nil
+}
+
+// DeadLetters - последние письма, исчерпавшие попытки, новые первыми
+func (q *Queue) DeadLetters(ctx context.Context, limit int64) ([]DeadJob, error) {
+	raw, err := q.client.LRange(ctx, deadLetterKey, 0, limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]DeadJob, 0, len(raw))
+	for _, r := range raw {
+		var dead DeadJob
+		if err := json.Unmarshal([]byte(r), &dead); err != nil {
+			continue
+		}
+		jobs = append(jobs, dead)
+	}
+	return jobs, nil
+}
+
+// Run - запускает worker'ы и планировщик повторов, блокируется до отмены контекста
+func (q *Queue) Run(ctx context.Context) error {
+	err := q.client.XGroupCreateMkStream(ctx, QueueStream, q.cfg.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("sender.Queue.Run: create group: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 1; i <= q.cfg.Workers; i++ {
+		wg.Add(1)
+		go func(consumer string) {
+			defer wg.Done()
+			q.work(ctx, consumer)
+		}(fmt.Sprintf("%s-%d", q.cfg.Consumer, i))
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		q.schedule(ctx)
+	}()
+
+	wg.Wait()
+	return nil
+}
+
+func (q *Queue) work(ctx context.Context, consumer string) {
+	for ctx.Err() == nil {
+		messages, _, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   QueueStream,
+			Group:    q.cfg.Group,
+			Consumer: consumer,
+			MinIdle:  q.cfg.ClaimIdle,
+			Start:    "0-0",
+			Count:    1,
+		}).Result()
+		if err != nil && ctx.Err() == nil {
+			q.log.Warn("failed to claim stale email jobs", slog.String("error", err.Error()))
+		}
+		for _, msg := range messages {
+			q.process(ctx, msg)
+		}
+
+		streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    q.cfg.Group,
+			Consumer: consumer,
+			Streams:  []string{QueueStream, ">"},
+			Count:    1,
+			Block:    q.cfg.Block,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				q.log.Warn("failed to read email queue", slog.String("error", err.Error()))
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				q.process(ctx, msg)
+			}
+		}
+	}
+}
+
+func (q *Queue) process(ctx context.Context, msg redis.XMessage) {
+	raw, _ := msg.Values[fieldJob].(string)
+
+	var job Job
+	if err := json.Unmarshal([]byte(raw), &job); err != nil {
+		q.log.Error("dropping malformed email job",
+			slog.String("id", msg.ID),
+			slog.String("error", err.Error()))
+		q.ack(ctx, msg.ID)
+		return
+	}
+
+	// Worker упал между отправкой и XACK - второй раз не отправляем
+	if status, err := q.Status(ctx, job.ID); err == nil && status.State == JobSent {
+		q.ack(ctx, msg.ID)
+		return
+	}
+
+	if job.expired(time.Now()) {
+		q.expire(ctx, msg.ID, job)
+		return
+	}
+
+	job.Attempt++
+	err := q.deliver(ctx, job)
+	if err == nil {
+		_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			q.setStatus(ctx, pipe, job.ID, JobSent, job.Attempt, "")
+			q.remove(ctx, pipe, msg.ID)
+			return nil
+		})
+		if err != nil {
+			q.log.Warn("failed to mark email job as sent", slog.String("job_id", job.ID), slog.String("error", err.Error()))
+		}
+		return
+	}
+
+	if ctx.Err() != nil {
+		// Остановка сервиса - письмо заберет другой worker после ClaimIdle
+		return
+	}
+
+	if job.Attempt >= q.cfg.MaxAttempts || errors.Is(err, errUnknownJobType) {
+		q.bury(ctx, msg.ID, job, err)
+		return
+	}
+	q.retry(ctx, msg.ID, job, err)
+}
+
+func (q *Queue) deliver(ctx context.Context, job Job) error {
+	switch job.Type {
+	case MessageVerification:
+		return q.next.SendVerificationCode(WithPhone(ctx, job.Phone), job.To, job.Name, job.Code, job.Locale)
+	case MessageNewSignIn:
+		if job.SignIn == nil {
+			return fmt.Errorf("%w: %s without sign-in details", errUnknownJobType, job.Type)
+		}
+		return q.next.SendNewSignIn(WithPhone(ctx, job.Phone), job.To, job.Name, *job.SignIn, job.Locale)
+	default:
+		return fmt.Errorf("%w: %s", errUnknownJobType, job.Type)
+	}
+}
+
+func (q *Queue) retry(ctx context.Context, msgID string, job Job, cause error) {
+	delay := q.backoff(job.Attempt)
+	if job.expired(time.Now().Add(delay)) {
+		// Повтор опоздал бы: код истечет раньше
+		q.expire(ctx, msgID, job)
+		return
+	}
+
+	raw, err := json.Marshal(job)
+	if err != nil {
+		q.bury(ctx, msgID, job, err)
+		return
+	}
+
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, retryKey, redis.Z{Score: float64(time.Now().Add(delay).UnixMilli()), Member: raw})
+		q.setStatus(ctx, pipe, job.ID, JobRetrying, job.Attempt, cause.Error())
+		q.remove(ctx, pipe, msgID)
+		return nil
+	})
+	if err != nil {
+		q.log.Warn("failed to schedule email retry", slog.String("job_id", job.ID), slog.String("error", err.Error()))
+		return
+	}
+
+	q.log.Warn("email delivery failed, will retry",
+		slog.String("job_id", job.ID),
+		slog.Int("attempt", job.Attempt),
+		slog.Duration("delay", delay),
+		slog.String("error", cause.Error()))
+}
+
+func (q *Queue) bury(ctx context.Context, msgID string, job Job, cause error) {
+	// Код в dead-letter не нужен: повторно его отправлять бессмысленно
+	dead := job
+	dead.Code = ""
+	raw, _ := json.Marshal(DeadJob{Job: dead, LastError: cause.Error(), FailedAt: time.Now().UTC()})
+
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, deadLetterKey, raw)
+		pipe.LTrim(ctx, deadLetterKey, 0, q.cfg.DeadLetterMax-1)
+		q.setStatus(ctx, pipe, job.ID, JobDead, job.Attempt, cause.Error())
+		q.remove(ctx, pipe, msgID)
+		return nil
+	})
+	if err != nil {
+		q.log.Warn("failed to move email job to dead letters", slog.String("job_id", job.ID), slog.String("error", err.Error()))
+		return
+	}
+
+	q.log.Error("email delivery failed permanently",
+		slog.String("job_id", job.ID),
+		slog.Int("attempts", job.Attempt),
+		slog.String("error", cause.Error()))
+}
+
+func (q *Queue) expire(ctx context.Context, msgID string, job Job) {
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		q.setStatus(ctx, pipe, job.ID, JobExpired, job.Attempt, "expired before delivery")
+		q.remove(ctx, pipe, msgID)
+		return nil
+	})
+	if err != nil {
+		q.log.Warn("failed to drop expired email job", slog.String("job_id", job.ID), slog.String("error", err.Error()))
+		return
+	}
+
+	q.log.Warn("email job expired before delivery",
+		slog.String("job_id", job.ID),
+		slog.Int("attempts", job.Attempt))
+}
+
+func (j Job) expired(at time.Time) bool {
+	return !j.ExpiresAt.IsZero() && !at.Before(j.ExpiresAt)
+}
+
+// promoteScript - атомарно переносит наступившие повторы обратно в поток
+const promoteScript = `
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, job in ipairs(due) do
+	redis.call('XADD', KEYS[2], '*', ARGV[3], job)
+	redis.call('ZREM', KEYS[1], job)
+end
+return #due
+`
+
+func (q *Queue) schedule(ctx context.Context) {
+	ticker := time.NewTicker(q.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := q.client.Eval(ctx, promoteScript, []string{retryKey, QueueStream},
+				time.Now().UnixMilli(), 100, fieldJob).Err()
+			if err != nil && ctx.Err() == nil {
+				q.log.Warn("failed to promote email retries", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+func (q *Queue) backoff(attempt int) time.Duration {
+	delay := q.cfg.BaseBackoff
+	for i := 1; i < attempt && delay < q.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, q.cfg.MaxBackoff)
+}
+
+func (q *Queue) setStatus(ctx context.Context, pipe redis.Pipeliner, id string, state JobState, attempts int, lastError string) {
+	pipe.HSet(ctx, statusKey(id),
+		"state", string(state),
+		"attempts", attempts,
+		"last_error", lastError,
+		"updated_at", time.Now().UTC().Format(time.RFC3339Nano))
+	pipe.Expire(ctx, statusKey(id), q.cfg.StatusTTL)
+}
+
+// remove - XACK и XDEL: обработанное письмо с адресом и кодом не остается в потоке
+func (q *Queue) remove(ctx context.Context, pipe redis.Pipeliner, id string) {
+	pipe.XAck(ctx, QueueStream, q.cfg.Group, id)
+	pipe.XDel(ctx, QueueStream, id)
+}
+
+func (q *Queue) ack(ctx context.Context, id string) {
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		q.remove(ctx, pipe, id)
+		return nil
+	})
+	if err != nil {
+		q.log.Warn("failed to ack email job", slog.String("id", id), slog.String("error", err.Error()))
+	}
+}
+
+func statusKey(id string) string {
+	return "email:status:" + id
+}
@@ -2,15 +2,33 @@ package sender
 
 import (
 	"auth/internal/config"
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"html/template"
 	"log"
-	"net/smtp"
+	"time"
 )
 
+// ErrNotSent - письмо не отправлено и не поставлено в очередь
+var ErrNotSent = errors.New("verification email could not be sent")
+
 type EmailSender interface {
-	SendVerificationCode(toEmail, userName, code string) error
+	// locale - предпочтительный язык получателя, например "ru-RU"; пустой - язык по умолчанию
+	SendVerificationCode(ctx context.Context, toEmail, userName, code, locale string) error
+	// SendNewSignIn - уведомление о входе с нового устройства
+	SendNewSignIn(ctx context.Context, toEmail, userName string, signIn SignIn, locale string) error
+}
+
+// SignIn - подробности входа для письма о новом устройстве
+type SignIn struct {
+	Device    string `json:"device"`
+	UserAgent string `json:"user_agent,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	// Location - приблизительное место по IP; пустое, если неизвестно
+	Location string    `json:"location,omitempty"`
+	Time     time.Time `json:"time"`
+	// RevokeURL - ссылка "это был не я": завершает все сессии пользователя
+	RevokeURL string `json:"revoke_url"`
 }
 
 type TemplateData struct {
@@ -20,70 +38,140 @@ type TemplateData struct {
 	AppURL        string
 	SupportEmail  string
 	ExpiryMinutes int
+	SignIn        SignIn
 }
 
 type sender struct {
-	config   config.SMTPConfig
-	template *template.Template
+	*composer
+	transport *Transport
+	dkim      *DKIMSigner
 }
 
 func NewEmailSender(config config.SMTPConfig) (EmailSender, error) {
-	templatePath := "C:\\auth\\internal\\sender\\templates\\verification_inline6.html"
+	return newSender(config)
+}
 
-	tmpl, err := template.ParseFiles(templatePath)
+// NewEmailChannel - SMTP канал для Router
+func NewEmailChannel(config config.SMTPConfig) (Channel, error) {
+	return newSender(config)
+}
+
+func newSender(config config.SMTPConfig) (*sender, error) {
+	composer, err := newComposer(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse email template: %w", err)
+		return nil, err
+	}
+
+	var dkim *DKIMSigner
+	if config.DKIM.KeyPath != "" {
+		key, err := LoadDKIMKey(config.DKIM.KeyPath)
+		if err != nil {
+			return nil, err
+		}
+		if dkim, err = NewDKIMSigner(config.DKIM.Domain, config.DKIM.Selector, key); err != nil {
+			return nil, err
+		}
 	}
 
 	return &sender{
-		config:   config,
-		template: tmpl,
+		composer:  composer,
+		transport: NewTransport(transportConfig(config)),
+		dkim:      dkim,
 	}, nil
 }
 
-func (s *sender) SendVerificationCode(toEmail, userName, code string) error {
-	log.Printf("[SMTP] Sending verification code to: %s, code: %s", toEmail, code)
-
-	data := TemplateData{
-		UserName:      userName,
-		Code:          code,
-		AppName:       s.config.FromName,
-		AppURL:        s.config.AppURL,
-		SupportEmail:  s.config.SupportEmail,
-		ExpiryMinutes: 3,
+// transportConfig - TLSMode по умолчанию выводится из UseTLS и порта
+func transportConfig(cfg config.SMTPConfig) TransportConfig {
+	mode := TLSMode(cfg.TLSMode)
+	if mode == "" {
+		switch {
+		case !cfg.UseTLS:
+			mode = TLSNone
+		case cfg.Port == "465":
+			mode = TLSImplicit
+		default:
+			mode = TLSStartTLS
+		}
 	}
 
-	var body bytes.Buffer
-	if err := s.template.Execute(&body, data); err != nil {
-		return fmt.Errorf("failed to render email template: %w", err)
+	timeout := time.Duration(cfg.Timeout) * time.Second
+
+	return TransportConfig{
+		Host:           cfg.Host,
+		Port:           cfg.Port,
+		Username:       cfg.Username,
+		Password:       cfg.Password,
+		TLSMode:        mode,
+		AuthMechanism:  cfg.AuthMechanism,
+		DialTimeout:    timeout,
+		CommandTimeout: timeout,
 	}
+}
 
+func (s *sender) Close() error {
+	return s.transport.Close()
+}
 
+func (s *sender) Name() string {
+	return "email"
+}
 
-	return s.sendEmail(toEmail, body.String())
+func (s *sender) SendVerificationCode(ctx context.Context, toEmail, userName, code, locale string) error {
+	return s.Deliver(ctx, Notification{
+		Type:   MessageVerification,
+		Email:  toEmail,
+		Name:   userName,
+		Code:   code,
+		Locale: locale,
+	})
 }
 
-func (s *sender) sendEmail(to,  body string) error {
-	log.Printf("[SMTP] Preparing email to: %s", to)
-	log.Printf("[SMTP] SMTP: %s:%s", s.config.Host, s.config.Port)
+func (s *sender) SendNewSignIn(ctx context.Context, toEmail, userName string, signIn SignIn, locale string) error {
+	return s.Deliver(ctx, Notification{
+		Type:   MessageNewSignIn,
+		Email:  toEmail,
+		Name:   userName,
+		SignIn: signIn,
+		Locale: locale,
+	})
+}
+
+func (s *sender) Deliver(ctx context.Context, n Notification) error {
+	if n.Email == "" {
+		return ErrNoAddress
+	}
+	log.Printf("[SMTP] Sending %s to: %s", n.Type, n.Email)
+
+	message, err := s.compose(n)
+	if err != nil {
+		return err
+	}
 
-	msg := fmt.Sprintf("From: %s <%s>\r\n", s.config.FromName, s.config.FromEmail)
-	msg += fmt.Sprintf("To: %s\r\n", to)
-	msg += fmt.Sprintf("Subject: %s\r\n", "Ваш код подтверждения")
-	msg += "MIME-version: 1.0;\r\n"
-	msg += "Content-Type: text/html; charset=\"UTF-8\";\r\n"
-	msg += "\r\n" + body + "\r\n"
+	return s.sendEmail(ctx, message)
+}
+
+func (s *sender) sendEmail(ctx context.Context, message *Message) error {
+	to := message.Recipients()
+	log.Printf("[SMTP] Preparing email to: %v", to)
+	log.Printf("[SMTP] SMTP: %s:%s", s.config.Host, s.config.Port)
 
-	smtpAddr := fmt.Sprintf("%s:%s", s.config.Host, s.config.Port)
-	auth := smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+	msg, err := message.Bytes()
+	if err != nil {
+		return fmt.Errorf("failed to build email: %w", err)
+	}
+	if s.dkim != nil {
+		if msg, err = s.dkim.Sign(msg); err != nil {
+			return fmt.Errorf("failed to sign email: %w", err)
+		}
+	}
 
 	log.Printf("[SMTP] Attempting to send...")
-	err := smtp.SendMail(smtpAddr, auth, s.config.FromEmail, []string{to}, []byte(msg))
+	err = s.transport.Send(ctx, s.config.FromEmail, to, msg)
 	if err != nil {
 		log.Printf("[SMTP] ERROR sending: %v", err)
 		return fmt.Errorf("failed to send email: %w", err)
 	}
 
-	log.Printf("[SMTP] Email sent successfully to: %s", to)
+	log.Printf("[SMTP] Email sent successfully to: %v", to)
 	return nil
 }
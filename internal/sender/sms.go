@@ -0,0 +1,101 @@
+package sender
+
+import (
+	"auth/internal/config"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// SMSProvider - шлюз отправки SMS
+type SMSProvider interface {
+	SendSMS(ctx context.Context, phone, text string) error
+}
+
+// SMSChannel - текст из шаблона sms.txt через SMSProvider
+type SMSChannel struct {
+	*composer
+	provider SMSProvider
+}
+
+func NewSMSChannel(cfg config.SMTPConfig, provider SMSProvider) (*SMSChannel, error) {
+	composer, err := newComposer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &SMSChannel{composer: composer, provider: provider}, nil
+}
+
+func (c *SMSChannel) Name() string {
+	return "sms"
+}
+
+func (c *SMSChannel) Deliver(ctx context.Context, n Notification) error {
+	if n.Phone == "" {
+		return ErrNoAddress
+	}
+	if !ValidPhone(n.Phone) {
+		return fmt.Errorf("%w: invalid phone number", ErrNoAddress)
+	}
+
+	rendered, err := c.render(n)
+	if err != nil {
+		return err
+	}
+	if rendered.SMS == "" {
+		return fmt.Errorf("no sms template for %s (locale %q)", n.Type, rendered.Locale)
+	}
+
+	return c.provider.SendSMS(ctx, n.Phone, rendered.SMS)
+}
+
+// HTTPSMSProvider - эталонная реализация: POST {"to","text"} на webhook шлюза
+type HTTPSMSProvider struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func NewHTTPSMSProvider(url, token string, timeout time.Duration) *HTTPSMSProvider {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &HTTPSMSProvider{url: url, token: token, client: &http.Client{Timeout: timeout}}
+}
+
+type smsRequest struct {
+	To   string `json:"to"`
+	Text string `json:"text"`
+}
+
+func (p *HTTPSMSProvider) SendSMS(ctx context.Context, phone, text string) error {
+	body, err := json.Marshal(smsRequest{To: phone, Text: text})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create sms request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send sms: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("sms gateway responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
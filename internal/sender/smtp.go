@@ -0,0 +1,342 @@
+package sender
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSMode - как защищается соединение с SMTP сервером
+type TLSMode string
+
+const (
+	// TLSStartTLS - STARTTLS обязателен, без него письмо не отправляется
+	TLSStartTLS TLSMode = "starttls"
+	// TLSImplicit - TLS с первого байта (обычно порт 465)
+	TLSImplicit TLSMode = "implicit"
+	// TLSNone - открытый текст, только для локальных relay
+	TLSNone TLSMode = "none"
+)
+
+const (
+	AuthPlain   = "PLAIN"
+	AuthLogin   = "LOGIN"
+	AuthCRAMMD5 = "CRAM-MD5"
+)
+
+var (
+	ErrStartTLSUnsupported = errors.New("smtp server does not support STARTTLS")
+	ErrAuthUnsupported     = errors.New("smtp server does not support a usable auth mechanism")
+)
+
+type TransportConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	TLSMode  TLSMode
+	// AuthMechanism - PLAIN | LOGIN | CRAM-MD5; пустой - выбор по EHLO
+	AuthMechanism  string
+	DialTimeout    time.Duration
+	CommandTimeout time.Duration
+	// IdleTimeout - сколько держать соединение между письмами
+	IdleTimeout time.Duration
+	LocalName   string
+	// TLSConfig - nil означает проверку сертификата по Host
+	TLSConfig *tls.Config
+}
+
+// Transport - SMTP клиент с одним переиспользуемым соединением
+type Transport struct {
+	cfg TransportConfig
+
+	mu       sync.Mutex
+	client   *smtp.Client
+	conn     *deadlineConn
+	lastUsed time.Time
+}
+
+func NewTransport(cfg TransportConfig) *Transport {
+	if cfg.TLSMode == "" {
+		cfg.TLSMode = TLSStartTLS
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 10 * time.Second
+	}
+	if cfg.CommandTimeout <= 0 {
+		cfg.CommandTimeout = 10 * time.Second
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = 30 * time.Second
+	}
+	if cfg.LocalName == "" {
+		cfg.LocalName = "localhost"
+	}
+	if cfg.TLSConfig == nil {
+		cfg.TLSConfig = &tls.Config{ServerName: cfg.Host, MinVersion: tls.VersionTLS12}
+	}
+
+	return &Transport{cfg: cfg}
+}
+
+// Send - одно письмо; при ошибке соединение закрывается, следующее письмо откроет новое
+func (t *Transport) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.ensureConn(ctx); err != nil {
+		return err
+	}
+	t.conn.setContext(ctx)
+
+	if err := t.send(from, to, msg); err != nil {
+		t.closeConn()
+		return err
+	}
+
+	t.lastUsed = time.Now()
+	return nil
+}
+
+func (t *Transport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.client == nil {
+		return nil
+	}
+	t.conn.setContext(context.Background())
+	err := t.client.Quit()
+	t.closeConn()
+	return err
+}
+
+func (t *Transport) send(from string, to []string, msg []byte) error {
+	if err := t.client.Mail(from); err != nil {
+		return fmt.Errorf("smtp MAIL FROM: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := t.client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s: %w", rcpt, err)
+		}
+	}
+
+	w, err := t.client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("smtp write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp end of DATA: %w", err)
+	}
+	return nil
+}
+
+// ensureConn - живое соединение: старое, если оно не простаивало дольше IdleTimeout и отвечает на NOOP
+func (t *Transport) ensureConn(ctx context.Context) error {
+	if t.client != nil {
+		t.conn.setContext(ctx)
+		if time.Since(t.lastUsed) < t.cfg.IdleTimeout && t.client.Noop() == nil {
+			return nil
+		}
+		t.closeConn()
+	}
+
+	return t.dial(ctx)
+}
+
+func (t *Transport) dial(ctx context.Context) error {
+	addr := net.JoinHostPort(t.cfg.Host, t.cfg.Port)
+
+	dialer := &net.Dialer{Timeout: t.cfg.DialTimeout}
+	raw, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("smtp dial %s: %w", addr, err)
+	}
+
+	conn := &deadlineConn{Conn: raw, timeout: t.cfg.CommandTimeout}
+	conn.setContext(ctx)
+
+	// smtp.Client считает соединение защищенным, только если получил *tls.Conn
+	var netConn net.Conn = conn
+	if t.cfg.TLSMode == TLSImplicit {
+		tlsConn := tls.Client(conn, t.cfg.TLSConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			raw.Close()
+			return fmt.Errorf("smtp tls handshake: %w", err)
+		}
+		netConn = tlsConn
+	}
+
+	client, err := smtp.NewClient(netConn, t.cfg.Host)
+	if err != nil {
+		raw.Close()
+		return fmt.Errorf("smtp greeting: %w", err)
+	}
+
+	if err := t.handshake(client); err != nil {
+		client.Close()
+		return err
+	}
+
+	t.client = client
+	t.conn = conn
+	return nil
+}
+
+func (t *Transport) handshake(client *smtp.Client) error {
+	if err := client.Hello(t.cfg.LocalName); err != nil {
+		return fmt.Errorf("smtp EHLO: %w", err)
+	}
+
+	if t.cfg.TLSMode == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return ErrStartTLSUnsupported
+		}
+		if err := client.StartTLS(t.cfg.TLSConfig); err != nil {
+			return fmt.Errorf("smtp STARTTLS: %w", err)
+		}
+	}
+
+	if t.cfg.Username == "" {
+		return nil
+	}
+
+	auth, err := t.auth(client)
+	if err != nil {
+		return err
+	}
+	if err := client.Auth(auth); err != nil {
+		return fmt.Errorf("smtp AUTH: %w", err)
+	}
+	return nil
+}
+
+// auth - механизм из конфига или лучший из объявленных сервером
+func (t *Transport) auth(client *smtp.Client) (smtp.Auth, error) {
+	_, advertised := client.Extension("AUTH")
+	supported := strings.Fields(strings.ToUpper(advertised))
+
+	var candidates []string
+	switch {
+	case t.cfg.AuthMechanism != "":
+		candidates = []string{strings.ToUpper(t.cfg.AuthMechanism)}
+	case t.cfg.TLSMode == TLSNone:
+		// Без TLS предпочитаем механизм, не передающий пароль
+		candidates = []string{AuthCRAMMD5, AuthPlain, AuthLogin}
+	default:
+		candidates = []string{AuthPlain, AuthLogin, AuthCRAMMD5}
+	}
+
+	for _, mechanism := range candidates {
+		if !contains(supported, mechanism) {
+			continue
+		}
+		switch mechanism {
+		case AuthPlain:
+			return smtp.PlainAuth("", t.cfg.Username, t.cfg.Password, t.cfg.Host), nil
+		case AuthLogin:
+			return &loginAuth{username: t.cfg.Username, password: t.cfg.Password, host: t.cfg.Host}, nil
+		case AuthCRAMMD5:
+			return smtp.CRAMMD5Auth(t.cfg.Username, t.cfg.Password), nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: server offers %q", ErrAuthUnsupported, advertised)
+}
+
+func (t *Transport) closeConn() {
+	if t.client != nil {
+		t.client.Close()
+	}
+	t.client = nil
+	t.conn = nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// loginAuth - AUTH LOGIN; как и PlainAuth, без TLS разрешен только для localhost
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:", "user name", "username":
+		return []byte(a.username), nil
+	case "password:", "password":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN challenge: %q", fromServer)
+	}
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
+
+// deadlineConn - каждая операция чтения/записи получает CommandTimeout, но не дольше дедлайна ctx
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func (c *deadlineConn) setContext(ctx context.Context) {
+	deadline, _ := ctx.Deadline()
+	c.mu.Lock()
+	c.deadline = deadline
+	c.mu.Unlock()
+}
+
+func (c *deadlineConn) extend() {
+	d := time.Now().Add(c.timeout)
+	c.mu.Lock()
+	if !c.deadline.IsZero() && c.deadline.Before(d) {
+		d = c.deadline
+	}
+	c.mu.Unlock()
+	c.Conn.SetDeadline(d)
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	c.extend()
+	return c.Conn.Read(b)
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	c.extend()
+	return c.Conn.Write(b)
+}
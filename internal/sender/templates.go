@@ -0,0 +1,239 @@
+package sender
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+)
+
+// MessageType - набор шаблонов templates/<type>/<locale>/
+type MessageType string
+
+const (
+	MessageVerification MessageType = "verification"
+	MessageNewSignIn    MessageType = "new_sign_in"
+)
+
+// fallbackLocale - последняя ступень цепочки локалей
+const fallbackLocale = "en"
+
+const (
+	subjectFile = "subject.txt"
+	htmlFile    = "body.html"
+	// textFile - необязательный; без него письмо уходит только в HTML
+	textFile = "body.txt"
+	// smsFile - необязательный текст для SMS канала
+	smsFile = "sms.txt"
+)
+
+//go:embed templates
+var embedded embed.FS
+
+var ErrTemplateNotFound = errors.New("email template not found")
+
+// Templates - шаблоны писем: сначала каталог override, затем встроенные
+type Templates struct {
+	sources       []fs.FS
+	defaultLocale string
+
+	mu    sync.RWMutex
+	cache map[string]*templateSet
+}
+
+type templateSet struct {
+	subject *texttemplate.Template
+	html    *htmltemplate.Template
+	text    *texttemplate.Template
+	sms     *texttemplate.Template
+}
+
+// Rendered - готовые части письма
+type Rendered struct {
+	Locale  string
+	Subject string
+	HTML    string
+	Text    string
+	SMS     string
+}
+
+// NewTemplates - overrideDir может быть пустым; структура каталога та же, что у встроенных шаблонов
+func NewTemplates(overrideDir, defaultLocale string) (*Templates, error) {
+	builtin, err := fs.Sub(embedded, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []fs.FS{builtin}
+	if overrideDir != "" {
+		info, err := os.Stat(overrideDir)
+		if err != nil {
+			return nil, fmt.Errorf("email templates dir: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("email templates dir: %s is not a directory", overrideDir)
+		}
+		sources = append([]fs.FS{os.DirFS(overrideDir)}, sources...)
+	}
+
+	return &Templates{
+		sources:       sources,
+		defaultLocale: normalizeLocale(defaultLocale),
+		cache:         make(map[string]*templateSet),
+	}, nil
+}
+
+// Render - первый найденный по цепочке локалей набор шаблонов
+func (t *Templates) Render(typ MessageType, locale string, data any) (*Rendered, error) {
+	for _, candidate := range LocaleChain(locale, t.defaultLocale) {
+		set, err := t.load(typ, candidate)
+		if errors.Is(err, ErrTemplateNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var subject, html, text, sms bytes.Buffer
+		if err := set.subject.Execute(&subject, data); err != nil {
+			return nil, fmt.Errorf("render %s/%s subject: %w", typ, candidate, err)
+		}
+		if err := set.html.Execute(&html, data); err != nil {
+			return nil, fmt.Errorf("render %s/%s body: %w", typ, candidate, err)
+		}
+		if set.text != nil {
+			if err := set.text.Execute(&text, data); err != nil {
+				return nil, fmt.Errorf("render %s/%s text body: %w", typ, candidate, err)
+			}
+		}
+		if set.sms != nil {
+			if err := set.sms.Execute(&sms, data); err != nil {
+				return nil, fmt.Errorf("render %s/%s sms: %w", typ, candidate, err)
+			}
+		}
+
+		return &Rendered{
+			Locale:  candidate,
+			Subject: strings.TrimSpace(subject.String()),
+			HTML:    html.String(),
+			Text:    text.String(),
+			SMS:     strings.TrimSpace(sms.String()),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s (locale %q)", ErrTemplateNotFound, typ, locale)
+}
+
+func (t *Templates) load(typ MessageType, locale string) (*templateSet, error) {
+	key := string(typ) + "/" + locale
+
+	t.mu.RLock()
+	set, ok := t.cache[key]
+	t.mu.RUnlock()
+	if ok {
+		return set, nil
+	}
+
+	subject, _, err := t.readFile(key + "/" + subjectFile)
+	if err != nil {
+		return nil, err
+	}
+	html, source, err := t.readFile(key + "/" + htmlFile)
+	if err != nil {
+		return nil, err
+	}
+
+	set = &templateSet{}
+	if set.subject, err = texttemplate.New(subjectFile).Parse(string(subject)); err != nil {
+		return nil, fmt.Errorf("parse %s/%s: %w", key, subjectFile, err)
+	}
+	if set.html, err = htmltemplate.New(htmlFile).Parse(string(html)); err != nil {
+		return nil, fmt.Errorf("parse %s/%s: %w", key, htmlFile, err)
+	}
+
+	// body.txt берется только из того же источника, что и body.html,
+	// иначе переопределенный HTML ушел бы со встроенным текстом
+	text, err := fs.ReadFile(source, key+"/"+textFile)
+	switch {
+	case err == nil:
+		if set.text, err = texttemplate.New(textFile).Parse(string(text)); err != nil {
+			return nil, fmt.Errorf("parse %s/%s: %w", key, textFile, err)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("read email template %s/%s: %w", key, textFile, err)
+	}
+
+	sms, _, err := t.readFile(key + "/" + smsFile)
+	switch {
+	case err == nil:
+		if set.sms, err = texttemplate.New(smsFile).Parse(string(sms)); err != nil {
+			return nil, fmt.Errorf("parse %s/%s: %w", key, smsFile, err)
+		}
+	case !errors.Is(err, ErrTemplateNotFound):
+		return nil, err
+	}
+
+	t.mu.Lock()
+	t.cache[key] = set
+	t.mu.Unlock()
+
+	return set, nil
+}
+
+// readFile - файл из первого источника, где он есть
+func (t *Templates) readFile(name string) ([]byte, fs.FS, error) {
+	for _, source := range t.sources {
+		data, err := fs.ReadFile(source, name)
+		if err == nil {
+			return data, source, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, fmt.Errorf("read email template %s: %w", name, err)
+		}
+	}
+	return nil, nil, ErrTemplateNotFound
+}
+
+// LocaleChain - "ru-RU" -> ["ru-ru", "ru", default, "en"] без повторов
+func LocaleChain(locale, defaultLocale string) []string {
+	chain := make([]string, 0, 4)
+	add := func(l string) {
+		if l == "" {
+			return
+		}
+		for _, existing := range chain {
+			if existing == l {
+				return
+			}
+		}
+		chain = append(chain, l)
+	}
+
+	locale = normalizeLocale(locale)
+	add(locale)
+	if base, _, found := strings.Cut(locale, "-"); found {
+		add(base)
+	}
+	add(normalizeLocale(defaultLocale))
+	add(fallbackLocale)
+
+	return chain
+}
+
+func normalizeLocale(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	locale = strings.ReplaceAll(locale, "_", "-")
+	// Имя локали используется как путь - отсекаем все, кроме букв, цифр и '-'
+	for _, r := range locale {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return ""
+		}
+	}
+	return locale
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"auth/internal/audit"
+	"auth/internal/provider"
+	"context"
+	"errors"
+)
+
+// record - пишет событие в аудит. Ошибка записи не прерывает запрос.
+func (a *Auth) record(ctx context.Context, rec audit.Record) {
+	rec.IP, rec.UserAgent = clientInfo(ctx)
+
+	if err := a.audit.Write(ctx, rec); err != nil {
+		a.log.Error("failed to write audit record",
+			"event", rec.Event,
+			"error", err)
+	}
+}
+
+// failureReason - причина отказа для аудита без текста ошибки,
+// т.к. в нем могут оказаться данные запроса
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, provider.ErrUserNotFound):
+		return "user_not_found"
+	case errors.Is(err, provider.ErrMissingData):
+		return "invalid_credentials"
+	case errors.Is(err, provider.ErrUserExists):
+		return "user_exists"
+	default:
+		return "internal"
+	}
+}
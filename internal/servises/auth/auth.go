@@ -1,10 +1,18 @@
 package auth
 
 import (
+	"auth/internal/audit"
+	"auth/internal/clients"
+	emailpolicy "auth/internal/email"
+	"auth/internal/events"
 	"auth/internal/grpc/auth"
 	"auth/internal/model"
+	pwpolicy "auth/internal/password"
+	"auth/internal/provider"
 	"auth/internal/provider/users"
+	"auth/internal/rbac"
 	"auth/internal/sender"
+	"auth/internal/sessions"
 	"auth/internal/storage"
 	"auth/internal/token"
 	"context"
@@ -13,48 +21,139 @@ import (
 	"github.com/redis/go-redis/v9"
 	"log/slog"
 	"math/rand"
-	"regexp"
+	"slices"
+	"strconv"
 	"strings"
-	"unicode"
+	"time"
 )
 
 type Auth struct {
-	provider users.Provider
-	token    token.Generate
-	redis    storage.Storage
-	sender   sender.EmailSender
-	log      slog.Logger
+	provider  users.Provider
+	token     token.Generate
+	redis     storage.Storage
+	sender    sender.EmailSender
+	audit     audit.Sink
+	domains   DomainPolicy
+	emails    *emailpolicy.Canonicalizer
+	passwords PasswordPolicy
+	roles     *rbac.Roles
+	// legacySessions - принимать старые ID сессий "userID:deviceID"
+	legacySessions bool
+	// refreshMode - token.RefreshOpaque или JWT (token.RefreshJWT, по умолчанию)
+	refreshMode string
+	sessions    *sessions.Policy
+	// signIn - nil: история входов не ведется, писем о новых устройствах нет
+	signIn *SignInAlerts
+	// clients - nil: реестра нет, токены одинаковые для всех клиентов
+	clients       clients.Registry
+	defaultClient string
+	log           slog.Logger
 }
 
-func NewServer(provider users.Provider, token token.Generate, redis storage.Storage, sender sender.EmailSender, log slog.Logger) auth.Auth {
-	return &Auth{
-		provider: provider,
-		token:    token,
-		redis:    redis,
-		sender:   sender,
-		log:      log,
+func NewServer(provider users.Provider, token token.Generate, redis storage.Storage, sender sender.EmailSender, log slog.Logger, opts ...Option) auth.Auth {
+	a := &Auth{
+		provider:       provider,
+		token:          token,
+		redis:          redis,
+		sender:         sender,
+		audit:          audit.NopSink{},
+		domains:        emailpolicy.DefaultPolicy(),
+		emails:         emailpolicy.NewCanonicalizer(emailpolicy.CanonicalConfig{}),
+		passwords:      pwpolicy.DefaultPolicy(),
+		roles:          &rbac.Roles{},
+		legacySessions: true,
+		sessions:       &sessions.Policy{},
+		log:            log,
 	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a
 }
 
 func (a *Auth) Login(ctx context.Context, email string, password string, deviceID string) (*model.Token, error) {
-	// 1. Аутентификация пользователя
-	user, err := a.provider.LoginUsers(ctx, email, password)
+	// 1. Клиентское приложение - до проверки пароля, как invalid_client в OAuth
+	canonical := a.emails.Canonical(email)
+	client, err := a.appClient(ctx, clients.GrantPassword, "")
+	if err != nil {
+		a.log.Warn("client rejected",
+			"client_id", clientID(ctx),
+			"device_id", deviceID,
+			"error", err)
+		a.record(ctx, audit.Record{
+			Event:     audit.EventLogin,
+			Outcome:   audit.OutcomeFailure,
+			EmailHash: audit.HashEmail(canonical),
+			DeviceID:  deviceID,
+			Reason:    clientReason(err),
+		})
+		return nil, err
+	}
+
+	// Аутентификация пользователя по канонической форме адреса
+	user, err := a.provider.LoginUsers(ctx, canonical, password)
+	if (errors.Is(err, provider.ErrMissingData) || errors.Is(err, provider.ErrUserNotFound)) && canonical != email {
+		// Аккаунты, созданные до канонизации, хранятся в том виде, как их ввели:
+		// по канонической форме такой аккаунт либо не найдется, либо пароль не совпадет
+		user, err = a.provider.LoginUsers(ctx, email, password)
+	}
 	if err != nil {
 		a.log.Error("login failed", "email", email, "error", err)
+		a.record(ctx, audit.Record{
+			Event:     audit.EventLogin,
+			Outcome:   audit.OutcomeFailure,
+			EmailHash: audit.HashEmail(canonical),
+			DeviceID:  deviceID,
+			Reason:    failureReason(err),
+		})
 		return nil, err
 	}
 
-	// 2. Создаем сессию
-	session := fmt.Sprintf("%s:%s", user.UserID, deviceID)
+	// 2. Создаем сессию с новым непрозрачным ID; срок и лимит - по роли и клиенту
+	sess := a.newSession(ctx, user.UserID, deviceID)
+	if client != nil {
+		sess.ClientID = client.ID
+	}
+	session := sess.ID
+	limits := a.sessions.For(user.Role, sess.ClientID)
+	deadline := limits.Deadline(sess.CreatedAt, sess.LastSeenAt)
+
+	if err = a.limitSessions(ctx, user.UserID, limits.MaxSessions); err != nil {
+		a.log.Warn("session limit reached",
+			"user_id", user.UserID,
+			"device_id", deviceID,
+			"error", err)
+		a.record(ctx, audit.Record{
+			Event:     audit.EventLogin,
+			Outcome:   audit.OutcomeFailure,
+			UserID:    user.UserID,
+			EmailHash: audit.HashEmail(canonical),
+			DeviceID:  deviceID,
+			Reason:    "session_limit",
+		})
+		if errors.Is(err, sessions.ErrTooManySessions) {
+			// on_limit: reject - новые входы закрыты, пока пользователь сам не завершит сессию
+			a.record(ctx, audit.Record{
+				Event:    audit.EventLockout,
+				Outcome:  audit.OutcomeSuccess,
+				UserID:   user.UserID,
+				DeviceID: deviceID,
+				Reason:   "session_limit",
+			})
+		}
+		return nil, err
+	}
 
-	// 3. Добавляем сессию в список сессий пользователя
-	err = a.redis.AddSession(ctx, user.UserID, deviceID)
+	// 3. Сохраняем запись сессии и добавляем ее в список сессий пользователя
+	err = a.redis.SaveSession(ctx, sess, untilDeadline(deadline))
 	if err != nil {
-		a.log.Warn("failed to add session to list",
+		a.log.Error("failed to create session",
 			"user_id", user.UserID,
 			"device_id", deviceID,
 			"error", err)
-		// Не прерываем логин, только логируем
+		return nil, fmt.Errorf("create session: %w", err)
 	}
 
 	// 4. Увеличиваем версию токенов для этой сессии
@@ -66,39 +165,51 @@ func (a *Auth) Login(ctx context.Context, email string, password string, deviceI
 		return nil, fmt.Errorf("increment token version: %w", err)
 	}
 
-	// 5. Создаем UserRefresh для генерации токенов
+	// 5. Создаем UserRefresh для генерации токенов; права - роль плюс персональные
 	userRefresh := &model.UserRefresh{
-		SessionId: session,
-		UserID:    user.UserID,
-		Version:   version,
-		Name:      user.Name,
-		Email:     user.Email,
-		Role:      user.Role,
-	}
-
-	// 6. Генерируем access token
-	accessToken, err := a.token.GenerateAccessToken(userRefresh)
+		SessionId:   session,
+		UserID:      user.UserID,
+		DeviceID:    deviceID,
+		Version:     version,
+		Name:        user.Name,
+		Email:       user.Email,
+		Role:        user.Role,
+		Permissions: a.roles.Resolve(user.Role, user.Permissions),
+	}
+
+	// 6. Генерируем access token с настройками клиента
+	accessToken, err := a.token.GenerateAccessToken(withClient(userRefresh, client))
 	if err != nil {
 		return nil, fmt.Errorf("generate access token: %w", err)
 	}
 
-	// 7. Генерируем refresh token
-	refreshToken, err := a.token.GenerateRefreshToken(session)
+	// 7. Выпускаем refresh token и сохраняем его в Redis вместе с событием входа
+	loggedIn := events.New(events.UserLoggedIn, user.UserID, map[string]string{
+		"device_id":  deviceID,
+		"session_id": session,
+	})
+	refreshToken, err := a.issueRefreshToken(events.WithEvents(ctx, loggedIn), user.UserID, session,
+		clientDeadline(client, deadline, sess.LastSeenAt))
 	if err != nil {
-		return nil, fmt.Errorf("generate refresh token: %w", err)
+		return nil, err
 	}
 
-	// 8. Сохраняем refresh token в Redis
-	err = a.redis.Save(ctx, session, refreshToken)
-	if err != nil {
-		return nil, fmt.Errorf("save refresh token: %w", err)
-	}
+	// 8. История входов, риск и письмо о новом устройстве
+	a.checkSignIn(ctx, user, sess)
 
 	a.log.Info("user logged in successfully",
 		"user_id", user.UserID,
 		"email", email,
 		"device_id", deviceID)
 
+	a.record(ctx, audit.Record{
+		Event:     audit.EventLogin,
+		Outcome:   audit.OutcomeSuccess,
+		UserID:    user.UserID,
+		EmailHash: audit.HashEmail(canonical),
+		DeviceID:  deviceID,
+	})
+
 	return &model.Token{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
@@ -107,69 +218,127 @@ func (a *Auth) Login(ctx context.Context, email string, password string, deviceI
 }
 
 func (a *Auth) RegisterNewUser(ctx context.Context, email string, name, password string) (userID string, err error) {
+	rec := audit.Record{
+		Event:     audit.EventRegister,
+		Outcome:   audit.OutcomeFailure,
+		EmailHash: audit.HashEmail(email),
+	}
 
-	if err = validateEmail(email); err != nil {
+	addr, err := a.validateEmail(ctx, email)
+	if err != nil {
+		rec.Reason = "invalid_email"
+		a.record(ctx, rec)
 		return "", err
 	}
+	rec.EmailHash = audit.HashEmail(addr.Canonical)
 
-	if err = validatePassword(password); err != nil {
+	if err = a.passwords.Check(password, addr.Display, name); err != nil {
+		rec.Reason = "invalid_password"
+		if !errors.Is(err, pwpolicy.ErrWeakPassword) {
+			rec.Reason = "internal"
+		}
+		a.record(ctx, rec)
 		return "", err
 	}
 
-	err = a.provider.Exists(ctx, email)
+	// Аккаунт, созданный до канонизации, хранится под адресом как его ввели -
+	// например John.Smith@gmail.com при канонической форме johnsmith@gmail.com
+	for _, form := range registeredForms(email, addr) {
+		if err = a.provider.Exists(ctx, form); err != nil {
+			break
+		}
+	}
 	if err != nil {
-		fmt.Println(err)
+		rec.Reason = failureReason(err)
+		a.record(ctx, rec)
 		return "", err
 	}
 
-	session := fmt.Sprintf("user:%s", email)
+	session := fmt.Sprintf("user:%s", addr.Canonical)
 
 	code := generateCode()
 
 	TempUser := model.UserTemporary{
-		SessionId: session,
-		Code:      code,
-		Name:      name,
-		Email:     email,
-		Password:  password,
+		SessionId:    session,
+		Code:         code,
+		Name:         name,
+		Email:        addr.Canonical,
+		DisplayEmail: addr.Display,
+		Password:     password,
 	}
 
 	err = a.redis.SaveTemporarySession(ctx, &TempUser)
 	if err != nil {
+		rec.Reason = "internal"
+		a.record(ctx, rec)
 		return "", err
 	}
 
-	go func() {
-		err = a.sender.SendVerificationCode(email, name, code)
-		if err != nil {
-			return
-		}
-	}()
+	// Ответ уходит только после того, как письмо надежно поставлено в очередь.
+	// Код подтверждает владение адресом, поэтому идет только на email: телефон
+	// из запроса ничем не подтвержден
+	err = a.sender.SendVerificationCode(ctx, addr.Mailbox(), name, code, clientLocale(ctx))
+	if err != nil {
+		a.log.Error("failed to enqueue verification email", slog.String("error", err.Error()))
+		rec.Reason = "internal"
+		a.record(ctx, rec)
+		return "", fmt.Errorf("%w: %w", sender.ErrNotSent, err)
+	}
+
+	rec.Outcome = audit.OutcomeSuccess
+	a.record(ctx, rec)
 
 	return session, nil
 }
 
 func (a *Auth) VerifyEmail(ctx context.Context, session string, code string) (userID string, err error) {
 
+	rec := audit.Record{
+		Event:   audit.EventVerifyEmail,
+		Outcome: audit.OutcomeFailure,
+	}
+
 	user, err := a.redis.GetTemporarySession(ctx, session)
 	if err != nil {
+		rec.Reason = "session_expired"
+		a.record(ctx, rec)
 		return "", errors.New("operations timed out")
 	}
+	rec.EmailHash = audit.HashEmail(user.Email)
 
 	if user.Code != code {
+		rec.Reason = "invalid_code"
+		a.record(ctx, rec)
 		return "", errors.New("invalid code")
 	}
 
-	id, err := a.provider.RegisterUsers(ctx, user.Email, user.Name, user.Password)
+	id, err := a.provider.RegisterUsers(ctx, user.Email, user.DisplayEmail, user.Name, user.Password)
 	if err != nil {
+		rec.Reason = failureReason(err)
+		a.record(ctx, rec)
 		return "", err
 	}
+	rec.UserID = id
+
+	registered := events.New(events.UserRegistered, id, map[string]string{
+		"email":         user.Email,
+		"display_email": user.DisplayEmail,
+		"name":          user.Name,
+	})
+	verified := events.New(events.EmailVerified, id, map[string]string{
+		"email": user.Email,
+	})
 
-	err = a.redis.DeleteTemporarySession(ctx, session)
+	err = a.redis.DeleteTemporarySession(events.WithEvents(ctx, registered, verified), session)
 	if err != nil {
+		rec.Reason = "internal"
+		a.record(ctx, rec)
 		return "", err
 	}
 
+	rec.Outcome = audit.OutcomeSuccess
+	a.record(ctx, rec)
+
 	return id, nil
 }
 
@@ -178,84 +347,156 @@ func (a *Auth) GetRefreshToken(ctx context.Context, refreshToken string) (*model
 		return nil, fmt.Errorf("refresh token is empty")
 	}
 
-	// 1. Верифицируем refresh token
-	claims, err := a.token.VerifyRefreshToken(refreshToken)
+	rec := audit.Record{
+		Event:   audit.EventRefresh,
+		Outcome: audit.OutcomeFailure,
+	}
+
+	// 1-2. Находим сессию: JWT - по подписи и claims, непрозрачный токен - по хешу
+	sess, presented, err := a.refreshSession(ctx, refreshToken, &rec)
 	if err != nil {
-		if strings.Contains(err.Error(), "expired") {
-			return nil, fmt.Errorf("refresh token expired")
+		if rec.Reason != "" {
+			a.record(ctx, rec)
 		}
-		return nil, fmt.Errorf("invalid refresh token: %w", err)
+		return nil, err
 	}
+	sessionID := sess.ID
+	rec.UserID = sess.UserID
+	rec.DeviceID = sess.DeviceID
 
-	// 2. Извлекаем session из claims
-	sessionID, ok := claims["session"].(string)
-	if !ok || sessionID == "" {
-		return nil, fmt.Errorf("invalid token: missing session")
+	// Продлить сессию может только клиент, который ее открыл
+	client, err := a.appClient(ctx, clients.GrantRefreshToken, sess.ClientID)
+	if err != nil {
+		rec.Reason = clientReason(err)
+		a.record(ctx, rec)
+		return nil, err
+	}
+	if client != nil {
+		// Сессии до появления реестра привязываются к клиенту при первом refresh
+		sess.ClientID = client.ID
 	}
 
 	// 3. Проверяем в Redis
 	storedToken, err := a.redis.Get(ctx, sessionID)
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
-			return nil, fmt.Errorf("token revoked or user logged out")
+			err = a.revoked(ctx, sessionID, &rec)
+			a.record(ctx, rec)
+			return nil, err
 		}
 		return nil, fmt.Errorf("failed to validate token: %w", err)
 	}
 
-	if storedToken != refreshToken {
+	// Валидный, но уже замененный токен - повторное использование
+	if storedToken != presented {
+		rec.Event = audit.EventRefreshReuse
+		rec.Reason = "token_rotated"
+		a.record(ctx, rec)
 		return nil, fmt.Errorf("invalid refresh token")
 	}
 
-	// 4. Парсим sessionID для получения userID
-	parts := strings.Split(sessionID, ":")
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid session format: %s", sessionID)
-	}
-	userID := parts[0]
-
-	// 5. Получаем данные пользователя
-	user, err := a.provider.FindOneUsers(ctx, userID)
+	// 4. Получаем данные пользователя
+	user, err := a.provider.FindOneUsers(ctx, sess.UserID)
 	if err != nil {
+		rec.Reason = failureReason(err)
+		a.record(ctx, rec)
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	// 6. Увеличиваем версию токенов для этой сессии
+	// 5. Абсолютный срок и бездействие - по текущей политике для роли и клиента
+	now := time.Now().UTC()
+	limits := a.sessions.For(user.Role, sess.ClientID)
+	if limits.Expired(sess.CreatedAt, sess.LastSeenAt, now) {
+		a.endSession(ctx, sess)
+		rec.Reason = "session_expired"
+		a.record(ctx, rec)
+		return nil, fmt.Errorf("session expired")
+	}
+
+	// Забираем токен: сравнение и удаление атомарны, поэтому второй одновременный
+	// refresh тем же токеном уже не пройдет. Если новый токен так и не выпущен,
+	// старый возвращается - иначе сбой ниже разлогинил бы клиента
+	taken, err := a.redis.TakeRefreshToken(ctx, sessionID, presented)
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to validate token: %w", err)
+	}
+	if !taken {
+		rec.Event = audit.EventRefreshReuse
+		rec.Reason = "token_rotated"
+		a.record(ctx, rec)
+		return nil, fmt.Errorf("invalid refresh token")
+	}
+	rotated := false
+	defer func(sessionID string) {
+		if !rotated {
+			a.restoreRefreshToken(ctx, sessionID, refreshToken, presented)
+		}
+	}(sessionID)
+
+	// 6. Старая сессия получает новый ID; старые ключи удаляются после сохранения токена.
+	// Начало сессии переносится, иначе перевод заново отсчитывал бы max_age
+	legacy := sess
+	if legacy.Legacy {
+		sess = a.newSession(ctx, legacy.UserID, legacy.DeviceID)
+		sessionID = sess.ID
+		if !legacy.CreatedAt.IsZero() {
+			sess.CreatedAt = legacy.CreatedAt
+		}
+		if client != nil {
+			sess.ClientID = client.ID
+		}
+	}
+	sess.LastSeenAt = now
+	deadline := limits.Deadline(sess.CreatedAt, sess.LastSeenAt)
+
+	if err = a.redis.SaveSession(ctx, sess, untilDeadline(deadline)); err != nil {
+		return nil, fmt.Errorf("save session: %w", err)
+	}
+
+	// 7. Увеличиваем версию токенов для этой сессии
 	version, err := a.redis.IncrementTokenVersion(ctx, sessionID)
 	if err != nil {
 		return nil, fmt.Errorf("increment token version: %w", err)
 	}
 
-	// 7. Генерируем новый access token
+	// 8. Генерируем новый access token
 	userRefresh := &model.UserRefresh{
-		SessionId: sessionID,
-		UserID:    user.UserID,
-		Version:   version,
-		Name:      user.Name,
-		Email:     user.Email,
-		Role:      user.Role,
+		SessionId:   sessionID,
+		UserID:      user.UserID,
+		DeviceID:    sess.DeviceID,
+		Version:     version,
+		Name:        user.Name,
+		Email:       user.Email,
+		Role:        user.Role,
+		Permissions: a.roles.Resolve(user.Role, user.Permissions),
 	}
 
-	newAccessToken, err := a.token.GenerateAccessToken(userRefresh)
+	newAccessToken, err := a.token.GenerateAccessToken(withClient(userRefresh, client))
 	if err != nil {
 		return nil, fmt.Errorf("generate access token: %w", err)
 	}
 
-	// 8. Генерируем новый refresh token
-	newRefreshToken, err := a.token.GenerateRefreshToken(sessionID)
+	// 9. Выпускаем и сохраняем новый refresh token
+	newRefreshToken, err := a.issueRefreshToken(ctx, user.UserID, sessionID, clientDeadline(client, deadline, now))
 	if err != nil {
-		return nil, fmt.Errorf("generate new refresh token: %w", err)
+		return nil, err
 	}
+	rotated = true
 
-	// 9. Сохраняем новый refresh token
-	err = a.redis.Save(ctx, sessionID, newRefreshToken)
-	if err != nil {
-		return nil, fmt.Errorf("failed to save new refresh token: %w", err)
+	if legacy.Legacy {
+		a.endSession(ctx, legacy)
+		a.log.Info("legacy session migrated",
+			"user_id", user.UserID,
+			"session", sessionID)
 	}
 
 	a.log.Info("token refreshed successfully",
 		"user_id", user.UserID,
 		"session", sessionID)
 
+	rec.Outcome = audit.OutcomeSuccess
+	a.record(ctx, rec)
+
 	return &model.Token{
 		AccessToken:  newAccessToken,
 		RefreshToken: newRefreshToken,
@@ -268,29 +509,38 @@ func (a *Auth) Logout(ctx context.Context, accessToken string) error {
 	claims, err := a.token.VerifyAccessToken(accessToken)
 	if err != nil {
 		a.log.Error("invalid access token", "error", err)
+		a.record(ctx, audit.Record{
+			Event:   audit.EventLogout,
+			Outcome: audit.OutcomeFailure,
+			Reason:  "invalid_token",
+		})
 		return fmt.Errorf("invalid access token: %w", err)
 	}
 
 	// 2. Извлекаем session ID
-	sessionID, ok := claims["session"].(string)
-	if !ok || sessionID == "" {
+	sessionID := claims.Session
+	if sessionID == "" {
 		return fmt.Errorf("invalid token: missing session")
 	}
 
-	// 3. Парсим sessionID для получения userID и deviceID
-	parts := strings.Split(sessionID, ":")
-	if len(parts) != 2 {
-		return fmt.Errorf("invalid session format: %s", sessionID)
+	// 3. Находим сессию: владелец и устройство берутся из записи
+	sess, err := a.session(ctx, sessionID, claims.UserID())
+	if err != nil {
+		if errors.Is(err, errSessionNotFound) {
+			a.record(ctx, audit.Record{
+				Event:   audit.EventLogout,
+				Outcome: audit.OutcomeFailure,
+				UserID:  claims.UserID(),
+				Reason:  "revoked",
+			})
+			return fmt.Errorf("session not found")
+		}
+		return fmt.Errorf("get session: %w", err)
 	}
-	userID := parts[0]
-	deviceID := parts[1]
+	userID, deviceID := sess.UserID, sess.DeviceID
 
 	// 4. Проверяем версию токена
-	versionFloat, ok := claims["ver"].(float64)
-	if !ok {
-		return fmt.Errorf("invalid version in token")
-	}
-	versionFromToken := int(versionFloat)
+	versionFromToken := claims.Version
 
 	currentVersion, err := a.redis.GetTokenVersion(ctx, sessionID)
 	if err != nil {
@@ -298,11 +548,18 @@ func (a *Auth) Logout(ctx context.Context, accessToken string) error {
 	}
 
 	if versionFromToken != currentVersion {
+		a.record(ctx, audit.Record{
+			Event:    audit.EventLogout,
+			Outcome:  audit.OutcomeFailure,
+			UserID:   userID,
+			DeviceID: deviceID,
+			Reason:   "stale_token_version",
+		})
 		return fmt.Errorf("invalid token version")
 	}
 
-	// 5. Удаляем deviceID из списка сессий пользователя
-	err = a.redis.RemoveSession(ctx, userID, deviceID)
+	// 5. Удаляем сессию из списка сессий пользователя
+	err = a.redis.RemoveSession(ctx, sess)
 	if err != nil && !errors.Is(err, redis.Nil) {
 		a.log.Warn("failed to remove session from list",
 			"user_id", userID,
@@ -311,8 +568,11 @@ func (a *Auth) Logout(ctx context.Context, accessToken string) error {
 		// Не прерываем логаут, только логируем
 	}
 
-	// 6. Удаляем refresh token
-	err = a.redis.DeleteRefreshToken(ctx, sessionID)
+	// 6. Удаляем refresh token вместе с событием отзыва сессии
+	revoked := events.New(events.SessionRevoked, userID, map[string]string{
+		"device_id": deviceID,
+	})
+	err = a.redis.DeleteRefreshToken(events.WithEvents(ctx, revoked), sessionID)
 	if err != nil && !errors.Is(err, redis.Nil) {
 		return fmt.Errorf("delete refresh token: %w", err)
 	}
@@ -328,6 +588,13 @@ func (a *Auth) Logout(ctx context.Context, accessToken string) error {
 		"device_id", deviceID,
 		"session", sessionID)
 
+	a.record(ctx, audit.Record{
+		Event:    audit.EventLogout,
+		Outcome:  audit.OutcomeSuccess,
+		UserID:   userID,
+		DeviceID: deviceID,
+	})
+
 	return nil
 }
 
@@ -336,39 +603,62 @@ func (a *Auth) LogoutAll(ctx context.Context, accessToken string) error {
 	claims, err := a.token.VerifyAccessToken(accessToken)
 	if err != nil {
 		a.log.Error("invalid access token", "error", err)
+		a.record(ctx, audit.Record{
+			Event:   audit.EventLogoutAll,
+			Outcome: audit.OutcomeFailure,
+			Reason:  "invalid_token",
+		})
 		return fmt.Errorf("invalid access token: %w", err)
 	}
 
 	// 2. Извлекаем userID
-	session, ok := claims["session"].(string)
-	if !ok || session == "" {
+	session := claims.Session
+	if session == "" {
 		return fmt.Errorf("invalid token: missing user_id")
 	}
 
-	parts := strings.Split(session, ":")
-	if len(parts) != 2 {
+	userID := claims.UserID()
+	if userID == "" {
 		return fmt.Errorf("invalid session format: %s", session)
 	}
-	userID := parts[0]
 
+	return a.logoutAll(ctx, userID, "")
+}
+
+// logoutAll - удаляет все сессии пользователя. reason - источник для аудита,
+// если выход инициирован не самим пользователем.
+func (a *Auth) logoutAll(ctx context.Context, userID string, reason string) error {
 	// 3. Получаем все сессии пользователя
-	deviceIDs, err := a.redis.GetUserSessions(ctx, userID)
+	members, err := a.redis.GetUserSessions(ctx, userID)
 	if err != nil && !errors.Is(err, redis.Nil) {
 		return fmt.Errorf("get user sessions: %w", err)
 	}
 
-	if len(deviceIDs) == 0 {
+	if len(members) == 0 {
 		a.log.Info("no active sessions found", "user_id", userID)
+		a.record(ctx, audit.Record{
+			Event:   audit.EventLogoutAll,
+			Outcome: audit.OutcomeSuccess,
+			UserID:  userID,
+			Reason:  reason,
+		})
 		return nil
 	}
 
 	// 4. Удаляем все сессии и связанные токены
 	var lastErr error
-	for _, deviceID := range deviceIDs {
-		sessionID := fmt.Sprintf("%s:%s", userID, deviceID)
+	for _, member := range members {
+		sessionID, err := a.userSessionID(ctx, userID, member)
+		if err != nil {
+			lastErr = err
+			a.log.Warn("failed to get session",
+				"user_id", userID,
+				"error", err)
+			continue
+		}
 
 		// Удаляем refresh token
-		err := a.redis.DeleteRefreshToken(ctx, sessionID)
+		err = a.redis.DeleteRefreshToken(ctx, sessionID)
 		if err != nil && !errors.Is(err, redis.Nil) {
 			lastErr = err
 			a.log.Warn("failed to delete refresh token",
@@ -386,8 +676,11 @@ func (a *Auth) LogoutAll(ctx context.Context, accessToken string) error {
 		}
 	}
 
-	// 5. Удаляем список сессий пользователя
-	err = a.redis.DeleteAllSessions(ctx, userID)
+	// 5. Удаляем список сессий пользователя вместе с событием
+	revoked := events.New(events.AllSessionsRevoked, userID, map[string]string{
+		"sessions_count": strconv.Itoa(len(members)),
+	})
+	err = a.redis.DeleteAllSessions(events.WithEvents(ctx, revoked), userID)
 	if err != nil && !errors.Is(err, redis.Nil) {
 		lastErr = err
 		a.log.Warn("failed to delete sessions list",
@@ -397,83 +690,58 @@ func (a *Auth) LogoutAll(ctx context.Context, accessToken string) error {
 
 	a.log.Info("logged out all sessions",
 		"user_id", userID,
-		"sessions_count", len(deviceIDs))
+		"sessions_count", len(members))
 
 	if lastErr != nil {
+		a.record(ctx, audit.Record{
+			Event:   audit.EventLogoutAll,
+			Outcome: audit.OutcomeFailure,
+			UserID:  userID,
+			Reason:  "partial",
+		})
 		return fmt.Errorf("some sessions were not deleted properly: %w", lastErr)
 	}
 
+	a.record(ctx, audit.Record{
+		Event:   audit.EventLogoutAll,
+		Outcome: audit.OutcomeSuccess,
+		UserID:  userID,
+		Reason:  reason,
+	})
+
 	return nil
 }
 
 var (
-	ErrEmailMissingAt     = errors.New("your email doesn't contain the '@' symbol")
-	ErrEmailInvalidFmt    = errors.New("your email contains not valid characters")
-	ErrEmailUnknownDomain = errors.New("your domain isn't allowed")
+	ErrEmailMissingAt     = emailpolicy.ErrMissingAt
+	ErrEmailInvalidFmt    = emailpolicy.ErrInvalidFormat
+	ErrEmailUnknownDomain = emailpolicy.ErrDomainNotAllowed
 )
 
-func validateEmail(email string) error {
-	// Проверяем есть ли пробелы
-	if strings.Contains(email, " ") {
-		return errors.New("email cannot contain spaces")
-	}
-
-	if !strings.Contains(email, "@") {
-		return ErrEmailMissingAt
-	}
-
-	// Regexp с заглавными буквами
-	re := regexp.MustCompile("^[A-Za-z0-9._%+\\-]+@[A-Za-z0-9.\\-]+\\.[A-Za-z]{2,}$")
-	if !re.MatchString(email) {
-		return ErrEmailInvalidFmt
+// validateEmail - разбор адреса и политика доменов; домен проверяется в ASCII форме
+func (a *Auth) validateEmail(ctx context.Context, email string) (emailpolicy.Address, error) {
+	addr, err := a.emails.Parse(email)
+	if err != nil {
+		return emailpolicy.Address{}, err
 	}
 
-	// Для проверки домена все равно нужно нижний регистр
-	// потому что allowedDomains содержит домены в нижнем регистре
-	lowerEmail := strings.ToLower(email)
-	paths := strings.Split(lowerEmail, "@")
-	domain := paths[1]
-
-	if !allowedDomains[domain] {
-		return ErrEmailUnknownDomain
+	if err = a.domains.Check(ctx, addr.Domain); err != nil {
+		return emailpolicy.Address{}, err
 	}
 
-	return nil
-}
-
-var allowedDomains = map[string]bool{
-	"gmail.com": true,
-	"yandex.ru": true,
-	"mail.ru":   true,
-	"mail.com":  true,
+	return addr, nil
 }
 
-var (
-	ErrPasswordLow = errors.New("the password must contain at 8 characters or more")
-	ErrPasswordFmt = errors.New("the password must contain at least one uppercase character and one number")
-)
-
-func validatePassword(password string) error {
-	if len(password) < 8 {
-		return ErrPasswordLow
-	}
-
-	var hasDigit bool
-	var hasUpper bool
-
-	for _, ch := range password {
-		switch {
-		case unicode.IsDigit(ch):
-			hasDigit = true
+// registeredForms - под какими адресами мог быть зарегистрирован владелец addr:
+// каноническая форма и, для аккаунтов до канонизации, адрес как введен и в нижнем регистре
+func registeredForms(raw string, addr emailpolicy.Address) []string {
+	forms := []string{addr.Canonical}
+	for _, form := range []string{addr.Display, strings.ToLower(addr.Display), strings.TrimSpace(raw)} {
+		if !slices.Contains(forms, form) {
+			forms = append(forms, form)
 		}
-		if unicode.IsUpper(ch) {
-			hasUpper = true
-		}
-	}
-	if !hasDigit || !hasUpper {
-		return ErrPasswordFmt
 	}
-	return nil
+	return forms
 }
 
 func generateCode() string {
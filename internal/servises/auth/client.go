@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"auth/internal/clients"
+	"auth/internal/model"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// clientInfo - IP и User-Agent вызывающей стороны из gRPC контекста
+func clientInfo(ctx context.Context) (ip string, userAgent string) {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		ip = p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("user-agent"); len(values) > 0 {
+			userAgent = values[0]
+		}
+	}
+
+	return ip, userAgent
+}
+
+// clientLocale - язык писем: x-locale, иначе первый тег accept-language
+func clientLocale(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	if values := md.Get("x-locale"); len(values) > 0 && values[0] != "" {
+		return strings.TrimSpace(values[0])
+	}
+
+	if values := md.Get("accept-language"); len(values) > 0 {
+		first, _, _ := strings.Cut(values[0], ",")
+		tag, _, _ := strings.Cut(first, ";")
+		if tag = strings.TrimSpace(tag); tag != "*" {
+			return tag
+		}
+	}
+
+	return ""
+}
+
+// clientID - приложение, через которое выполнен вход; от него зависят ограничения сессии
+func clientID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-client-id"); len(values) > 0 {
+			return strings.TrimSpace(values[0])
+		}
+	}
+	return ""
+}
+
+// clientSecret - секрет конфиденциального клиента из metadata x-client-secret
+func clientSecret(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-client-secret"); len(values) > 0 {
+			return strings.TrimSpace(values[0])
+		}
+	}
+	return ""
+}
+
+// requestedAudience - x-audience: одно или несколько значений, можно через пробел
+func requestedAudience(ctx context.Context) []string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	var audience []string
+	for _, value := range md.Get("x-audience") {
+		audience = append(audience, strings.Fields(value)...)
+	}
+	return audience
+}
+
+// appClient - клиент запроса из реестра с проверкой секрета и grant. При refresh
+// sessionClient - клиент, открывший сессию: продлить ее от имени другого нельзя.
+// Audiences результата - уже итоговый aud с учетом x-audience.
+// Без реестра - nil, токены выпускаются с общими настройками.
+func (a *Auth) appClient(ctx context.Context, grant, sessionClient string) (*clients.Client, error) {
+	if a.clients == nil {
+		return nil, nil
+	}
+
+	id := clientID(ctx)
+	if sessionClient != "" {
+		if id != "" && id != sessionClient {
+			return nil, clients.ErrClientMismatch
+		}
+		id = sessionClient
+	}
+	if id == "" {
+		id = a.defaultClient
+	}
+
+	registered, err := a.clients.Client(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err = registered.Authenticate(clientSecret(ctx)); err != nil {
+		return nil, err
+	}
+	if !registered.AllowsGrant(grant) {
+		return nil, clients.ErrGrantNotAllowed
+	}
+
+	audience, err := registered.Audience(requestedAudience(ctx))
+	if err != nil {
+		return nil, err
+	}
+	c := *registered
+	c.Audiences = audience
+	return &c, nil
+}
+
+// withClient - azp, aud и TTL access token по клиенту
+func withClient(u *model.UserRefresh, c *clients.Client) *model.UserRefresh {
+	if c != nil {
+		u.ClientID, u.Audience, u.AccessTTL = c.ID, c.Audiences, c.AccessTTL
+	}
+	return u
+}
+
+// clientDeadline - срок refresh token: конец сессии, но не позже refresh TTL клиента
+func clientDeadline(c *clients.Client, deadline, now time.Time) time.Time {
+	if c == nil || c.RefreshTTL <= 0 {
+		return deadline
+	}
+	if limit := now.Add(c.RefreshTTL); deadline.IsZero() || limit.Before(deadline) {
+		return limit
+	}
+	return deadline
+}
+
+// clientReason - причина отказа клиенту для аудита
+func clientReason(err error) string {
+	switch {
+	case errors.Is(err, clients.ErrUnknownClient),
+		errors.Is(err, clients.ErrInvalidSecret),
+		errors.Is(err, clients.ErrClientMismatch):
+		return "invalid_client"
+	case errors.Is(err, clients.ErrGrantNotAllowed):
+		return "unauthorized_client"
+	case errors.Is(err, clients.ErrAudienceNotAllowed):
+		return "invalid_audience"
+	default:
+		return "internal"
+	}
+}
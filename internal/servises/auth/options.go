@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"auth/internal/audit"
+	"auth/internal/clients"
+	emailpolicy "auth/internal/email"
+	"auth/internal/rbac"
+	"auth/internal/sessions"
+	"context"
+	"time"
+)
+
+// Option - дополнительные зависимости сервиса
+type Option func(*Auth)
+
+func WithAudit(sink audit.Sink) Option {
+	return func(a *Auth) {
+		a.audit = sink
+	}
+}
+
+// DomainPolicy - какие домены email допустимы при регистрации
+type DomainPolicy interface {
+	Check(ctx context.Context, domain string) error
+}
+
+func WithDomainPolicy(policy DomainPolicy) Option {
+	return func(a *Auth) {
+		a.domains = policy
+	}
+}
+
+// WithEmailCanonicalizer - правила канонической формы адресов (Gmail, +теги)
+func WithEmailCanonicalizer(c *emailpolicy.Canonicalizer) Option {
+	return func(a *Auth) {
+		a.emails = c
+	}
+}
+
+// PasswordPolicy - требования к паролю; ошибка *password.ViolationError перечисляет нарушения
+type PasswordPolicy interface {
+	Check(password, email, name string) error
+}
+
+func WithPasswordPolicy(policy PasswordPolicy) Option {
+	return func(a *Auth) {
+		a.passwords = policy
+	}
+}
+
+// WithRoles - права ролей для claim scope в access token
+func WithRoles(roles *rbac.Roles) Option {
+	return func(a *Auth) {
+		a.roles = roles
+	}
+}
+
+// WithLegacySessions - принимать токены со старыми ID сессий "userID:deviceID".
+// Включено по умолчанию; выключать после того, как истекут все refresh token,
+// выданные до перехода на непрозрачные ID.
+func WithLegacySessions(enabled bool) Option {
+	return func(a *Auth) {
+		a.legacySessions = enabled
+	}
+}
+
+// WithRefreshMode - формат новых refresh token: token.RefreshJWT или token.RefreshOpaque.
+// Уже выданные токены другого формата принимаются до ротации.
+func WithRefreshMode(mode string) Option {
+	return func(a *Auth) {
+		a.refreshMode = mode
+	}
+}
+
+// WithSessionPolicy - абсолютный срок и таймаут бездействия сессий
+func WithSessionPolicy(policy *sessions.Policy) Option {
+	return func(a *Auth) {
+		a.sessions = policy
+	}
+}
+
+// WithSignInAlerts - история входов, оценка риска и письма о новых устройствах; nil - выключено
+func WithSignInAlerts(alerts *SignInAlerts) Option {
+	return func(a *Auth) {
+		if alerts == nil {
+			a.signIn = nil
+			return
+		}
+		copied := *alerts
+		if copied.RevokeTTL <= 0 {
+			copied.RevokeTTL = 7 * 24 * time.Hour
+		}
+		a.signIn = &copied
+	}
+}
+
+// WithClients - реестр клиентских приложений; defaultClient - для запросов без x-client-id.
+// Без реестра все клиенты получают одинаковые токены.
+func WithClients(registry clients.Registry, defaultClient string) Option {
+	return func(a *Auth) {
+		a.clients = registry
+		a.defaultClient = defaultClient
+	}
+}
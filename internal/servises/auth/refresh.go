@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"auth/internal/audit"
+	"auth/internal/model"
+	"auth/internal/token"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// issueRefreshToken - новый refresh token сессии в текущем режиме. В режиме
+// token.RefreshOpaque в Redis попадает только SHA-256 токена.
+// deadline - конец сессии по sessions.Limits: ограничивает и TTL в Redis, и exp JWT.
+func (a *Auth) issueRefreshToken(ctx context.Context, userID, sessionID string, deadline time.Time) (string, error) {
+	ttl := untilDeadline(deadline)
+
+	if a.refreshMode == token.RefreshOpaque {
+		refreshToken, hash, err := token.NewOpaqueRefreshToken()
+		if err != nil {
+			return "", fmt.Errorf("generate refresh token: %w", err)
+		}
+		if err = a.redis.SaveRefreshHash(ctx, sessionID, hash, ttl); err != nil {
+			return "", fmt.Errorf("save refresh token: %w", err)
+		}
+		return refreshToken, nil
+	}
+
+	refreshToken, err := a.token.GenerateRefreshToken(userID, sessionID, deadline)
+	if err != nil {
+		return "", fmt.Errorf("generate refresh token: %w", err)
+	}
+	if err = a.redis.Save(ctx, sessionID, refreshToken, ttl); err != nil {
+		return "", fmt.Errorf("save refresh token: %w", err)
+	}
+	return refreshToken, nil
+}
+
+// restoreRefreshToken - возвращает забранный TakeRefreshToken токен сессии, если
+// ротация не дошла до выпуска нового. Срок - refresh TTL: исходный остаток уже потерян.
+func (a *Auth) restoreRefreshToken(ctx context.Context, sessionID, refreshToken, presented string) {
+	// Запрос мог быть уже отменен клиентом, а токен вернуть нужно все равно
+	ctx = context.WithoutCancel(ctx)
+
+	var err error
+	if token.IsOpaqueRefreshToken(refreshToken) {
+		err = a.redis.SaveRefreshHash(ctx, sessionID, presented, 0)
+	} else {
+		err = a.redis.Save(ctx, sessionID, presented, 0)
+	}
+	if err != nil {
+		a.log.Error("failed to restore refresh token", "session", sessionID, "error", err)
+	}
+}
+
+// refreshSession - сессия предъявленного refresh token. Формат определяется по
+// самому токену, а не по текущему режиму: после переключения режима ранее
+// выданные токены продолжают работать до ротации.
+// Возвращает значение, которое должно совпасть с сохраненным для сессии:
+// хеш для непрозрачного токена, сам токен для JWT. При отказе заполняет rec.Reason.
+func (a *Auth) refreshSession(ctx context.Context, refreshToken string, rec *audit.Record) (*model.Session, string, error) {
+	if token.IsOpaqueRefreshToken(refreshToken) {
+		hash := token.HashRefreshToken(refreshToken)
+
+		// Поиск по хешу: подписи нет, разбирать нечего
+		sessionID, err := a.redis.SessionByRefreshHash(ctx, hash)
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				rec.Reason = "invalid_token"
+				return nil, "", fmt.Errorf("invalid refresh token")
+			}
+			return nil, "", fmt.Errorf("failed to validate token: %w", err)
+		}
+
+		sess, err := a.redis.GetSession(ctx, sessionID)
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				return nil, "", a.revoked(ctx, sessionID, rec)
+			}
+			return nil, "", fmt.Errorf("failed to get session: %w", err)
+		}
+		return sess, hash, nil
+	}
+
+	claims, err := a.token.VerifyRefreshToken(refreshToken)
+	if err != nil {
+		rec.Reason = "invalid_token"
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, "", fmt.Errorf("refresh token expired")
+		}
+		return nil, "", fmt.Errorf("invalid refresh token: %w", err)
+	}
+
+	if claims.Session == "" {
+		return nil, "", fmt.Errorf("invalid token: missing session")
+	}
+	rec.UserID = claims.UserID()
+
+	sess, err := a.session(ctx, claims.Session, claims.UserID())
+	if err != nil {
+		if errors.Is(err, errSessionNotFound) {
+			return nil, "", a.revoked(ctx, claims.Session, rec)
+		}
+		return nil, "", fmt.Errorf("failed to get session: %w", err)
+	}
+	if sess.Legacy {
+		// Токен старой сессии - обычно еще исходного формата (typ JWT, без sub),
+		// его принимает JWTManager с token.WithLegacyTokens.
+		// У старых сессий записи нет: начало берется из iat - время первого входа
+		// не сохранилось, это самая ранняя известная отметка; бездействие - по lat
+		if claims.IssuedAt != nil {
+			sess.CreatedAt = claims.IssuedAt.UTC()
+		}
+		if claims.LastActivity > 0 {
+			sess.LastSeenAt = time.Unix(claims.LastActivity, 0).UTC()
+		}
+	}
+	return sess, refreshToken, nil
+}
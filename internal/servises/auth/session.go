@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"auth/internal/audit"
+	"auth/internal/events"
+	"auth/internal/model"
+	"auth/internal/sessions"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// errSessionNotFound - записи сессии нет: истекла, отозвана или ID чужой
+var errSessionNotFound = errors.New("session not found")
+
+// newSessionID - 128 бит из crypto/rand в base64url; двоеточия в ID не бывает,
+// по нему старые ID "userID:deviceID" отличаются от новых
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (a *Auth) newSession(ctx context.Context, userID, deviceID string) *model.Session {
+	ip, userAgent := clientInfo(ctx)
+	now := time.Now().UTC()
+	return &model.Session{
+		ID:         newSessionID(),
+		UserID:     userID,
+		DeviceID:   deviceID,
+		ClientID:   clientID(ctx),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		IP:         ip,
+		UserAgent:  userAgent,
+	}
+}
+
+// untilDeadline - TTL ключей сессии; 0 для сессии без срока - хранилище возьмет refresh TTL
+func untilDeadline(deadline time.Time) time.Duration {
+	if deadline.IsZero() {
+		return 0
+	}
+	// Истекшая сессия сюда не попадает, но TTL не должен стать "без срока"
+	return max(time.Until(deadline), time.Second)
+}
+
+// session - запись сессии из токена. userID - sub токена, сессия должна принадлежать ему.
+// Старые ID "userID:deviceID" записи не имеют: пока включены legacy сессии,
+// они восстанавливаются из самого ID и при refresh переводятся на новый ID.
+func (a *Auth) session(ctx context.Context, sessionID, userID string) (*model.Session, error) {
+	if strings.Contains(sessionID, ":") {
+		// Префикс по sub, а не split: двоеточие может быть и в userID, и в deviceID
+		device, ok := strings.CutPrefix(sessionID, userID+":")
+		if !a.legacySessions || !ok || userID == "" || device == "" {
+			return nil, errSessionNotFound
+		}
+		return &model.Session{ID: sessionID, UserID: userID, DeviceID: device, Legacy: true}, nil
+	}
+
+	session, err := a.redis.GetSession(ctx, sessionID)
+	if errors.Is(err, redis.Nil) {
+		return nil, errSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID != userID {
+		return nil, errSessionNotFound
+	}
+	return session, nil
+}
+
+// endSession - удаляет ключи сессии: после перевода старой сессии на новый ID
+// или по истечении срока. Ошибки только в лог, ключи в любом случае истекут сами.
+func (a *Auth) endSession(ctx context.Context, session *model.Session) {
+	if err := a.redis.RemoveSession(ctx, session); err != nil && !errors.Is(err, redis.Nil) {
+		a.log.Warn("failed to remove session from list", "session", session.ID, "error", err)
+	}
+	if err := a.redis.DeleteRefreshToken(ctx, session.ID); err != nil && !errors.Is(err, redis.Nil) {
+		a.log.Warn("failed to delete refresh token", "session", session.ID, "error", err)
+	}
+	if err := a.redis.DeleteVersionToken(ctx, session.ID); err != nil && !errors.Is(err, redis.Nil) {
+		a.log.Warn("failed to delete version token", "session", session.ID, "error", err)
+	}
+}
+
+// userSessionID - ID сессии по элементу списка сессий пользователя:
+// новый ID с записью этого пользователя или deviceID старой сессии
+func (a *Auth) userSessionID(ctx context.Context, userID, member string) (string, error) {
+	session, err := a.redis.GetSession(ctx, member)
+	switch {
+	case err == nil && session.UserID == userID:
+		return member, nil
+	case err != nil && !errors.Is(err, redis.Nil):
+		return "", err
+	}
+	return userID + ":" + member, nil
+}
+
+// liveSessions - действующие сессии пользователя. Элементы списка, у которых
+// не осталось ни записи, ни refresh token, по пути из списка убираются.
+func (a *Auth) liveSessions(ctx context.Context, userID string) ([]*model.Session, error) {
+	members, err := a.redis.GetUserSessions(ctx, userID)
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	var live []*model.Session
+	for _, member := range members {
+		session, err := a.redis.GetSession(ctx, member)
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		if err == nil && session.UserID == userID {
+			live = append(live, session)
+			continue
+		}
+
+		// Старая сессия записана по deviceID и жива, пока есть ее refresh token
+		legacy := &model.Session{ID: userID + ":" + member, UserID: userID, DeviceID: member, Legacy: true}
+		if a.legacySessions {
+			_, err = a.redis.Get(ctx, legacy.ID)
+			if err == nil {
+				live = append(live, legacy)
+				continue
+			}
+			if !errors.Is(err, redis.Nil) {
+				return nil, err
+			}
+		}
+		if err = a.redis.RemoveSession(ctx, legacy); err != nil {
+			a.log.Warn("failed to remove stale session from list", "user_id", userID, "error", err)
+		}
+	}
+	return live, nil
+}
+
+// limitSessions - освобождает место под новую сессию пользователя в пределах max.
+// При sessions.OnLimitEvictLRU вытесняются сессии, дольше всех не делавшие refresh
+// (у старых сессий времени нет - они первые), иначе вход отклоняется.
+func (a *Auth) limitSessions(ctx context.Context, userID string, max int) error {
+	if max <= 0 {
+		return nil
+	}
+
+	live, err := a.liveSessions(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("list sessions: %w", err)
+	}
+	excess := len(live) - max + 1
+	if excess <= 0 {
+		return nil
+	}
+	if a.sessions.OnLimit != sessions.OnLimitEvictLRU {
+		return sessions.ErrTooManySessions
+	}
+
+	slices.SortFunc(live, func(x, y *model.Session) int {
+		return x.LastSeenAt.Compare(y.LastSeenAt)
+	})
+	for _, victim := range live[:excess] {
+		evicted := events.New(events.SessionEvicted, userID, map[string]string{
+			"device_id":  victim.DeviceID,
+			"session_id": victim.ID,
+		})
+		if err = a.redis.EvictSession(events.WithEvents(ctx, evicted), victim); err != nil {
+			return fmt.Errorf("evict session: %w", err)
+		}
+
+		a.log.Info("session evicted",
+			"user_id", userID,
+			"device_id", victim.DeviceID,
+			"session", victim.ID)
+		a.record(ctx, audit.Record{
+			Event:    audit.EventSessionEvicted,
+			Outcome:  audit.OutcomeSuccess,
+			UserID:   userID,
+			DeviceID: victim.DeviceID,
+			Reason:   "session_limit",
+		})
+	}
+	return nil
+}
+
+// revoked - отказ в refresh для сессии, ключей которой уже нет; вытесненная
+// по лимиту сессия отличается от отозванной меткой вытеснения
+func (a *Auth) revoked(ctx context.Context, sessionID string, rec *audit.Record) error {
+	evicted, err := a.redis.IsEvicted(ctx, sessionID)
+	if err != nil {
+		a.log.Warn("failed to check session eviction", "session", sessionID, "error", err)
+	}
+	if evicted {
+		rec.Reason = "evicted"
+		return sessions.ErrEvicted
+	}
+	rec.Reason = "revoked"
+	return fmt.Errorf("token revoked or user logged out")
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"auth/internal/audit"
+	"auth/internal/events"
+	"auth/internal/model"
+	"auth/internal/risk"
+	"auth/internal/sender"
+	"auth/internal/signin"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SignInAlerts - письмо о входе с нового устройства и оценка риска входа
+type SignInAlerts struct {
+	// RevokeURL - страница "это был не я" (signin.Handler); пустой - письма не отправляются
+	RevokeURL string
+	// RevokeTTL - срок ссылки из письма; 0 - неделя
+	RevokeTTL time.Duration
+	// GeoIP - nil: местоположение неизвестно, перемещение не проверяется
+	GeoIP *risk.GeoIP
+	// Risk - nil: риск входа не оценивается
+	Risk *risk.Detector
+}
+
+// checkSignIn - после успешного входа: оценка риска по истории входов, запись входа
+// в историю и письмо, если устройство новое. Ошибки только в лог - вход уже состоялся.
+func (a *Auth) checkSignIn(ctx context.Context, user *model.User, sess *model.Session) {
+	if a.signIn == nil {
+		return
+	}
+
+	login := model.LoginRecord{DeviceID: sess.DeviceID, IP: sess.IP, At: sess.CreatedAt}
+	location, located := a.signIn.GeoIP.Lookup(sess.IP)
+	if located {
+		login.Country = location.Country
+		login.City = location.City
+		login.Lat = location.Lat
+		login.Lon = location.Lon
+		login.Located = true
+	}
+
+	devices, err := a.redis.UserDevices(ctx, user.UserID)
+	if err != nil && !errors.Is(err, redis.Nil) {
+		a.log.Warn("failed to get user devices", "user_id", user.UserID, "error", err)
+		return
+	}
+	history, err := a.redis.LoginHistory(ctx, user.UserID)
+	if err != nil && !errors.Is(err, redis.Nil) {
+		a.log.Warn("failed to get login history", "user_id", user.UserID, "error", err)
+		return
+	}
+
+	// События риска пишутся в outbox вместе с самим входом
+	var flagged []events.Event
+	for _, reason := range a.signIn.Risk.Assess(history, login) {
+		a.log.Warn("suspicious login",
+			"user_id", user.UserID,
+			"device_id", sess.DeviceID,
+			"reason", reason)
+		a.record(ctx, audit.Record{
+			Event:    audit.EventLoginRisk,
+			Outcome:  audit.OutcomeSuccess,
+			UserID:   user.UserID,
+			DeviceID: sess.DeviceID,
+			Reason:   reason,
+		})
+		flagged = append(flagged, events.New(events.LoginRiskDetected, user.UserID, map[string]string{
+			"reason":     reason,
+			"device_id":  sess.DeviceID,
+			"session_id": sess.ID,
+			"ip":         sess.IP,
+			"country":    login.Country,
+		}))
+	}
+
+	if err = a.redis.AddLogin(events.WithEvents(ctx, flagged...), user.UserID, login); err != nil {
+		a.log.Warn("failed to save login history", "user_id", user.UserID, "error", err)
+	}
+
+	// Самый первый вход (и первый после появления истории) - не "новое устройство"
+	if len(devices) == 0 || slices.Contains(devices, sess.DeviceID) || a.signIn.RevokeURL == "" {
+		return
+	}
+	if err = a.notifyNewDevice(ctx, user, sess, location.String()); err != nil {
+		a.log.Warn("failed to send new sign-in email", "user_id", user.UserID, "error", err)
+	}
+}
+
+func (a *Auth) notifyNewDevice(ctx context.Context, user *model.User, sess *model.Session, location string) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	revokeToken := base64.RawURLEncoding.EncodeToString(b)
+
+	if err := a.redis.SaveRevokeToken(ctx, hashRevokeToken(revokeToken), user.UserID, a.signIn.RevokeTTL); err != nil {
+		return fmt.Errorf("save revoke token: %w", err)
+	}
+
+	link, err := url.Parse(a.signIn.RevokeURL)
+	if err != nil {
+		return fmt.Errorf("revoke url: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", revokeToken)
+	link.RawQuery = query.Encode()
+
+	// Телефон - только подтвержденный номер из записи пользователя в users service
+	return a.sender.SendNewSignIn(sender.WithPhone(ctx, user.Phone), user.Email, user.Name, sender.SignIn{
+		Device:    sess.DeviceID,
+		UserAgent: sess.UserAgent,
+		IP:        sess.IP,
+		Location:  location,
+		Time:      sess.CreatedAt,
+		RevokeURL: link.String(),
+	}, clientLocale(ctx))
+}
+
+// hashRevokeToken - в Redis только SHA-256 токена ссылки
+func hashRevokeToken(revokeToken string) string {
+	sum := sha256.Sum256([]byte(revokeToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// RevokeAllSessions - ссылка "это был не я": завершает все сессии пользователя.
+// Ссылка одноразовая; неизвестная или использованная - signin.ErrInvalidToken.
+func (a *Auth) RevokeAllSessions(ctx context.Context, revokeToken string) error {
+	rec := audit.Record{
+		Event:   audit.EventLogoutAll,
+		Outcome: audit.OutcomeFailure,
+	}
+
+	if revokeToken == "" {
+		rec.Reason = "invalid_token"
+		a.record(ctx, rec)
+		return signin.ErrInvalidToken
+	}
+
+	userID, err := a.redis.TakeRevokeToken(ctx, hashRevokeToken(revokeToken))
+	if errors.Is(err, redis.Nil) {
+		rec.Reason = "invalid_token"
+		a.record(ctx, rec)
+		return signin.ErrInvalidToken
+	}
+	if err != nil {
+		return fmt.Errorf("take revoke token: %w", err)
+	}
+
+	a.log.Warn("sessions revoked by sign-in alert link", "user_id", userID)
+	return a.logoutAll(ctx, userID, "sign_in_alert")
+}
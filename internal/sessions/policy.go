@@ -0,0 +1,112 @@
+// Package sessions - ограничения времени жизни сессий: абсолютный срок от входа
+// и таймаут бездействия от последнего refresh, с переопределением по роли и клиенту.
+package sessions
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrTooManySessions - вход сверх лимита сессий при OnLimitReject
+	ErrTooManySessions = errors.New("too many active sessions")
+	// ErrEvicted - refresh сессии, вытесненной более новым входом
+	ErrEvicted = errors.New("session evicted")
+)
+
+// Limits - нулевое значение поля означает "без ограничения"
+type Limits struct {
+	// MaxAge - максимальный возраст сессии от исходного входа
+	MaxAge time.Duration
+	// IdleTimeout - сколько сессия живет без refresh
+	IdleTimeout time.Duration
+	// MaxSessions - одновременных сессий у пользователя, считаются все его сессии
+	MaxSessions int
+}
+
+// Deadline - момент, после которого сессия недействительна; нулевое время - без срока.
+// Нулевые createdAt / lastSeen пропускают соответствующую проверку.
+func (l Limits) Deadline(createdAt, lastSeen time.Time) time.Time {
+	var deadline time.Time
+	if l.MaxAge > 0 && !createdAt.IsZero() {
+		deadline = createdAt.Add(l.MaxAge)
+	}
+	if l.IdleTimeout > 0 && !lastSeen.IsZero() {
+		if idle := lastSeen.Add(l.IdleTimeout); deadline.IsZero() || idle.Before(deadline) {
+			deadline = idle
+		}
+	}
+	return deadline
+}
+
+// Expired - истек ли хотя бы один из сроков на момент now
+func (l Limits) Expired(createdAt, lastSeen, now time.Time) bool {
+	deadline := l.Deadline(createdAt, lastSeen)
+	return !deadline.IsZero() && !now.Before(deadline)
+}
+
+// Что делать со входом сверх Limits.MaxSessions
+const (
+	// OnLimitReject - новый вход отклоняется
+	OnLimitReject = "reject"
+	// OnLimitEvictLRU - вытесняется сессия, дольше всех не делавшая refresh
+	OnLimitEvictLRU = "evict_lru"
+)
+
+// Policy - ограничения по умолчанию и переопределения. Для роли и клиента
+// берется более строгое значение каждого поля; нулевое поле переопределения
+// наследуется.
+type Policy struct {
+	Default Limits
+	Roles   map[string]Limits
+	Clients map[string]Limits
+	// OnLimit - OnLimitReject или OnLimitEvictLRU; пустое - OnLimitReject
+	OnLimit string
+}
+
+// For - ограничения для сессии пользователя с ролью role, вошедшего через клиента clientID
+func (p *Policy) For(role, clientID string) Limits {
+	limits := p.Default
+
+	var overrides []Limits
+	if o, ok := p.Roles[role]; ok {
+		overrides = append(overrides, o)
+	}
+	if o, ok := p.Clients[clientID]; ok && clientID != "" {
+		overrides = append(overrides, o)
+	}
+
+	// Переопределение может и ослабить умолчание, но из двух переопределений
+	// побеждает более строгое
+	var maxAge, idle time.Duration
+	var maxSessions int
+	for _, o := range overrides {
+		maxAge = stricter(maxAge, o.MaxAge)
+		idle = stricter(idle, o.IdleTimeout)
+		maxSessions = stricter(maxSessions, o.MaxSessions)
+	}
+	if maxAge > 0 {
+		limits.MaxAge = maxAge
+	}
+	if idle > 0 {
+		limits.IdleTimeout = idle
+	}
+	if maxSessions > 0 {
+		limits.MaxSessions = maxSessions
+	}
+
+	return limits
+}
+
+// stricter - меньшее из положительных значений
+func stricter[T time.Duration | int](a, b T) T {
+	switch {
+	case a <= 0:
+		return b
+	case b <= 0:
+		return a
+	case b < a:
+		return b
+	}
+	return a
+}
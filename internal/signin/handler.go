@@ -0,0 +1,110 @@
+// Package signin - страница "это был не я" из письма о входе с нового устройства
+package signin
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ErrInvalidToken - ссылка истекла, уже использована или подделана
+var ErrInvalidToken = errors.New("invalid or expired revoke link")
+
+// Revoker - завершает все сессии владельца ссылки
+type Revoker interface {
+	RevokeAllSessions(ctx context.Context, revokeToken string) error
+}
+
+type handler struct {
+	revoker Revoker
+	log     *slog.Logger
+}
+
+// Handler - GET показывает подтверждение, POST завершает сессии. Сам переход
+// по ссылке ничего не делает: почтовые сканеры открывают ссылки из писем.
+func Handler(revoker Revoker, log *slog.Logger) http.Handler {
+	h := &handler{revoker: revoker, log: log}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /signin/revoke", h.confirm)
+	mux.HandleFunc("POST /signin/revoke", h.revoke)
+	return mux
+}
+
+// Serve - handler на addr до отмены контекста
+func Serve(ctx context.Context, addr string, handler http.Handler) error {
+	server := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+var pageTemplate = template.Must(template.New("revoke").Parse(`<!DOCTYPE html>
+<html><head><meta charset="UTF-8"><meta name="viewport" content="width=device-width, initial-scale=1.0">
+<title>Secure your account</title></head>
+<body style="font-family: Arial, sans-serif; max-width: 480px; margin: 60px auto; padding: 0 20px; text-align: center; color: #333;">
+{{if .Token}}<h2>This wasn't you?</h2>
+<p>All devices, including this one, will be signed out. Then change your password.</p>
+<form method="post" action="revoke">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit" style="padding: 14px 28px; background: #e94343; color: #fff; font-weight: bold; border: 0; border-radius: 8px; cursor: pointer;">Sign out everywhere</button>
+</form>
+{{else}}<h2>{{.Title}}</h2>
+<p>{{.Message}}</p>
+{{end}}</body></html>`))
+
+type page struct {
+	Token   string
+	Title   string
+	Message string
+}
+
+func (h *handler) confirm(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		h.render(w, http.StatusBadRequest, page{Title: "Link is invalid", Message: "Open the link from the email again."})
+		return
+	}
+	h.render(w, http.StatusOK, page{Token: token})
+}
+
+func (h *handler) revoke(w http.ResponseWriter, r *http.Request) {
+	err := h.revoker.RevokeAllSessions(r.Context(), r.PostFormValue("token"))
+	switch {
+	case errors.Is(err, ErrInvalidToken):
+		h.render(w, http.StatusGone, page{
+			Title:   "Link has expired",
+			Message: "This link was already used or is too old. Sign in and use \"sign out everywhere\" in your account.",
+		})
+	case err != nil:
+		h.log.Error("failed to revoke sessions by sign-in link", slog.String("error", err.Error()))
+		h.render(w, http.StatusInternalServerError, page{Title: "Something went wrong", Message: "Please try again later."})
+	default:
+		h.render(w, http.StatusOK, page{
+			Title:   "All sessions are signed out",
+			Message: "Change your password now so that nobody can sign in again.",
+		})
+	}
+}
+
+func (h *handler) render(w http.ResponseWriter, status int, p page) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// Токен в ссылке не должен уйти третьим лицам через Referer
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	pageTemplate.Execute(w, p)
+}
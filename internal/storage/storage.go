@@ -3,20 +3,50 @@ package storage
 import (
 	"auth/internal/model"
 	"context"
+	"time"
 )
 
+// TTL в методах сохранения - срок до конца сессии; 0 - refresh TTL из конфига
 type Storage interface {
-	Save(ctx context.Context, userId string, refreshToken string) error
+	Save(ctx context.Context, userId string, refreshToken string, ttl time.Duration) error
 	Get(ctx context.Context, userId string) (string, error)
 	IncrementTokenVersion(ctx context.Context, session string) (int, error)
 	GetTokenVersion(ctx context.Context, session string) (int, error)
 	DeleteVersionToken(ctx context.Context, session string) error
+	// DeleteRefreshToken - удаляет refresh token и запись сессии
 	DeleteRefreshToken(ctx context.Context, session string) error
+	// SaveRefreshHash - хеш непрозрачного refresh token вместо самого токена
+	// и индекс хеш -> сессия; Get по сессии вернет хеш
+	SaveRefreshHash(ctx context.Context, session string, hash string, ttl time.Duration) error
+	SessionByRefreshHash(ctx context.Context, hash string) (string, error)
+	// TakeRefreshToken - атомарно забирает токен сессии (для непрозрачного - хеш),
+	// если он совпал с предъявленным. false - сохранен другой токен, redis.Nil - токена нет.
+	// Из двух одновременных refresh одним токеном успешен только один.
+	TakeRefreshToken(ctx context.Context, session string, refreshToken string) (bool, error)
 
-	AddSession(ctx context.Context, userID, deviceID string) error
-	RemoveSession(ctx context.Context, userID, deviceID string) error
-	GetUserSessions(ctx context.Context, userID string) ([]string, error) // возвращает deviceIDs
+	// SaveSession - запись сессии и ее ID в списке сессий пользователя;
+	// повторный вызов обновляет запись и ее срок
+	SaveSession(ctx context.Context, session *model.Session, ttl time.Duration) error
+	GetSession(ctx context.Context, sessionID string) (*model.Session, error)
+	// RemoveSession - убирает сессию из списка пользователя
+	RemoveSession(ctx context.Context, session *model.Session) error
+	// GetUserSessions - ID сессий; у старых сессий в списке лежит deviceID
+	GetUserSessions(ctx context.Context, userID string) ([]string, error)
 	DeleteAllSessions(ctx context.Context, userID string) error
+	// EvictSession - удаляет ключи сессии и оставляет метку вытеснения на refresh TTL
+	EvictSession(ctx context.Context, session *model.Session) error
+	IsEvicted(ctx context.Context, sessionID string) (bool, error)
+
+	// UserDevices - устройства, с которых пользователь уже входил
+	UserDevices(ctx context.Context, userID string) ([]string, error)
+	// LoginHistory - последние входы пользователя, новые первыми
+	LoginHistory(ctx context.Context, userID string) ([]model.LoginRecord, error)
+	// AddLogin - вход в историю, устройство - в список известных
+	AddLogin(ctx context.Context, userID string, login model.LoginRecord) error
+	// SaveRevokeToken - хеш токена ссылки "это был не я" -> userID
+	SaveRevokeToken(ctx context.Context, hash string, userID string, ttl time.Duration) error
+	// TakeRevokeToken - userID по хешу; токен одноразовый и удаляется
+	TakeRevokeToken(ctx context.Context, hash string) (string, error)
 
 	SaveTemporarySession(ctx context.Context, userTemporary *model.UserTemporary) error
 	GetTemporarySession(ctx context.Context, session string) (*model.UserTemporary, error)
@@ -1,12 +1,14 @@
 package mock
 
 import (
+	"auth/internal/audit"
 	"auth/internal/model"
+	"auth/internal/sender"
+	"auth/internal/token"
 	"context"
 	"sync"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -25,8 +27,8 @@ func (m *MockProvider) Exists(ctx context.Context, email string) error {
 	return args.Error(0)
 }
 
-func (m *MockProvider) RegisterUsers(ctx context.Context, email, name, password string) (string, error) {
-	args := m.Called(ctx, email, name, password)
+func (m *MockProvider) RegisterUsers(ctx context.Context, email, displayEmail, name, password string) (string, error) {
+	args := m.Called(ctx, email, displayEmail, name, password)
 	return args.String(0), args.Error(1)
 }
 
@@ -75,8 +77,8 @@ func (m *MockStorage) DeleteTemporarySession(ctx context.Context, session string
 }
 
 // Остальные методы для соответствия интерфейсу
-func (m *MockStorage) Save(ctx context.Context, userId, refreshToken string) error {
-	args := m.Called(ctx, userId, refreshToken)
+func (m *MockStorage) Save(ctx context.Context, userId, refreshToken string, ttl time.Duration) error {
+	args := m.Called(ctx, userId, refreshToken, ttl)
 	return args.Error(0)
 }
 
@@ -105,13 +107,36 @@ func (m *MockStorage) DeleteRefreshToken(ctx context.Context, session string) er
 	return args.Error(0)
 }
 
-func (m *MockStorage) AddSession(ctx context.Context, userID, deviceID string) error {
-	args := m.Called(ctx, userID, deviceID)
+func (m *MockStorage) SaveRefreshHash(ctx context.Context, session, hash string, ttl time.Duration) error {
+	args := m.Called(ctx, session, hash, ttl)
 	return args.Error(0)
 }
 
-func (m *MockStorage) RemoveSession(ctx context.Context, userID, deviceID string) error {
-	args := m.Called(ctx, userID, deviceID)
+func (m *MockStorage) SessionByRefreshHash(ctx context.Context, hash string) (string, error) {
+	args := m.Called(ctx, hash)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockStorage) TakeRefreshToken(ctx context.Context, session, refreshToken string) (bool, error) {
+	args := m.Called(ctx, session, refreshToken)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) SaveSession(ctx context.Context, session *model.Session, ttl time.Duration) error {
+	args := m.Called(ctx, session, ttl)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetSession(ctx context.Context, sessionID string) (*model.Session, error) {
+	args := m.Called(ctx, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Session), args.Error(1)
+}
+
+func (m *MockStorage) RemoveSession(ctx context.Context, session *model.Session) error {
+	args := m.Called(ctx, session)
 	return args.Error(0)
 }
 
@@ -128,6 +153,47 @@ func (m *MockStorage) DeleteAllSessions(ctx context.Context, userID string) erro
 	return args.Error(0)
 }
 
+func (m *MockStorage) EvictSession(ctx context.Context, session *model.Session) error {
+	args := m.Called(ctx, session)
+	return args.Error(0)
+}
+
+func (m *MockStorage) IsEvicted(ctx context.Context, sessionID string) (bool, error) {
+	args := m.Called(ctx, sessionID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockStorage) UserDevices(ctx context.Context, userID string) ([]string, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockStorage) LoginHistory(ctx context.Context, userID string) ([]model.LoginRecord, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.LoginRecord), args.Error(1)
+}
+
+func (m *MockStorage) AddLogin(ctx context.Context, userID string, login model.LoginRecord) error {
+	args := m.Called(ctx, userID, login)
+	return args.Error(0)
+}
+
+func (m *MockStorage) SaveRevokeToken(ctx context.Context, hash string, userID string, ttl time.Duration) error {
+	args := m.Called(ctx, hash, userID, ttl)
+	return args.Error(0)
+}
+
+func (m *MockStorage) TakeRevokeToken(ctx context.Context, hash string) (string, error) {
+	args := m.Called(ctx, hash)
+	return args.String(0), args.Error(1)
+}
+
 // ===================== МОК EMAIL SENDER =====================
 
 type MockEmailSender struct {
@@ -140,6 +206,7 @@ type SentEmail struct {
 	ToEmail  string
 	UserName string
 	Code     string
+	Locale   string
 	Time     time.Time
 }
 
@@ -149,17 +216,23 @@ func NewMockEmailSender() *MockEmailSender {
 	}
 }
 
-func (m *MockEmailSender) SendVerificationCode(toEmail, userName, code string) error {
+func (m *MockEmailSender) SendVerificationCode(ctx context.Context, toEmail, userName, code, locale string) error {
 	m.mu.Lock()
 	m.sentEmails = append(m.sentEmails, SentEmail{
 		ToEmail:  toEmail,
 		UserName: userName,
 		Code:     code,
+		Locale:   locale,
 		Time:     time.Now(),
 	})
 	m.mu.Unlock()
 
-	args := m.Called(toEmail, userName, code)
+	args := m.Called(ctx, toEmail, userName, code, locale)
+	return args.Error(0)
+}
+
+func (m *MockEmailSender) SendNewSignIn(ctx context.Context, toEmail, userName string, signIn sender.SignIn, locale string) error {
+	args := m.Called(ctx, toEmail, userName, signIn, locale)
 	return args.Error(0)
 }
 
@@ -195,23 +268,54 @@ func (m *MockToken) GenerateAccessToken(user *model.UserRefresh) (string, error)
 	return args.String(0), args.Error(1)
 }
 
-func (m *MockToken) GenerateRefreshToken(sessionId string) (string, error) {
-	args := m.Called(sessionId)
+func (m *MockToken) GenerateRefreshToken(userID, sessionID string, expiresAt time.Time) (string, error) {
+	args := m.Called(userID, sessionID, expiresAt)
 	return args.String(0), args.Error(1)
 }
 
-func (m *MockToken) VerifyRefreshToken(tokenString string) (jwt.MapClaims, error) {
+func (m *MockToken) VerifyRefreshToken(tokenString string) (*token.RefreshClaims, error) {
 	args := m.Called(tokenString)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(jwt.MapClaims), args.Error(1)
+	return args.Get(0).(*token.RefreshClaims), args.Error(1)
 }
 
-func (m *MockToken) VerifyAccessToken(tokenString string) (jwt.MapClaims, error) {
+func (m *MockToken) VerifyAccessToken(tokenString string) (*token.AccessClaims, error) {
 	args := m.Called(tokenString)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
-	return args.Get(0).(jwt.MapClaims), args.Error(1)
+	return args.Get(0).(*token.AccessClaims), args.Error(1)
+}
+
+// ===================== МОК AUDIT SINK =====================
+
+type MockAuditSink struct {
+	mu      sync.Mutex
+	records []audit.Record
+}
+
+func NewMockAuditSink() *MockAuditSink {
+	return &MockAuditSink{}
+}
+
+func (m *MockAuditSink) Write(_ context.Context, record audit.Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, record)
+	return nil
+}
+
+func (m *MockAuditSink) Close() error {
+	return nil
+}
+
+func (m *MockAuditSink) Records() []audit.Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	records := make([]audit.Record, len(m.records))
+	copy(records, m.records)
+	return records
 }
@@ -45,6 +45,13 @@ type Suite struct {
 func New(t *testing.T) *Suite {
 	t.Helper()
 
+	return NewWithOptions(t)
+}
+
+// NewWithOptions создает тестовую сьюту с дополнительными опциями сервиса
+func NewWithOptions(t *testing.T, opts ...auth.Option) *Suite {
+	t.Helper()
+
 	// Выбираем свободный порт
 	port := getFreePort(t)
 
@@ -61,6 +68,7 @@ func New(t *testing.T) *Suite {
 		mockStorage,
 		mockSender,
 		*slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelWarn})),
+		opts...,
 	)
 
 	// Создаем и запускаем App
@@ -0,0 +1,163 @@
+package tests
+
+import (
+	"auth/internal/audit"
+	"auth/internal/model"
+	"auth/internal/provider"
+	"auth/internal/servises/auth"
+	mocks "auth/internal/tests/mock"
+	"auth/internal/tests/suite"
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/s10n41k/protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit_LoginSuccessAndFailure(t *testing.T) {
+	sink := mocks.NewMockAuditSink()
+	s := suite.NewWithOptions(t, auth.WithAudit(sink))
+	ctx := context.Background()
+
+	const (
+		testEmail    = "john@gmail.com"
+		testPassword = "Password123"
+		testDeviceID = "iphone-13"
+		testUserID   = "user-123"
+	)
+
+	s.MockProvider.On("LoginUsers", mock.Anything, testEmail, testPassword).
+		Return(&model.User{UserID: testUserID, Email: testEmail, Role: "user"}, nil).
+		Once()
+	s.MockProvider.On("LoginUsers", mock.Anything, testEmail, "wrong").
+		Return(nil, provider.ErrMissingData).
+		Once()
+	s.MockStorage.On("SaveSession", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	s.MockStorage.On("IncrementTokenVersion", mock.Anything, mock.Anything).Return(1, nil).Once()
+	s.MockToken.On("GenerateAccessToken", mock.Anything).Return("access-secret-token", nil).Once()
+	s.MockToken.On("GenerateRefreshToken", testUserID, mock.Anything, mock.Anything).Return("refresh-secret-token", nil).Once()
+	s.MockStorage.On("Save", mock.Anything, mock.Anything, "refresh-secret-token", mock.Anything).Return(nil).Once()
+
+	_, err := s.Client.Login(ctx, &sso.LoginRequest{Email: testEmail, Password: testPassword, DeviceID: testDeviceID})
+	require.NoError(t, err)
+
+	_, err = s.Client.Login(ctx, &sso.LoginRequest{Email: testEmail, Password: "wrong", DeviceID: testDeviceID})
+	require.Error(t, err)
+
+	records := sink.Records()
+	require.Len(t, records, 2)
+
+	assert.Equal(t, audit.EventLogin, records[0].Event)
+	assert.Equal(t, audit.OutcomeSuccess, records[0].Outcome)
+	assert.Equal(t, testUserID, records[0].UserID)
+	assert.Equal(t, testDeviceID, records[0].DeviceID)
+	assert.Equal(t, audit.HashEmail(testEmail), records[0].EmailHash)
+	assert.NotEmpty(t, records[0].IP)
+	assert.NotEmpty(t, records[0].UserAgent)
+
+	assert.Equal(t, audit.OutcomeFailure, records[1].Outcome)
+	assert.Equal(t, "invalid_credentials", records[1].Reason)
+
+	// В записях не должно быть ни email, ни пароля, ни токенов
+	raw, err := json.Marshal(records)
+	require.NoError(t, err)
+	for _, secret := range []string{testEmail, testPassword, "access-secret-token", "refresh-secret-token"} {
+		assert.NotContains(t, string(raw), secret)
+	}
+}
+
+func TestAudit_FileSinkRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	sink, err := audit.NewFileSink(path, 200, 2)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, sink.Write(context.Background(), audit.Record{
+			Event:   audit.EventLogout,
+			Outcome: audit.OutcomeSuccess,
+			UserID:  "user-123",
+		}))
+	}
+	require.NoError(t, sink.Close())
+
+	backups, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	assert.Len(t, backups, 2, "old files above max backups should be removed")
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec audit.Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		assert.Equal(t, audit.EventLogout, rec.Event)
+	}
+}
+
+func TestAudit_FileSinkKeepsBackupsByDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	sink, err := audit.NewFileSink(path, 200, 0)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, sink.Write(context.Background(), audit.Record{
+			Event:   audit.EventLogout,
+			Outcome: audit.OutcomeSuccess,
+			UserID:  "user-123",
+		}))
+	}
+	require.NoError(t, sink.Close())
+
+	// Ни одна запись не удалена вместе со старыми файлами
+	files, err := filepath.Glob(path + "*")
+	require.NoError(t, err)
+	assert.Greater(t, len(files), 2)
+
+	var lines int
+	for _, name := range files {
+		raw, err := os.ReadFile(name)
+		require.NoError(t, err)
+		lines += strings.Count(string(raw), "\n")
+	}
+	assert.Equal(t, 10, lines, "max_backups 0 must never remove audit files")
+}
+
+func TestAudit_FileSinkSurvivesFailedRotation(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "audit")
+	path := filepath.Join(dir, "audit.log")
+
+	sink, err := audit.NewFileSink(path, 200, 0)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	rec := audit.Record{Event: audit.EventLogout, Outcome: audit.OutcomeSuccess, UserID: "user-123"}
+	for i := 0; i < 2; i++ {
+		require.NoError(t, sink.Write(context.Background(), rec))
+	}
+
+	// Файл исчез из-под открытого дескриптора: переименовать при ротации нечего
+	require.NoError(t, os.RemoveAll(dir))
+	for i := 0; i < 2; i++ {
+		if err = sink.Write(context.Background(), rec); err != nil {
+			break
+		}
+	}
+	assert.Error(t, err, "failed rotation is reported")
+
+	// Запись продолжается в файл по исходному пути
+	require.NoError(t, sink.Write(context.Background(), rec))
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), `"user_id":"user-123"`)
+}
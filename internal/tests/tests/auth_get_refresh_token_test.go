@@ -2,15 +2,24 @@ package tests
 
 import (
 	"auth/internal/model"
+	"auth/internal/provider"
+	redisRepo "auth/internal/redis"
+	"auth/internal/servises/auth"
+	mocks "auth/internal/tests/mock"
 	"auth/internal/tests/suite"
+	"auth/internal/token"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/s10n41k/protos/gen/go/sso"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"log/slog"
+	"os"
 	"testing"
+	"time"
 )
 
 func TestGetRefreshToken_HappyPath(t *testing.T) {
@@ -19,24 +28,33 @@ func TestGetRefreshToken_HappyPath(t *testing.T) {
 
 	const (
 		oldRefreshToken = "old-refresh-token-123"
-		sessionID       = "user-123:iphone-13"
+		sessionID       = "c2Vzc2lvbi1pZC0xMjM"
 		userID          = "user-123"
+		deviceID        = "iphone-13"
 		userName        = "John Doe"
 		userEmail       = "john@example.com"
 		userRole        = "user"
 	)
 
 	// 1. Настраиваем моки
-	claims := jwt.MapClaims{
-		"session": sessionID,
+	claims := &token.RefreshClaims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: userID},
+		Session:          sessionID,
 	}
 	s.MockToken.On("VerifyRefreshToken", oldRefreshToken).
 		Return(claims, nil).
 		Once()
 
+	s.MockStorage.On("GetSession", mock.Anything, sessionID).
+		Return(&model.Session{ID: sessionID, UserID: userID, DeviceID: deviceID}, nil).
+		Once()
+
 	s.MockStorage.On("Get", mock.Anything, sessionID).
 		Return(oldRefreshToken, nil).
 		Once()
+	s.MockStorage.On("TakeRefreshToken", mock.Anything, sessionID, oldRefreshToken).
+		Return(true, nil).
+		Once()
 
 	s.MockProvider.On("FindOneUsers", mock.Anything, userID).
 		Return(&model.UserRefresh{
@@ -47,6 +65,13 @@ func TestGetRefreshToken_HappyPath(t *testing.T) {
 		}, nil).
 		Once()
 
+	// Время последней активности записывается в сессию
+	s.MockStorage.On("SaveSession", mock.Anything, mock.MatchedBy(func(sess *model.Session) bool {
+		return sess.ID == sessionID && !sess.LastSeenAt.IsZero()
+	}), mock.Anything).
+		Return(nil).
+		Once()
+
 	s.MockStorage.On("IncrementTokenVersion", mock.Anything, sessionID).
 		Return(2, nil).
 		Once()
@@ -59,11 +84,11 @@ func TestGetRefreshToken_HappyPath(t *testing.T) {
 		Return("new-access-token-456", nil).
 		Once()
 
-	s.MockToken.On("GenerateRefreshToken", sessionID).
+	s.MockToken.On("GenerateRefreshToken", userID, sessionID, mock.Anything).
 		Return("new-refresh-token-789", nil).
 		Once()
 
-	s.MockStorage.On("Save", mock.Anything, sessionID, "new-refresh-token-789").
+	s.MockStorage.On("Save", mock.Anything, sessionID, "new-refresh-token-789", mock.Anything).
 		Return(nil).
 		Once()
 
@@ -82,6 +107,7 @@ func TestGetRefreshToken_HappyPath(t *testing.T) {
 	require.NotNil(t, capturedUserRefresh)
 	assert.Equal(t, sessionID, capturedUserRefresh.SessionId)
 	assert.Equal(t, userID, capturedUserRefresh.UserID)
+	assert.Equal(t, deviceID, capturedUserRefresh.DeviceID)
 	assert.Equal(t, 2, capturedUserRefresh.Version)
 	assert.Equal(t, userName, capturedUserRefresh.Name)
 	assert.Equal(t, userEmail, capturedUserRefresh.Email)
@@ -129,3 +155,59 @@ func TestGetRefreshToken_ExpiredToken(t *testing.T) {
 	// 5. Проверяем, что ожидаемые методы были вызваны
 	s.MockToken.AssertExpectations(t)
 }
+
+// failingAccess - JWTManager, который не выпускает первый access token
+type failingAccess struct {
+	*token.JWTManager
+	failed bool
+}
+
+func (f *failingAccess) GenerateAccessToken(u *model.UserRefresh) (string, error) {
+	if !f.failed {
+		f.failed = true
+		return "", errors.New("signer unavailable")
+	}
+	return f.JWTManager.GenerateAccessToken(u)
+}
+
+// Сбой посреди ротации не должен сжигать refresh token: повтор тем же токеном проходит
+func TestGetRefreshToken_FailedRotationKeepsToken(t *testing.T) {
+	_, client := newMiniRedis(t)
+	repo := redisRepo.NewRepositoryRedis(client, time.Hour)
+	manager := &failingAccess{JWTManager: token.NewJWTManager("access-secret", "refresh-secret", time.Minute, time.Hour)}
+	users := mocks.NewProvider()
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	srv := auth.NewServer(users, manager, repo, mocks.NewMockEmailSender(), *log)
+	ctx := context.Background()
+
+	const userID = "user-123"
+	session := &model.Session{ID: "sess-1", UserID: userID, DeviceID: "iphone", CreatedAt: time.Now(), LastSeenAt: time.Now()}
+	require.NoError(t, repo.SaveSession(ctx, session, 0))
+	refresh, err := manager.GenerateRefreshToken(userID, session.ID, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, repo.Save(ctx, session.ID, refresh, 0))
+
+	// Сервис пользователей недоступен - токен не тронут
+	users.On("FindOneUsers", mock.Anything, userID).
+		Return(nil, &provider.UnavailableError{Endpoint: "users:50051", Err: errors.New("connection refused")}).
+		Once()
+	_, err = srv.GetRefreshToken(ctx, refresh)
+	require.ErrorIs(t, err, provider.ErrUnavailable)
+
+	// Сбой после того, как токен забран - токен возвращается
+	users.On("FindOneUsers", mock.Anything, userID).
+		Return(&model.UserRefresh{UserID: userID, Email: "john@gmail.com", Role: "user"}, nil)
+	_, err = srv.GetRefreshToken(ctx, refresh)
+	require.Error(t, err)
+	stored, err := repo.Get(ctx, session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, refresh, stored)
+
+	resp, err := srv.GetRefreshToken(ctx, refresh)
+	require.NoError(t, err)
+	assert.NotEqual(t, refresh, resp.RefreshToken)
+
+	// Замененный токен больше не проходит
+	_, err = srv.GetRefreshToken(ctx, refresh)
+	assert.Error(t, err)
+}
@@ -38,11 +38,20 @@ func TestLogin_HappyPath(t *testing.T) {
 		}, nil).
 		Once()
 
-	s.MockStorage.On("AddSession", mock.Anything, testUserID, testDeviceID).
+	// Сессия получает ID от сервера, а не склейку userID:deviceID
+	var createdSession *model.Session
+	s.MockStorage.On("SaveSession", mock.Anything, mock.MatchedBy(func(sess *model.Session) bool {
+		return sess.UserID == testUserID && sess.DeviceID == testDeviceID && sess.ID != ""
+	}), mock.Anything).
+		Run(func(args mock.Arguments) {
+			createdSession = args.Get(1).(*model.Session)
+		}).
 		Return(nil).
 		Once()
 
-	sessionKey := testUserID + ":" + testDeviceID
+	sessionKey := mock.MatchedBy(func(id string) bool {
+		return createdSession != nil && id == createdSession.ID
+	})
 	s.MockStorage.On("IncrementTokenVersion", mock.Anything, sessionKey).
 		Return(1, nil).
 		Once()
@@ -56,11 +65,11 @@ func TestLogin_HappyPath(t *testing.T) {
 		Return("access-token-123", nil).
 		Once()
 
-	s.MockToken.On("GenerateRefreshToken", sessionKey).
+	s.MockToken.On("GenerateRefreshToken", testUserID, sessionKey, mock.Anything).
 		Return("refresh-token-456", nil).
 		Once()
 
-	s.MockStorage.On("Save", mock.Anything, sessionKey, "refresh-token-456").
+	s.MockStorage.On("Save", mock.Anything, sessionKey, "refresh-token-456", mock.Anything).
 		Return(nil).
 		Once()
 
@@ -79,8 +88,11 @@ func TestLogin_HappyPath(t *testing.T) {
 
 	// 6. Проверяем структуру UserRefresh ПРЯМО В ТЕСТЕ
 	require.NotNil(t, capturedUserRefresh, "UserRefresh should be passed to GenerateAccessToken")
-	assert.Equal(t, sessionKey, capturedUserRefresh.SessionId)
+	require.NotNil(t, createdSession)
+	assert.Equal(t, createdSession.ID, capturedUserRefresh.SessionId)
+	assert.NotContains(t, createdSession.ID, ":")
 	assert.Equal(t, testUserID, capturedUserRefresh.UserID)
+	assert.Equal(t, testDeviceID, capturedUserRefresh.DeviceID)
 	assert.Equal(t, 1, capturedUserRefresh.Version)
 	assert.Equal(t, "Test User", capturedUserRefresh.Name)
 	assert.Equal(t, testEmail, capturedUserRefresh.Email)
@@ -129,7 +141,7 @@ func TestLogin_UserNotFound(t *testing.T) {
 	assert.Contains(t, grpcErr.Message(), "user",
 		"Error message should mention user")
 
-	s.MockStorage.AssertNotCalled(t, "AddSession")
+	s.MockStorage.AssertNotCalled(t, "SaveSession")
 	s.MockStorage.AssertNotCalled(t, "IncrementTokenVersion")
 	s.MockToken.AssertNotCalled(t, "GenerateAccessToken")
 	s.MockToken.AssertNotCalled(t, "GenerateRefreshToken")
@@ -175,7 +187,7 @@ func TestLogin_NoValidPassword(t *testing.T) {
 	assert.Contains(t, grpcErr.Message(), "missing data",
 		"Error message should mention user")
 
-	s.MockStorage.AssertNotCalled(t, "AddSession")
+	s.MockStorage.AssertNotCalled(t, "SaveSession")
 	s.MockStorage.AssertNotCalled(t, "IncrementTokenVersion")
 	s.MockToken.AssertNotCalled(t, "GenerateAccessToken")
 	s.MockToken.AssertNotCalled(t, "GenerateRefreshToken")
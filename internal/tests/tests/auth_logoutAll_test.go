@@ -1,9 +1,12 @@
 package tests
 
 import (
+	"auth/internal/model"
 	"auth/internal/tests/suite"
+	"auth/internal/token"
 	"context"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
 	"github.com/s10n41k/protos/gen/go/sso"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -26,24 +29,34 @@ func TestLogoutAll_HappyPath_MultipleSessions(t *testing.T) {
 		testUserID      = "user-123"
 	)
 
-	// Список активных сессий пользователя
-	deviceIDs := []string{"device-123", "device-456", "device-789"}
+	// Список активных сессий пользователя: две с новыми ID и одна старая,
+	// записанная в списке по deviceID
+	members := []string{"sess-a", "sess-b", "device-789"}
 	sessionIDs := []string{
-		"user-123:device-123",
-		"user-123:device-456",
+		"sess-a",
+		"sess-b",
 		"user-123:device-789",
 	}
 
 	// 1. Мок верификации токена
 	s.MockToken.On("VerifyAccessToken", testAccessToken).
-		Return(jwt.MapClaims{
-			"session": testSessionID,
+		Return(&token.AccessClaims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: testUserID},
+			Session:          testSessionID,
 		}, nil).
 		Once()
 
 	// 2. Мок получения всех сессий пользователя
 	s.MockStorage.On("GetUserSessions", mock.Anything, testUserID).
-		Return(deviceIDs, nil).
+		Return(members, nil).
+		Once()
+	for _, id := range members[:2] {
+		s.MockStorage.On("GetSession", mock.Anything, id).
+			Return(&model.Session{ID: id, UserID: testUserID}, nil).
+			Once()
+	}
+	s.MockStorage.On("GetSession", mock.Anything, "device-789").
+		Return(nil, redis.Nil).
 		Once()
 
 	// 3. Моки удаления refresh токенов для каждой сессии
@@ -92,8 +105,9 @@ func TestLogoutAll_HappyPath_NoActiveSessions(t *testing.T) {
 
 	// 1. Мок верификации токена
 	s.MockToken.On("VerifyAccessToken", testAccessToken).
-		Return(jwt.MapClaims{
-			"session": testSessionID,
+		Return(&token.AccessClaims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: testUserID},
+			Session:          testSessionID,
 		}, nil).
 		Once()
 
@@ -137,8 +151,9 @@ func TestLogoutAll_HappyPath_SingleSession(t *testing.T) {
 
 	// 1. Мок верификации токена
 	s.MockToken.On("VerifyAccessToken", testAccessToken).
-		Return(jwt.MapClaims{
-			"session": testSessionID,
+		Return(&token.AccessClaims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: testUserID},
+			Session:          testSessionID,
 		}, nil).
 		Once()
 
@@ -146,6 +161,9 @@ func TestLogoutAll_HappyPath_SingleSession(t *testing.T) {
 	s.MockStorage.On("GetUserSessions", mock.Anything, testUserID).
 		Return(deviceIDs, nil).
 		Once()
+	s.MockStorage.On("GetSession", mock.Anything, "device-123").
+		Return(nil, redis.Nil).
+		Once()
 
 	// 3. Моки удаления для одной сессии
 	s.MockStorage.On("DeleteRefreshToken", mock.Anything, testSessionID).
@@ -1,7 +1,9 @@
 package tests
 
 import (
+	"auth/internal/model"
 	"auth/internal/tests/suite"
+	"auth/internal/token"
 	"context"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/s10n41k/protos/gen/go/sso"
@@ -20,26 +22,31 @@ func TestLogout_HappyPath(t *testing.T) {
 
 	const (
 		testAccessToken = "valid-access-token"
-		testSessionID   = "user-123:device-123"
+		testSessionID   = "Qm9ndXNTZXNzaW9uSUQ"
 		testUserID      = "user-123"
 		testDeviceID    = "device-123"
 	)
+	session := &model.Session{ID: testSessionID, UserID: testUserID, DeviceID: testDeviceID}
 
 	// 1. Мок верификации токена
 	s.MockToken.On("VerifyAccessToken", testAccessToken).
-		Return(jwt.MapClaims{
-			"session": testSessionID,
-			"ver":     1.0,
+		Return(&token.AccessClaims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: testUserID},
+			Session:          testSessionID,
+			Version:          1,
 		}, nil).
 		Once()
 
-	// 2. Мок получения версии токена из Redis
+	// 2. Моки записи сессии и версии токена из Redis
+	s.MockStorage.On("GetSession", mock.Anything, testSessionID).
+		Return(session, nil).
+		Once()
 	s.MockStorage.On("GetTokenVersion", mock.Anything, testSessionID).
 		Return(1, nil).
 		Once()
 
 	// 3. Моки удаления из Redis
-	s.MockStorage.On("RemoveSession", mock.Anything, testUserID, testDeviceID).
+	s.MockStorage.On("RemoveSession", mock.Anything, session).
 		Return(nil).
 		Once()
 	s.MockStorage.On("DeleteRefreshToken", mock.Anything, testSessionID).
@@ -2,6 +2,7 @@ package tests
 
 import (
 	"auth/internal/model"
+	"auth/internal/sender"
 	"auth/internal/tests/suite"
 	"context"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -58,14 +60,14 @@ func TestRegister_HappyPath(t *testing.T) {
 	})).Return(nil).Once()
 
 	// 3. Email - проверяем что отправляется ТОТ ЖЕ код
-	s.MockSender.On("SendVerificationCode", testEmail, testName, mock.MatchedBy(func(code string) bool {
+	s.MockSender.On("SendVerificationCode", mock.Anything, testEmail, testName, mock.MatchedBy(func(code string) bool {
 		// Проверяем что код совпадает с сохраненным
 		if code != savedCode {
 			t.Errorf("Email code doesn't match saved code: email=%s, saved=%s", code, savedCode)
 			return false
 		}
 		return true
-	})).Return(nil).Once()
+	}), mock.Anything).Return(nil).Once()
 
 	// 4. Вызываем
 	resp, err := s.Client.Register(ctx, &sso.RegisterRequest{
@@ -83,6 +85,30 @@ func TestRegister_HappyPath(t *testing.T) {
 	s.MockStorage.AssertExpectations(t)
 	s.MockSender.AssertExpectations(t)
 }
+
+// Телефон из метаданных не подтвержден: код подтверждения email по нему не уходит
+func TestRegister_IgnoresCallerPhone(t *testing.T) {
+	s := suite.New(t)
+
+	s.MockProvider.On("Exists", mock.Anything, "victim@gmail.com").Return(nil).Once()
+	s.MockStorage.On("SaveTemporarySession", mock.Anything, mock.Anything).Return(nil).Once()
+
+	var phone string
+	s.MockSender.On("SendVerificationCode", mock.Anything, "victim@gmail.com", "Mallory", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { phone = sender.PhoneFrom(args.Get(0).(context.Context)) }).
+		Return(nil).
+		Once()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-phone", "+79990000000")
+	_, err := s.Client.Register(ctx, &sso.RegisterRequest{
+		Name:     "Mallory",
+		Email:    "victim@gmail.com",
+		Password: "Password123",
+	})
+	require.NoError(t, err)
+	assert.Empty(t, phone)
+}
+
 func TestRegister_EmptyFields(t *testing.T) {
 	s := suite.New(t)
 	ctx := context.Background()
@@ -271,25 +297,24 @@ func TestRegister_EmailSendError(t *testing.T) {
 		Return(nil).
 		Once()
 
-	// 3. Email sender возвращает ошибку (асинхронно)
-	s.MockSender.On("SendVerificationCode", testEmail, mock.Anything, mock.Anything).
+	// 3. Email sender не смог поставить письмо в очередь
+	s.MockSender.On("SendVerificationCode", mock.Anything, testEmail, mock.Anything, mock.Anything, mock.Anything).
 		Return(fmt.Errorf("SMTP error")).
 		Once()
 
-	// 4. Вызываем - email отправка асинхронная, не влияет на ответ
+	// 4. Вызываем - ответ приходит только после постановки письма
 	resp, err := s.Client.Register(ctx, &sso.RegisterRequest{
 		Name:     "Test",
 		Email:    testEmail,
 		Password: "Password123",
 	})
 
-	// 5. Проверяем - регистрация должна пройти успешно
-	require.NoError(t, err)
-	assert.NotNil(t, resp)
-	assert.Equal(t, "user:"+testEmail, resp.GetSession())
+	// 5. Проверяем - без письма регистрация не считается успешной
+	require.Error(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
 
-	// 6. Ждем немного и проверяем что email пытался отправиться
-	time.Sleep(100 * time.Millisecond)
+	// 6. Проверяем что email пытался отправиться
 	s.MockSender.AssertExpectations(t)
 
 	// 7. Проверяем все вызовы
@@ -316,7 +341,7 @@ func TestRegister_Concurrent(t *testing.T) {
 			return u.Email == email
 		})).Return(nil).Once()
 
-		s.MockSender.On("SendVerificationCode", email, mock.Anything, mock.Anything).
+		s.MockSender.On("SendVerificationCode", mock.Anything, email, mock.Anything, mock.Anything, mock.Anything).
 			Return(nil).
 			Once()
 	}
@@ -31,16 +31,17 @@ func TestVerifyEmail_HappyPath(t *testing.T) {
 	// 1. Storage возвращает временного пользователя
 	s.MockStorage.On("GetTemporarySession", mock.Anything, session).
 		Return(&model.UserTemporary{
-			SessionId: session,
-			Code:      code,
-			Name:      testName,
-			Email:     testEmail,
-			Password:  testPassword,
+			SessionId:    session,
+			Code:         code,
+			Name:         testName,
+			Email:        testEmail,
+			DisplayEmail: "Test@Gmail.com",
+			Password:     testPassword,
 		}, nil).
 		Once()
 
-	// 2. Provider регистрирует пользователя
-	s.MockProvider.On("RegisterUsers", mock.Anything, testEmail, testName, testPassword).
+	// 2. Provider регистрирует пользователя; адрес как введен сохраняется вместе с ним
+	s.MockProvider.On("RegisterUsers", mock.Anything, testEmail, "Test@Gmail.com", testName, testPassword).
 		Return(expectedID, nil).
 		Once()
 
@@ -206,7 +207,7 @@ func TestVerifyEmail_ProviderRegistrationError(t *testing.T) {
 		Once()
 
 	// 2. Provider возвращает ошибку при регистрации
-	s.MockProvider.On("RegisterUsers", mock.Anything, testEmail, testName, testPassword).
+	s.MockProvider.On("RegisterUsers", mock.Anything, testEmail, "", testName, testPassword).
 		Return("", fmt.Errorf("database error")).
 		Once()
 
@@ -262,7 +263,7 @@ func TestVerifyEmail_CompleteFlow_RegisterAndVerify(t *testing.T) {
 			len(u.Code) == 4
 	})).Return(nil).Once()
 
-	s.MockSender.On("SendVerificationCode", testEmail, testName, mock.Anything).
+	s.MockSender.On("SendVerificationCode", mock.Anything, testEmail, testName, mock.Anything, mock.Anything).
 		Return(nil).
 		Once()
 
@@ -295,7 +296,7 @@ func TestVerifyEmail_CompleteFlow_RegisterAndVerify(t *testing.T) {
 		}, nil).
 		Once()
 
-	s.MockProvider.On("RegisterUsers", mock.Anything, testEmail, testName, testPassword).
+	s.MockProvider.On("RegisterUsers", mock.Anything, testEmail, "", testName, testPassword).
 		Return(expectedID, nil).
 		Once()
 
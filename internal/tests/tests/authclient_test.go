@@ -0,0 +1,247 @@
+package tests
+
+import (
+	"auth/internal/model"
+	"auth/internal/token"
+	"auth/pkg/authclient"
+	"auth/pkg/authclient/authclienttest"
+	"auth/pkg/permissions"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthClient_VerifiesServiceTokens(t *testing.T) {
+	// Токен, выпущенный самим auth service, проверяется тем же секретом
+	manager := token.NewJWTManager("access-secret", "refresh-secret", time.Minute, time.Hour)
+	access, err := manager.GenerateAccessToken(&model.UserRefresh{
+		SessionId:   "sess-1",
+		UserID:      "user-123",
+		DeviceID:    "iphone",
+		Email:       "john@gmail.com",
+		Role:        "admin",
+		Version:     3,
+		Permissions: []string{"tasks:*"},
+	})
+	require.NoError(t, err)
+
+	v, err := authclient.New(authclient.Config{Secret: []byte("access-secret")})
+	require.NoError(t, err)
+
+	claims, err := v.Verify(context.Background(), access)
+	require.NoError(t, err)
+	assert.Equal(t, "user-123", claims.UserID)
+	assert.Equal(t, "iphone", claims.DeviceID)
+	assert.Equal(t, "sess-1", claims.SessionID)
+	assert.Equal(t, "john@gmail.com", claims.Email)
+	assert.Equal(t, "admin", claims.Role)
+	assert.Equal(t, 3, claims.Version)
+	assert.True(t, claims.Can("tasks:delete"))
+	assert.False(t, claims.Can("users:delete"))
+
+	other, err := authclient.New(authclient.Config{Secret: []byte("other-secret")})
+	require.NoError(t, err)
+	_, err = other.Verify(context.Background(), access)
+	assert.ErrorIs(t, err, authclient.ErrInvalidToken)
+
+	_, err = v.Verify(context.Background(), "")
+	assert.ErrorIs(t, err, authclient.ErrMissingToken)
+}
+
+func TestAuthClient_MinterAndClaimChecks(t *testing.T) {
+	minter := authclienttest.NewHMAC("test-secret")
+	minter.Issuer = "auth"
+	minter.Audience = "tasks"
+	v := minter.Verifier(t)
+	ctx := context.Background()
+
+	claims, err := v.Verify(ctx, minter.Mint(t, authclienttest.Token{UserID: "user-1", Role: "user"}))
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", claims.UserID)
+	assert.Equal(t, "auth", claims.Issuer)
+
+	_, err = v.Verify(ctx, minter.Mint(t, authclienttest.Token{ExpiresAt: time.Now().Add(-time.Minute)}))
+	assert.ErrorIs(t, err, authclient.ErrInvalidToken)
+
+	_, err = v.Verify(ctx, minter.Mint(t, authclienttest.Token{Extra: map[string]any{"aud": "billing"}}))
+	assert.ErrorIs(t, err, authclient.ErrInvalidToken)
+
+	// HMAC секрет не принимает RS256 и наоборот
+	rsaMinter := authclienttest.NewRSA(t)
+	_, err = v.Verify(ctx, rsaMinter.Mint(t, authclienttest.Token{}))
+	assert.ErrorIs(t, err, authclient.ErrInvalidToken)
+
+	_, err = rsaMinter.Verifier(t).Verify(ctx, rsaMinter.Mint(t, authclienttest.Token{}))
+	assert.NoError(t, err)
+}
+
+func TestAuthClient_RemoteKeySetIsCached(t *testing.T) {
+	minter := authclienttest.NewRSA(t)
+
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		minter.JWKS().ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	v, err := authclient.New(authclient.Config{JWKSURL: server.URL})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := v.Verify(context.Background(), minter.Mint(t, authclienttest.Token{}))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// Неизвестный kid сразу после загрузки не вызывает повторный запрос
+	stranger := authclienttest.NewRSA(t)
+	_, err = v.Verify(context.Background(), stranger.Mint(t, authclienttest.Token{}))
+	assert.ErrorIs(t, err, authclient.ErrKeyNotFound)
+	assert.Equal(t, int32(1), fetches.Load())
+}
+
+func TestAuthClient_Introspection(t *testing.T) {
+	minter := authclienttest.NewHMAC("test-secret")
+	revoked := minter.Mint(t, authclienttest.Token{UserID: "revoked"})
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		user, pass, _ := r.BasicAuth()
+		assert.Equal(t, "tasks", user)
+		assert.Equal(t, "s3cret", pass)
+		json.NewEncoder(w).Encode(map[string]bool{"active": r.FormValue("token") != revoked})
+	}))
+	defer server.Close()
+
+	cfg := minter.Config()
+	cfg.IntrospectionURL = server.URL
+	cfg.ClientID, cfg.ClientSecret = "tasks", "s3cret"
+	v, err := authclient.New(cfg)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	active := minter.Mint(t, authclienttest.Token{UserID: "active"})
+	_, err = v.Verify(ctx, active)
+	require.NoError(t, err)
+	_, err = v.Verify(ctx, active)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), calls.Load(), "introspection result is cached")
+
+	_, err = v.Verify(ctx, revoked)
+	assert.ErrorIs(t, err, authclient.ErrRevoked)
+
+	server.Close()
+	_, err = v.Verify(ctx, minter.Mint(t, authclienttest.Token{UserID: "new"}))
+	assert.ErrorIs(t, err, authclient.ErrIntrospection)
+
+	cfg.IntrospectionFailOpen = true
+	failOpen, err := authclient.New(cfg)
+	require.NoError(t, err)
+	_, err = failOpen.Verify(ctx, minter.Mint(t, authclienttest.Token{UserID: "new"}))
+	assert.NoError(t, err)
+}
+
+func TestAuthClient_HTTPMiddleware(t *testing.T) {
+	minter := authclienttest.NewHMAC("test-secret")
+	v := minter.Verifier(t)
+
+	handler := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := authclient.FromContext(r.Context())
+		require.True(t, ok)
+		if err := permissions.Require(r.Context(), "tasks:read"); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(claims.UserID))
+	}))
+
+	do := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/tasks", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("Bearer " + minter.Mint(t, authclienttest.Token{UserID: "user-7", Permissions: []string{"tasks:read"}}))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "user-7", rec.Body.String())
+
+	rec = do("Bearer " + minter.Mint(t, authclienttest.Token{UserID: "user-8"}))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = do("")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+
+	rec = do("Bearer garbage")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "invalid_token")
+}
+
+// claimsHealth - health сервер, который отвечает только если claims попали в контекст
+type claimsHealth struct {
+	*health.Server
+}
+
+func (h claimsHealth) Check(ctx context.Context, in *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	claims, ok := authclient.FromContext(ctx)
+	if !ok || claims.UserID != "user-42" {
+		return nil, status.Error(codes.Internal, "claims missing")
+	}
+	return h.Server.Check(ctx, in)
+}
+
+func TestAuthClient_GRPCInterceptors(t *testing.T) {
+	minter := authclienttest.NewHMAC("test-secret")
+	v := minter.Verifier(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(v.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(v.StreamServerInterceptor("/grpc.health.v1.Health/Watch")),
+	)
+	healthpb.RegisterHealthServer(server, claimsHealth{health.NewServer()})
+	go server.Serve(l)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		"authorization", "Bearer "+minter.Mint(t, authclienttest.Token{UserID: "user-42"}))
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+
+	// Публичный стрим-метод пропускается без токена
+	stream, err := client.Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,266 @@
+package tests
+
+import (
+	"auth/internal/audit"
+	"auth/internal/clients"
+	"auth/internal/model"
+	"auth/internal/servises/auth"
+	mocks "auth/internal/tests/mock"
+	"auth/internal/tests/suite"
+	"auth/internal/token"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/s10n41k/protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func testClients() clients.Registry {
+	return clients.NewStatic(
+		&clients.Client{ID: "web", Audiences: []string{"api"}},
+		&clients.Client{
+			ID:         "ios",
+			AccessTTL:  15 * time.Minute,
+			RefreshTTL: 24 * time.Hour,
+			Audiences:  []string{"api", "media"},
+		},
+		&clients.Client{
+			ID:         "admin-tool",
+			SecretHash: clients.HashSecret("s3cret"),
+			GrantTypes: []string{clients.GrantRefreshToken},
+			Audiences:  []string{"admin-api"},
+		},
+	)
+}
+
+func TestClients_Registry(t *testing.T) {
+	_, client := newMiniRedis(t)
+	ctx := context.Background()
+
+	stored := clients.NewRedis(client)
+	require.NoError(t, stored.Save(ctx, &clients.Client{
+		ID:           "android",
+		GrantTypes:   []string{clients.GrantPassword, clients.GrantRefreshToken},
+		AccessTTL:    10 * time.Minute,
+		Audiences:    []string{"api"},
+		RedirectURIs: []string{"com.example.app:/callback"},
+	}))
+
+	registry := clients.Chain{testClients(), stored}
+
+	c, err := registry.Client(ctx, "android")
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, c.AccessTTL)
+	assert.Zero(t, c.RefreshTTL)
+	assert.True(t, c.AllowsRedirect("com.example.app:/callback"))
+	assert.False(t, c.AllowsRedirect("com.example.app:/callback/other"))
+
+	c, err = registry.Client(ctx, "admin-tool")
+	require.NoError(t, err)
+	assert.NoError(t, c.Authenticate("s3cret"))
+	assert.ErrorIs(t, c.Authenticate("wrong"), clients.ErrInvalidSecret)
+	assert.ErrorIs(t, c.Authenticate(""), clients.ErrInvalidSecret)
+	assert.False(t, c.AllowsGrant(clients.GrantPassword))
+	assert.True(t, c.AllowsGrant(clients.GrantRefreshToken))
+
+	c, err = registry.Client(ctx, "ios")
+	require.NoError(t, err)
+	assert.NoError(t, c.Authenticate(""))
+	assert.True(t, c.AllowsGrant(clients.GrantPassword))
+	audience, err := c.Audience(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api", "media"}, audience)
+	audience, err = c.Audience([]string{"media"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"media"}, audience)
+	_, err = c.Audience([]string{"media", "admin-api"})
+	assert.ErrorIs(t, err, clients.ErrAudienceNotAllowed)
+
+	for _, id := range []string{"unknown", ""} {
+		_, err = registry.Client(ctx, id)
+		assert.ErrorIs(t, err, clients.ErrUnknownClient, id)
+	}
+}
+
+func TestClients_AccessTokenAzpAndAudience(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	registry := testClients()
+	clientAudiences := token.WithClientAudiences(func(clientID string) ([]string, error) {
+		c, err := registry.Client(context.Background(), clientID)
+		if err != nil {
+			return nil, err
+		}
+		return c.Audiences, nil
+	})
+	manager := token.NewJWTManager("access-secret", "refresh-secret", time.Hour, 24*time.Hour,
+		token.WithAudience("api"), token.WithClock(func() time.Time { return now }), clientAudiences)
+
+	issue := func(clientID string, audience ...string) string {
+		access, err := manager.GenerateAccessToken(&model.UserRefresh{
+			SessionId: "sess-1",
+			UserID:    "user-123",
+			ClientID:  clientID,
+			Audience:  audience,
+			AccessTTL: 5 * time.Minute,
+		})
+		require.NoError(t, err)
+		return access
+	}
+	access := issue("admin-tool", "admin-api")
+
+	// Сервис принимает токен клиента для logout, хотя aud не его: aud разрешен клиенту
+	claims, err := manager.VerifyAccessToken(access)
+	require.NoError(t, err)
+	assert.Equal(t, "admin-tool", claims.AuthorizedParty)
+	assert.Equal(t, jwt.ClaimStrings{"admin-api"}, claims.Audience)
+	assert.Equal(t, now.Add(5*time.Minute).Unix(), claims.ExpiresAt.Unix())
+
+	// azp сам по себе aud не заменяет
+	for _, access := range []string{
+		issue("admin-tool", "media"),
+		issue("admin-tool", "admin-api", "media"),
+		issue("tv", "admin-api"),
+	} {
+		_, err = manager.VerifyAccessToken(access)
+		assert.ErrorIs(t, err, jwt.ErrTokenInvalidAudience)
+	}
+
+	// Без реестра клиентов - только аудитория сервиса
+	strict := token.NewJWTManager("access-secret", "refresh-secret", time.Hour, 24*time.Hour,
+		token.WithAudience("api"), token.WithClock(func() time.Time { return now }))
+	_, err = strict.VerifyAccessToken(issue("admin-tool", "admin-api"))
+	assert.ErrorIs(t, err, jwt.ErrTokenInvalidAudience)
+	_, err = strict.VerifyAccessToken(issue("web", "api"))
+	assert.NoError(t, err)
+
+	// Без клиента - прежние aud и TTL
+	access, err = manager.GenerateAccessToken(&model.UserRefresh{SessionId: "sess-1", UserID: "user-123"})
+	require.NoError(t, err)
+	claims, err = manager.VerifyAccessToken(access)
+	require.NoError(t, err)
+	assert.Empty(t, claims.AuthorizedParty)
+	assert.Equal(t, jwt.ClaimStrings{"api"}, claims.Audience)
+	assert.Equal(t, now.Add(time.Hour).Unix(), claims.ExpiresAt.Unix())
+}
+
+func TestClients_LoginAppliesClientSettings(t *testing.T) {
+	s := suite.NewWithOptions(t, auth.WithClients(testClients(), "web"))
+
+	const userID = "user-123"
+
+	s.MockProvider.On("LoginUsers", mock.Anything, "john@gmail.com", "Password123").
+		Return(&model.User{UserID: userID, Email: "john@gmail.com", Role: "user"}, nil)
+	s.MockStorage.On("IncrementTokenVersion", mock.Anything, mock.Anything).Return(1, nil)
+	s.MockStorage.On("Save", mock.Anything, mock.Anything, "refresh", mock.Anything).Return(nil)
+
+	var saved []*model.Session
+	s.MockStorage.On("SaveSession", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { saved = append(saved, args.Get(1).(*model.Session)) }).
+		Return(nil)
+
+	var issued []*model.UserRefresh
+	s.MockToken.On("GenerateAccessToken", mock.Anything).
+		Run(func(args mock.Arguments) { issued = append(issued, args.Get(0).(*model.UserRefresh)) }).
+		Return("access", nil)
+
+	var expiresAt []time.Time
+	s.MockToken.On("GenerateRefreshToken", userID, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { expiresAt = append(expiresAt, args.Get(2).(time.Time)) }).
+		Return("refresh", nil)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-client-id", "ios", "x-audience", "media")
+	_, err := s.Client.Login(ctx, &sso.LoginRequest{Email: "john@gmail.com", Password: "Password123", DeviceID: "iphone"})
+	require.NoError(t, err)
+
+	require.Len(t, issued, 1)
+	assert.Equal(t, "ios", issued[0].ClientID)
+	assert.Equal(t, []string{"media"}, issued[0].Audience)
+	assert.Equal(t, 15*time.Minute, issued[0].AccessTTL)
+	assert.Equal(t, "ios", saved[0].ClientID)
+	// refresh TTL клиента короче срока сессии
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), expiresAt[0], time.Minute)
+
+	// Без x-client-id - клиент по умолчанию
+	_, err = s.Client.Login(context.Background(), &sso.LoginRequest{Email: "john@gmail.com", Password: "Password123", DeviceID: "laptop"})
+	require.NoError(t, err)
+
+	require.Len(t, issued, 2)
+	assert.Equal(t, "web", issued[1].ClientID)
+	assert.Equal(t, []string{"api"}, issued[1].Audience)
+	assert.Zero(t, issued[1].AccessTTL)
+	assert.Equal(t, "web", saved[1].ClientID)
+}
+
+func TestClients_LoginRejected(t *testing.T) {
+	sink := mocks.NewMockAuditSink()
+	s := suite.NewWithOptions(t, auth.WithAudit(sink), auth.WithClients(testClients(), ""))
+
+	cases := []struct {
+		name   string
+		md     []string
+		code   codes.Code
+		reason string
+	}{
+		{"no client", nil, codes.Unauthenticated, "invalid_client"},
+		{"unknown client", []string{"x-client-id", "tv"}, codes.Unauthenticated, "invalid_client"},
+		{"wrong secret", []string{"x-client-id", "admin-tool", "x-client-secret", "guess"}, codes.Unauthenticated, "invalid_client"},
+		{"grant not allowed", []string{"x-client-id", "admin-tool", "x-client-secret", "s3cret"}, codes.PermissionDenied, "unauthorized_client"},
+		{"audience not allowed", []string{"x-client-id", "web", "x-audience", "admin-api"}, codes.PermissionDenied, "invalid_audience"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.md != nil {
+				ctx = metadata.AppendToOutgoingContext(ctx, tc.md...)
+			}
+
+			_, err := s.Client.Login(ctx, &sso.LoginRequest{Email: "john@gmail.com", Password: "Password123", DeviceID: "iphone"})
+			require.Error(t, err)
+			assert.Equal(t, tc.code, status.Code(err))
+
+			records := sink.Records()
+			require.NotEmpty(t, records)
+			assert.Equal(t, audit.EventLogin, records[len(records)-1].Event)
+			assert.Equal(t, tc.reason, records[len(records)-1].Reason)
+		})
+	}
+
+	// До проверки пароля дело не доходит
+	s.MockProvider.AssertNotCalled(t, "LoginUsers", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestClients_RefreshBoundToSessionClient(t *testing.T) {
+	sink := mocks.NewMockAuditSink()
+	s := suite.NewWithOptions(t, auth.WithAudit(sink), auth.WithClients(testClients(), "web"))
+
+	s.MockToken.On("VerifyRefreshToken", "refresh").
+		Return(&token.RefreshClaims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: "user-123"},
+			Session:          "sess-1",
+		}, nil).
+		Once()
+	s.MockStorage.On("GetSession", mock.Anything, "sess-1").
+		Return(&model.Session{ID: "sess-1", UserID: "user-123", DeviceID: "iphone", ClientID: "ios"}, nil).
+		Once()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-client-id", "web")
+	_, err := s.Client.GetAccessToken(ctx, &sso.TokenRequest{RefreshToken: "refresh"})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, clients.ErrClientMismatch.Error(), status.Convert(err).Message())
+
+	records := sink.Records()
+	require.NotEmpty(t, records)
+	assert.Equal(t, audit.EventRefresh, records[len(records)-1].Event)
+	assert.Equal(t, "invalid_client", records[len(records)-1].Reason)
+
+	s.MockStorage.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"auth/internal/config"
+	"auth/internal/sender"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dkim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dkimRecord - TXT запись selector._domainkey.domain для публичного ключа
+func dkimRecord(t *testing.T, pub crypto.PublicKey) string {
+	t.Helper()
+
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(key)
+		require.NoError(t, err)
+		return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der)
+	case ed25519.PublicKey:
+		return "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(key)
+	}
+	t.Fatalf("unsupported key %T", pub)
+	return ""
+}
+
+func verifyDKIM(t *testing.T, msg []byte, record string) error {
+	t.Helper()
+
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(msg), &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			if domain != "mail._domainkey.example.com" {
+				t.Errorf("unexpected dkim lookup: %s", domain)
+			}
+			return []string{record}, nil
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, verifications, 1)
+	return verifications[0].Err
+}
+
+func testMessage(t *testing.T) []byte {
+	t.Helper()
+
+	raw, err := (&sender.Message{
+		From:    mail.Address{Name: "Команда TODOLIST", Address: "noreply@example.com"},
+		To:      []mail.Address{{Name: "Иван", Address: "ivan@example.com"}},
+		Subject: "TODOLIST: ваш код подтверждения",
+		Text:    "Ваш код: 1234\n",
+		HTML:    "<p>Ваш код: <b>1234</b></p>",
+	}).Bytes()
+	require.NoError(t, err)
+	return raw
+}
+
+func TestDKIM_SignaturesVerifyAgainstPublicKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		key crypto.Signer
+		pub crypto.PublicKey
+	}{
+		"rsa-sha256":     {rsaKey, &rsaKey.PublicKey},
+		"ed25519-sha256": {edKey, edPub},
+	} {
+		t.Run(name, func(t *testing.T) {
+			signer, err := sender.NewDKIMSigner("example.com", "mail", tc.key)
+			require.NoError(t, err)
+
+			signed, err := signer.Sign(testMessage(t))
+			require.NoError(t, err)
+			assert.Contains(t, string(signed), "a="+name)
+			assert.Contains(t, string(signed), "c=relaxed/relaxed")
+
+			record := dkimRecord(t, tc.pub)
+			require.NoError(t, verifyDKIM(t, signed, record))
+
+			// relaxed/relaxed переживает перенос заголовка и пустые строки, добавленные relay
+			relayed := bytes.Replace(signed, []byte("MIME-Version: 1.0"), []byte("MIME-Version:\r\n\t 1.0"), 1)
+			relayed = append(relayed, "\r\n\r\n"...)
+			assert.NoError(t, verifyDKIM(t, relayed, record))
+
+			// Измененное тело не проходит проверку
+			tampered := bytes.Replace(signed, []byte("1234"), []byte("9999"), 1)
+			assert.Error(t, verifyDKIM(t, tampered, record))
+
+			// Чужой ключ не проходит проверку
+			otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+			assert.Error(t, verifyDKIM(t, signed, dkimRecord(t, otherPub)))
+		})
+	}
+}
+
+func TestDKIM_SenderSignsOutgoingMail(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	keyPath := filepath.Join(t.TempDir(), "dkim.pem")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}), 0o600))
+
+	stub, _ := newSMTPStub(t, false, false, "")
+	cfg := notifySMTPConfig
+	cfg.Host = "127.0.0.1"
+	cfg.Port = stub.port()
+	cfg.UseTLS = false
+	cfg.Timeout = 2
+	cfg.DKIM = config.DKIMConfig{Domain: "example.com", Selector: "mail", KeyPath: keyPath}
+
+	emailSender, err := sender.NewEmailSender(cfg)
+	require.NoError(t, err)
+	require.NoError(t, emailSender.SendVerificationCode(context.Background(), "ivan@example.com", "Иван", "1234", "ru"))
+
+	mails := stub.sent()
+	require.Len(t, mails, 1)
+	require.True(t, strings.HasPrefix(mails[0].data, "DKIM-Signature: "))
+	assert.NoError(t, verifyDKIM(t, []byte(mails[0].data), dkimRecord(t, &key.PublicKey)))
+
+	_, err = sender.LoadDKIMKey(filepath.Join(t.TempDir(), "missing.pem"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,191 @@
+package tests
+
+import (
+	"auth/internal/email"
+	"auth/internal/model"
+	"auth/internal/provider"
+	"auth/internal/servises/auth"
+	"auth/internal/tests/suite"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/s10n41k/protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCanonicalizer_Parse(t *testing.T) {
+	c := email.NewCanonicalizer(email.CanonicalConfig{})
+
+	valid := []struct {
+		in, domain, canonical string
+	}{
+		{"User@Gmail.COM", "gmail.com", "user@gmail.com"},
+		{"  john@gmail.com ", "gmail.com", "john@gmail.com"},
+		{"o'brien+news@corp.example", "corp.example", "o'brien+news@corp.example"},
+		{"{tag}=x/y@corp.example", "corp.example", "{tag}=x/y@corp.example"},
+		{"иван@пример.рф", "xn--e1afmkfd.xn--p1ai", "иван@xn--e1afmkfd.xn--p1ai"},
+		{"Δοκιμή@Παράδειγμα.δοκιμή", "xn--hxajbheg2az3al.xn--jxalpdlp", "δοκιμή@xn--hxajbheg2az3al.xn--jxalpdlp"},
+		{"user@ＥＸＡＭＰＬＥ.com", "example.com", "user@example.com"},
+	}
+	for _, tc := range valid {
+		addr, err := c.Parse(tc.in)
+		require.NoError(t, err, tc.in)
+		assert.Equal(t, tc.domain, addr.Domain, tc.in)
+		assert.Equal(t, tc.canonical, addr.Canonical, tc.in)
+		assert.Equal(t, strings.TrimSpace(tc.in), addr.Display, tc.in)
+	}
+
+	invalid := []struct {
+		in  string
+		err error
+	}{
+		{"invalidemail", email.ErrMissingAt},
+		{"test @gmail.com", email.ErrWhitespace},
+		{"@gmail.com", email.ErrInvalidFormat},
+		{"test@", email.ErrInvalidFormat},
+		{".john@gmail.com", email.ErrInvalidFormat},
+		{"john.@gmail.com", email.ErrInvalidFormat},
+		{"jo..hn@gmail.com", email.ErrInvalidFormat},
+		{`"john doe"@gmail.com`, email.ErrWhitespace},
+		{`"john"@gmail.com`, email.ErrInvalidFormat},
+		{"john@localhost", email.ErrInvalidFormat},
+		{"john@mail.123", email.ErrInvalidFormat},
+		{"john@[192.0.2.1]", email.ErrInvalidFormat},
+		{"john@under_score.com", email.ErrInvalidFormat},
+		{"john@gmail.com.", email.ErrInvalidFormat},
+		{strings.Repeat("a", 65) + "@gmail.com", email.ErrTooLong},
+		{strings.Repeat("j", 64) + "@" + strings.Repeat("a", 63) + "." + strings.Repeat("b", 63) + "." + strings.Repeat("c", 59) + ".com", email.ErrTooLong},
+	}
+	for _, tc := range invalid {
+		_, err := c.Parse(tc.in)
+		assert.ErrorIs(t, err, tc.err, tc.in)
+	}
+}
+
+func TestCanonicalizer_ProviderFolding(t *testing.T) {
+	plain := email.NewCanonicalizer(email.CanonicalConfig{})
+	assert.Equal(t, "john.smith+promo@gmail.com", plain.Canonical("John.Smith+promo@gmail.com"))
+
+	c := email.NewCanonicalizer(email.CanonicalConfig{FoldGmail: true, FoldSubaddress: []string{"Yandex.ru"}})
+
+	assert.Equal(t, "johnsmith@gmail.com", c.Canonical("John.Smith+promo@gmail.com"))
+	assert.Equal(t, "johnsmith@gmail.com", c.Canonical("j.o.h.n.smith@googlemail.com"))
+	assert.Equal(t, "ivan@yandex.ru", c.Canonical("ivan+shop@yandex.ru"))
+	// В остальных доменах точки и +тег значимы
+	assert.Equal(t, "john.smith+promo@mail.ru", c.Canonical("john.smith+promo@mail.ru"))
+
+	addr, err := c.Parse("John.Smith+promo@gmail.com")
+	require.NoError(t, err)
+	assert.Equal(t, "John.Smith+promo@gmail.com", addr.Mailbox(), "delivery keeps what the user typed")
+}
+
+func TestRegister_UsesCanonicalEmailForKeys(t *testing.T) {
+	policy, err := email.NewPolicy(email.PolicyConfig{Mode: email.ModeOpen}, nil, policyLog)
+	require.NoError(t, err)
+
+	s := suite.NewWithOptions(t,
+		auth.WithDomainPolicy(policy),
+		auth.WithEmailCanonicalizer(email.NewCanonicalizer(email.CanonicalConfig{FoldGmail: true})),
+	)
+	ctx := context.Background()
+
+	s.MockProvider.On("Exists", mock.Anything, "johnsmith@gmail.com").Return(nil).Once()
+	s.MockProvider.On("Exists", mock.Anything, "John.Smith@Gmail.com").Return(nil).Once()
+	s.MockProvider.On("Exists", mock.Anything, "john.smith@gmail.com").Return(nil).Once()
+	s.MockStorage.On("SaveTemporarySession", mock.Anything, mock.MatchedBy(func(u *model.UserTemporary) bool {
+		return u.SessionId == "user:johnsmith@gmail.com" &&
+			u.Email == "johnsmith@gmail.com" &&
+			u.DisplayEmail == "John.Smith@Gmail.com"
+	})).Return(nil).Once()
+	s.MockSender.On("SendVerificationCode", mock.Anything, "John.Smith@gmail.com", "John", mock.Anything, mock.Anything).
+		Return(nil).Once()
+
+	resp, err := s.Client.Register(ctx, &sso.RegisterRequest{Name: "John", Email: "John.Smith@Gmail.com", Password: "Password123"})
+	require.NoError(t, err)
+	assert.Equal(t, "user:johnsmith@gmail.com", resp.GetSession())
+
+	// IDN домен уходит в политику и в ключи в punycode
+	s.MockProvider.On("Exists", mock.Anything, "ivan@xn--e1afmkfd.xn--p1ai").Return(nil).Once()
+	s.MockProvider.On("Exists", mock.Anything, "Ivan@Пример.рф").Return(nil).Once()
+	s.MockProvider.On("Exists", mock.Anything, "ivan@пример.рф").Return(nil).Once()
+	s.MockStorage.On("SaveTemporarySession", mock.Anything, mock.Anything).Return(nil).Once()
+	s.MockSender.On("SendVerificationCode", mock.Anything, "Ivan@xn--e1afmkfd.xn--p1ai", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil).Once()
+
+	resp, err = s.Client.Register(ctx, &sso.RegisterRequest{Name: "Ivan", Email: "Ivan@Пример.рф", Password: "Password123"})
+	require.NoError(t, err)
+	assert.Equal(t, "user:ivan@xn--e1afmkfd.xn--p1ai", resp.GetSession())
+
+	s.MockProvider.AssertExpectations(t)
+	s.MockStorage.AssertExpectations(t)
+	s.MockSender.AssertExpectations(t)
+}
+
+func TestLogin_UsesCanonicalEmailWithLegacyFallback(t *testing.T) {
+	s := suite.New(t)
+
+	// Сначала каноническая форма, затем адрес как введен - для старых аккаунтов
+	s.MockProvider.On("LoginUsers", mock.Anything, "john@gmail.com", "Password123").
+		Return(nil, provider.ErrMissingData).Once()
+	s.MockProvider.On("LoginUsers", mock.Anything, "John@GMAIL.com", "Password123").
+		Return(nil, provider.ErrMissingData).Once()
+
+	_, err := s.Client.Login(context.Background(), &sso.LoginRequest{
+		Email:    "John@GMAIL.com",
+		Password: "Password123",
+		DeviceID: "iphone",
+	})
+	require.Error(t, err)
+	s.MockProvider.AssertExpectations(t)
+	s.MockStorage.AssertNotCalled(t, "SaveSession")
+}
+
+func TestLogin_LegacyFallbackWhenCanonicalNotFound(t *testing.T) {
+	s := suite.NewWithOptions(t,
+		auth.WithEmailCanonicalizer(email.NewCanonicalizer(email.CanonicalConfig{FoldGmail: true})))
+
+	// Под канонической формой старого аккаунта нет вовсе
+	s.MockProvider.On("LoginUsers", mock.Anything, "johnsmith@gmail.com", "Password123").
+		Return(nil, provider.ErrUserNotFound).Once()
+	s.MockProvider.On("LoginUsers", mock.Anything, "John.Smith@gmail.com", "Password123").
+		Return(nil, provider.ErrMissingData).Once()
+
+	_, err := s.Client.Login(context.Background(), &sso.LoginRequest{
+		Email:    "John.Smith@gmail.com",
+		Password: "Password123",
+		DeviceID: "iphone",
+	})
+	require.Error(t, err)
+	s.MockProvider.AssertExpectations(t)
+}
+
+func TestRegister_RejectsAccountCreatedBeforeCanonicalization(t *testing.T) {
+	policy, err := email.NewPolicy(email.PolicyConfig{Mode: email.ModeOpen}, nil, policyLog)
+	require.NoError(t, err)
+
+	s := suite.NewWithOptions(t,
+		auth.WithDomainPolicy(policy),
+		auth.WithEmailCanonicalizer(email.NewCanonicalizer(email.CanonicalConfig{FoldGmail: true})),
+	)
+
+	// Аккаунт создан до канонизации и хранится как John.Smith@gmail.com
+	s.MockProvider.On("Exists", mock.Anything, "johnsmith@gmail.com").Return(nil).Once()
+	s.MockProvider.On("Exists", mock.Anything, "John.Smith@gmail.com").Return(provider.ErrUserExists).Once()
+
+	_, err = s.Client.Register(context.Background(), &sso.RegisterRequest{
+		Name:     "John",
+		Email:    "John.Smith@gmail.com",
+		Password: "Password123",
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	s.MockProvider.AssertExpectations(t)
+	s.MockStorage.AssertNotCalled(t, "SaveTemporarySession")
+	s.MockSender.AssertNotCalled(t, "SendVerificationCode")
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"auth/internal/sender"
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessage_MultipartAlternative(t *testing.T) {
+	msg := &sender.Message{
+		From:            mail.Address{Name: "Команда TODOLIST", Address: "noreply@example.com"},
+		To:              []mail.Address{{Name: "Иван", Address: "ivan@example.com"}},
+		ReplyTo:         &mail.Address{Address: "support@example.com"},
+		Subject:         "TODOLIST: ваш код подтверждения",
+		Text:            "Ваш код: 1234\n",
+		HTML:            "<p>Ваш код: <b>1234</b></p>",
+		ListUnsubscribe: "https://example.com/unsubscribe?u=1",
+		Date:            time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	raw, err := msg.Bytes()
+	require.NoError(t, err)
+
+	// Заголовки только ASCII
+	header, _, _ := bytes.Cut(raw, []byte("\r\n\r\n"))
+	for _, b := range header {
+		require.Less(t, b, byte(0x80), "non-ascii byte in headers")
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(parsed.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, msg.Subject, subject)
+
+	from, err := parsed.Header.AddressList("From")
+	require.NoError(t, err)
+	assert.Equal(t, "Команда TODOLIST", from[0].Name)
+
+	assert.Equal(t, "1.0", parsed.Header.Get("MIME-Version"))
+	assert.Equal(t, "Fri, 02 Jan 2026 03:04:05 +0000", parsed.Header.Get("Date"))
+	assert.True(t, strings.HasSuffix(parsed.Header.Get("Message-ID"), "@example.com>"))
+	assert.Equal(t, "<support@example.com>", parsed.Header.Get("Reply-To"))
+	assert.Equal(t, "<https://example.com/unsubscribe?u=1>", parsed.Header.Get("List-Unsubscribe"))
+	assert.Equal(t, "List-Unsubscribe=One-Click", parsed.Header.Get("List-Unsubscribe-Post"))
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		// multipart.Reader сам снимает quoted-printable
+		body, err := io.ReadAll(part)
+		require.NoError(t, err)
+		parts = append(parts, part.Header.Get("Content-Type")+"|"+string(body))
+	}
+
+	require.Len(t, parts, 2)
+	assert.Equal(t, "text/plain; charset=utf-8|Ваш код: 1234\r\n", parts[0])
+	assert.Equal(t, "text/html; charset=utf-8|<p>Ваш код: <b>1234</b></p>", parts[1])
+}
+
+func TestMessage_SinglePartAndHeaderInjection(t *testing.T) {
+	msg := &sender.Message{
+		From:    mail.Address{Address: "noreply@example.com"},
+		To:      []mail.Address{{Address: "ivan@example.com"}},
+		Subject: "Hi\r\nBcc: attacker@example.com",
+		HTML:    "<p>hi</p>",
+	}
+
+	raw, err := msg.Bytes()
+	require.NoError(t, err)
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+	assert.Empty(t, parsed.Header.Get("Bcc"))
+	assert.Empty(t, parsed.Header.Get("List-Unsubscribe"))
+	assert.Equal(t, "text/html; charset=utf-8", parsed.Header.Get("Content-Type"))
+
+	_, err = (&sender.Message{To: msg.To}).Bytes()
+	assert.ErrorIs(t, err, sender.ErrEmptyMessage)
+}
+
+func TestTemplates_RenderTextAlternative(t *testing.T) {
+	templates, err := sender.NewTemplates("", "ru")
+	require.NoError(t, err)
+
+	rendered, err := templates.Render(sender.MessageVerification, "en", templateData)
+	require.NoError(t, err)
+	assert.Contains(t, rendered.Text, "Your verification code: 1234")
+	assert.NotContains(t, rendered.Text, "<")
+}
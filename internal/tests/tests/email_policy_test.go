@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"auth/internal/email"
+	"auth/internal/servises/auth"
+	"auth/internal/tests/suite"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/s10n41k/protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var policyLog = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+// stubResolver - DNS без сети
+type stubResolver struct {
+	mx    map[string][]*net.MX
+	hosts map[string][]string
+	err   error
+}
+
+func (r stubResolver) LookupMX(_ context.Context, name string) ([]*net.MX, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if mx, ok := r.mx[name]; ok {
+		return mx, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r stubResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	if hosts, ok := r.hosts[host]; ok {
+		return hosts, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestEmailPolicy_Modes(t *testing.T) {
+	ctx := context.Background()
+
+	allow, err := email.NewPolicy(email.PolicyConfig{Mode: email.ModeAllowlist, Allow: []string{"gmail.com", "corp.example"}}, nil, policyLog)
+	require.NoError(t, err)
+	assert.NoError(t, allow.Check(ctx, "Gmail.com"))
+	assert.NoError(t, allow.Check(ctx, "eu.corp.example"))
+	assert.ErrorIs(t, allow.Check(ctx, "yahoo.com"), email.ErrDomainNotAllowed)
+
+	block, err := email.NewPolicy(email.PolicyConfig{Mode: email.ModeBlocklist, Block: []string{"spam.example"}}, nil, policyLog)
+	require.NoError(t, err)
+	assert.NoError(t, block.Check(ctx, "corp.example"))
+	assert.ErrorIs(t, block.Check(ctx, "spam.example"), email.ErrDomainBlocked)
+
+	open, err := email.NewPolicy(email.PolicyConfig{Mode: email.ModeOpen, BlockDisposable: true, Allow: []string{"yopmail.com"}}, nil, policyLog)
+	require.NoError(t, err)
+	assert.NoError(t, open.Check(ctx, "corp.example"))
+	assert.ErrorIs(t, open.Check(ctx, "mailinator.com"), email.ErrDisposableDomain)
+	assert.ErrorIs(t, open.Check(ctx, "x.guerrillamail.com"), email.ErrDisposableDomain)
+	// Явно разрешенный домен важнее списка одноразовых
+	assert.NoError(t, open.Check(ctx, "yopmail.com"))
+
+	_, err = email.NewPolicy(email.PolicyConfig{Mode: "strict"}, nil, policyLog)
+	assert.Error(t, err)
+}
+
+func TestEmailPolicy_MX(t *testing.T) {
+	ctx := context.Background()
+	resolver := stubResolver{
+		mx: map[string][]*net.MX{
+			"corp.example":   {{Host: "mx.corp.example.", Pref: 10}},
+			"nomail.example": {{Host: ".", Pref: 0}},
+		},
+		hosts: map[string][]string{"implicit.example": {"192.0.2.1"}},
+	}
+
+	p, err := email.NewPolicy(email.PolicyConfig{Mode: email.ModeOpen, CheckMX: true}, resolver, policyLog)
+	require.NoError(t, err)
+
+	assert.NoError(t, p.Check(ctx, "corp.example"))
+	assert.NoError(t, p.Check(ctx, "implicit.example"))
+	assert.ErrorIs(t, p.Check(ctx, "nomail.example"), email.ErrNoMailServer)
+	assert.ErrorIs(t, p.Check(ctx, "missing.example"), email.ErrNoMailServer)
+
+	// Сбой DNS не должен блокировать регистрацию
+	flaky, err := email.NewPolicy(email.PolicyConfig{Mode: email.ModeOpen, CheckMX: true},
+		stubResolver{err: errors.New("i/o timeout")}, policyLog)
+	require.NoError(t, err)
+	assert.NoError(t, flaky.Check(ctx, "corp.example"))
+}
+
+func TestEmailPolicy_ReloadsFilesWithoutRestart(t *testing.T) {
+	dir := t.TempDir()
+	blockFile := filepath.Join(dir, "block.txt")
+	require.NoError(t, os.WriteFile(blockFile, []byte("# blocked\nspam.example\n"), 0o644))
+
+	p, err := email.NewPolicy(email.PolicyConfig{
+		Mode:           email.ModeBlocklist,
+		BlockFile:      blockFile,
+		ReloadInterval: 10 * time.Millisecond,
+	}, nil, policyLog)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Watch(ctx)
+
+	assert.ErrorIs(t, p.Check(ctx, "spam.example"), email.ErrDomainBlocked)
+	assert.NoError(t, p.Check(ctx, "junk.example"))
+
+	time.Sleep(30 * time.Millisecond)
+	require.NoError(t, os.WriteFile(blockFile, []byte("junk.example\n"), 0o644))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(blockFile, future, future))
+
+	assert.Eventually(t, func() bool {
+		return errors.Is(p.Check(ctx, "junk.example"), email.ErrDomainBlocked) &&
+			p.Check(ctx, "spam.example") == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRegister_CorporateDomainWithOpenPolicy(t *testing.T) {
+	policy, err := email.NewPolicy(email.PolicyConfig{Mode: email.ModeOpen, BlockDisposable: true}, nil, policyLog)
+	require.NoError(t, err)
+
+	s := suite.NewWithOptions(t, auth.WithDomainPolicy(policy))
+	ctx := context.Background()
+
+	s.MockProvider.On("Exists", mock.Anything, "john@corp.example").Return(nil).Once()
+	s.MockStorage.On("SaveTemporarySession", mock.Anything, mock.Anything).Return(nil).Once()
+	s.MockSender.On("SendVerificationCode", mock.Anything, "john@corp.example", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil).Once()
+
+	_, err = s.Client.Register(ctx, &sso.RegisterRequest{Name: "John", Email: "john@corp.example", Password: "Password123"})
+	require.NoError(t, err)
+
+	_, err = s.Client.Register(ctx, &sso.RegisterRequest{Name: "John", Email: "john@mailinator.com", Password: "Password123"})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, err.Error(), "disposable")
+}
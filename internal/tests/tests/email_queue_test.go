@@ -0,0 +1,234 @@
+package tests
+
+import (
+	"auth/internal/sender"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakySender - падает первые failures раз
+type flakySender struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	sent     []string
+}
+
+func (f *flakySender) SendVerificationCode(_ context.Context, toEmail, _, code, _ string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if f.calls <= f.failures {
+		return errors.New("smtp: 451 try again later")
+	}
+	f.sent = append(f.sent, toEmail+":"+code)
+	return nil
+}
+
+func (f *flakySender) SendNewSignIn(_ context.Context, toEmail, _ string, signIn sender.SignIn, _ string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	f.sent = append(f.sent, toEmail+":"+signIn.Device)
+	return nil
+}
+
+func (f *flakySender) snapshot() (int, []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls, append([]string(nil), f.sent...)
+}
+
+func newTestQueue(t *testing.T, next sender.EmailSender, maxAttempts int) (*sender.Queue, context.Context) {
+	t.Helper()
+
+	_, client := newMiniRedis(t)
+	queue := sender.NewQueue(client, next, sender.QueueConfig{
+		Workers:      2,
+		MaxAttempts:  maxAttempts,
+		BaseBackoff:  10 * time.Millisecond,
+		MaxBackoff:   20 * time.Millisecond,
+		PollInterval: 10 * time.Millisecond,
+		Block:        50 * time.Millisecond,
+	}, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = queue.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return queue, ctx
+}
+
+func TestEmailQueue_RetriesUntilSent(t *testing.T) {
+	next := &flakySender{failures: 2}
+	queue, ctx := newTestQueue(t, next, 5)
+
+	id, err := queue.Enqueue(ctx, sender.Job{Type: sender.MessageVerification, To: "john@gmail.com", Name: "John", Code: "1234"})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		status, err := queue.Status(ctx, id)
+		return err == nil && status.State == sender.JobSent
+	}, 3*time.Second, 10*time.Millisecond)
+
+	status, err := queue.Status(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, 3, status.Attempts)
+
+	calls, sent := next.snapshot()
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []string{"john@gmail.com:1234"}, sent)
+}
+
+func TestEmailQueue_DeadLetterAfterMaxAttempts(t *testing.T) {
+	next := &flakySender{failures: 100}
+	queue, ctx := newTestQueue(t, next, 2)
+
+	id, err := queue.Enqueue(ctx, sender.Job{Type: sender.MessageVerification, To: "john@gmail.com", Code: "1234"})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		status, err := queue.Status(ctx, id)
+		return err == nil && status.State == sender.JobDead
+	}, 3*time.Second, 10*time.Millisecond)
+
+	dead, err := queue.DeadLetters(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, id, dead[0].Job.ID)
+	assert.Equal(t, 2, dead[0].Job.Attempt)
+	assert.Contains(t, dead[0].LastError, "try again later")
+	assert.Empty(t, dead[0].Job.Code, "codes must not be kept in dead letters")
+
+	calls, _ := next.snapshot()
+	assert.Equal(t, 2, calls)
+}
+
+func TestEmailQueue_IdempotencyKey(t *testing.T) {
+	next := &flakySender{}
+	queue, ctx := newTestQueue(t, next, 3)
+
+	keyed := sender.WithIdempotencyKey(ctx, "register:john@gmail.com:1")
+	first, err := queue.Enqueue(keyed, sender.Job{Type: sender.MessageVerification, To: "john@gmail.com", Code: "1111"})
+	require.NoError(t, err)
+	second, err := queue.Enqueue(keyed, sender.Job{Type: sender.MessageVerification, To: "john@gmail.com", Code: "1111"})
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	byKey, err := queue.JobID(ctx, "register:john@gmail.com:1")
+	require.NoError(t, err)
+	assert.Equal(t, first, byKey)
+
+	require.Eventually(t, func() bool {
+		_, sent := next.snapshot()
+		return len(sent) == 1
+	}, 3*time.Second, 10*time.Millisecond)
+
+	// Второе письмо не должно появиться
+	time.Sleep(100 * time.Millisecond)
+	calls, _ := next.snapshot()
+	assert.Equal(t, 1, calls)
+
+	_, err = queue.Status(ctx, "missing")
+	assert.ErrorIs(t, err, sender.ErrJobNotFound)
+}
+
+func TestEmailQueue_EnqueueIsDurableWithoutWorkers(t *testing.T) {
+	_, client := newMiniRedis(t)
+	queue := sender.NewQueue(client, &flakySender{}, sender.QueueConfig{}, slog.Default())
+
+	ctx := context.Background()
+	require.NoError(t, queue.SendVerificationCode(ctx, "john@gmail.com", "John", "1234", "en"))
+
+	// Письмо лежит в потоке, даже если ни один worker не запущен
+	length, err := client.XLen(ctx, sender.QueueStream).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), length)
+}
+
+func TestEmailQueue_ProcessedJobsLeaveStream(t *testing.T) {
+	_, client := newMiniRedis(t)
+	next := &flakySender{failures: 1}
+	queue := sender.NewQueue(client, next, sender.QueueConfig{
+		Workers:      1,
+		MaxAttempts:  3,
+		BaseBackoff:  10 * time.Millisecond,
+		MaxBackoff:   20 * time.Millisecond,
+		PollInterval: 10 * time.Millisecond,
+		Block:        50 * time.Millisecond,
+	}, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+
+	id, err := queue.Enqueue(ctx, sender.Job{Type: sender.MessageVerification, To: "john@gmail.com", Code: "1234"})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		status, err := queue.Status(ctx, id)
+		return err == nil && status.State == sender.JobSent
+	}, 3*time.Second, 10*time.Millisecond)
+
+	// Ни первая попытка, ни повтор не остаются в потоке с адресом и кодом
+	length, err := client.XLen(ctx, sender.QueueStream).Result()
+	require.NoError(t, err)
+	assert.Zero(t, length)
+}
+
+func TestEmailQueue_ExpiredCodeIsNotRetried(t *testing.T) {
+	_, client := newMiniRedis(t)
+	next := &flakySender{failures: 100}
+	queue := sender.NewQueue(client, next, sender.QueueConfig{
+		Workers:      1,
+		MaxAttempts:  10,
+		BaseBackoff:  100 * time.Millisecond,
+		MaxBackoff:   time.Second,
+		PollInterval: 10 * time.Millisecond,
+		Block:        50 * time.Millisecond,
+		CodeTTL:      250 * time.Millisecond,
+	}, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+
+	id, err := queue.Enqueue(ctx, sender.Job{Type: sender.MessageVerification, To: "john@gmail.com", Code: "1234"})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		status, err := queue.Status(ctx, id)
+		return err == nil && status.State == sender.JobExpired
+	}, 3*time.Second, 10*time.Millisecond)
+
+	// Повторы 100ms, 200ms: третий опоздал бы - письмо снято, а не похоронено
+	calls, _ := next.snapshot()
+	assert.Equal(t, 2, calls)
+	dead, err := queue.DeadLetters(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, dead)
+
+	length, err := client.XLen(ctx, sender.QueueStream).Result()
+	require.NoError(t, err)
+	assert.Zero(t, length)
+	retries, err := client.ZCard(ctx, "email:retry").Result()
+	require.NoError(t, err)
+	assert.Zero(t, retries)
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"auth/internal/sender"
+	"auth/internal/tests/suite"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/s10n41k/protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+var templateData = sender.TemplateData{
+	UserName:      "John",
+	Code:          "1234",
+	AppName:       "TODOLIST",
+	SupportEmail:  "support@example.com",
+	ExpiryMinutes: 3,
+}
+
+func TestLocaleChain(t *testing.T) {
+	assert.Equal(t, []string{"ru-ru", "ru", "en"}, sender.LocaleChain("ru_RU", "ru"))
+	assert.Equal(t, []string{"de", "ru", "en"}, sender.LocaleChain("de", "ru"))
+	assert.Equal(t, []string{"ru", "en"}, sender.LocaleChain("", "ru"))
+	// Локаль не должна выходить за пределы каталога шаблонов
+	assert.Equal(t, []string{"ru", "en"}, sender.LocaleChain("../../etc", "ru"))
+}
+
+func TestTemplates_EmbeddedLocales(t *testing.T) {
+	templates, err := sender.NewTemplates("", "ru")
+	require.NoError(t, err)
+
+	en, err := templates.Render(sender.MessageVerification, "en-US", templateData)
+	require.NoError(t, err)
+	assert.Equal(t, "en", en.Locale)
+	assert.Equal(t, "TODOLIST: your verification code", en.Subject)
+	assert.Contains(t, en.HTML, "Hello, John!")
+
+	// Неизвестная локаль - язык по умолчанию
+	ru, err := templates.Render(sender.MessageVerification, "de-DE", templateData)
+	require.NoError(t, err)
+	assert.Equal(t, "ru", ru.Locale)
+	assert.Equal(t, "TODOLIST: ваш код подтверждения", ru.Subject)
+	assert.Contains(t, ru.HTML, "Здравствуйте, John!")
+
+	_, err = templates.Render("password_reset", "en", templateData)
+	assert.ErrorIs(t, err, sender.ErrTemplateNotFound)
+}
+
+func TestTemplates_OverrideDir(t *testing.T) {
+	dir := t.TempDir()
+	localeDir := filepath.Join(dir, "verification", "de")
+	require.NoError(t, os.MkdirAll(localeDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(localeDir, "subject.txt"), []byte("Ihr Code"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(localeDir, "body.html"), []byte("<p>Hallo {{.UserName}}, {{.Code}}</p>"), 0o644))
+
+	templates, err := sender.NewTemplates(dir, "ru")
+	require.NoError(t, err)
+
+	de, err := templates.Render(sender.MessageVerification, "de-AT", templateData)
+	require.NoError(t, err)
+	assert.Equal(t, "de", de.Locale)
+	assert.Equal(t, "Ihr Code", de.Subject)
+	assert.Equal(t, "<p>Hallo John, 1234</p>", de.HTML)
+
+	// Отсутствующие в override локали берутся из встроенных шаблонов
+	en, err := templates.Render(sender.MessageVerification, "en", templateData)
+	require.NoError(t, err)
+	assert.Equal(t, "TODOLIST: your verification code", en.Subject)
+
+	_, err = sender.NewTemplates(filepath.Join(dir, "missing"), "ru")
+	assert.Error(t, err)
+}
+
+func TestRegister_PassesLocaleFromMetadata(t *testing.T) {
+	s := suite.New(t)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "accept-language", "en-GB,en;q=0.9,ru;q=0.8")
+
+	s.MockProvider.On("Exists", mock.Anything, "locale@gmail.com").Return(nil).Once()
+	s.MockStorage.On("SaveTemporarySession", mock.Anything, mock.Anything).Return(nil).Once()
+	s.MockSender.On("SendVerificationCode", mock.Anything, "locale@gmail.com", "Locale User", mock.Anything, "en-GB").
+		Return(nil).Once()
+
+	_, err := s.Client.Register(ctx, &sso.RegisterRequest{
+		Name:     "Locale User",
+		Email:    "locale@gmail.com",
+		Password: "Password123",
+	})
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return len(s.MockSender.GetSentEmails()) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "en-GB", s.MockSender.GetSentEmails()[0].Locale)
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"auth/internal/events"
+	redisRepo "auth/internal/redis"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMiniRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return mr, client
+}
+
+func TestOutbox_EventWrittenWithStateChange(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	repo := redisRepo.NewRepositoryRedis(client, time.Hour)
+
+	event := events.New(events.UserLoggedIn, "user-123", map[string]string{"device_id": "iphone"})
+	ctx := events.WithEvents(context.Background(), event)
+
+	require.NoError(t, repo.Save(ctx, "user-123:iphone", "refresh-token", 0))
+
+	assert.True(t, mr.Exists("session:user-123:iphone"))
+
+	entries, err := client.XRange(context.Background(), events.OutboxStream, "-", "+").Result()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// Операция без событий в контексте не пишет в outbox
+	require.NoError(t, repo.DeleteVersionToken(context.Background(), "user-123:iphone"))
+	length, err := client.XLen(context.Background(), events.OutboxStream).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), length)
+}
+
+type flakyBroker struct {
+	*events.MemoryBroker
+	failures atomic.Int32
+}
+
+func (b *flakyBroker) Publish(ctx context.Context, event events.Event) error {
+	if b.failures.Add(-1) >= 0 {
+		return errors.New("broker unavailable")
+	}
+	return b.MemoryBroker.Publish(ctx, event)
+}
+
+func TestOutbox_RelayRedeliversUntilPublished(t *testing.T) {
+	_, client := newMiniRedis(t)
+	repo := redisRepo.NewRepositoryRedis(client, time.Hour)
+
+	event := events.New(events.SessionRevoked, "user-123", nil)
+	require.NoError(t, repo.DeleteRefreshToken(events.WithEvents(context.Background(), event), "user-123:iphone"))
+
+	broker := &flakyBroker{MemoryBroker: events.NewMemoryBroker()}
+	broker.failures.Store(1)
+
+	relay := events.NewRelay(client, broker, events.RelayConfig{
+		Block:     50 * time.Millisecond,
+		ClaimIdle: 100 * time.Millisecond,
+	}, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go relay.Run(ctx)
+
+	require.Eventually(t, func() bool {
+		return len(broker.Published()) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+
+	published := broker.Published()[0]
+	assert.Equal(t, event.ID, published.ID, "idempotency ID must survive the outbox")
+	assert.Equal(t, events.SessionRevoked, published.Type)
+
+	require.Eventually(t, func() bool {
+		pending, err := client.XPending(context.Background(), events.OutboxStream, "outbox-relay").Result()
+		return err == nil && pending.Count == 0
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestOutbox_TrimKeepsEntriesPendingInAnyGroup(t *testing.T) {
+	_, client := newMiniRedis(t)
+	ctx := context.Background()
+
+	var ids []string
+	for range 5 {
+		id, err := client.XAdd(ctx, &redis.XAddArgs{Stream: events.OutboxStream, Values: map[string]any{"event": "{}"}}).Result()
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	for _, group := range []string{"outbox-relay", "webhooks:crm"} {
+		require.NoError(t, client.XGroupCreate(ctx, events.OutboxStream, group, "0").Err())
+	}
+
+	// Брокер обработал все, webhook отстает: прочитал два, первое не подтвердил
+	read := func(group string, count int64) []redis.XMessage {
+		streams, err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group: group, Consumer: "relay-1", Streams: []string{events.OutboxStream, ">"}, Count: count,
+		}).Result()
+		require.NoError(t, err)
+		return streams[0].Messages
+	}
+	for _, msg := range read("outbox-relay", 5) {
+		require.NoError(t, client.XAck(ctx, events.OutboxStream, "outbox-relay", msg.ID).Err())
+	}
+	slow := read("webhooks:crm", 2)
+	require.NoError(t, client.XAck(ctx, events.OutboxStream, "webhooks:crm", slow[1].ID).Err())
+
+	_, err := events.TrimOutbox(ctx, client)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), client.XLen(ctx, events.OutboxStream).Val())
+
+	// Подтвердил первое - уходит все, что раньше непрочитанного
+	require.NoError(t, client.XAck(ctx, events.OutboxStream, "webhooks:crm", slow[0].ID).Err())
+	_, err = events.TrimOutbox(ctx, client)
+	require.NoError(t, err)
+
+	left, err := client.XRange(ctx, events.OutboxStream, "-", "+").Result()
+	require.NoError(t, err)
+	var leftIDs []string
+	for _, msg := range left {
+		leftIDs = append(leftIDs, msg.ID)
+	}
+	// last-delivered-id группы webhook остается, дальше - еще не прочитанные ею записи
+	assert.Equal(t, ids[1:], leftIDs)
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"auth/internal/config"
+	"auth/internal/sender"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var notifySMTPConfig = config.SMTPConfig{
+	FromName:      "TODOLIST",
+	FromEmail:     "noreply@example.com",
+	SupportEmail:  "support@example.com",
+	DefaultLocale: "en",
+}
+
+func newTestDevSink(t *testing.T) (*sender.DevSink, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	sink, err := sender.NewDevSink(notifySMTPConfig, dir,
+		slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})))
+	require.NoError(t, err)
+	return sink, dir
+}
+
+func TestRouter_SMSWhenPhoneKnownElseDevSink(t *testing.T) {
+	type smsCall struct {
+		auth string
+		To   string `json:"to"`
+		Text string `json:"text"`
+	}
+	calls := make(chan smsCall, 1)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var call smsCall
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&call))
+		call.auth = r.Header.Get("Authorization")
+		calls <- call
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer gateway.Close()
+
+	sms, err := sender.NewSMSChannel(notifySMTPConfig, sender.NewHTTPSMSProvider(gateway.URL, "gw-token", time.Second))
+	require.NoError(t, err)
+	dev, dir := newTestDevSink(t)
+
+	router := sender.NewRouter(sms, dev)
+
+	// Есть телефон - SMS
+	ctx := sender.WithPhone(context.Background(), "+79990000000")
+	require.NoError(t, router.SendVerificationCode(ctx, "john@gmail.com", "John", "1234", "ru"))
+
+	call := <-calls
+	assert.Equal(t, "Bearer gw-token", call.auth)
+	assert.Equal(t, "+79990000000", call.To)
+	assert.Contains(t, call.Text, "1234")
+	assert.Contains(t, call.Text, "код подтверждения")
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.Empty(t, files)
+
+	// Нет телефона - следующий канал
+	require.NoError(t, router.SendVerificationCode(context.Background(), "john@gmail.com", "John", "5678", "en"))
+	files, _ = filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.Len(t, files, 1)
+
+	// Номер не в E.164 - как будто его нет
+	for _, phone := range []string{"89990000000", "+7999", "+79990000000;+15550000000"} {
+		require.NoError(t, router.SendVerificationCode(sender.WithPhone(context.Background(), phone), "john@gmail.com", "John", "5678", "en"))
+	}
+	files, _ = filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.Len(t, files, 4)
+	assert.Empty(t, calls)
+
+	// Ни одного адреса
+	assert.ErrorIs(t, sender.NewRouter(sms).SendVerificationCode(context.Background(), "john@gmail.com", "John", "1", ""),
+		sender.ErrNoAddress)
+}
+
+func TestDevSink_InboxServesMessages(t *testing.T) {
+	dev, dir := newTestDevSink(t)
+	require.NoError(t, dev.Deliver(context.Background(), sender.Notification{
+		Type:   sender.MessageVerification,
+		Email:  "john@gmail.com",
+		Name:   "John",
+		Code:   "4321",
+		Locale: "en",
+	}))
+
+	server := httptest.NewServer(dev.Handler())
+	defer server.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	code, list := get("/")
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, list, "TODOLIST: your verification code")
+	assert.Contains(t, list, "john@gmail.com")
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	name := filepath.Base(files[0])
+
+	code, html := get("/html/" + name)
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, html, "Hello, John!")
+
+	code, raw := get("/raw/" + name)
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, raw, "Content-Type: multipart/alternative")
+	assert.Contains(t, raw, "Your verification code: 4321")
+
+	code, _ = get("/raw/..%2F..%2Fetc%2Fpasswd")
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"auth/internal/password"
+	"auth/internal/servises/auth"
+	"auth/internal/tests/suite"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/s10n41k/protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func violatedRules(t *testing.T, err error) []password.Rule {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var violations *password.ViolationError
+	require.ErrorAs(t, err, &violations)
+	assert.ErrorIs(t, err, password.ErrWeakPassword)
+	return violations.Rules()
+}
+
+func TestPasswordPolicy_Rules(t *testing.T) {
+	p := password.NewPolicy(password.Config{
+		MinLength:     10,
+		MaxLength:     20,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+	})
+
+	cases := []struct {
+		password string
+		rules    []password.Rule
+	}{
+		{"Xk4!qm9Lz#", nil},
+		{"Xk4!q", []password.Rule{password.RuleMinLength}},
+		{"Xk4!qm9Lz#Xk4!qm9Lz#1", []password.Rule{password.RuleMaxLength}},
+		{"xk4!qm9lz#", []password.Rule{password.RuleUpper}},
+		{"XK4!QM9LZ#", []password.Rule{password.RuleLower}},
+		{"xkq", []password.Rule{password.RuleMinLength, password.RuleUpper, password.RuleDigit, password.RuleSymbol}},
+		// Длина в символах, а не в байтах
+		{"Пароль4!ёж", nil},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.rules, violatedRules(t, p.Check(tc.password, "", "")), tc.password)
+	}
+}
+
+func TestPasswordPolicy_PersonalInfo(t *testing.T) {
+	p := password.DefaultPolicy()
+
+	assert.Equal(t, []password.Rule{password.RuleContainsEmail},
+		violatedRules(t, p.Check("Johnsmith1987x", "john.smith@gmail.com", "J")))
+	assert.Equal(t, []password.Rule{password.RuleContainsEmail},
+		violatedRules(t, p.Check("JOHN.SMITH-7zq", "John.Smith+promo@gmail.com", "J")))
+	assert.Equal(t, []password.Rule{password.RuleContainsName},
+		violatedRules(t, p.Check("Ivanov2024!zq", "user@gmail.com", "Petr Ivanov")))
+	// Короткие фрагменты не считаются совпадением
+	assert.NoError(t, p.Check("Alxq8Zr3!w", "al@gmail.com", "Al"))
+}
+
+func TestPasswordPolicy_Entropy(t *testing.T) {
+	assert.Less(t, password.Entropy("aaaaaaaa"), password.Entropy("qmzkxbtw"))
+	assert.Less(t, password.Entropy("abcdefgh"), password.Entropy("qmzkxbtw"))
+	assert.Less(t, password.Entropy("qwertyui"), password.Entropy("qmzkxbtw"))
+	assert.Less(t, password.Entropy("qmzkxbtw"), password.Entropy("qmzK4!tw"))
+
+	p := password.DefaultPolicy()
+	assert.NoError(t, p.Check("Password123", "john@gmail.com", "John"))
+	assert.Equal(t, []password.Rule{password.RuleWeak}, violatedRules(t, p.Check("Aaaaaaa1", "", "")))
+	assert.Equal(t, []password.Rule{password.RuleWeak}, violatedRules(t, p.Check("Qwerty12", "", "")))
+}
+
+// writeBreachedFile - файл в формате выгрузки HIBP: "SHA1:COUNT", по возрастанию хеша
+func writeBreachedFile(t *testing.T, passwords ...string) string {
+	t.Helper()
+
+	lines := make([]string, 0, len(passwords))
+	for i, p := range passwords {
+		sum := sha1.Sum([]byte(p))
+		lines = append(lines, fmt.Sprintf("%s:%d", strings.ToUpper(hex.EncodeToString(sum[:])), i+1))
+	}
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o644))
+	return path
+}
+
+func TestPasswordPolicy_BreachedCorpus(t *testing.T) {
+	corpus, err := password.OpenPrefixFile(writeBreachedFile(t, "Password123", "Summer2024!", "Qz8!kLm2Xw"))
+	require.NoError(t, err)
+	defer corpus.Close()
+
+	for _, p := range []string{"Password123", "Summer2024!", "Qz8!kLm2Xw"} {
+		found, err := corpus.Contains(p)
+		require.NoError(t, err)
+		assert.True(t, found, p)
+	}
+	found, err := corpus.Contains("Qz8!kLm2Xv")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	p := password.NewPolicy(password.Config{MinLength: 8, Breached: corpus})
+	assert.Equal(t, []password.Rule{password.RuleBreached}, violatedRules(t, p.Check("Summer2024!", "", "")))
+	assert.NoError(t, p.Check("Winter2024!", "", ""))
+
+	unsorted := filepath.Join(t.TempDir(), "unsorted.txt")
+	require.NoError(t, os.WriteFile(unsorted, []byte("FFFFF0000000000000000000000000000000000:1\n00000000000000000000000000000000000000000:1\n"), 0o644))
+	_, err = password.OpenPrefixFile(unsorted)
+	assert.ErrorIs(t, err, password.ErrCorpusNotSorted)
+}
+
+func TestRegister_PasswordViolationsAsDetails(t *testing.T) {
+	s := suite.NewWithOptions(t, auth.WithPasswordPolicy(password.NewPolicy(password.Config{
+		MinLength:     12,
+		RequireUpper:  true,
+		RequireSymbol: true,
+	})))
+
+	_, err := s.Client.Register(context.Background(), &sso.RegisterRequest{
+		Name:     "John",
+		Email:    "john@gmail.com",
+		Password: "john1234",
+	})
+	require.Error(t, err)
+
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	assert.Contains(t, st.Message(), "password")
+
+	var reasons []string
+	for _, d := range st.Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.GetFieldViolations() {
+				assert.Equal(t, "password", v.GetField())
+				assert.NotEmpty(t, v.GetDescription())
+				reasons = append(reasons, v.GetReason())
+			}
+		}
+	}
+	assert.Equal(t, []string{"min_length", "upper", "symbol", "contains_email", "contains_name"}, reasons)
+
+	s.MockProvider.AssertNotCalled(t, "Exists")
+}
@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"auth/internal/model"
+	"auth/internal/provider/users"
+	"auth/internal/rbac"
+	"auth/internal/servises/auth"
+	"auth/internal/tests/suite"
+	"auth/internal/token"
+	"auth/pkg/permissions"
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/s10n41k/protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestPermissionSet_Wildcards(t *testing.T) {
+	s := permissions.Parse("tasks:* profile:read  comments:mod:*")
+
+	assert.True(t, s.Has("tasks:read"))
+	assert.True(t, s.Has("tasks:comments:write"))
+	assert.True(t, s.Has("profile:read"))
+	assert.False(t, s.Has("profile:write"))
+	assert.True(t, s.Has("comments:mod:delete"))
+	assert.False(t, s.Has("comments:delete"))
+	assert.Equal(t, []string{"profile:write"}, s.Missing("tasks:read", "profile:write"))
+
+	assert.True(t, permissions.NewSet("*").HasAll("users:delete", "tasks:read"))
+
+	fromArray := permissions.FromClaims(map[string]any{"permissions": []any{"users:read", 42}})
+	assert.Equal(t, []string{"users:read"}, fromArray.List())
+	assert.Empty(t, permissions.FromClaims(map[string]any{"role": "admin"}))
+}
+
+func TestRoles_ResolveWithInheritanceAndGrants(t *testing.T) {
+	roles, err := rbac.NewRoles(map[string][]string{
+		"user":      {"tasks:read", "tasks:write"},
+		"moderator": {"@user", "comments:*"},
+		"admin":     {"@moderator", "users:*"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"comments:*", "tasks:read", "tasks:write", "users:*"}, roles.Resolve("admin", nil))
+	assert.Equal(t, []string{"billing:read", "tasks:read", "tasks:write"}, roles.Resolve("user", []string{"billing:read", "tasks:read"}))
+	assert.Equal(t, []string{"billing:read"}, roles.Resolve("guest", []string{"billing:read"}))
+	assert.Nil(t, roles.Resolve("guest", nil))
+
+	_, err = rbac.NewRoles(map[string][]string{"a": {"@b"}, "b": {"@a"}})
+	assert.Error(t, err)
+	_, err = rbac.NewRoles(map[string][]string{"a": {"@missing"}})
+	assert.Error(t, err)
+}
+
+func TestLogin_AccessTokenCarriesPermissions(t *testing.T) {
+	roles, err := rbac.NewRoles(map[string][]string{"user": {"tasks:read", "tasks:write"}})
+	require.NoError(t, err)
+
+	s := suite.NewWithOptions(t, auth.WithRoles(roles))
+
+	s.MockProvider.On("LoginUsers", mock.Anything, "john@gmail.com", "Password123").
+		Return(&model.User{UserID: "user-123", Name: "John", Email: "john@gmail.com", Role: "user",
+			Permissions: []string{"billing:read"}}, nil).
+		Once()
+	s.MockStorage.On("SaveSession", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	s.MockStorage.On("IncrementTokenVersion", mock.Anything, mock.Anything).Return(1, nil).Once()
+
+	var captured *model.UserRefresh
+	s.MockToken.On("GenerateAccessToken", mock.Anything).
+		Run(func(args mock.Arguments) { captured = args.Get(0).(*model.UserRefresh) }).
+		Return("access", nil).Once()
+	s.MockToken.On("GenerateRefreshToken", "user-123", mock.Anything, mock.Anything).Return("refresh", nil).Once()
+	s.MockStorage.On("Save", mock.Anything, mock.Anything, "refresh", mock.Anything).Return(nil).Once()
+
+	_, err = s.Client.Login(context.Background(), &sso.LoginRequest{Email: "john@gmail.com", Password: "Password123", DeviceID: "iphone"})
+	require.NoError(t, err)
+
+	require.NotNil(t, captured)
+	assert.Equal(t, []string{"billing:read", "tasks:read", "tasks:write"}, captured.Permissions)
+
+	// В JWT права попадают в claim scope
+	manager := token.NewJWTManager("access-secret", "refresh-secret", time.Minute, time.Hour)
+	signed, err := manager.GenerateAccessToken(captured)
+	require.NoError(t, err)
+	claims, err := manager.VerifyAccessToken(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "billing:read tasks:read tasks:write", claims.Scope)
+}
+
+func TestGRPCProvider_DecodesPermissions(t *testing.T) {
+	host, port := startUsersGRPC(t, func(method string, req map[protowire.Number]string) ([]byte, error) {
+		b := encodeUser("user-123", "john@gmail.com", "John", "user")
+		for _, p := range []string{"billing:read", "reports:export"} {
+			b = protowire.AppendTag(b, 6, protowire.BytesType)
+			b = protowire.AppendString(b, p)
+		}
+		return b, nil
+	})
+
+	p, err := users.NewGRPCProvider(host, port, false, time.Second, nil,
+		*slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})))
+	require.NoError(t, err)
+	defer p.Close()
+
+	user, err := p.FindOneUsers(context.Background(), "user-123")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"billing:read", "reports:export"}, user.Permissions)
+}
+
+func TestPermissionInterceptor(t *testing.T) {
+	manager := token.NewJWTManager("access-secret", "refresh-secret", time.Minute, time.Hour)
+	verifier := permissions.VerifierFunc(func(_ context.Context, raw string) (map[string]any, error) {
+		claims, err := manager.VerifyAccessToken(raw)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{permissions.Claim: claims.Scope}, nil
+	})
+
+	interceptor := permissions.NewInterceptor(verifier, permissions.Rules{
+		"/tasks.Tasks/Delete": {"tasks:delete"},
+		"/tasks.Tasks/List":   {"tasks:read"},
+		"/admin.Admin/*":      {"users:*"},
+	}, permissions.WithPublic("/tasks.Tasks/Health")).Unary()
+
+	access, err := manager.GenerateAccessToken(&model.UserRefresh{
+		SessionId:   "user-123:iphone",
+		Permissions: []string{"tasks:read", "tasks:write"},
+	})
+	require.NoError(t, err)
+
+	call := func(method, bearer string) (context.Context, error) {
+		ctx := context.Background()
+		if bearer != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+bearer))
+		}
+		var handled context.Context
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, _ any) (any, error) {
+				handled = ctx
+				return nil, nil
+			})
+		return handled, err
+	}
+
+	ctx, err := call("/tasks.Tasks/List", access)
+	require.NoError(t, err)
+	assert.NoError(t, permissions.Require(ctx, "tasks:write"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(permissions.Require(ctx, "tasks:delete")))
+
+	_, err = call("/tasks.Tasks/Delete", access)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, err.Error(), "tasks:delete")
+
+	_, err = call("/admin.Admin/Ban", access)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = call("/tasks.Tasks/List", "")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = call("/tasks.Tasks/List", "forged.token.value")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = call("/tasks.Tasks/Health", "")
+	assert.NoError(t, err)
+
+	// Метод без правила закрыт по умолчанию
+	_, err = call("/tasks.Tasks/Unlisted", access)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = call("/tasks.Tasks/Unlisted", "")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// Явное разрешение - прежнее поведение
+	open := permissions.NewInterceptor(verifier, permissions.Rules{}, permissions.WithAllowUnlisted()).Unary()
+	_, err = open(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/tasks.Tasks/Unlisted"},
+		func(context.Context, any) (any, error) { return nil, nil })
+	assert.NoError(t, err)
+}
@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"auth/internal/events"
+	"auth/internal/model"
+	"auth/internal/provider"
+	"auth/internal/provider/users"
+	mocks "auth/internal/tests/mock"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var cacheLog = *slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+func TestCachingProvider_ReadThroughAndNegative(t *testing.T) {
+	next := mocks.NewProvider()
+	cache := users.NewCachingProvider(next, users.CacheConfig{Size: 10, TTL: time.Minute}, nil, cacheLog)
+	ctx := context.Background()
+
+	next.On("FindOneUsers", mock.Anything, "user-123").
+		Return(&model.UserRefresh{UserID: "user-123", Role: "user", Permissions: []string{"tasks:read"}}, nil).
+		Once()
+	next.On("FindOneUsers", mock.Anything, "user-404").
+		Return(nil, fmt.Errorf("%w: user-404", provider.ErrUserNotFound)).
+		Once()
+
+	for i := 0; i < 3; i++ {
+		user, err := cache.FindOneUsers(ctx, "user-123")
+		require.NoError(t, err)
+		assert.Equal(t, "user-123", user.UserID)
+
+		_, err = cache.FindOneUsers(ctx, "user-404")
+		assert.ErrorIs(t, err, provider.ErrUserNotFound)
+	}
+
+	// Изменение возвращенного значения не портит кеш
+	user, _ := cache.FindOneUsers(ctx, "user-123")
+	user.Role = "admin"
+	user.Permissions[0] = "tasks:delete"
+	user, _ = cache.FindOneUsers(ctx, "user-123")
+	assert.Equal(t, "user", user.Role)
+	assert.Equal(t, []string{"tasks:read"}, user.Permissions)
+
+	next.AssertExpectations(t)
+}
+
+func TestCachingProvider_RedisTierAndEventPurge(t *testing.T) {
+	_, client := newMiniRedis(t)
+	ctx := context.Background()
+
+	next := mocks.NewProvider()
+	next.On("FindOneUsers", mock.Anything, "user-123").
+		Return(&model.UserRefresh{UserID: "user-123", Role: "user"}, nil).
+		Once()
+
+	first := users.NewCachingProvider(next, users.CacheConfig{Size: 10}, users.NewRedisUserCache(client), cacheLog)
+	second := users.NewCachingProvider(next, users.CacheConfig{Size: 10}, users.NewRedisUserCache(client), cacheLog)
+
+	_, err := first.FindOneUsers(ctx, "user-123")
+	require.NoError(t, err)
+
+	// Второй инстанс берет пользователя из Redis, а не из users service
+	_, err = second.FindOneUsers(ctx, "user-123")
+	require.NoError(t, err)
+	next.AssertNumberOfCalls(t, "FindOneUsers", 1)
+
+	broker := events.NewMemoryBroker()
+	unsubscribe, err := second.InvalidateOn(broker, events.UserUpdated)
+	require.NoError(t, err)
+	defer unsubscribe()
+
+	require.NoError(t, broker.Publish(ctx, events.New(events.UserUpdated, "user-123", nil)))
+
+	next.On("FindOneUsers", mock.Anything, "user-123").
+		Return(&model.UserRefresh{UserID: "user-123", Role: "admin"}, nil).
+		Once()
+
+	user, err := second.FindOneUsers(ctx, "user-123")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", user.Role)
+	next.AssertNumberOfCalls(t, "FindOneUsers", 2)
+}
+
+func TestCachingProvider_PromotedEntryKeepsRemoteTTL(t *testing.T) {
+	_, client := newMiniRedis(t)
+	ctx := context.Background()
+
+	next := mocks.NewProvider()
+	next.On("FindOneUsers", mock.Anything, "user-123").
+		Return(&model.UserRefresh{UserID: "user-123", Role: "user"}, nil)
+
+	// В Redis запись живет 300ms, в LRU - минуту
+	writer := users.NewCachingProvider(next, users.CacheConfig{Size: 10, TTL: time.Minute, RemoteTTL: 300 * time.Millisecond},
+		users.NewRedisUserCache(client), cacheLog)
+	reader := users.NewCachingProvider(next, users.CacheConfig{Size: 10, TTL: time.Minute},
+		users.NewRedisUserCache(client), cacheLog)
+
+	_, err := writer.FindOneUsers(ctx, "user-123")
+	require.NoError(t, err)
+	_, err = reader.FindOneUsers(ctx, "user-123")
+	require.NoError(t, err)
+	next.AssertNumberOfCalls(t, "FindOneUsers", 1)
+
+	// Запись в Redis истекла - из LRU второго инстанса она ушла вместе с ней
+	require.NoError(t, client.Del(ctx, "users_cache:user-123").Err())
+	time.Sleep(400 * time.Millisecond)
+
+	_, err = reader.FindOneUsers(ctx, "user-123")
+	require.NoError(t, err)
+	next.AssertNumberOfCalls(t, "FindOneUsers", 2)
+}
@@ -0,0 +1,169 @@
+package tests
+
+import (
+	"auth/internal/provider"
+	"auth/internal/provider/users"
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// rawCodec - пропускает байты как есть, чтобы тестовый сервер
+// разбирал protobuf независимо от кодека провайдера
+type rawCodec struct{}
+
+func (rawCodec) Name() string { return "proto" }
+
+func (rawCodec) Marshal(v any) ([]byte, error) { return *(v.(*[]byte)), nil }
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	*(v.(*[]byte)) = append([]byte(nil), data...)
+	return nil
+}
+
+func decodeStrings(t *testing.T, data []byte) map[protowire.Number]string {
+	t.Helper()
+
+	fields := make(map[protowire.Number]string)
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		require.GreaterOrEqual(t, n, 0)
+		data = data[n:]
+		require.Equal(t, protowire.BytesType, typ)
+		v, n := protowire.ConsumeString(data)
+		require.GreaterOrEqual(t, n, 0)
+		fields[num] = v
+		data = data[n:]
+	}
+	return fields
+}
+
+func encodeUser(id, email, name, role string) []byte {
+	var b []byte
+	for i, v := range []string{id, email, name, role} {
+		b = protowire.AppendTag(b, protowire.Number(i+1), protowire.BytesType)
+		b = protowire.AppendString(b, v)
+	}
+	return b
+}
+
+// startUsersGRPC - фейковый users service на сыром protobuf
+func startUsersGRPC(t *testing.T, handler func(method string, req map[protowire.Number]string) ([]byte, error)) (string, string) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := grpc.NewServer(
+		grpc.ForceServerCodec(rawCodec{}),
+		grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+			method, _ := grpc.MethodFromServerStream(stream)
+
+			var in []byte
+			if err := stream.RecvMsg(&in); err != nil {
+				return err
+			}
+			out, err := handler(method, decodeStrings(t, in))
+			if err != nil {
+				return err
+			}
+			return stream.SendMsg(&out)
+		}),
+	)
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	return host, port
+}
+
+func TestGRPCProvider_CallsAndErrorMapping(t *testing.T) {
+	host, port := startUsersGRPC(t, func(method string, req map[protowire.Number]string) ([]byte, error) {
+		switch method {
+		case "/users.Users/Login":
+			if req[2] != "Password123" {
+				return nil, status.Error(codes.Unauthenticated, "bad password")
+			}
+			return encodeUser("user-123", req[1], "John", "admin"), nil
+		case "/users.Users/FindOne":
+			if req[1] != "user-123" {
+				return nil, status.Error(codes.NotFound, "no such user")
+			}
+			return encodeUser("user-123", "john@gmail.com", "John", "admin"), nil
+		case "/users.Users/Register":
+			// Адрес как ввел пользователь сохраняется вместе с аккаунтом
+			if req[4] != "John.Smith@gmail.com" {
+				return nil, status.Error(codes.InvalidArgument, "missing display_email")
+			}
+			return nil, status.Error(codes.AlreadyExists, "exists")
+		case "/users.Users/Exists":
+			b := protowire.AppendTag(nil, 1, protowire.VarintType)
+			return protowire.AppendVarint(b, 1), nil
+		}
+		return nil, status.Error(codes.Unimplemented, method)
+	})
+
+	p, err := users.NewGRPCProvider(host, port, false, time.Second, nil,
+		*slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})))
+	require.NoError(t, err)
+	defer p.Close()
+
+	ctx := context.Background()
+
+	user, err := p.LoginUsers(ctx, "john@gmail.com", "Password123")
+	require.NoError(t, err)
+	assert.Equal(t, "user-123", user.UserID)
+	assert.Equal(t, "john@gmail.com", user.Email)
+	assert.Equal(t, "admin", user.Role)
+
+	_, err = p.LoginUsers(ctx, "john@gmail.com", "wrong")
+	assert.ErrorIs(t, err, provider.ErrMissingData)
+
+	found, err := p.FindOneUsers(ctx, "user-123")
+	require.NoError(t, err)
+	assert.Equal(t, "John", found.Name)
+
+	_, err = p.FindOneUsers(ctx, "user-404")
+	assert.ErrorIs(t, err, provider.ErrUserNotFound)
+
+	_, err = p.RegisterUsers(ctx, "john@gmail.com", "John.Smith@gmail.com", "John", "Password123")
+	assert.ErrorIs(t, err, provider.ErrUserExists)
+
+	assert.ErrorIs(t, p.Exists(ctx, "john@gmail.com"), provider.ErrUserExists)
+}
+
+func TestGRPCProvider_UnavailableAndDeadline(t *testing.T) {
+	host, port := startUsersGRPC(t, func(method string, req map[protowire.Number]string) ([]byte, error) {
+		if method == "/users.Users/FindOne" {
+			time.Sleep(200 * time.Millisecond)
+			return encodeUser("user-123", "", "", ""), nil
+		}
+		return nil, status.Error(codes.Unavailable, "overloaded")
+	})
+
+	p, err := users.NewGRPCProvider(host, port, false, time.Second, nil,
+		*slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})))
+	require.NoError(t, err)
+	defer p.Close()
+
+	err = p.Exists(context.Background(), "john@gmail.com")
+	assert.ErrorIs(t, err, provider.ErrUnavailable)
+
+	// Дедлайн вызывающего передается в users service и не считается недоступностью
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = p.FindOneUsers(ctx, "user-123")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, provider.ErrUnavailable)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"auth/internal/provider"
+	"auth/internal/provider/breaker"
+	"auth/internal/provider/users"
+	"auth/internal/tests/suite"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/s10n41k/protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newHTTPUsersProvider(t *testing.T, handler http.HandlerFunc) users.Provider {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	return users.NewUsersProvider(u.Scheme, u.Hostname(), u.Port(), time.Second, nil,
+		*slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})))
+}
+
+func TestResilientProvider_RetriesIdempotentCalls(t *testing.T) {
+	var calls atomic.Int32
+	base := newHTTPUsersProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"id":"user-123","name":"John","email":"john@gmail.com","role":"user"}`)
+	})
+
+	p := users.NewResilientProvider(base, users.ResilienceConfig{
+		Retry: users.RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond},
+	}, *slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})), nil)
+
+	user, err := p.FindOneUsers(context.Background(), "user-123")
+	require.NoError(t, err)
+	assert.Equal(t, "user-123", user.UserID)
+	assert.Equal(t, int32(3), calls.Load())
+
+	// Login не идемпотентен - без повторов
+	calls.Store(0)
+	_, err = p.LoginUsers(context.Background(), "john@gmail.com", "Password123")
+	assert.ErrorIs(t, err, provider.ErrUnavailable)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestResilientProvider_BreakerOpensAndFailsFast(t *testing.T) {
+	var calls atomic.Int32
+	base := newHTTPUsersProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	var changes []breaker.State
+	p := users.NewResilientProvider(base, users.ResilienceConfig{
+		Breaker: breaker.Config{FailureThreshold: 2, OpenTimeout: time.Hour},
+	}, *slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})),
+		func(endpoint string, from, to breaker.State) {
+			changes = append(changes, to)
+		})
+
+	for i := 0; i < 2; i++ {
+		_, err := p.LoginUsers(context.Background(), "john@gmail.com", "Password123")
+		require.ErrorIs(t, err, provider.ErrUnavailable)
+	}
+	assert.Equal(t, breaker.Open, p.States()[users.EndpointLogin])
+	assert.Equal(t, breaker.Closed, p.States()[users.EndpointFindOne], "breakers are per endpoint")
+	assert.Equal(t, []breaker.State{breaker.Open}, changes)
+
+	_, err := p.LoginUsers(context.Background(), "john@gmail.com", "Password123")
+	var unavailable *provider.UnavailableError
+	require.True(t, errors.As(err, &unavailable))
+	assert.ErrorIs(t, unavailable.Err, breaker.ErrOpen)
+	assert.Equal(t, int32(2), calls.Load(), "open breaker must not reach the users service")
+}
+
+func TestLogin_UsersServiceUnavailable(t *testing.T) {
+	s := suite.New(t)
+
+	s.MockProvider.On("LoginUsers", mock.Anything, "john@gmail.com", "Password123").
+		Return(nil, &provider.UnavailableError{Endpoint: users.EndpointLogin, Err: breaker.ErrOpen}).
+		Once()
+
+	_, err := s.Client.Login(context.Background(), &sso.LoginRequest{
+		Email:    "john@gmail.com",
+		Password: "Password123",
+		DeviceID: "iphone",
+	})
+
+	require.Error(t, err)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
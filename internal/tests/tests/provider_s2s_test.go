@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"auth/internal/provider/s2s"
+	"auth/internal/provider/users"
+	"auth/internal/token"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type capturedRequest struct {
+	method string
+	uri    string
+	header http.Header
+	body   []byte
+}
+
+func newSignedUsersProvider(t *testing.T, signer s2s.Signer) (users.Provider, <-chan capturedRequest) {
+	t.Helper()
+
+	captured := make(chan capturedRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		captured <- capturedRequest{method: r.Method, uri: r.URL.RequestURI(), header: r.Header.Clone(), body: body}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	p := users.NewUsersProvider(u.Scheme, u.Hostname(), u.Port(), time.Second, signer,
+		*slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})))
+	return p, captured
+}
+
+func TestServiceAuth_Bearer(t *testing.T) {
+	signer, err := s2s.New(s2s.Config{Mode: "bearer", Token: "static-token"}, nil)
+	require.NoError(t, err)
+
+	p, captured := newSignedUsersProvider(t, signer)
+	_, _ = p.FindOneUsers(context.Background(), "user-123")
+
+	req := <-captured
+	assert.Equal(t, "Bearer static-token", req.header.Get("Authorization"))
+}
+
+func TestServiceAuth_HMACSignsBodyAndTimestamp(t *testing.T) {
+	signer, err := s2s.New(s2s.Config{Mode: "hmac", KeyID: "auth", Secret: "hmac-secret"}, nil)
+	require.NoError(t, err)
+
+	p, captured := newSignedUsersProvider(t, signer)
+	_, _ = p.LoginUsers(context.Background(), "john@gmail.com", "Password123")
+
+	req := <-captured
+	digest := sha256.Sum256(req.body)
+	assert.NotEmpty(t, req.body)
+	assert.Equal(t, "auth", req.header.Get(s2s.HeaderKeyID))
+	assert.Equal(t, hex.EncodeToString(digest[:]), req.header.Get(s2s.HeaderContentSHA256))
+
+	ts := req.header.Get(s2s.HeaderTimestamp)
+	require.NotEmpty(t, ts)
+	expected := s2s.SignHMAC([]byte("hmac-secret"), req.method, req.uri, ts, req.header.Get(s2s.HeaderContentSHA256))
+	assert.Equal(t, expected, req.header.Get(s2s.HeaderSignature))
+
+	// Подпись другим секретом не совпадает
+	assert.NotEqual(t, s2s.SignHMAC([]byte("other"), req.method, req.uri, ts, req.header.Get(s2s.HeaderContentSHA256)),
+		req.header.Get(s2s.HeaderSignature))
+}
+
+func TestServiceAuth_JWTWithAudience(t *testing.T) {
+	tokens := token.NewServiceTokens("service-secret", "auth-service", time.Minute)
+	signer, err := s2s.New(s2s.Config{Mode: "jwt", Audience: "users-service"}, tokens)
+	require.NoError(t, err)
+
+	p, captured := newSignedUsersProvider(t, signer)
+	_, _ = p.FindOneUsers(context.Background(), "user-123")
+
+	req := <-captured
+	raw := req.header.Get("Authorization")
+	require.Contains(t, raw, "Bearer ")
+
+	parsed, err := jwt.ParseWithClaims(raw[len("Bearer "):], &jwt.RegisteredClaims{},
+		func(*jwt.Token) (any, error) { return []byte("service-secret"), nil },
+		jwt.WithAudience("users-service"), jwt.WithIssuer("auth-service"), jwt.WithExpirationRequired())
+	require.NoError(t, err)
+
+	claims := parsed.Claims.(*jwt.RegisteredClaims)
+	assert.Equal(t, "auth-service", claims.Subject)
+	assert.NotEmpty(t, claims.ID)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), claims.ExpiresAt.Time, 5*time.Second)
+
+	// Для другой аудитории токен не подходит
+	_, err = jwt.ParseWithClaims(raw[len("Bearer "):], &jwt.RegisteredClaims{},
+		func(*jwt.Token) (any, error) { return []byte("service-secret"), nil },
+		jwt.WithAudience("billing"))
+	assert.Error(t, err)
+}
+
+func TestServiceAuth_UnknownMode(t *testing.T) {
+	_, err := s2s.New(s2s.Config{Mode: "kerberos"}, nil)
+	assert.ErrorIs(t, err, s2s.ErrUnknownMode)
+}
@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"auth/internal/audit"
+	"auth/internal/model"
+	redisRepo "auth/internal/redis"
+	"auth/internal/servises/auth"
+	mocks "auth/internal/tests/mock"
+	"auth/internal/tests/suite"
+	"auth/internal/token"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/s10n41k/protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpaqueRefresh_TokenFormat(t *testing.T) {
+	first, hash, err := token.NewOpaqueRefreshToken()
+	require.NoError(t, err)
+	second, _, err := token.NewOpaqueRefreshToken()
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first, second)
+	assert.True(t, token.IsOpaqueRefreshToken(first))
+	// rt_ + 32 байта в base64url без паддинга
+	assert.Len(t, first, 3+43)
+
+	sum := sha256.Sum256([]byte(first))
+	assert.Equal(t, hex.EncodeToString(sum[:]), hash)
+	assert.Equal(t, hash, token.HashRefreshToken(first))
+
+	manager := token.NewJWTManager("access-secret", "refresh-secret", time.Minute, time.Hour)
+	jwtRefresh, err := manager.GenerateRefreshToken("user-123", "sess-1", time.Time{})
+	require.NoError(t, err)
+	assert.False(t, token.IsOpaqueRefreshToken(jwtRefresh))
+}
+
+func TestOpaqueRefresh_RedisStoresOnlyHash(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	repo := redisRepo.NewRepositoryRedis(client, time.Hour)
+	ctx := context.Background()
+
+	refresh, hash, err := token.NewOpaqueRefreshToken()
+	require.NoError(t, err)
+	require.NoError(t, repo.SaveRefreshHash(ctx, "sess-1", hash, 0))
+
+	sessionID, err := repo.SessionByRefreshHash(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, "sess-1", sessionID)
+
+	stored, err := repo.Get(ctx, "sess-1")
+	require.NoError(t, err)
+	assert.Equal(t, hash, stored)
+
+	// Утечка Redis не дает рабочего refresh token
+	for _, key := range mr.Keys() {
+		value, _ := mr.Get(key)
+		assert.NotContains(t, key, refresh)
+		assert.NotContains(t, value, refresh)
+		assert.NotContains(t, value, strings.TrimPrefix(refresh, "rt_"))
+	}
+
+	mr.FastForward(time.Hour + time.Second)
+	_, err = repo.SessionByRefreshHash(ctx, hash)
+	assert.Error(t, err)
+}
+
+func TestOpaqueRefresh_ConcurrentRefreshTakesTokenOnce(t *testing.T) {
+	_, client := newMiniRedis(t)
+	repo := redisRepo.NewRepositoryRedis(client, time.Hour)
+	ctx := context.Background()
+
+	_, hash, err := token.NewOpaqueRefreshToken()
+	require.NoError(t, err)
+	require.NoError(t, repo.SaveRefreshHash(ctx, "sess-1", hash, 0))
+
+	// Чужой хеш не забирает токен
+	taken, err := repo.TakeRefreshToken(ctx, "sess-1", "other")
+	require.NoError(t, err)
+	assert.False(t, taken)
+
+	var (
+		wg  sync.WaitGroup
+		won atomic.Int32
+	)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, err := repo.TakeRefreshToken(ctx, "sess-1", hash); err == nil && ok {
+				won.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), won.Load())
+
+	_, err = repo.TakeRefreshToken(ctx, "sess-1", hash)
+	assert.ErrorIs(t, err, redis.Nil)
+}
+
+func TestOpaqueRefresh_LoginRotateAndReuse(t *testing.T) {
+	sink := mocks.NewMockAuditSink()
+	s := suite.NewWithOptions(t, auth.WithRefreshMode(token.RefreshOpaque), auth.WithAudit(sink))
+	ctx := context.Background()
+
+	const userID = "user-123"
+
+	var session *model.Session
+	s.MockProvider.On("LoginUsers", mock.Anything, "john@gmail.com", "Password123").
+		Return(&model.User{UserID: userID, Email: "john@gmail.com", Role: "user"}, nil).Once()
+	s.MockStorage.On("SaveSession", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { session = args.Get(1).(*model.Session) }).
+		Return(nil).Twice()
+	s.MockStorage.On("IncrementTokenVersion", mock.Anything, mock.Anything).Return(1, nil).Twice()
+	s.MockToken.On("GenerateAccessToken", mock.Anything).Return("access", nil).Twice()
+
+	var hashes []string
+	s.MockStorage.On("SaveRefreshHash", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			assert.Equal(t, session.ID, args.String(1))
+			hashes = append(hashes, args.String(2))
+		}).
+		Return(nil).Twice()
+
+	login, err := s.Client.Login(ctx, &sso.LoginRequest{Email: "john@gmail.com", Password: "Password123", DeviceID: "iphone"})
+	require.NoError(t, err)
+	first := login.GetTokenRefresh()
+	require.True(t, token.IsOpaqueRefreshToken(first))
+	require.Len(t, hashes, 1)
+	assert.Equal(t, token.HashRefreshToken(first), hashes[0])
+
+	// Refresh: поиск по хешу, подпись не проверяется
+	s.MockStorage.On("SessionByRefreshHash", mock.Anything, hashes[0]).Return(session.ID, nil).Twice()
+	s.MockStorage.On("GetSession", mock.Anything, session.ID).Return(session, nil).Twice()
+	s.MockStorage.On("Get", mock.Anything, session.ID).Return(hashes[0], nil).Once()
+	s.MockStorage.On("TakeRefreshToken", mock.Anything, session.ID, hashes[0]).Return(true, nil).Once()
+	s.MockProvider.On("FindOneUsers", mock.Anything, userID).
+		Return(&model.UserRefresh{UserID: userID, Email: "john@gmail.com", Role: "user"}, nil).Once()
+
+	rotated, err := s.Client.GetAccessToken(ctx, &sso.TokenRequest{RefreshToken: first})
+	require.NoError(t, err)
+	second := rotated.GetRefreshToken()
+	require.Len(t, hashes, 2)
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, token.HashRefreshToken(second), hashes[1])
+
+	// Повторное предъявление замененного токена
+	s.MockStorage.On("Get", mock.Anything, session.ID).Return(hashes[1], nil).Once()
+	_, err = s.Client.GetAccessToken(ctx, &sso.TokenRequest{RefreshToken: first})
+	require.Error(t, err)
+
+	records := sink.Records()
+	require.NotEmpty(t, records)
+	assert.Equal(t, audit.EventRefreshReuse, records[len(records)-1].Event)
+
+	s.MockToken.AssertNotCalled(t, "GenerateRefreshToken", mock.Anything, mock.Anything, mock.Anything)
+	s.MockToken.AssertNotCalled(t, "VerifyRefreshToken", mock.Anything)
+	s.MockStorage.AssertNotCalled(t, "Save", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	s.MockStorage.AssertExpectations(t)
+}
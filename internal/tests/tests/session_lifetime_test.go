@@ -0,0 +1,184 @@
+package tests
+
+import (
+	"auth/internal/audit"
+	"auth/internal/model"
+	redisRepo "auth/internal/redis"
+	"auth/internal/servises/auth"
+	"auth/internal/sessions"
+	mocks "auth/internal/tests/mock"
+	"auth/internal/tests/suite"
+	"auth/internal/token"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/s10n41k/protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionPolicy_Limits(t *testing.T) {
+	policy := &sessions.Policy{
+		Default: sessions.Limits{MaxAge: 30 * 24 * time.Hour, IdleTimeout: 7 * 24 * time.Hour},
+		Roles: map[string]sessions.Limits{
+			"admin": {MaxAge: 24 * time.Hour},
+		},
+		Clients: map[string]sessions.Limits{
+			"kiosk": {MaxAge: 48 * time.Hour, IdleTimeout: 15 * time.Minute},
+			"cli":   {MaxAge: 90 * 24 * time.Hour},
+		},
+	}
+
+	assert.Equal(t, policy.Default, policy.For("user", ""))
+	// Нулевое поле переопределения наследуется
+	assert.Equal(t, sessions.Limits{MaxAge: 24 * time.Hour, IdleTimeout: 7 * 24 * time.Hour}, policy.For("admin", "web"))
+	// Из роли и клиента - более строгое по каждому полю
+	assert.Equal(t, sessions.Limits{MaxAge: 24 * time.Hour, IdleTimeout: 15 * time.Minute}, policy.For("admin", "kiosk"))
+	// Переопределение может ослабить умолчание
+	assert.Equal(t, 90*24*time.Hour, policy.For("user", "cli").MaxAge)
+
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	limits := sessions.Limits{MaxAge: 10 * time.Hour, IdleTimeout: time.Hour}
+
+	assert.Equal(t, created.Add(time.Hour), limits.Deadline(created, created))
+	assert.Equal(t, created.Add(10*time.Hour), limits.Deadline(created, created.Add(9*time.Hour+30*time.Minute)))
+	assert.False(t, limits.Expired(created, created.Add(8*time.Hour), created.Add(8*time.Hour+59*time.Minute)))
+	assert.True(t, limits.Expired(created, created.Add(8*time.Hour), created.Add(9*time.Hour)))
+	assert.True(t, limits.Expired(created, created.Add(9*time.Hour+59*time.Minute), created.Add(10*time.Hour)))
+
+	assert.True(t, sessions.Limits{}.Deadline(created, created).IsZero())
+	assert.False(t, sessions.Limits{}.Expired(created, created, created.Add(1000*time.Hour)))
+}
+
+func TestSessionLifetime_RefreshTokenCappedByDeadline(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	manager := token.NewJWTManager("access-secret", "refresh-secret", time.Minute, 24*time.Hour,
+		token.WithClock(func() time.Time { return now }))
+
+	deadline := now.Add(time.Hour)
+	refresh, err := manager.GenerateRefreshToken("user-123", "sess-1", deadline)
+	require.NoError(t, err)
+
+	claims := &token.RefreshClaims{}
+	_, _, err = jwt.NewParser().ParseUnverified(refresh, claims)
+	require.NoError(t, err)
+	assert.Equal(t, deadline.Unix(), claims.ExpiresAt.Unix())
+	assert.Equal(t, now.Unix(), claims.LastActivity)
+
+	// Срок сессии дальше refresh TTL - exp не продлевается
+	refresh, err = manager.GenerateRefreshToken("user-123", "sess-1", now.Add(48*time.Hour))
+	require.NoError(t, err)
+	_, _, err = jwt.NewParser().ParseUnverified(refresh, claims)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(24*time.Hour).Unix(), claims.ExpiresAt.Unix())
+}
+
+func TestSessionLifetime_RedisTTL(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	repo := redisRepo.NewRepositoryRedis(client, time.Hour)
+	ctx := context.Background()
+
+	session := &model.Session{ID: "sess-1", UserID: "user-123", DeviceID: "iphone"}
+	require.NoError(t, repo.SaveSession(ctx, session, 10*time.Minute))
+	require.NoError(t, repo.Save(ctx, "sess-1", "refresh", 10*time.Minute))
+	assert.Equal(t, 10*time.Minute, mr.TTL("session_info:sess-1"))
+	assert.Equal(t, 10*time.Minute, mr.TTL("session:sess-1"))
+
+	// Больше refresh TTL не бывает
+	require.NoError(t, repo.Save(ctx, "sess-1", "refresh", 3*time.Hour))
+	assert.Equal(t, time.Hour, mr.TTL("session:sess-1"))
+
+	mr.FastForward(10*time.Minute + time.Second)
+	assert.False(t, mr.Exists("session_info:sess-1"))
+}
+
+func TestGetRefreshToken_SessionExpired(t *testing.T) {
+	sink := mocks.NewMockAuditSink()
+	s := suite.NewWithOptions(t, auth.WithAudit(sink), auth.WithSessionPolicy(&sessions.Policy{
+		Default: sessions.Limits{MaxAge: 30 * 24 * time.Hour, IdleTimeout: 7 * 24 * time.Hour},
+		Roles:   map[string]sessions.Limits{"admin": {MaxAge: time.Hour}},
+	}))
+	ctx := context.Background()
+
+	const (
+		userID    = "user-123"
+		sessionID = "sess-1"
+	)
+
+	// Сессия активна, но вошли в нее два часа назад - для админа это слишком давно
+	session := &model.Session{
+		ID:         sessionID,
+		UserID:     userID,
+		DeviceID:   "iphone",
+		CreatedAt:  time.Now().Add(-2 * time.Hour),
+		LastSeenAt: time.Now().Add(-time.Minute),
+	}
+	s.MockToken.On("VerifyRefreshToken", "refresh").
+		Return(&token.RefreshClaims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: userID},
+			Session:          sessionID,
+		}, nil).
+		Once()
+	s.MockStorage.On("GetSession", mock.Anything, sessionID).Return(session, nil).Once()
+	s.MockStorage.On("Get", mock.Anything, sessionID).Return("refresh", nil).Once()
+	s.MockProvider.On("FindOneUsers", mock.Anything, userID).
+		Return(&model.UserRefresh{UserID: userID, Email: "john@gmail.com", Role: "admin"}, nil).
+		Once()
+
+	s.MockStorage.On("RemoveSession", mock.Anything, session).Return(nil).Once()
+	s.MockStorage.On("DeleteRefreshToken", mock.Anything, sessionID).Return(nil).Once()
+	s.MockStorage.On("DeleteVersionToken", mock.Anything, sessionID).Return(nil).Once()
+
+	_, err := s.Client.GetAccessToken(ctx, &sso.TokenRequest{RefreshToken: "refresh"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "session expired")
+
+	records := sink.Records()
+	require.NotEmpty(t, records)
+	assert.Equal(t, audit.EventRefresh, records[len(records)-1].Event)
+	assert.Equal(t, "session_expired", records[len(records)-1].Reason)
+
+	s.MockStorage.AssertNotCalled(t, "SaveSession", mock.Anything, mock.Anything, mock.Anything)
+	s.MockToken.AssertNotCalled(t, "GenerateRefreshToken", mock.Anything, mock.Anything, mock.Anything)
+	s.MockStorage.AssertExpectations(t)
+}
+
+func TestSessionLifetime_LegacySessionKeepsMaxAge(t *testing.T) {
+	s := suite.NewWithOptions(t, auth.WithSessionPolicy(&sessions.Policy{
+		Default: sessions.Limits{MaxAge: 30 * 24 * time.Hour},
+	}))
+
+	const (
+		userID   = "user-123"
+		legacyID = "user-123:iphone"
+	)
+
+	// Старый токен выпущен 40 дней назад: перевод на новый ID не должен его продлить
+	s.MockToken.On("VerifyRefreshToken", "refresh").
+		Return(&token.RefreshClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:  userID,
+				IssuedAt: jwt.NewNumericDate(time.Now().Add(-40 * 24 * time.Hour)),
+			},
+			Session: legacyID,
+		}, nil).
+		Once()
+	s.MockStorage.On("Get", mock.Anything, legacyID).Return("refresh", nil).Once()
+	s.MockProvider.On("FindOneUsers", mock.Anything, userID).
+		Return(&model.UserRefresh{UserID: userID, Email: "john@gmail.com", Role: "user"}, nil).
+		Once()
+
+	s.MockStorage.On("RemoveSession", mock.Anything, mock.Anything).Return(nil).Once()
+	s.MockStorage.On("DeleteRefreshToken", mock.Anything, legacyID).Return(nil).Once()
+	s.MockStorage.On("DeleteVersionToken", mock.Anything, legacyID).Return(nil).Once()
+
+	_, err := s.Client.GetAccessToken(context.Background(), &sso.TokenRequest{RefreshToken: "refresh"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "session expired")
+
+	s.MockStorage.AssertNotCalled(t, "SaveSession", mock.Anything, mock.Anything, mock.Anything)
+	s.MockStorage.AssertExpectations(t)
+}
@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"auth/internal/audit"
+	"auth/internal/events"
+	"auth/internal/model"
+	redisRepo "auth/internal/redis"
+	"auth/internal/servises/auth"
+	"auth/internal/sessions"
+	mocks "auth/internal/tests/mock"
+	"auth/internal/tests/suite"
+	"auth/internal/token"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/s10n41k/protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSessionLimit_RedisEvict(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	repo := redisRepo.NewRepositoryRedis(client, time.Hour)
+	ctx := context.Background()
+
+	session := &model.Session{ID: "sess-1", UserID: "user-123", DeviceID: "iphone"}
+	require.NoError(t, repo.SaveSession(ctx, session, 0))
+	require.NoError(t, repo.Save(ctx, "sess-1", "refresh", 0))
+	_, err := repo.IncrementTokenVersion(ctx, "sess-1")
+	require.NoError(t, err)
+
+	evicted, err := repo.IsEvicted(ctx, "sess-1")
+	require.NoError(t, err)
+	assert.False(t, evicted)
+
+	event := events.New(events.SessionEvicted, "user-123", map[string]string{"session_id": "sess-1"})
+	require.NoError(t, repo.EvictSession(events.WithEvents(ctx, event), session))
+
+	for _, key := range []string{"session:sess-1", "session_info:sess-1", "token_ver:sess-1", "user_sessions:user-123"} {
+		assert.False(t, mr.Exists(key), key)
+	}
+	evicted, err = repo.IsEvicted(ctx, "sess-1")
+	require.NoError(t, err)
+	assert.True(t, evicted)
+	assert.Equal(t, time.Hour, mr.TTL("evicted:sess-1"))
+	assert.True(t, mr.Exists(events.OutboxStream))
+}
+
+func TestSessionLimit_EvictsLeastRecentlyUsed(t *testing.T) {
+	sink := mocks.NewMockAuditSink()
+	s := suite.NewWithOptions(t, auth.WithAudit(sink), auth.WithSessionPolicy(&sessions.Policy{
+		Default: sessions.Limits{MaxSessions: 2},
+		OnLimit: sessions.OnLimitEvictLRU,
+	}))
+	ctx := context.Background()
+
+	const userID = "user-123"
+
+	oldest := &model.Session{ID: "sess-old", UserID: userID, DeviceID: "ipad", LastSeenAt: time.Now().Add(-2 * time.Hour)}
+	recent := &model.Session{ID: "sess-recent", UserID: userID, DeviceID: "laptop", LastSeenAt: time.Now().Add(-time.Minute)}
+
+	s.MockProvider.On("LoginUsers", mock.Anything, "john@gmail.com", "Password123").
+		Return(&model.User{UserID: userID, Email: "john@gmail.com", Role: "user"}, nil).Once()
+	s.MockStorage.On("GetUserSessions", mock.Anything, userID).
+		Return([]string{"sess-recent", "stale", "sess-old"}, nil).Once()
+	s.MockStorage.On("GetSession", mock.Anything, "sess-recent").Return(recent, nil).Once()
+	s.MockStorage.On("GetSession", mock.Anything, "sess-old").Return(oldest, nil).Once()
+
+	// Истекшая сессия не считается и убирается из списка
+	s.MockStorage.On("GetSession", mock.Anything, "stale").Return(nil, redis.Nil).Once()
+	s.MockStorage.On("Get", mock.Anything, userID+":stale").Return("", redis.Nil).Once()
+	s.MockStorage.On("RemoveSession", mock.Anything, mock.MatchedBy(func(sess *model.Session) bool {
+		return sess.Legacy && sess.DeviceID == "stale"
+	})).Return(nil).Once()
+
+	s.MockStorage.On("EvictSession", mock.Anything, oldest).Return(nil).Once()
+
+	s.MockStorage.On("SaveSession", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	s.MockStorage.On("IncrementTokenVersion", mock.Anything, mock.Anything).Return(1, nil).Once()
+	s.MockToken.On("GenerateAccessToken", mock.Anything).Return("access", nil).Once()
+	s.MockToken.On("GenerateRefreshToken", userID, mock.Anything, mock.Anything).Return("refresh", nil).Once()
+	s.MockStorage.On("Save", mock.Anything, mock.Anything, "refresh", mock.Anything).Return(nil).Once()
+
+	_, err := s.Client.Login(ctx, &sso.LoginRequest{Email: "john@gmail.com", Password: "Password123", DeviceID: "iphone"})
+	require.NoError(t, err)
+
+	s.MockStorage.AssertExpectations(t)
+
+	var evicted []audit.Record
+	for _, rec := range sink.Records() {
+		if rec.Event == audit.EventSessionEvicted {
+			evicted = append(evicted, rec)
+		}
+	}
+	require.Len(t, evicted, 1)
+	assert.Equal(t, "ipad", evicted[0].DeviceID)
+}
+
+func TestSessionLimit_RejectsLogin(t *testing.T) {
+	sink := mocks.NewMockAuditSink()
+	s := suite.NewWithOptions(t, auth.WithAudit(sink), auth.WithSessionPolicy(&sessions.Policy{
+		Default: sessions.Limits{MaxSessions: 5},
+		Roles:   map[string]sessions.Limits{"admin": {MaxSessions: 1}},
+		OnLimit: sessions.OnLimitReject,
+	}))
+
+	const userID = "user-123"
+
+	s.MockProvider.On("LoginUsers", mock.Anything, "john@gmail.com", "Password123").
+		Return(&model.User{UserID: userID, Email: "john@gmail.com", Role: "admin"}, nil).Once()
+	s.MockStorage.On("GetUserSessions", mock.Anything, userID).Return([]string{"sess-1"}, nil).Once()
+	s.MockStorage.On("GetSession", mock.Anything, "sess-1").
+		Return(&model.Session{ID: "sess-1", UserID: userID, DeviceID: "ipad"}, nil).Once()
+
+	_, err := s.Client.Login(context.Background(), &sso.LoginRequest{Email: "john@gmail.com", Password: "Password123", DeviceID: "iphone"})
+	require.Error(t, err)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	s.MockStorage.AssertNotCalled(t, "EvictSession", mock.Anything, mock.Anything)
+	s.MockStorage.AssertNotCalled(t, "SaveSession", mock.Anything, mock.Anything, mock.Anything)
+
+	var lockouts []audit.Record
+	for _, rec := range sink.Records() {
+		if rec.Event == audit.EventLockout {
+			lockouts = append(lockouts, rec)
+		}
+	}
+	require.Len(t, lockouts, 1)
+	assert.Equal(t, userID, lockouts[0].UserID)
+	assert.Equal(t, "iphone", lockouts[0].DeviceID)
+	assert.Equal(t, "session_limit", lockouts[0].Reason)
+}
+
+func TestSessionLimit_EvictedRefresh(t *testing.T) {
+	sink := mocks.NewMockAuditSink()
+	s := suite.NewWithOptions(t, auth.WithAudit(sink))
+
+	s.MockToken.On("VerifyRefreshToken", "refresh").
+		Return(&token.RefreshClaims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: "user-123"},
+			Session:          "sess-old",
+		}, nil).
+		Once()
+	s.MockStorage.On("GetSession", mock.Anything, "sess-old").Return(nil, redis.Nil).Once()
+	s.MockStorage.On("IsEvicted", mock.Anything, "sess-old").Return(true, nil).Once()
+
+	_, err := s.Client.GetAccessToken(context.Background(), &sso.TokenRequest{RefreshToken: "refresh"})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, "session evicted", status.Convert(err).Message())
+
+	records := sink.Records()
+	require.NotEmpty(t, records)
+	assert.Equal(t, "evicted", records[len(records)-1].Reason)
+}
@@ -0,0 +1,212 @@
+package tests
+
+import (
+	"auth/internal/model"
+	redisRepo "auth/internal/redis"
+	"auth/internal/servises/auth"
+	mocks "auth/internal/tests/mock"
+	"auth/internal/tests/suite"
+	"auth/internal/token"
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/s10n41k/protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessions_RedisRecord(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	repo := redisRepo.NewRepositoryRedis(client, time.Hour)
+	ctx := context.Background()
+
+	session := &model.Session{ID: "sess-1", UserID: "user:1", DeviceID: "ipad:2", IP: "10.0.0.1"}
+	require.NoError(t, repo.SaveSession(ctx, session, 0))
+
+	got, err := repo.GetSession(ctx, "sess-1")
+	require.NoError(t, err)
+	assert.Equal(t, "user:1", got.UserID)
+	assert.Equal(t, "ipad:2", got.DeviceID)
+	assert.Equal(t, "10.0.0.1", got.IP)
+
+	members, err := repo.GetUserSessions(ctx, "user:1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sess-1"}, members)
+
+	// Запись продлевается при каждом сохранении и удаляется вместе с refresh token
+	mr.FastForward(50 * time.Minute)
+	require.NoError(t, repo.SaveSession(ctx, session, 0))
+	mr.FastForward(50 * time.Minute)
+	_, err = repo.GetSession(ctx, "sess-1")
+	require.NoError(t, err)
+
+	require.NoError(t, repo.RemoveSession(ctx, session))
+	require.NoError(t, repo.DeleteRefreshToken(ctx, "sess-1"))
+	_, err = repo.GetSession(ctx, "sess-1")
+	assert.ErrorIs(t, err, redis.Nil)
+	members, err = repo.GetUserSessions(ctx, "user:1")
+	require.NoError(t, err)
+	assert.Empty(t, members)
+
+	// Старая сессия записана в списке по deviceID
+	_, err = client.SAdd(ctx, "user_sessions:user-123", "iphone").Result()
+	require.NoError(t, err)
+	require.NoError(t, repo.RemoveSession(ctx, &model.Session{ID: "user-123:iphone", UserID: "user-123", DeviceID: "iphone", Legacy: true}))
+	assert.False(t, mr.Exists("user_sessions:user-123"))
+}
+
+func TestGetRefreshToken_MigratesLegacySession(t *testing.T) {
+	s := suite.New(t)
+
+	const (
+		oldRefresh = "legacy-refresh"
+		userID     = "user-123"
+		legacyID   = "user-123:ipad:2"
+	)
+	issuedAt := time.Now().Add(-10 * 24 * time.Hour).Truncate(time.Second).UTC()
+
+	s.MockToken.On("VerifyRefreshToken", oldRefresh).
+		Return(&token.RefreshClaims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: userID, IssuedAt: jwt.NewNumericDate(issuedAt)},
+			Session:          legacyID,
+		}, nil).
+		Once()
+	s.MockStorage.On("Get", mock.Anything, legacyID).Return(oldRefresh, nil).Once()
+	s.MockStorage.On("TakeRefreshToken", mock.Anything, legacyID, oldRefresh).Return(true, nil).Once()
+	s.MockProvider.On("FindOneUsers", mock.Anything, userID).
+		Return(&model.UserRefresh{UserID: userID, Email: "john@gmail.com", Role: "user"}, nil).
+		Once()
+
+	// Новая сессия сохраняет устройство; двоеточие в deviceID больше ничего не ломает
+	var created *model.Session
+	s.MockStorage.On("SaveSession", mock.Anything, mock.MatchedBy(func(sess *model.Session) bool {
+		return sess.UserID == userID && sess.DeviceID == "ipad:2" && !sess.Legacy
+	}), mock.Anything).
+		Run(func(args mock.Arguments) { created = args.Get(1).(*model.Session) }).
+		Return(nil).
+		Once()
+	newID := mock.MatchedBy(func(id string) bool { return created != nil && id == created.ID })
+
+	s.MockStorage.On("IncrementTokenVersion", mock.Anything, newID).Return(1, nil).Once()
+	s.MockToken.On("GenerateAccessToken", mock.Anything).Return("new-access", nil).Once()
+	s.MockToken.On("GenerateRefreshToken", userID, newID, mock.Anything).Return("new-refresh", nil).Once()
+	s.MockStorage.On("Save", mock.Anything, newID, "new-refresh", mock.Anything).Return(nil).Once()
+
+	// Ключи старой сессии удаляются после сохранения нового токена
+	s.MockStorage.On("RemoveSession", mock.Anything, mock.MatchedBy(func(sess *model.Session) bool {
+		return sess.Legacy && sess.ID == legacyID && sess.DeviceID == "ipad:2"
+	})).Return(nil).Once()
+	s.MockStorage.On("DeleteRefreshToken", mock.Anything, legacyID).Return(nil).Once()
+	s.MockStorage.On("DeleteVersionToken", mock.Anything, legacyID).Return(nil).Once()
+
+	resp, err := s.Client.GetAccessToken(context.Background(), &sso.TokenRequest{RefreshToken: oldRefresh})
+	require.NoError(t, err)
+	assert.Equal(t, "new-refresh", resp.GetRefreshToken())
+
+	require.NotNil(t, created)
+	assert.NotContains(t, created.ID, ":")
+	// Перевод не продлевает сессию: начало - из старого токена
+	assert.True(t, created.CreatedAt.Equal(issuedAt), created.CreatedAt)
+	s.MockStorage.AssertExpectations(t)
+	s.MockToken.AssertExpectations(t)
+}
+
+func TestGetRefreshToken_RejectsForeignAndLegacySessions(t *testing.T) {
+	s := suite.NewWithOptions(t, auth.WithLegacySessions(false))
+	s.MockStorage.On("IsEvicted", mock.Anything, mock.Anything).Return(false, nil)
+
+	// Старые ID после отключения миграции не принимаются
+	s.MockToken.On("VerifyRefreshToken", "legacy").
+		Return(&token.RefreshClaims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: "user-123"},
+			Session:          "user-123:iphone",
+		}, nil).
+		Once()
+
+	_, err := s.Client.GetAccessToken(context.Background(), &sso.TokenRequest{RefreshToken: "legacy"})
+	require.Error(t, err)
+
+	// Запись сессии другого пользователя
+	s.MockToken.On("VerifyRefreshToken", "foreign").
+		Return(&token.RefreshClaims{
+			RegisteredClaims: jwt.RegisteredClaims{Subject: "user-123"},
+			Session:          "sess-other",
+		}, nil).
+		Once()
+	s.MockStorage.On("GetSession", mock.Anything, "sess-other").
+		Return(&model.Session{ID: "sess-other", UserID: "user-456"}, nil).
+		Once()
+
+	_, err = s.Client.GetAccessToken(context.Background(), &sso.TokenRequest{RefreshToken: "foreign"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "revoked")
+
+	s.MockStorage.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+	s.MockProvider.AssertNotCalled(t, "FindOneUsers", mock.Anything, mock.Anything)
+}
+
+// Сессия, открытая до обновления: токены и ключи Redis в исходном формате,
+// перевод через настоящий JWTManager и Redis
+func TestGetRefreshToken_MigratesBaselineSession(t *testing.T) {
+	mr, client := newMiniRedis(t)
+	repo := redisRepo.NewRepositoryRedis(client, 24*time.Hour)
+	manager := token.NewJWTManager("access-secret", "refresh-secret", time.Minute, 24*time.Hour,
+		token.WithLegacyTokens(true))
+	users := mocks.NewProvider()
+	users.On("FindOneUsers", mock.Anything, "user-123").
+		Return(&model.UserRefresh{UserID: "user-123", Email: "john@gmail.com", Role: "user"}, nil)
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	srv := auth.NewServer(users, manager, repo, mocks.NewMockEmailSender(), *log)
+	ctx := context.Background()
+
+	// Как сохранял вход до обновления: session:<userID:deviceID>, token_ver и список устройств
+	issuedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, device := range []string{"iphone", "ipad"} {
+		legacyID := "user-123:" + device
+		require.NoError(t, repo.Save(ctx, legacyID, baselineRefreshToken(t, "refresh-secret", legacyID, issuedAt, 24*time.Hour), 0))
+		require.NoError(t, mr.Set("token_ver:"+legacyID, "1"))
+		_, err := mr.SAdd("user_sessions:user-123", device)
+		require.NoError(t, err)
+	}
+	legacyRefresh := baselineRefreshToken(t, "refresh-secret", "user-123:iphone", issuedAt, 24*time.Hour)
+
+	resp, err := srv.GetRefreshToken(ctx, legacyRefresh)
+	require.NoError(t, err)
+
+	// Новые токены - в новом формате, сессия - под новым ID с прежним началом
+	strict := token.NewJWTManager("access-secret", "refresh-secret", time.Minute, 24*time.Hour)
+	rc, err := strict.VerifyRefreshToken(resp.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, "user-123", rc.UserID())
+	assert.NotContains(t, rc.Session, ":")
+	_, err = strict.VerifyAccessToken(resp.AccessToken)
+	require.NoError(t, err)
+
+	sess, err := repo.GetSession(ctx, rc.Session)
+	require.NoError(t, err)
+	assert.Equal(t, "iphone", sess.DeviceID)
+	assert.True(t, sess.CreatedAt.Equal(issuedAt), sess.CreatedAt)
+
+	// Ключи старой сессии удалены, в списке - новый ID
+	assert.False(t, mr.Exists("session:user-123:iphone"))
+	assert.False(t, mr.Exists("token_ver:user-123:iphone"))
+	members, err := mr.SMembers("user_sessions:user-123")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"ipad", rc.Session}, members)
+
+	// Старый токен второй раз не проходит, новый - проходит
+	_, err = srv.GetRefreshToken(ctx, legacyRefresh)
+	require.Error(t, err)
+	_, err = srv.GetRefreshToken(ctx, resp.RefreshToken)
+	require.NoError(t, err)
+
+	// Выход старым access token со второго устройства
+	require.NoError(t, srv.Logout(ctx, baselineAccessToken(t, "access-secret", "user-123:ipad", 1, time.Now().Truncate(time.Second), time.Minute)))
+	assert.False(t, mr.Exists("session:user-123:ipad"))
+}
@@ -0,0 +1,407 @@
+package tests
+
+import (
+	"auth/internal/audit"
+	"auth/internal/model"
+	redisRepo "auth/internal/redis"
+	"auth/internal/risk"
+	"auth/internal/sender"
+	"auth/internal/servises/auth"
+	"auth/internal/signin"
+	mocks "auth/internal/tests/mock"
+	"auth/internal/tests/suite"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/s10n41k/protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testGeoIPCSV = `ip_start,ip_end,continent,country,stateprov,city,latitude,longitude
+1.0.0.0,1.0.0.255,OC,AU,Queensland,South Brisbane,-27.4767,153.017
+127.0.0.0,127.255.255.255,EU,NL,North Holland,Amsterdam,52.3740,4.8897
+2001:db8::,2001:db8::ffff,NA,US,New York,New York,40.7128,-74.0060
+`
+
+func TestSignIn_GeoIPLookup(t *testing.T) {
+	geo, err := risk.ReadGeoIP(strings.NewReader(testGeoIPCSV))
+	require.NoError(t, err)
+
+	location, ok := geo.Lookup("127.0.0.1")
+	require.True(t, ok)
+	assert.Equal(t, "Amsterdam, North Holland, NL", location.String())
+
+	location, ok = geo.Lookup("2001:db8::42")
+	require.True(t, ok)
+	assert.Equal(t, "US", location.Country)
+
+	// IPv4 в IPv6 записи - тот же адрес
+	_, ok = geo.Lookup("::ffff:1.0.0.7")
+	assert.True(t, ok)
+
+	for _, ip := range []string{"1.0.1.0", "10.0.0.1", "not-an-ip", ""} {
+		_, ok = geo.Lookup(ip)
+		assert.False(t, ok, ip)
+	}
+
+	var empty *risk.GeoIP
+	_, ok = empty.Lookup("127.0.0.1")
+	assert.False(t, ok)
+}
+
+func TestSignIn_RiskDetector(t *testing.T) {
+	detector := &risk.Detector{MaxSpeed: 900, MinHistory: 5, HourWindow: 1}
+	now := time.Date(2026, 3, 10, 10, 0, 0, 0, time.UTC)
+
+	moscow := model.LoginRecord{Lat: 55.7558, Lon: 37.6173, Located: true}
+	newYork := model.LoginRecord{Lat: 40.7128, Lon: -74.0060, Located: true}
+
+	// ~7500 км за час
+	prev := moscow
+	prev.At = now.Add(-time.Hour)
+	current := newYork
+	current.At = now
+	assert.Equal(t, []string{risk.ImpossibleTravel}, detector.Assess([]model.LoginRecord{prev}, current))
+
+	// За 12 часов можно долететь
+	prev.At = now.Add(-12 * time.Hour)
+	assert.Empty(t, detector.Assess([]model.LoginRecord{prev}, current))
+
+	// Без координат не с чем сравнивать
+	assert.Empty(t, detector.Assess([]model.LoginRecord{{At: now.Add(-time.Minute)}}, current))
+
+	// Привычные входы в 9-11 UTC
+	var history []model.LoginRecord
+	for day := 1; day <= 5; day++ {
+		history = append(history, model.LoginRecord{At: now.AddDate(0, 0, -day).Add(time.Duration(day%3-1) * time.Hour)})
+	}
+	assert.Empty(t, detector.Assess(history, model.LoginRecord{At: now.Add(time.Hour)}))
+	assert.Equal(t, []string{risk.UnusualHour}, detector.Assess(history, model.LoginRecord{At: now.Add(-7 * time.Hour)}))
+	// Полночь рядом с 23 часами
+	late := []model.LoginRecord{{At: now.Add(13 * time.Hour)}, {At: now.Add(13 * time.Hour)}, {At: now.Add(13 * time.Hour)}, {At: now.Add(13 * time.Hour)}, {At: now.Add(13 * time.Hour)}}
+	assert.Empty(t, detector.Assess(late, model.LoginRecord{At: now.Add(14 * time.Hour)}))
+
+	// Истории мало - о времени не судим
+	assert.Empty(t, detector.Assess(history[:4], model.LoginRecord{At: now.Add(-7 * time.Hour)}))
+
+	var off *risk.Detector
+	assert.Empty(t, off.Assess([]model.LoginRecord{prev}, current))
+}
+
+func TestSignIn_RedisHistoryAndRevokeToken(t *testing.T) {
+	_, client := newMiniRedis(t)
+	repo := redisRepo.NewRepositoryRedis(client, time.Hour)
+	ctx := context.Background()
+
+	first := model.LoginRecord{DeviceID: "ipad", IP: "1.0.0.1", At: time.Now().Add(-time.Hour).UTC().Truncate(time.Second)}
+	second := model.LoginRecord{DeviceID: "iphone", IP: "127.0.0.1", Country: "NL", Located: true, At: time.Now().UTC().Truncate(time.Second)}
+	require.NoError(t, repo.AddLogin(ctx, "user-123", first))
+	require.NoError(t, repo.AddLogin(ctx, "user-123", second))
+	require.NoError(t, repo.AddLogin(ctx, "user-123", first))
+
+	devices, err := repo.UserDevices(ctx, "user-123")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"ipad", "iphone"}, devices)
+
+	history, err := repo.LoginHistory(ctx, "user-123")
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, first.At, history[0].At)
+	assert.Equal(t, second, history[1])
+
+	require.NoError(t, repo.SaveRevokeToken(ctx, "hash", "user-123", time.Minute))
+	userID, err := repo.TakeRevokeToken(ctx, "hash")
+	require.NoError(t, err)
+	assert.Equal(t, "user-123", userID)
+
+	// Ссылка одноразовая
+	_, err = repo.TakeRevokeToken(ctx, "hash")
+	assert.ErrorIs(t, err, redis.Nil)
+}
+
+func TestSignIn_NewDeviceEmailAndRisk(t *testing.T) {
+	geo, err := risk.ReadGeoIP(strings.NewReader(testGeoIPCSV))
+	require.NoError(t, err)
+
+	sink := mocks.NewMockAuditSink()
+	s := suite.NewWithOptions(t, auth.WithAudit(sink), auth.WithSignInAlerts(&auth.SignInAlerts{
+		RevokeURL: "https://auth.example.com/signin/revoke",
+		GeoIP:     geo,
+		Risk:      &risk.Detector{MaxSpeed: 900},
+	}))
+	ctx := context.Background()
+
+	const userID = "user-123"
+
+	s.MockProvider.On("LoginUsers", mock.Anything, "john@gmail.com", "Password123").
+		Return(&model.User{UserID: userID, Email: "john@gmail.com", Name: "John", Role: "user"}, nil)
+	s.MockStorage.On("SaveSession", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	s.MockStorage.On("IncrementTokenVersion", mock.Anything, mock.Anything).Return(1, nil)
+	s.MockToken.On("GenerateAccessToken", mock.Anything).Return("access", nil)
+	s.MockToken.On("GenerateRefreshToken", userID, mock.Anything, mock.Anything).Return("refresh", nil)
+	s.MockStorage.On("Save", mock.Anything, mock.Anything, "refresh", mock.Anything).Return(nil)
+
+	// Десять минут назад входили из Нью-Йорка, сейчас - Амстердам (127.0.0.1 в тестовой базе)
+	s.MockStorage.On("UserDevices", mock.Anything, userID).Return([]string{"ipad"}, nil)
+	s.MockStorage.On("LoginHistory", mock.Anything, userID).Return([]model.LoginRecord{{
+		DeviceID: "ipad",
+		Country:  "US",
+		Lat:      40.7128,
+		Lon:      -74.0060,
+		Located:  true,
+		At:       time.Now().Add(-10 * time.Minute),
+	}}, nil)
+
+	var logins []model.LoginRecord
+	s.MockStorage.On("AddLogin", mock.Anything, userID, mock.Anything).
+		Run(func(args mock.Arguments) { logins = append(logins, args.Get(2).(model.LoginRecord)) }).
+		Return(nil)
+
+	var revokeHash string
+	s.MockStorage.On("SaveRevokeToken", mock.Anything, mock.Anything, userID, 7*24*time.Hour).
+		Run(func(args mock.Arguments) { revokeHash = args.String(1) }).
+		Return(nil).Once()
+
+	var signIn sender.SignIn
+	s.MockSender.On("SendNewSignIn", mock.Anything, "john@gmail.com", "John", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { signIn = args.Get(3).(sender.SignIn) }).
+		Return(nil).Once()
+
+	// Новое устройство
+	_, err = s.Client.Login(ctx, &sso.LoginRequest{Email: "john@gmail.com", Password: "Password123", DeviceID: "iphone"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "iphone", signIn.Device)
+	assert.Equal(t, "127.0.0.1", signIn.IP)
+	assert.Equal(t, "Amsterdam, North Holland, NL", signIn.Location)
+	assert.WithinDuration(t, time.Now(), signIn.Time, time.Minute)
+
+	link, err := url.Parse(signIn.RevokeURL)
+	require.NoError(t, err)
+	assert.Equal(t, "auth.example.com", link.Host)
+	assert.Equal(t, "/signin/revoke", link.Path)
+	sum := sha256.Sum256([]byte(link.Query().Get("token")))
+	assert.Equal(t, hex.EncodeToString(sum[:]), revokeHash)
+
+	require.Len(t, logins, 1)
+	assert.Equal(t, "iphone", logins[0].DeviceID)
+	assert.Equal(t, "NL", logins[0].Country)
+	assert.True(t, logins[0].Located)
+
+	var risky []audit.Record
+	for _, rec := range sink.Records() {
+		if rec.Event == audit.EventLoginRisk {
+			risky = append(risky, rec)
+		}
+	}
+	require.Len(t, risky, 1)
+	assert.Equal(t, risk.ImpossibleTravel, risky[0].Reason)
+
+	// Знакомое устройство - письма нет
+	_, err = s.Client.Login(ctx, &sso.LoginRequest{Email: "john@gmail.com", Password: "Password123", DeviceID: "ipad"})
+	require.NoError(t, err)
+	s.MockSender.AssertNumberOfCalls(t, "SendNewSignIn", 1)
+	require.Len(t, logins, 2)
+}
+
+func TestSignIn_FirstLoginIsNotNewDevice(t *testing.T) {
+	s := suite.NewWithOptions(t, auth.WithSignInAlerts(&auth.SignInAlerts{
+		RevokeURL: "https://auth.example.com/signin/revoke",
+	}))
+
+	const userID = "user-123"
+
+	s.MockProvider.On("LoginUsers", mock.Anything, "john@gmail.com", "Password123").
+		Return(&model.User{UserID: userID, Email: "john@gmail.com", Role: "user"}, nil).Once()
+	s.MockStorage.On("SaveSession", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	s.MockStorage.On("IncrementTokenVersion", mock.Anything, mock.Anything).Return(1, nil).Once()
+	s.MockToken.On("GenerateAccessToken", mock.Anything).Return("access", nil).Once()
+	s.MockToken.On("GenerateRefreshToken", userID, mock.Anything, mock.Anything).Return("refresh", nil).Once()
+	s.MockStorage.On("Save", mock.Anything, mock.Anything, "refresh", mock.Anything).Return(nil).Once()
+	s.MockStorage.On("UserDevices", mock.Anything, userID).Return([]string{}, nil).Once()
+	s.MockStorage.On("LoginHistory", mock.Anything, userID).Return([]model.LoginRecord{}, nil).Once()
+	s.MockStorage.On("AddLogin", mock.Anything, userID, mock.Anything).Return(nil).Once()
+
+	_, err := s.Client.Login(context.Background(), &sso.LoginRequest{Email: "john@gmail.com", Password: "Password123", DeviceID: "iphone"})
+	require.NoError(t, err)
+
+	s.MockSender.AssertNotCalled(t, "SendNewSignIn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	s.MockStorage.AssertNotCalled(t, "SaveRevokeToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	s.MockStorage.AssertExpectations(t)
+}
+
+func TestSignIn_RevokeAllSessions(t *testing.T) {
+	sink := mocks.NewMockAuditSink()
+	s := suite.NewWithOptions(t, auth.WithAudit(sink))
+	revoker := (*s.Server).(signin.Revoker)
+	ctx := context.Background()
+
+	const userID = "user-123"
+
+	sum := sha256.Sum256([]byte("link-token"))
+	s.MockStorage.On("TakeRevokeToken", mock.Anything, hex.EncodeToString(sum[:])).Return(userID, nil).Once()
+	s.MockStorage.On("GetUserSessions", mock.Anything, userID).Return([]string{"sess-1"}, nil).Once()
+	s.MockStorage.On("GetSession", mock.Anything, "sess-1").
+		Return(&model.Session{ID: "sess-1", UserID: userID, DeviceID: "iphone"}, nil).Once()
+	s.MockStorage.On("DeleteRefreshToken", mock.Anything, "sess-1").Return(nil).Once()
+	s.MockStorage.On("DeleteVersionToken", mock.Anything, "sess-1").Return(nil).Once()
+	s.MockStorage.On("DeleteAllSessions", mock.Anything, userID).Return(nil).Once()
+
+	require.NoError(t, revoker.RevokeAllSessions(ctx, "link-token"))
+
+	records := sink.Records()
+	require.NotEmpty(t, records)
+	last := records[len(records)-1]
+	assert.Equal(t, audit.EventLogoutAll, last.Event)
+	assert.Equal(t, audit.OutcomeSuccess, last.Outcome)
+	assert.Equal(t, "sign_in_alert", last.Reason)
+
+	// Использованная ссылка
+	s.MockStorage.On("TakeRevokeToken", mock.Anything, hex.EncodeToString(sum[:])).Return("", redis.Nil).Once()
+	assert.ErrorIs(t, revoker.RevokeAllSessions(ctx, "link-token"), signin.ErrInvalidToken)
+	assert.ErrorIs(t, revoker.RevokeAllSessions(ctx, ""), signin.ErrInvalidToken)
+
+	s.MockStorage.AssertExpectations(t)
+}
+
+// fakeRevoker - запоминает токены и отвечает ErrInvalidToken на неизвестные
+type fakeRevoker struct {
+	valid   string
+	revoked []string
+}
+
+func (f *fakeRevoker) RevokeAllSessions(_ context.Context, revokeToken string) error {
+	if revokeToken != f.valid {
+		return signin.ErrInvalidToken
+	}
+	f.revoked = append(f.revoked, revokeToken)
+	return nil
+}
+
+func TestSignIn_RevokePage(t *testing.T) {
+	revoker := &fakeRevoker{valid: "link-token"}
+	handler := signin.Handler(revoker, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})))
+
+	// Переход по ссылке только показывает подтверждение
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/signin/revoke?token=link-token", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `value="link-token"`)
+	assert.Equal(t, "no-referrer", rec.Header().Get("Referrer-Policy"))
+	assert.Empty(t, revoker.revoked)
+
+	post := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/signin/revoke", strings.NewReader(url.Values{"token": {token}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, post("link-token").Code)
+	assert.Equal(t, []string{"link-token"}, revoker.revoked)
+	assert.Equal(t, http.StatusGone, post("other").Code)
+}
+
+func TestSignIn_EmailTemplates(t *testing.T) {
+	templates, err := sender.NewTemplates("", "en")
+	require.NoError(t, err)
+
+	data := sender.TemplateData{
+		UserName: "John",
+		AppName:  "Auth",
+		SignIn: sender.SignIn{
+			Device:    "iphone",
+			IP:        "127.0.0.1",
+			Location:  "Amsterdam, NL",
+			Time:      time.Date(2026, 3, 10, 10, 0, 0, 0, time.UTC),
+			RevokeURL: "https://auth.example.com/signin/revoke?token=abc&x=1",
+		},
+	}
+
+	for _, locale := range []string{"en", "ru"} {
+		rendered, err := templates.Render(sender.MessageNewSignIn, locale, data)
+		require.NoError(t, err)
+		assert.Equal(t, locale, rendered.Locale)
+		assert.Contains(t, rendered.Text, "Amsterdam, NL")
+		assert.Contains(t, rendered.Text, "2026-03-10 10:00 UTC")
+		assert.Contains(t, rendered.Text, data.SignIn.RevokeURL)
+		assert.Contains(t, rendered.HTML, `href="https://auth.example.com/signin/revoke?token=abc&amp;x=1"`)
+		// Пользователю с подтвержденным телефоном уведомление уходит по SMS
+		assert.Contains(t, rendered.SMS, "iphone (Amsterdam, NL)")
+		assert.Contains(t, rendered.SMS, data.SignIn.RevokeURL)
+	}
+}
+
+// smsRecorder - SMS шлюз, который запоминает отправленные сообщения
+type smsRecorder struct {
+	phones, texts []string
+}
+
+func (r *smsRecorder) SendSMS(_ context.Context, phone, text string) error {
+	r.phones = append(r.phones, phone)
+	r.texts = append(r.texts, text)
+	return nil
+}
+
+func TestSignIn_NewDeviceSMSToVerifiedPhone(t *testing.T) {
+	gateway := &smsRecorder{}
+	sms, err := sender.NewSMSChannel(notifySMTPConfig, gateway)
+	require.NoError(t, err)
+	dev, dir := newTestDevSink(t)
+
+	provider := mocks.NewProvider()
+	storage := mocks.NewMockStorage()
+	tokens := mocks.NewMockToken()
+	server := auth.NewServer(provider, tokens, storage, sender.NewRouter(sms, dev),
+		*slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})),
+		auth.WithSignInAlerts(&auth.SignInAlerts{RevokeURL: "https://auth.example.com/signin/revoke"}))
+	ctx := context.Background()
+
+	const userID = "user-123"
+
+	// Телефон подтвержден в users service и приходит в записи пользователя
+	provider.On("LoginUsers", mock.Anything, "john@gmail.com", "Password123").
+		Return(&model.User{UserID: userID, Email: "john@gmail.com", Name: "John", Role: "user", Phone: "+79990000000"}, nil).Once()
+	provider.On("LoginUsers", mock.Anything, "jane@gmail.com", "Password123").
+		Return(&model.User{UserID: userID, Email: "jane@gmail.com", Name: "Jane", Role: "user"}, nil).Once()
+	storage.On("SaveSession", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	storage.On("IncrementTokenVersion", mock.Anything, mock.Anything).Return(1, nil)
+	tokens.On("GenerateAccessToken", mock.Anything).Return("access", nil)
+	tokens.On("GenerateRefreshToken", userID, mock.Anything, mock.Anything).Return("refresh", nil)
+	storage.On("Save", mock.Anything, mock.Anything, "refresh", mock.Anything).Return(nil)
+	storage.On("UserDevices", mock.Anything, userID).Return([]string{"ipad"}, nil)
+	storage.On("LoginHistory", mock.Anything, userID).Return([]model.LoginRecord{}, nil)
+	storage.On("AddLogin", mock.Anything, userID, mock.Anything).Return(nil)
+	storage.On("SaveRevokeToken", mock.Anything, mock.Anything, userID, mock.Anything).Return(nil)
+
+	_, err = server.Login(ctx, "john@gmail.com", "Password123", "iphone")
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"+79990000000"}, gateway.phones)
+	assert.Contains(t, gateway.texts[0], "new sign-in to your account from iphone")
+	assert.Contains(t, gateway.texts[0], "https://auth.example.com/signin/revoke?token=")
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.Empty(t, files)
+
+	// Без подтвержденного телефона - следующий канал
+	_, err = server.Login(ctx, "jane@gmail.com", "Password123", "iphone")
+	require.NoError(t, err)
+
+	assert.Len(t, gateway.phones, 1)
+	files, _ = filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.Len(t, files, 1)
+}
@@ -0,0 +1,326 @@
+package tests
+
+import (
+	"auth/internal/sender"
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	stubUser     = "mailer"
+	stubPassword = "secret"
+)
+
+type stubMail struct {
+	from string
+	to   []string
+	data string
+	tls  bool
+	auth string
+}
+
+// smtpStub - минимальный SMTP сервер: EHLO, STARTTLS, AUTH PLAIN/LOGIN/CRAM-MD5, MAIL/RCPT/DATA
+type smtpStub struct {
+	t         *testing.T
+	listener  net.Listener
+	tlsConfig *tls.Config
+	startTLS  bool
+	authMechs string
+
+	connections atomic.Int32
+	mu          sync.Mutex
+	mails       []stubMail
+}
+
+func newSMTPStub(t *testing.T, implicitTLS, startTLS bool, authMechs string) (*smtpStub, *tls.Config) {
+	t.Helper()
+
+	serverTLS, clientTLS := selfSignedTLS(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	if implicitTLS {
+		listener = tls.NewListener(listener, serverTLS)
+	}
+
+	stub := &smtpStub{t: t, listener: listener, tlsConfig: serverTLS, startTLS: startTLS, authMechs: authMechs}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			stub.connections.Add(1)
+			go stub.serve(conn, implicitTLS)
+		}
+	}()
+
+	return stub, clientTLS
+}
+
+func (s *smtpStub) port() string {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return port
+}
+
+func (s *smtpStub) sent() []stubMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]stubMail(nil), s.mails...)
+}
+
+func (s *smtpStub) serve(conn net.Conn, secure bool) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+	readLine := func() (string, bool) {
+		line, err := r.ReadString('\n')
+		return strings.TrimRight(line, "\r\n"), err == nil
+	}
+
+	reply("220 stub ESMTP")
+	var current stubMail
+	authenticated := ""
+
+	for {
+		line, ok := readLine()
+		if !ok {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			lines := []string{"250-stub"}
+			if s.startTLS && !secure {
+				lines = append(lines, "250-STARTTLS")
+			}
+			if s.authMechs != "" {
+				lines = append(lines, "250-AUTH "+s.authMechs)
+			}
+			lines = append(lines, "250 8BITMIME")
+			reply(strings.Join(lines, "\r\n"))
+		case "STARTTLS":
+			reply("220 go ahead")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn, r, secure = tlsConn, bufio.NewReader(tlsConn), true
+			reply = func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+		case "AUTH":
+			mech, initial, _ := strings.Cut(arg, " ")
+			if s.authenticate(strings.ToUpper(mech), initial, reply, readLine) {
+				authenticated = strings.ToUpper(mech)
+				reply("235 ok")
+			} else {
+				reply("535 bad credentials")
+			}
+		case "MAIL":
+			current = stubMail{from: strings.TrimSuffix(strings.TrimPrefix(arg, "FROM:<"), ">"), tls: secure, auth: authenticated}
+			reply("250 ok")
+		case "RCPT":
+			current.to = append(current.to, strings.TrimSuffix(strings.TrimPrefix(arg, "TO:<"), ">"))
+			reply("250 ok")
+		case "DATA":
+			reply("354 end with .")
+			var data strings.Builder
+			for {
+				line, ok := readLine()
+				if !ok {
+					return
+				}
+				if line == "." {
+					break
+				}
+				data.WriteString(line + "\r\n")
+			}
+			current.data = data.String()
+			s.mu.Lock()
+			s.mails = append(s.mails, current)
+			s.mu.Unlock()
+			reply("250 queued")
+		case "NOOP", "RSET":
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (s *smtpStub) authenticate(mech, initial string, reply func(string), readLine func() (string, bool)) bool {
+	decode := func(v string) string {
+		b, _ := base64.StdEncoding.DecodeString(v)
+		return string(b)
+	}
+
+	switch mech {
+	case "PLAIN":
+		parts := strings.Split(decode(initial), "\x00")
+		return len(parts) == 3 && parts[1] == stubUser && parts[2] == stubPassword
+	case "LOGIN":
+		reply("334 " + base64.StdEncoding.EncodeToString([]byte("Username:")))
+		user, _ := readLine()
+		reply("334 " + base64.StdEncoding.EncodeToString([]byte("Password:")))
+		password, _ := readLine()
+		return decode(user) == stubUser && decode(password) == stubPassword
+	case "CRAM-MD5":
+		challenge := "<1234.5678@stub>"
+		reply("334 " + base64.StdEncoding.EncodeToString([]byte(challenge)))
+		answer, _ := readLine()
+		mac := hmac.New(md5.New, []byte(stubPassword))
+		mac.Write([]byte(challenge))
+		return decode(answer) == stubUser+" "+hex.EncodeToString(mac.Sum(nil))
+	}
+	return false
+}
+
+func selfSignedTLS(t *testing.T) (server *tls.Config, client *tls.Config) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		&tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+}
+
+func newStubTransport(stub *smtpStub, clientTLS *tls.Config, mode sender.TLSMode, mechanism string) *sender.Transport {
+	return sender.NewTransport(sender.TransportConfig{
+		Host:           "127.0.0.1",
+		Port:           stub.port(),
+		Username:       stubUser,
+		Password:       stubPassword,
+		TLSMode:        mode,
+		AuthMechanism:  mechanism,
+		CommandTimeout: 2 * time.Second,
+		TLSConfig:      clientTLS,
+	})
+}
+
+func TestSMTPTransport_StartTLSReusesConnection(t *testing.T) {
+	stub, clientTLS := newSMTPStub(t, false, true, "PLAIN LOGIN")
+	transport := newStubTransport(stub, clientTLS, sender.TLSStartTLS, "")
+	defer transport.Close()
+
+	ctx := context.Background()
+	require.NoError(t, transport.Send(ctx, "noreply@example.com", []string{"a@example.com"}, []byte("Subject: one\r\n\r\nfirst\r\n")))
+	require.NoError(t, transport.Send(ctx, "noreply@example.com", []string{"b@example.com"}, []byte("Subject: two\r\n\r\nsecond\r\n")))
+
+	mails := stub.sent()
+	require.Len(t, mails, 2)
+	assert.Equal(t, int32(1), stub.connections.Load())
+	assert.True(t, mails[0].tls)
+	assert.Equal(t, "PLAIN", mails[0].auth)
+	assert.Equal(t, []string{"b@example.com"}, mails[1].to)
+	assert.Contains(t, mails[1].data, "second")
+}
+
+func TestSMTPTransport_ImplicitTLSWithLogin(t *testing.T) {
+	stub, clientTLS := newSMTPStub(t, true, false, "LOGIN")
+	transport := newStubTransport(stub, clientTLS, sender.TLSImplicit, "")
+	defer transport.Close()
+
+	require.NoError(t, transport.Send(context.Background(), "noreply@example.com", []string{"a@example.com"}, []byte("Subject: hi\r\n\r\nbody\r\n")))
+
+	mails := stub.sent()
+	require.Len(t, mails, 1)
+	assert.True(t, mails[0].tls)
+	assert.Equal(t, "LOGIN", mails[0].auth)
+}
+
+func TestSMTPTransport_PlaintextPrefersCRAMMD5(t *testing.T) {
+	stub, _ := newSMTPStub(t, false, false, "PLAIN LOGIN CRAM-MD5")
+	transport := newStubTransport(stub, nil, sender.TLSNone, "")
+	defer transport.Close()
+
+	require.NoError(t, transport.Send(context.Background(), "noreply@example.com", []string{"a@example.com"}, []byte("Subject: hi\r\n\r\nbody\r\n")))
+
+	mails := stub.sent()
+	require.Len(t, mails, 1)
+	assert.False(t, mails[0].tls)
+	assert.Equal(t, "CRAM-MD5", mails[0].auth)
+}
+
+func TestSMTPTransport_StartTLSRequired(t *testing.T) {
+	stub, clientTLS := newSMTPStub(t, false, false, "PLAIN")
+	transport := newStubTransport(stub, clientTLS, sender.TLSStartTLS, "")
+	defer transport.Close()
+
+	err := transport.Send(context.Background(), "noreply@example.com", []string{"a@example.com"}, []byte("Subject: hi\r\n\r\nbody\r\n"))
+	assert.ErrorIs(t, err, sender.ErrStartTLSUnsupported)
+	assert.Empty(t, stub.sent())
+}
+
+func TestSMTPTransport_CommandTimeout(t *testing.T) {
+	// Сервер принимает соединение и молчит
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	transport := sender.NewTransport(sender.TransportConfig{
+		Host:           "127.0.0.1",
+		Port:           port,
+		TLSMode:        sender.TLSNone,
+		CommandTimeout: 200 * time.Millisecond,
+	})
+
+	start := time.Now()
+	err = transport.Send(context.Background(), "noreply@example.com", []string{"a@example.com"}, []byte("x"))
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
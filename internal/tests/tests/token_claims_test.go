@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"auth/internal/model"
+	"auth/internal/token"
+	"auth/pkg/authclient"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToken_TypedClaimsRoundTrip(t *testing.T) {
+	manager := token.NewJWTManager("access-secret", "refresh-secret", time.Minute, time.Hour,
+		token.WithIssuer("auth-test"), token.WithAudience("tasks", "billing"))
+
+	access, err := manager.GenerateAccessToken(&model.UserRefresh{
+		SessionId:   "sess-1",
+		UserID:      "user-123",
+		DeviceID:    "iphone",
+		Email:       "john@gmail.com",
+		Role:        "user",
+		Version:     2,
+		Permissions: []string{"tasks:read"},
+	})
+	require.NoError(t, err)
+
+	claims, err := manager.VerifyAccessToken(access)
+	require.NoError(t, err)
+	assert.Equal(t, "user-123", claims.UserID())
+	assert.Equal(t, "iphone", claims.DeviceID())
+	assert.Equal(t, "auth-test", claims.Issuer)
+	assert.Equal(t, jwt.ClaimStrings{"tasks", "billing"}, claims.Audience)
+	assert.Equal(t, 2, claims.Version)
+	assert.NotEmpty(t, claims.ID)
+	require.NotNil(t, claims.NotBefore)
+
+	refresh, err := manager.GenerateRefreshToken("user-123", "sess-1", time.Time{})
+	require.NoError(t, err)
+
+	rc, err := manager.VerifyRefreshToken(refresh)
+	require.NoError(t, err)
+	assert.Equal(t, "user-123", rc.UserID())
+	assert.Equal(t, "sess-1", rc.Session)
+	assert.NotEqual(t, claims.ID, rc.ID)
+}
+
+func TestToken_RefreshIsNotAccess(t *testing.T) {
+	// Общий секрет - отличить токены может только typ
+	manager := token.NewJWTManager("secret", "secret", time.Minute, time.Hour,
+		token.WithAudience("auth"))
+
+	refresh, err := manager.GenerateRefreshToken("user-123", "sess-1", time.Time{})
+	require.NoError(t, err)
+	_, err = manager.VerifyAccessToken(refresh)
+	assert.ErrorIs(t, err, token.ErrTokenType)
+
+	access, err := manager.GenerateAccessToken(&model.UserRefresh{SessionId: "sess-1", UserID: "user-123"})
+	require.NoError(t, err)
+	_, err = manager.VerifyRefreshToken(access)
+	assert.ErrorIs(t, err, token.ErrTokenType)
+
+	// Другие сервисы тоже не примут refresh token
+	v, err := authclient.New(authclient.Config{Secret: []byte("secret")})
+	require.NoError(t, err)
+	_, err = v.Verify(context.Background(), refresh)
+	assert.ErrorIs(t, err, authclient.ErrInvalidToken)
+}
+
+func TestToken_IssuerAndAudience(t *testing.T) {
+	issuer := token.NewJWTManager("access-secret", "refresh-secret", time.Minute, time.Hour,
+		token.WithIssuer("auth-a"), token.WithAudience("tasks"))
+	access, err := issuer.GenerateAccessToken(&model.UserRefresh{SessionId: "sess-1", UserID: "user-123"})
+	require.NoError(t, err)
+
+	otherIssuer := token.NewJWTManager("access-secret", "refresh-secret", time.Minute, time.Hour,
+		token.WithIssuer("auth-b"), token.WithAudience("tasks"))
+	_, err = otherIssuer.VerifyAccessToken(access)
+	assert.ErrorIs(t, err, jwt.ErrTokenInvalidIssuer)
+
+	otherAudience := token.NewJWTManager("access-secret", "refresh-secret", time.Minute, time.Hour,
+		token.WithIssuer("auth-a"), token.WithAudience("billing"))
+	_, err = otherAudience.VerifyAccessToken(access)
+	assert.ErrorIs(t, err, jwt.ErrTokenInvalidAudience)
+}
+
+func TestToken_Leeway(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	manager := token.NewJWTManager("access-secret", "refresh-secret", time.Minute, time.Hour,
+		token.WithLeeway(30*time.Second), token.WithClock(clock))
+	access, err := manager.GenerateAccessToken(&model.UserRefresh{SessionId: "sess-1", UserID: "user-123"})
+	require.NoError(t, err)
+
+	// Истек, но в пределах допуска
+	now = now.Add(time.Minute + 20*time.Second)
+	_, err = manager.VerifyAccessToken(access)
+	require.NoError(t, err)
+
+	now = now.Add(20 * time.Second)
+	_, err = manager.VerifyAccessToken(access)
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+
+	// Часы выпустившего инстанса ушли вперед больше допуска
+	ahead := token.NewJWTManager("access-secret", "refresh-secret", time.Minute, time.Hour,
+		token.WithClock(func() time.Time { return time.Now().Add(2 * time.Minute) }))
+	early, err := ahead.GenerateAccessToken(&model.UserRefresh{SessionId: "sess-1", UserID: "user-123"})
+	require.NoError(t, err)
+
+	strict := token.NewJWTManager("access-secret", "refresh-secret", time.Minute, time.Hour,
+		token.WithLeeway(30*time.Second))
+	_, err = strict.VerifyAccessToken(early)
+	assert.ErrorIs(t, err, jwt.ErrTokenNotValidYet)
+}
+
+// baselineRefreshToken / baselineAccessToken - токены в том виде, в каком их выпускал
+// сервис до typ, iss и sub: jwt.MapClaims и заголовок typ по умолчанию
+func baselineRefreshToken(t *testing.T, secret, session string, issuedAt time.Time, ttl time.Duration) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"session": session,
+		"exp":     issuedAt.Add(ttl).Unix(),
+		"iat":     issuedAt.Unix(),
+		"lat":     issuedAt.Unix(),
+	}).SignedString([]byte(secret))
+	require.NoError(t, err)
+	return signed
+}
+
+func baselineAccessToken(t *testing.T, secret, session string, version int, issuedAt time.Time, ttl time.Duration) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"session": session,
+		"role":    "user",
+		"email":   "john@gmail.com",
+		"exp":     issuedAt.Add(ttl).Unix(),
+		"ver":     version,
+		"iat":     issuedAt.Unix(),
+	}).SignedString([]byte(secret))
+	require.NoError(t, err)
+	return signed
+}
+
+func TestToken_LegacyFormat(t *testing.T) {
+	issuedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	refresh := baselineRefreshToken(t, "refresh-secret", "user-123:iphone", issuedAt, 24*time.Hour)
+	access := baselineAccessToken(t, "access-secret", "user-123:iphone", 3, time.Now().Truncate(time.Second), time.Minute)
+
+	// Без совместимости старые токены не принимаются
+	strict := token.NewJWTManager("access-secret", "refresh-secret", time.Minute, 24*time.Hour)
+	_, err := strict.VerifyRefreshToken(refresh)
+	assert.ErrorIs(t, err, token.ErrTokenType)
+	_, err = strict.VerifyAccessToken(access)
+	assert.ErrorIs(t, err, token.ErrTokenType)
+
+	manager := token.NewJWTManager("access-secret", "refresh-secret", time.Minute, 24*time.Hour,
+		token.WithLegacyTokens(true))
+
+	rc, err := manager.VerifyRefreshToken(refresh)
+	require.NoError(t, err)
+	assert.Equal(t, "user-123", rc.UserID())
+	assert.Equal(t, "user-123:iphone", rc.Session)
+	assert.Equal(t, issuedAt.Unix(), rc.LastActivity)
+	require.NotNil(t, rc.IssuedAt)
+	assert.True(t, rc.IssuedAt.Equal(issuedAt))
+
+	ac, err := manager.VerifyAccessToken(access)
+	require.NoError(t, err)
+	assert.Equal(t, "user-123", ac.UserID())
+	assert.Equal(t, "iphone", ac.DeviceID())
+	assert.Equal(t, 3, ac.Version)
+
+	// Подпись проверяется тем же секретом
+	_, err = manager.VerifyRefreshToken(baselineRefreshToken(t, "other-secret", "user-123:iphone", issuedAt, 24*time.Hour))
+	assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+	_, err = manager.VerifyRefreshToken(access)
+	assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+
+	// Не дольше refresh TTL после выпуска, даже если exp дальше
+	old := baselineRefreshToken(t, "refresh-secret", "user-123:iphone", time.Now().Add(-25*time.Hour), 30*24*time.Hour)
+	_, err = manager.VerifyRefreshToken(old)
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+
+	// Без пользователя в session токен бесполезен
+	_, err = manager.VerifyRefreshToken(baselineRefreshToken(t, "refresh-secret", "sess-1", issuedAt, 24*time.Hour))
+	assert.Error(t, err)
+
+	// Новый токен с typ JWT и iss - не старый формат, проверяется строго
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": token.DefaultIssuer, "sub": "user-123", "session": "sess-1",
+		"exp": time.Now().Add(time.Hour).Unix(), "iat": time.Now().Unix(),
+	}).SignedString([]byte("refresh-secret"))
+	require.NoError(t, err)
+	_, err = manager.VerifyRefreshToken(forged)
+	assert.ErrorIs(t, err, token.ErrTokenType)
+}
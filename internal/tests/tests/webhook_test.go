@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"auth/internal/events"
+	redisRepo "auth/internal/redis"
+	"auth/internal/webhook"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const webhookSecret = "partner-secret"
+
+func newWebhookDispatcher(t *testing.T, url string, dead webhook.DeadLetterStore) *webhook.Dispatcher {
+	t.Helper()
+
+	return webhook.NewDispatcher(webhook.Config{
+		Subscriptions: []webhook.Subscription{{
+			Name:   "partner",
+			URL:    url,
+			Secret: webhookSecret,
+			Events: []events.Type{events.UserRegistered, events.AllSessionsRevoked},
+		}},
+		MaxAttempts: 3,
+		BaseBackoff: 10 * time.Millisecond,
+		MaxBackoff:  50 * time.Millisecond,
+	}, dead, slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError})))
+}
+
+func TestWebhook_SignedDelivery(t *testing.T) {
+	_, client := newMiniRedis(t)
+	dead := webhook.NewRedisDeadLetterStore(client, 0)
+
+	received := make(chan events.Event, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		err = webhook.Verify(webhookSecret, r.Header.Get(webhook.HeaderTimestamp), body,
+			r.Header.Get(webhook.HeaderSignature), time.Minute)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		event, err := events.Unmarshal(body)
+		require.NoError(t, err)
+		assert.Equal(t, event.ID, r.Header.Get(webhook.HeaderID))
+		received <- event
+	}))
+	defer receiver.Close()
+
+	dispatcher := newWebhookDispatcher(t, receiver.URL, dead)
+
+	event := events.New(events.UserRegistered, "user-123", map[string]string{"email": "john@gmail.com"})
+	require.NoError(t, dispatcher.Publish(context.Background(), event))
+
+	select {
+	case got := <-received:
+		assert.Equal(t, event.ID, got.ID)
+	default:
+		t.Fatal("webhook was not delivered")
+	}
+
+	// Событие без подписки не отправляется
+	require.NoError(t, dispatcher.Publish(context.Background(), events.New(events.UserLoggedIn, "user-123", nil)))
+	assert.Empty(t, received)
+}
+
+func TestWebhook_RetriesThenDeadLetter(t *testing.T) {
+	_, client := newMiniRedis(t)
+	dead := webhook.NewRedisDeadLetterStore(client, 0)
+
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	dispatcher := newWebhookDispatcher(t, receiver.URL, dead)
+
+	event := events.New(events.AllSessionsRevoked, "user-123", nil)
+	require.NoError(t, dispatcher.Publish(context.Background(), event))
+
+	assert.Equal(t, int32(3), calls.Load())
+
+	letters, err := dead.List(context.Background(), "partner", 10)
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.Equal(t, event.ID, letters[0].Event.ID)
+	assert.Equal(t, 3, letters[0].Attempts)
+	assert.Contains(t, letters[0].LastError, "503")
+}
+
+func TestWebhook_VerifyRejectsTampering(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	ts := "1700000000"
+	sig := webhook.Sign(webhookSecret, ts, body)
+
+	require.NoError(t, webhook.Verify(webhookSecret, ts, body, sig, 0))
+	assert.Error(t, webhook.Verify(webhookSecret, ts, []byte(`{"id":"2"}`), sig, 0))
+	assert.Error(t, webhook.Verify("other", ts, body, sig, 0))
+	assert.Error(t, webhook.Verify(webhookSecret, ts, body, sig, time.Minute), "old timestamp must be rejected")
+}
+
+func TestWebhook_OwnConsumerGroup(t *testing.T) {
+	_, client := newMiniRedis(t)
+	repo := redisRepo.NewRepositoryRedis(client, time.Hour)
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	// Получатель отвечает, только когда его отпустят
+	release := make(chan struct{})
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		calls.Add(1)
+	}))
+	defer receiver.Close()
+	defer close(release)
+
+	broker := events.NewMemoryBroker()
+	dispatcher := newWebhookDispatcher(t, receiver.URL, webhook.NewRedisDeadLetterStore(client, 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfg := events.RelayConfig{Block: 50 * time.Millisecond, ClaimIdle: time.Minute}
+	go events.NewRelay(client, broker, cfg, log).Run(ctx)
+	cfg.Group = "webhooks:partner"
+	go events.NewRelay(client, dispatcher, cfg, log).Run(ctx)
+
+	first := events.New(events.AllSessionsRevoked, "user-123", nil)
+	second := events.New(events.AllSessionsRevoked, "user-456", nil)
+	require.NoError(t, repo.DeleteAllSessions(events.WithEvents(context.Background(), first), "user-123"))
+	require.NoError(t, repo.DeleteAllSessions(events.WithEvents(context.Background(), second), "user-456"))
+
+	// Брокер получает оба события, пока webhook висит на первом
+	require.Eventually(t, func() bool {
+		return len(broker.Published()) == 2
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Zero(t, calls.Load())
+
+	release <- struct{}{}
+	release <- struct{}{}
+	require.Eventually(t, func() bool {
+		return calls.Load() == 2
+	}, 5*time.Second, 20*time.Millisecond)
+}
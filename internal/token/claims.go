@@ -0,0 +1,56 @@
+package token
+
+import (
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Значения заголовка typ: refresh token нельзя предъявить вместо access и наоборот
+const (
+	TypeAccess  = "at+jwt"
+	TypeRefresh = "refresh+jwt"
+)
+
+// AccessClaims - содержимое access token
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	// Session - ID сессии; у старых токенов "userID:deviceID"
+	Session string `json:"session"`
+	Device  string `json:"did,omitempty"`
+	Role    string `json:"role,omitempty"`
+	Email   string `json:"email,omitempty"`
+	Version int    `json:"ver"`
+	// Scope - права через пробел, см. pkg/permissions
+	Scope string `json:"scope,omitempty"`
+	// AuthorizedParty - клиентское приложение, которому выдан токен (azp)
+	AuthorizedParty string `json:"azp,omitempty"`
+}
+
+func (c *AccessClaims) UserID() string {
+	return c.Subject
+}
+
+func (c *AccessClaims) DeviceID() string {
+	if c.Device != "" {
+		return c.Device
+	}
+	// Старые токены без did: session "userID:deviceID"
+	if device, ok := strings.CutPrefix(c.Session, c.Subject+":"); ok {
+		return device
+	}
+	return ""
+}
+
+// RefreshClaims - содержимое refresh token
+type RefreshClaims struct {
+	jwt.RegisteredClaims
+	Session string `json:"session"`
+	// LastActivity - unix время выпуска, т.е. последнего входа или refresh;
+	// по нему считается бездействие старых сессий без записи в хранилище
+	LastActivity int64 `json:"lat,omitempty"`
+}
+
+func (c *RefreshClaims) UserID() string {
+	return c.Subject
+}
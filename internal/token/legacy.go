@@ -0,0 +1,75 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TypeLegacy - typ токенов, выпущенных до access/refresh типов, iss и nbf
+const TypeLegacy = "JWT"
+
+// WithLegacyTokens - принимать токены старого формата: HS256 с тем же секретом,
+// typ "JWT", без iss, sub и nbf. Пользователь берется из session "userID:deviceID".
+// Такой токен принимается не дольше refresh TTL после выпуска, поэтому флаг можно
+// снять через refresh TTL после обновления: к этому времени старые сессии либо
+// переведены на новые токены при refresh, либо истекли.
+func WithLegacyTokens(enabled bool) Option {
+	return func(m *JWTManager) {
+		m.legacy = enabled
+	}
+}
+
+// isLegacy - токен старого формата при включенной совместимости. Подпись здесь
+// не проверяется: это делает parseLegacy с тем же секретом, что и для новых токенов.
+func (m *JWTManager) isLegacy(tokenString string) bool {
+	if !m.legacy {
+		return false
+	}
+	claims := jwt.MapClaims{}
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, claims)
+	if err != nil || token.Header["typ"] != TypeLegacy {
+		return false
+	}
+	_, hasIssuer := claims["iss"]
+	return !hasIssuer
+}
+
+// parseLegacy - подпись HS256, обязательные exp и iat; iat не старше refresh TTL
+func (m *JWTManager) parseLegacy(tokenString string, claims jwt.Claims, secret string) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["typ"] != TypeLegacy {
+			return nil, fmt.Errorf("%w: %v", ErrTokenType, token.Header["typ"])
+		}
+		return []byte(secret), nil
+	},
+		jwt.WithValidMethods([]string{"HS256"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(m.leeway),
+		jwt.WithTimeFunc(m.now),
+	)
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return errors.New("invalid token")
+	}
+
+	issuedAt, _ := claims.GetIssuedAt()
+	if issuedAt == nil || m.now().After(issuedAt.Add(m.refreshTokenTTL+m.leeway)) {
+		return fmt.Errorf("%w: legacy token is older than refresh ttl", jwt.ErrTokenExpired)
+	}
+	return nil
+}
+
+// legacySubject - у старых токенов нет sub: пользователь - часть session до ":"
+func legacySubject(session string) string {
+	userID, device, ok := strings.Cut(session, ":")
+	if !ok || device == "" {
+		return ""
+	}
+	return userID
+}
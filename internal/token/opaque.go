@@ -0,0 +1,40 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// Режимы refresh token
+const (
+	// RefreshJWT - подписанный JWT, хранится в Redis как есть
+	RefreshJWT = "jwt"
+	// RefreshOpaque - случайное значение; на сервере хранится только его SHA-256
+	RefreshOpaque = "opaque"
+)
+
+// opaquePrefix - отличает непрозрачный токен от JWT без разбора подписи
+const opaquePrefix = "rt_"
+
+// NewOpaqueRefreshToken - 256 бит из crypto/rand и SHA-256 для хранения
+func NewOpaqueRefreshToken() (refreshToken, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+	refreshToken = opaquePrefix + base64.RawURLEncoding.EncodeToString(b)
+	return refreshToken, HashRefreshToken(refreshToken), nil
+}
+
+// IsOpaqueRefreshToken - токен выпущен в режиме RefreshOpaque
+func IsOpaqueRefreshToken(refreshToken string) bool {
+	return strings.HasPrefix(refreshToken, opaquePrefix)
+}
+
+func HashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,65 @@
+package token
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// ServiceTokens - выпускает короткоживущие JWT, которыми auth service
+// представляется другим сервисам. Токен кешируется до половины TTL.
+type ServiceTokens struct {
+	secret []byte
+	issuer string
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedServiceToken
+}
+
+type cachedServiceToken struct {
+	token     string
+	refreshAt time.Time
+}
+
+func NewServiceTokens(secret, issuer string, ttl time.Duration) *ServiceTokens {
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	return &ServiceTokens{
+		secret: []byte(secret),
+		issuer: issuer,
+		ttl:    ttl,
+		cache:  make(map[string]cachedServiceToken),
+	}
+}
+
+func (s *ServiceTokens) ServiceToken(audience string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if cached, ok := s.cache[audience]; ok && now.Before(cached.refreshAt) {
+		return cached.token, nil
+	}
+
+	claims := jwt.RegisteredClaims{
+		Issuer:    s.issuer,
+		Subject:   s.issuer,
+		Audience:  jwt.ClaimStrings{audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(s.ttl)),
+		ID:        uuid.NewString(),
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		return "", err
+	}
+
+	s.cache[audience] = cachedServiceToken{token: signed, refreshAt: now.Add(s.ttl / 2)}
+	return signed, nil
+}
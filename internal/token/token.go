@@ -5,19 +5,31 @@ import (
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"slices"
+	"strings"
 	"time"
 )
 
 var (
 	ErrRefreshToken = errors.New("refresh token error")
 	ErrAccessToken  = errors.New("access token not valid")
+	// ErrTokenType - заголовок typ не соответствует ожидаемому типу токена
+	ErrTokenType = errors.New("unexpected token type")
+)
+
+// Значения iss и aud по умолчанию
+const (
+	DefaultIssuer   = "auth"
+	DefaultAudience = "api"
 )
 
 type Generate interface {
 	GenerateAccessToken(user *model.UserRefresh) (string, error)
-	GenerateRefreshToken(sessionId string) (string, error)
-	VerifyRefreshToken(tokenString string) (jwt.MapClaims, error)
-	VerifyAccessToken(tokenString string) (jwt.MapClaims, error)
+	// GenerateRefreshToken - expiresAt ограничивает exp концом сессии; нулевое - только refresh TTL
+	GenerateRefreshToken(userID, sessionID string, expiresAt time.Time) (string, error)
+	VerifyRefreshToken(tokenString string) (*RefreshClaims, error)
+	VerifyAccessToken(tokenString string) (*AccessClaims, error)
 }
 
 type JWTManager struct {
@@ -25,85 +37,239 @@ type JWTManager struct {
 	refreshSecret   string
 	accessTokenTTL  time.Duration
 	refreshTokenTTL time.Duration
+	issuer          string
+	audience        []string
+	leeway          time.Duration
+	now             func() time.Time
+	clientAudiences func(clientID string) ([]string, error)
+	legacy          bool
+}
+
+// Option - необязательные параметры JWTManager
+type Option func(*JWTManager)
+
+func WithIssuer(issuer string) Option {
+	return func(m *JWTManager) {
+		m.issuer = issuer
+	}
+}
+
+// WithAudience - aud access token; при проверке достаточно совпадения с первым значением
+func WithAudience(audience ...string) Option {
+	return func(m *JWTManager) {
+		m.audience = audience
+	}
 }
 
-func NewJWTManager(accessSecret, refreshSecret string, accessTTL, refreshTTL time.Duration) *JWTManager {
-	return &JWTManager{
+// WithClientAudiences - аудитории зарегистрированного клиента по его ID. Токен клиента
+// (azp) без аудитории сервиса принимается, только если все его aud разрешены клиенту.
+func WithClientAudiences(audiences func(clientID string) ([]string, error)) Option {
+	return func(m *JWTManager) {
+		m.clientAudiences = audiences
+	}
+}
+
+// WithLeeway - допуск расхождения часов при проверке exp, nbf и iat
+func WithLeeway(leeway time.Duration) Option {
+	return func(m *JWTManager) {
+		m.leeway = leeway
+	}
+}
+
+// WithClock - источник времени для выпуска и проверки токенов
+func WithClock(now func() time.Time) Option {
+	return func(m *JWTManager) {
+		m.now = now
+	}
+}
+
+func NewJWTManager(accessSecret, refreshSecret string, accessTTL, refreshTTL time.Duration, opts ...Option) *JWTManager {
+	m := &JWTManager{
 		accessSecret:    accessSecret,
 		refreshSecret:   refreshSecret,
 		accessTokenTTL:  accessTTL,
 		refreshTokenTTL: refreshTTL,
+		issuer:          DefaultIssuer,
+		audience:        []string{DefaultAudience},
+		now:             time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+	if len(m.audience) == 0 {
+		m.audience = []string{DefaultAudience}
+	}
+
+	return m
+}
+
+func (m *JWTManager) registered(subject string, audience []string, ttl time.Duration) jwt.RegisteredClaims {
+	now := m.now()
+	return jwt.RegisteredClaims{
+		Issuer:    m.issuer,
+		Subject:   subject,
+		Audience:  audience,
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		ID:        uuid.NewString(),
 	}
 }
 
+// GenerateAccessToken - TTL и aud клиента, если они заданы в u, иначе общие; azp - ID клиента
 func (m *JWTManager) GenerateAccessToken(u *model.UserRefresh) (string, error) {
-	claims := jwt.MapClaims{
-		"session": u.SessionId,
-		"role":    u.Role,
-		"email":   u.Email,
-		"exp":     time.Now().Add(m.accessTokenTTL).Unix(),
-		"ver":     u.Version,
-		"iat":     time.Now().Unix(),
+	audience, ttl := m.audience, m.accessTokenTTL
+	if len(u.Audience) > 0 {
+		audience = u.Audience
+	}
+	if u.AccessTTL > 0 {
+		ttl = u.AccessTTL
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(m.accessSecret))
+	claims := AccessClaims{
+		RegisteredClaims: m.registered(u.UserID, audience, ttl),
+		Session:          u.SessionId,
+		Device:           u.DeviceID,
+		Role:             u.Role,
+		Email:            u.Email,
+		Version:          u.Version,
+		Scope:            strings.Join(u.Permissions, " "),
+		AuthorizedParty:  u.ClientID,
+	}
+
+	return m.sign(&claims, TypeAccess, m.accessSecret)
 }
 
-func (m *JWTManager) GenerateRefreshToken(session string) (string, error) {
-	claims := jwt.MapClaims{
-		"session": session,
-		"exp":     time.Now().Add(m.refreshTokenTTL).Unix(),
-		"iat":     time.Now().Unix(),
-		"lat":     time.Now().Unix(),
+// GenerateRefreshToken - aud refresh token - сам auth service: другим сервисам он не предъявляется
+func (m *JWTManager) GenerateRefreshToken(userID, session string, expiresAt time.Time) (string, error) {
+	claims := RefreshClaims{
+		RegisteredClaims: m.registered(userID, []string{m.issuer}, m.refreshTokenTTL),
+		Session:          session,
+		LastActivity:     m.now().Unix(),
 	}
+	if !expiresAt.IsZero() && expiresAt.Before(claims.ExpiresAt.Time) {
+		claims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+	}
+
+	return m.sign(&claims, TypeRefresh, m.refreshSecret)
+}
 
+func (m *JWTManager) sign(claims jwt.Claims, typ, secret string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(m.refreshSecret))
+	token.Header["typ"] = typ
+	return token.SignedString([]byte(secret))
 }
 
-func (m *JWTManager) VerifyRefreshToken(session string) (jwt.MapClaims, error) {
-	if session == "" {
+func (m *JWTManager) VerifyRefreshToken(tokenString string) (*RefreshClaims, error) {
+	if tokenString == "" {
 		return nil, errors.New("token is empty")
 	}
 
-	token, err := jwt.Parse(session, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	var claims RefreshClaims
+	if m.isLegacy(tokenString) {
+		if err := m.parseLegacy(tokenString, &claims, m.refreshSecret); err != nil {
+			return nil, fmt.Errorf("token validation failed: %w", err)
 		}
-		return []byte(m.refreshSecret), nil
-	})
+		if claims.Subject = legacySubject(claims.Session); claims.Subject == "" {
+			return nil, errors.New("invalid token: missing session")
+		}
+		return &claims, nil
+	}
 
-	if err != nil {
+	if err := m.parse(tokenString, &claims, TypeRefresh, m.refreshSecret, m.issuer); err != nil {
 		return nil, fmt.Errorf("token validation failed: %w", err)
 	}
-
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
+	if claims.Session == "" {
+		return nil, errors.New("invalid token: missing session")
 	}
 
-	return nil, errors.New("invalid token")
+	return &claims, nil
 }
 
-func (m *JWTManager) VerifyAccessToken(tokenString string) (jwt.MapClaims, error) {
+func (m *JWTManager) VerifyAccessToken(tokenString string) (*AccessClaims, error) {
 	if tokenString == "" {
 		return nil, ErrAccessToken
 	}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	// aud токена клиента - его API, а не аудитория сервиса: такой aud сверяется
+	// с аудиториями, зарегистрированными для клиента из azp
+	var claims AccessClaims
+	if m.isLegacy(tokenString) {
+		// aud в старых токенах не было
+		if err := m.parseLegacy(tokenString, &claims, m.accessSecret); err != nil {
+			return nil, fmt.Errorf("access token validation failed: %w", err)
 		}
-		return []byte(m.accessSecret), nil
-	})
+		if claims.Subject = legacySubject(claims.Session); claims.Subject == "" {
+			return nil, errors.New("invalid access token: missing session")
+		}
+		return &claims, nil
+	}
 
-	if err != nil {
+	if err := m.parse(tokenString, &claims, TypeAccess, m.accessSecret, ""); err != nil {
 		return nil, fmt.Errorf("access token validation failed: %w", err)
 	}
+	if !slices.Contains(claims.Audience, m.audience[0]) && !m.clientAudience(&claims) {
+		return nil, fmt.Errorf("access token validation failed: %w", jwt.ErrTokenInvalidAudience)
+	}
+	if claims.Session == "" {
+		return nil, errors.New("invalid access token: missing session")
+	}
+
+	return &claims, nil
+}
+
+// clientAudience - aud токена целиком из аудиторий клиента azp
+func (m *JWTManager) clientAudience(claims *AccessClaims) bool {
+	if claims.AuthorizedParty == "" || len(claims.Audience) == 0 || m.clientAudiences == nil {
+		return false
+	}
+	allowed, err := m.clientAudiences(claims.AuthorizedParty)
+	if err != nil {
+		return false
+	}
+	for _, aud := range claims.Audience {
+		if !slices.Contains(allowed, aud) {
+			return false
+		}
+	}
+	return true
+}
+
+// parse - подпись HMAC, typ, iss, aud и обязательные exp / nbf / iat с допуском leeway.
+// Пустой audience - aud проверяет вызывающий.
+func (m *JWTManager) parse(tokenString string, claims jwt.Claims, typ, secret, audience string) error {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256"}),
+		jwt.WithIssuer(m.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(m.leeway),
+		jwt.WithTimeFunc(m.now),
+	}
+	if audience != "" {
+		opts = append(opts, jwt.WithAudience(audience))
+	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		if token.Header["typ"] != typ {
+			return nil, fmt.Errorf("%w: %v", ErrTokenType, token.Header["typ"])
+		}
+		return []byte(secret), nil
+	}, opts...)
+	if err != nil {
+		return err
 	}
 
-	return nil, errors.New("invalid access token")
+	// jwt проверяет nbf, только если он есть; у наших токенов он обязателен
+	if nbf, _ := claims.GetNotBefore(); nbf == nil {
+		return fmt.Errorf("%w: missing nbf", jwt.ErrTokenNotValidYet)
+	}
+	if !token.Valid {
+		return errors.New("invalid token")
+	}
+	return nil
 }
@@ -0,0 +1,78 @@
+package webhook
+
+import (
+	"auth/internal/events"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type DeadLetter struct {
+	Subscription string       `json:"subscription"`
+	Event        events.Event `json:"event"`
+	Attempts     int          `json:"attempts"`
+	LastError    string       `json:"last_error"`
+	FailedAt     time.Time    `json:"failed_at"`
+}
+
+type DeadLetterStore interface {
+	Push(ctx context.Context, letter DeadLetter) error
+	List(ctx context.Context, subscription string, limit int64) ([]DeadLetter, error)
+}
+
+// Client - команды Redis, которые нужны dead-letter хранилищу
+type Client interface {
+	LPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+	LTrim(ctx context.Context, key string, start, stop int64) *redis.StatusCmd
+	LRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd
+}
+
+type redisDeadLetterStore struct {
+	client Client
+	max    int64
+}
+
+// NewRedisDeadLetterStore - список webhook:dead:<subscription>, новые записи в начале
+func NewRedisDeadLetterStore(client Client, max int64) DeadLetterStore {
+	if max <= 0 {
+		max = 10000
+	}
+	return &redisDeadLetterStore{client: client, max: max}
+}
+
+func deadLetterKey(subscription string) string {
+	return fmt.Sprintf("webhook:dead:%s", subscription)
+}
+
+func (s *redisDeadLetterStore) Push(ctx context.Context, letter DeadLetter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return fmt.Errorf("marshal dead letter: %w", err)
+	}
+
+	key := deadLetterKey(letter.Subscription)
+	if err := s.client.LPush(ctx, key, data).Err(); err != nil {
+		return err
+	}
+	return s.client.LTrim(ctx, key, 0, s.max-1).Err()
+}
+
+func (s *redisDeadLetterStore) List(ctx context.Context, subscription string, limit int64) ([]DeadLetter, error) {
+	raw, err := s.client.LRange(ctx, deadLetterKey(subscription), 0, limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	letters := make([]DeadLetter, 0, len(raw))
+	for _, item := range raw {
+		var letter DeadLetter
+		if err := json.Unmarshal([]byte(item), &letter); err != nil {
+			return nil, fmt.Errorf("unmarshal dead letter: %w", err)
+		}
+		letters = append(letters, letter)
+	}
+	return letters, nil
+}
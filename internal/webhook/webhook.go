@@ -0,0 +1,232 @@
+package webhook
+
+import (
+	"auth/internal/events"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+
+	signaturePrefix = "sha256="
+)
+
+type Subscription struct {
+	Name   string
+	URL    string
+	Secret string
+	// Пустой список - все события
+	Events []events.Type
+}
+
+func (s Subscription) matches(typ events.Type) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, t := range s.Events {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+type Config struct {
+	Subscriptions []Subscription
+	MaxAttempts   int
+	BaseBackoff   time.Duration
+	MaxBackoff    time.Duration
+	Timeout       time.Duration
+}
+
+// Dispatcher - доставляет события подписчикам по HTTP.
+// Реализует events.Broker, но работает через отдельный relay со своей
+// consumer group: повторы доставки не задерживают брокер и не зависят от него.
+type Dispatcher struct {
+	cfg    Config
+	client *http.Client
+	dead   DeadLetterStore
+	log    *slog.Logger
+	now    func() time.Time
+}
+
+func NewDispatcher(cfg Config, dead DeadLetterStore, log *slog.Logger) *Dispatcher {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Minute
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	return &Dispatcher{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		dead:   dead,
+		log:    log,
+		now:    time.Now,
+	}
+}
+
+// Publish - доставляет событие всем подходящим подписчикам. Подписчик, не
+// принявший событие за MaxAttempts попыток, попадает в dead-letter. Ошибка
+// возвращается только если не удалось сохранить dead-letter - тогда relay
+// повторит событие целиком.
+func (d *Dispatcher) Publish(ctx context.Context, event events.Event) error {
+	body, err := events.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		lastErr error
+	)
+
+	for _, sub := range d.cfg.Subscriptions {
+		if !sub.matches(event.Type) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(sub Subscription) {
+			defer wg.Done()
+
+			attempts, err := d.deliverWithRetry(ctx, sub, event, body)
+			if err == nil {
+				return
+			}
+
+			d.log.Warn("webhook delivery failed, moving to dead-letter",
+				slog.String("subscription", sub.Name),
+				slog.String("event_id", event.ID),
+				slog.Int("attempts", attempts),
+				slog.String("error", err.Error()))
+
+			dlErr := d.dead.Push(ctx, DeadLetter{
+				Subscription: sub.Name,
+				Event:        event,
+				Attempts:     attempts,
+				LastError:    err.Error(),
+				FailedAt:     d.now().UTC(),
+			})
+			if dlErr != nil {
+				mu.Lock()
+				lastErr = fmt.Errorf("store dead letter for %s: %w", sub.Name, dlErr)
+				mu.Unlock()
+			}
+		}(sub)
+	}
+
+	wg.Wait()
+	return lastErr
+}
+
+func (d *Dispatcher) Close() error {
+	d.client.CloseIdleConnections()
+	return nil
+}
+
+func (d *Dispatcher) deliverWithRetry(ctx context.Context, sub Subscription, event events.Event, body []byte) (int, error) {
+	var err error
+	for attempt := 1; attempt <= d.cfg.MaxAttempts; attempt++ {
+		if err = d.deliver(ctx, sub, event, body); err == nil {
+			return attempt, nil
+		}
+		if attempt == d.cfg.MaxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		case <-time.After(d.backoff(attempt)):
+		}
+	}
+	return d.cfg.MaxAttempts, err
+}
+
+// backoff - BaseBackoff * 2^(attempt-1), но не больше MaxBackoff
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.cfg.BaseBackoff << (attempt - 1)
+	if delay <= 0 || delay > d.cfg.MaxBackoff {
+		return d.cfg.MaxBackoff
+	}
+	return delay
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, sub Subscription, event events.Event, body []byte) error {
+	timestamp := strconv.FormatInt(d.now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, event.ID)
+	req.Header.Set(HeaderEvent, string(event.Type))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("receiver returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign - подпись "sha256=<hex>" от HMAC-SHA256(secret, timestamp + "." + body)
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify - проверка подписи на стороне получателя. tolerance ограничивает
+// возраст timestamp для защиты от повторной отправки перехваченного запроса.
+func Verify(secret, timestamp string, body []byte, signature string, tolerance time.Duration) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %w", err)
+	}
+
+	if tolerance > 0 {
+		age := time.Since(time.Unix(ts, 0))
+		if age > tolerance || age < -tolerance {
+			return fmt.Errorf("timestamp outside tolerance")
+		}
+	}
+
+	if !hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Package authclienttest - выпуск access token в формате auth service для тестов
+// сервисов, которые проверяют их через authclient.
+package authclienttest
+
+import (
+	"auth/pkg/authclient"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Token - содержимое выпускаемого токена; пустые поля получают значения по умолчанию
+type Token struct {
+	UserID string
+	// SessionID - по умолчанию случайный
+	SessionID   string
+	DeviceID    string
+	Email       string
+	Role        string
+	Version     int
+	Permissions []string
+	// ExpiresAt - по умолчанию сейчас + Minter.TTL; прошедшее время дает истекший токен
+	ExpiresAt time.Time
+	// Extra - дополнительные или переопределенные claims
+	Extra map[string]any
+}
+
+// Minter - подписывает токены HMAC секретом или RSA ключом с kid
+type Minter struct {
+	Issuer   string
+	Audience string
+	TTL      time.Duration
+
+	secret []byte
+	key    *rsa.PrivateKey
+	kid    string
+}
+
+// NewHMAC - токены HS256, как у auth service с TOKEN_ACCESS_SECRET
+func NewHMAC(secret string) *Minter {
+	return &Minter{TTL: 15 * time.Minute, secret: []byte(secret)}
+}
+
+// NewRSA - токены RS256 на новом ключе; ключ публикуется через JWKS
+func NewRSA(tb testing.TB) *Minter {
+	tb.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		tb.Fatalf("authclienttest: generate key: %v", err)
+	}
+	return &Minter{TTL: 15 * time.Minute, key: key, kid: uuid.NewString()}
+}
+
+// Config - настройки authclient, принимающие токены этого Minter
+func (m *Minter) Config() authclient.Config {
+	cfg := authclient.Config{Issuer: m.Issuer, Audience: m.Audience}
+	if m.key != nil {
+		cfg.Keys = map[string]crypto.PublicKey{m.kid: &m.key.PublicKey}
+	} else {
+		cfg.Secret = m.secret
+	}
+	return cfg
+}
+
+// Verifier - authclient.Verifier для токенов этого Minter
+func (m *Minter) Verifier(tb testing.TB) *authclient.Verifier {
+	tb.Helper()
+
+	v, err := authclient.New(m.Config())
+	if err != nil {
+		tb.Fatalf("authclienttest: %v", err)
+	}
+	return v
+}
+
+func (m *Minter) Mint(tb testing.TB, t Token) string {
+	tb.Helper()
+
+	if t.UserID == "" {
+		t.UserID = "user-" + uuid.NewString()[:8]
+	}
+	if t.DeviceID == "" {
+		t.DeviceID = "test-device"
+	}
+	if t.Version == 0 {
+		t.Version = 1
+	}
+	now := time.Now()
+	if t.ExpiresAt.IsZero() {
+		t.ExpiresAt = now.Add(m.TTL)
+	}
+
+	if t.SessionID == "" {
+		t.SessionID = uuid.NewString()
+	}
+
+	claims := jwt.MapClaims{
+		"sub":     t.UserID,
+		"session": t.SessionID,
+		"did":     t.DeviceID,
+		"role":    t.Role,
+		"email":   t.Email,
+		"ver":     t.Version,
+		"iat":     now.Unix(),
+		"exp":     t.ExpiresAt.Unix(),
+	}
+	if len(t.Permissions) > 0 {
+		claims["scope"] = strings.Join(t.Permissions, " ")
+	}
+	if m.Issuer != "" {
+		claims["iss"] = m.Issuer
+	}
+	if m.Audience != "" {
+		claims["aud"] = m.Audience
+	}
+	for k, v := range t.Extra {
+		claims[k] = v
+	}
+
+	var (
+		signed string
+		err    error
+	)
+	if m.key != nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = m.kid
+		token.Header["typ"] = authclient.TokenType
+		signed, err = token.SignedString(m.key)
+	} else {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		token.Header["typ"] = authclient.TokenType
+		signed, err = token.SignedString(m.secret)
+	}
+	if err != nil {
+		tb.Fatalf("authclienttest: sign token: %v", err)
+	}
+	return signed
+}
+
+// JWKS - обработчик с публичным ключом для authclient.Config.JWKSURL
+func (m *Minter) JWKS() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var keys []authclient.JWK
+		if m.key != nil {
+			jwk, _ := authclient.NewJWK(m.kid, &m.key.PublicKey)
+			jwk.Alg = "RS256"
+			keys = append(keys, jwk)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	})
+}
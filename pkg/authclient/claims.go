@@ -0,0 +1,87 @@
+package authclient
+
+import (
+	"auth/pkg/permissions"
+	"context"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims - проверенный access token auth service
+type Claims struct {
+	UserID      string
+	SessionID   string
+	DeviceID    string
+	Email       string
+	Role        string
+	Version     int
+	Permissions permissions.Set
+
+	Issuer    string
+	Audience  []string
+	ID        string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+
+	// Raw - все claims как есть
+	Raw map[string]any
+}
+
+// Can - есть ли у субъекта право с учетом wildcard
+func (c *Claims) Can(permission string) bool {
+	return c.Permissions.Has(permission)
+}
+
+func claimsFromMap(m jwt.MapClaims) *Claims {
+	c := &Claims{
+		Raw:         m,
+		Permissions: permissions.FromClaims(m),
+	}
+
+	c.SessionID, _ = m["session"].(string)
+	c.Email, _ = m["email"].(string)
+	c.Role, _ = m["role"].(string)
+	c.ID, _ = m["jti"].(string)
+	c.Issuer, _ = m.GetIssuer()
+	c.Audience, _ = m.GetAudience()
+	if ver, ok := m["ver"].(float64); ok {
+		c.Version = int(ver)
+	}
+	if iat, _ := m.GetIssuedAt(); iat != nil {
+		c.IssuedAt = iat.Time
+	}
+	if exp, _ := m.GetExpirationTime(); exp != nil {
+		c.ExpiresAt = exp.Time
+	}
+
+	c.UserID, _ = m.GetSubject()
+	c.DeviceID, _ = m["did"].(string)
+
+	// У старых токенов нет did, а session - "userID:deviceID"
+	if c.DeviceID == "" && strings.Contains(c.SessionID, ":") {
+		if c.UserID == "" {
+			c.UserID, _, _ = strings.Cut(c.SessionID, ":")
+		}
+		if device, ok := strings.CutPrefix(c.SessionID, c.UserID+":"); ok {
+			c.DeviceID = device
+		}
+	}
+
+	return c
+}
+
+type claimsKey struct{}
+
+// NewContext - claims для обработчика; права доступны и через permissions.Require
+func NewContext(ctx context.Context, c *Claims) context.Context {
+	ctx = permissions.NewContext(ctx, c.Raw, c.Permissions)
+	return context.WithValue(ctx, claimsKey{}, c)
+}
+
+// FromContext - claims, положенные интерцептором или middleware
+func FromContext(ctx context.Context) (*Claims, bool) {
+	c, ok := ctx.Value(claimsKey{}).(*Claims)
+	return c, ok
+}
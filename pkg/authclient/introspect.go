@@ -0,0 +1,118 @@
+package authclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// introspector - RFC 7662: POST token=..., ответ {"active": bool}.
+// Ответы кешируются по хешу токена, но не дольше срока его жизни.
+type introspector struct {
+	url          string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+	ttl          time.Duration
+
+	mu    sync.Mutex
+	cache map[[32]byte]introspection
+}
+
+type introspection struct {
+	active    bool
+	expiresAt time.Time
+}
+
+// maxCachedTokens - при переполнении кеш чистится от истекших записей, а если их нет - целиком
+const maxCachedTokens = 10000
+
+func newIntrospector(cfg Config) *introspector {
+	return &introspector{
+		url:          cfg.IntrospectionURL,
+		clientID:     cfg.ClientID,
+		clientSecret: cfg.ClientSecret,
+		client:       cfg.HTTPClient,
+		ttl:          cfg.IntrospectionCacheTTL,
+		cache:        make(map[[32]byte]introspection),
+	}
+}
+
+func (i *introspector) active(ctx context.Context, token string, tokenExpiry time.Time) (bool, error) {
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	i.mu.Lock()
+	cached, ok := i.cache[key]
+	i.mu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.active, nil
+	}
+
+	active, err := i.call(ctx, token)
+	if err != nil {
+		return false, err
+	}
+
+	expiresAt := now.Add(i.ttl)
+	if !tokenExpiry.IsZero() && tokenExpiry.Before(expiresAt) {
+		expiresAt = tokenExpiry
+	}
+
+	i.mu.Lock()
+	if len(i.cache) >= maxCachedTokens {
+		i.evict(now)
+	}
+	i.cache[key] = introspection{active: active, expiresAt: expiresAt}
+	i.mu.Unlock()
+
+	return active, nil
+}
+
+func (i *introspector) evict(now time.Time) {
+	for k, v := range i.cache {
+		if now.After(v.expiresAt) {
+			delete(i.cache, k)
+		}
+	}
+	if len(i.cache) >= maxCachedTokens {
+		clear(i.cache)
+	}
+}
+
+func (i *introspector) call(ctx context.Context, token string) (bool, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrIntrospection, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(i.clientID), url.QueryEscape(i.clientSecret))
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrIntrospection, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%w: status %d", ErrIntrospection, resp.StatusCode)
+	}
+
+	var out struct {
+		Active bool `json:"active"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return false, fmt.Errorf("%w: %w", ErrIntrospection, err)
+	}
+	return out.Active, nil
+}
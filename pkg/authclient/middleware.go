@@ -0,0 +1,120 @@
+package authclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor - проверяет "authorization: Bearer <token>" и кладет Claims в контекст.
+// public - полные имена методов, которым токен не нужен (health, reflection).
+func (v *Verifier) UnaryServerInterceptor(public ...string) grpc.UnaryServerInterceptor {
+	skip := methodSet(public)
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if skip[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		ctx, err := v.authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (v *Verifier) StreamServerInterceptor(public ...string) grpc.StreamServerInterceptor {
+	skip := methodSet(public)
+
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if skip[info.FullMethod] {
+			return handler(srv, ss)
+		}
+		ctx, err := v.authenticate(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &claimsStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (v *Verifier) authenticate(ctx context.Context) (context.Context, error) {
+	var header string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			header = values[0]
+		}
+	}
+
+	claims, err := v.Verify(ctx, bearer(header))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return NewContext(ctx, claims), nil
+}
+
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrMissingToken):
+		return status.Error(codes.Unauthenticated, "missing access token")
+	case errors.Is(err, ErrRevoked):
+		return status.Error(codes.Unauthenticated, "access token revoked")
+	case errors.Is(err, ErrIntrospection):
+		return status.Error(codes.Unavailable, "token introspection unavailable")
+	}
+	return status.Error(codes.Unauthenticated, "invalid access token")
+}
+
+type claimsStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *claimsStream) Context() context.Context {
+	return s.ctx
+}
+
+// Middleware - то же для net/http; на ошибку отвечает 401 (503, если недоступен introspection)
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := v.Verify(r.Context(), bearer(r.Header.Get("Authorization")))
+		if err != nil {
+			if errors.Is(err, ErrIntrospection) {
+				http.Error(w, "token introspection unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			// RFC 6750
+			if errors.Is(err, ErrMissingToken) {
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+			} else {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+	})
+}
+
+func bearer(header string) string {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+func methodSet(methods []string) map[string]bool {
+	set := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		set[m] = true
+	}
+	return set
+}
@@ -0,0 +1,199 @@
+// Package authclient - проверка access token auth service в других сервисах:
+// офлайн по ключам (HMAC секрет, публичные ключи, удаленный JWKS),
+// при необходимости - отзыв через introspection endpoint.
+package authclient
+
+import (
+	"auth/pkg/permissions"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrMissingToken = errors.New("authclient: missing access token")
+	ErrInvalidToken = errors.New("authclient: invalid access token")
+	ErrRevoked      = errors.New("authclient: access token revoked")
+	ErrKeyNotFound  = errors.New("authclient: signing key not found")
+	// ErrIntrospection - introspection endpoint недоступен, отзыв не проверен
+	ErrIntrospection = errors.New("authclient: introspection failed")
+)
+
+// TokenType - заголовок typ access token auth service (RFC 9068).
+// Токены без typ или с "JWT" принимаются для совместимости, любой другой typ - нет:
+// так refresh token не пройдет проверку даже при общем секрете.
+const TokenType = "at+jwt"
+
+type Config struct {
+	// Secret - общий HMAC ключ (HS256/384/512), как TOKEN_ACCESS_SECRET у auth service
+	Secret []byte
+	// Keys - публичные ключи (RSA, ECDSA, Ed25519) по kid
+	Keys map[string]crypto.PublicKey
+	// JWKSURL - удаленный набор ключей; неизвестный kid вызывает внеочередное обновление
+	JWKSURL     string
+	JWKSRefresh time.Duration
+
+	// Issuer / Audience - проверяются, если заданы
+	Issuer   string
+	Audience string
+	// Leeway - допуск расхождения часов для exp / nbf / iat
+	Leeway time.Duration
+
+	// IntrospectionURL - RFC 7662 endpoint для проверки отзыва; пустой - только офлайн
+	IntrospectionURL string
+	ClientID         string
+	ClientSecret     string
+	// IntrospectionCacheTTL - сколько помнить ответ по токену
+	IntrospectionCacheTTL time.Duration
+	// IntrospectionFailOpen - принимать токен, если endpoint недоступен
+	IntrospectionFailOpen bool
+
+	HTTPClient *http.Client
+}
+
+// Verifier - проверка access token; безопасен для конкурентного использования
+type Verifier struct {
+	cfg        Config
+	jwks       *keySet
+	introspect *introspector
+	methods    []string
+}
+
+func New(cfg Config) (*Verifier, error) {
+	if len(cfg.Secret) == 0 && len(cfg.Keys) == 0 && cfg.JWKSURL == "" {
+		return nil, errors.New("authclient: no verification keys configured")
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	if cfg.JWKSRefresh <= 0 {
+		cfg.JWKSRefresh = 10 * time.Minute
+	}
+	if cfg.IntrospectionCacheTTL <= 0 {
+		cfg.IntrospectionCacheTTL = 30 * time.Second
+	}
+
+	v := &Verifier{cfg: cfg}
+
+	// Алгоритмы только под настроенные ключи: HMAC секрет не должен
+	// принимать токен, подписанный "публичным ключом" как секретом
+	if len(cfg.Secret) > 0 {
+		v.methods = append(v.methods, "HS256", "HS384", "HS512")
+	}
+	if len(cfg.Keys) > 0 || cfg.JWKSURL != "" {
+		v.methods = append(v.methods, "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA")
+	}
+
+	if cfg.JWKSURL != "" {
+		v.jwks = newKeySet(cfg.JWKSURL, cfg.HTTPClient, cfg.JWKSRefresh)
+	}
+	if cfg.IntrospectionURL != "" {
+		v.introspect = newIntrospector(cfg)
+	}
+
+	return v, nil
+}
+
+// Verify - подпись, срок, iss / aud и, если настроено, отзыв
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(v.methods),
+		jwt.WithLeeway(v.cfg.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if v.cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.cfg.Issuer))
+	}
+	if v.cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(v.cfg.Audience))
+	}
+
+	var claims jwt.MapClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		return v.key(ctx, t)
+	}, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	c := claimsFromMap(claims)
+
+	if v.introspect != nil {
+		active, err := v.introspect.active(ctx, token, c.ExpiresAt)
+		switch {
+		case err != nil && !v.cfg.IntrospectionFailOpen:
+			return nil, err
+		case err == nil && !active:
+			return nil, ErrRevoked
+		}
+	}
+
+	return c, nil
+}
+
+// PermissionsVerifier - адаптер для permissions.NewInterceptor
+func (v *Verifier) PermissionsVerifier() permissions.Verifier {
+	return permissions.VerifierFunc(func(ctx context.Context, token string) (map[string]any, error) {
+		c, err := v.Verify(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		return c.Raw, nil
+	})
+}
+
+func (v *Verifier) key(ctx context.Context, t *jwt.Token) (any, error) {
+	switch typ := t.Header["typ"]; typ {
+	case nil, TokenType, "JWT":
+	default:
+		return nil, fmt.Errorf("unexpected token type %v", typ)
+	}
+
+	if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+		return v.cfg.Secret, nil
+	}
+
+	kid, _ := t.Header["kid"].(string)
+	if key, ok := v.cfg.Keys[kid]; ok {
+		return checkKeyType(t.Method, key)
+	}
+	if v.jwks != nil {
+		key, err := v.jwks.get(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		return checkKeyType(t.Method, key)
+	}
+
+	return nil, ErrKeyNotFound
+}
+
+// checkKeyType - ключ должен подходить к alg токена
+func checkKeyType(method jwt.SigningMethod, key crypto.PublicKey) (any, error) {
+	var ok bool
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok = key.(*rsa.PublicKey)
+	case *jwt.SigningMethodECDSA:
+		_, ok = key.(*ecdsa.PublicKey)
+	case *jwt.SigningMethodEd25519:
+		_, ok = key.(ed25519.PublicKey)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: key type does not match %s", ErrKeyNotFound, method.Alg())
+	}
+	return key, nil
+}
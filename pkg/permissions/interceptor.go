@@ -0,0 +1,189 @@
+package permissions
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Verifier - проверка подписи и срока access token; возвращает claims
+type Verifier interface {
+	Verify(ctx context.Context, token string) (map[string]any, error)
+}
+
+// VerifierFunc - функция как Verifier
+type VerifierFunc func(ctx context.Context, token string) (map[string]any, error)
+
+func (f VerifierFunc) Verify(ctx context.Context, token string) (map[string]any, error) {
+	return f(ctx, token)
+}
+
+// Rules - полное имя метода ("/pkg.Service/Method") или сервиса ("/pkg.Service/*")
+// и права, которые нужны все сразу. Пустой список - достаточно валидного токена.
+type Rules map[string][]string
+
+type Option func(*Interceptor)
+
+// WithPublic - методы, доступные без токена
+func WithPublic(methods ...string) Option {
+	return func(i *Interceptor) {
+		for _, m := range methods {
+			i.public[m] = true
+		}
+	}
+}
+
+// WithAllowUnlisted - методы вне Rules и WithPublic пропускаются без проверки токена.
+// По умолчанию они запрещены: забытое правило не должно открывать метод.
+func WithAllowUnlisted() Option {
+	return func(i *Interceptor) {
+		i.allowUnlisted = true
+	}
+}
+
+// Interceptor - декларативная проверка прав на gRPC методах
+type Interceptor struct {
+	verifier      Verifier
+	rules         Rules
+	public        map[string]bool
+	allowUnlisted bool
+}
+
+func NewInterceptor(verifier Verifier, rules Rules, opts ...Option) *Interceptor {
+	i := &Interceptor{
+		verifier: verifier,
+		rules:    rules,
+		public:   make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+func (i *Interceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := i.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (i *Interceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := i.authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func (i *Interceptor) authorize(ctx context.Context, method string) (context.Context, error) {
+	if i.public[method] || i.public[serviceWildcard(method)] {
+		return ctx, nil
+	}
+
+	required, listed := i.rules[method]
+	if !listed {
+		required, listed = i.rules[serviceWildcard(method)]
+	}
+	if !listed && i.allowUnlisted {
+		return ctx, nil
+	}
+
+	token := bearerToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing access token")
+	}
+	claims, err := i.verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid access token")
+	}
+
+	if !listed {
+		return nil, status.Error(codes.PermissionDenied, "method is not allowed")
+	}
+
+	granted := FromClaims(claims)
+	if missing := granted.Missing(required...); len(missing) > 0 {
+		return nil, status.Errorf(codes.PermissionDenied, "missing permissions: %s", strings.Join(missing, ", "))
+	}
+
+	return NewContext(ctx, claims, granted), nil
+}
+
+func serviceWildcard(method string) string {
+	if i := strings.LastIndexByte(method, '/'); i > 0 {
+		return method[:i+1] + "*"
+	}
+	return method
+}
+
+func bearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ""
+	}
+
+	scheme, token, ok := strings.Cut(values[0], " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+type contextKey struct{}
+
+type subject struct {
+	claims map[string]any
+	perms  Set
+}
+
+// NewContext - claims и права проверенного токена для обработчика
+func NewContext(ctx context.Context, claims map[string]any, perms Set) context.Context {
+	return context.WithValue(ctx, contextKey{}, subject{claims: claims, perms: perms})
+}
+
+// FromContext - права, положенные интерцептором
+func FromContext(ctx context.Context) (Set, bool) {
+	s, ok := ctx.Value(contextKey{}).(subject)
+	return s.perms, ok
+}
+
+// ClaimsFromContext - claims проверенного токена
+func ClaimsFromContext(ctx context.Context) (map[string]any, bool) {
+	s, ok := ctx.Value(contextKey{}).(subject)
+	return s.claims, ok
+}
+
+// Require - проверка прав внутри обработчика, например зависящих от ресурса
+func Require(ctx context.Context, permissions ...string) error {
+	perms, ok := FromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing access token")
+	}
+	if missing := perms.Missing(permissions...); len(missing) > 0 {
+		return status.Errorf(codes.PermissionDenied, "missing permissions: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// Package permissions - проверка прав из access token auth service.
+// Права - строки вида "ресурс:действие"; "*" и "ресурс:*" покрывают все действия.
+package permissions
+
+import (
+	"sort"
+	"strings"
+)
+
+// Claim - имя claim с правами: строка через пробел, как OAuth scope
+const Claim = "scope"
+
+// Set - набор прав субъекта
+type Set map[string]struct{}
+
+func NewSet(permissions ...string) Set {
+	s := make(Set, len(permissions))
+	for _, p := range permissions {
+		if p = strings.TrimSpace(p); p != "" {
+			s[p] = struct{}{}
+		}
+	}
+	return s
+}
+
+// Parse - разбор значения claim scope
+func Parse(scope string) Set {
+	return NewSet(strings.Fields(scope)...)
+}
+
+// FromClaims - права из claims токена: scope (строка) или permissions (массив)
+func FromClaims(claims map[string]any) Set {
+	switch v := claims[Claim].(type) {
+	case string:
+		return Parse(v)
+	case []string:
+		return NewSet(v...)
+	}
+
+	if list, ok := claims["permissions"].([]any); ok {
+		s := make(Set, len(list))
+		for _, item := range list {
+			if p, ok := item.(string); ok && p != "" {
+				s[p] = struct{}{}
+			}
+		}
+		return s
+	}
+
+	return Set{}
+}
+
+// Has - есть ли право с учетом "*" и "ресурс:*"
+func (s Set) Has(permission string) bool {
+	if _, ok := s[permission]; ok {
+		return true
+	}
+	if _, ok := s["*"]; ok {
+		return true
+	}
+
+	// tasks:comments:write покрывается tasks:comments:* и tasks:*
+	for i := strings.LastIndexByte(permission, ':'); i > 0; i = strings.LastIndexByte(permission[:i], ':') {
+		if _, ok := s[permission[:i]+":*"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAll - есть все перечисленные права
+func (s Set) HasAll(permissions ...string) bool {
+	for _, p := range permissions {
+		if !s.Has(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// Missing - права из списка, которых нет в наборе
+func (s Set) Missing(permissions ...string) []string {
+	var missing []string
+	for _, p := range permissions {
+		if !s.Has(p) {
+			missing = append(missing, p)
+		}
+	}
+	return missing
+}
+
+// List - права по алфавиту
+func (s Set) List() []string {
+	list := make([]string, 0, len(s))
+	for p := range s {
+		list = append(list, p)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// String - значение для claim scope
+func (s Set) String() string {
+	return strings.Join(s.List(), " ")
+}